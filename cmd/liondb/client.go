@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+const maxBulkLineSize = 16 * 1024 * 1024
+
+func runBulk(args []string) error {
+	flags := flag.NewFlagSet("bulk", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:7123", "address of the server to load records into")
+	entity := flags.String("entity", "", "entity the records are inserted into")
+	file := flags.String("file", "-", "file with one record per line, as text or JSON; - reads stdin")
+	flags.Parse(args)
+	if *entity == "" {
+		return errors.New("bulk: -entity is required")
+	}
+	return loadRecords("bulk", *addr, "BULK "+*entity, *file)
+}
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:7123", "address of the server to import records into")
+	entity := flags.String("entity", "", "entity the records are imported into")
+	format := flags.String("format", "jsonl", "format of the file: jsonl or csv")
+	conflict := flags.String("conflict", "fail", "what to do with records whose id already exists: fail, skip or replace")
+	file := flags.String("file", "-", "file to import; - reads stdin")
+	flags.Parse(args)
+	if *entity == "" {
+		return errors.New("import: -entity is required")
+	}
+	command := fmt.Sprintf("IMPORT %s %s ON CONFLICT %s", *entity, strings.ToUpper(*format), strings.ToUpper(*conflict))
+	return loadRecords("import", *addr, command, *file)
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:7123", "address of the server to export records from")
+	entity := flags.String("entity", "", "entity whose records are exported")
+	format := flags.String("format", "jsonl", "format of the file: jsonl or csv")
+	file := flags.String("file", "-", "file to write; - writes stdout")
+	flags.Parse(args)
+	if *entity == "" {
+		return errors.New("export: -entity is required")
+	}
+
+	output := io.Writer(os.Stdout)
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return fmt.Errorf("export: %w", err)
+		}
+		defer f.Close()
+		output = f
+	}
+
+	conn, err := net.Dial("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	defer conn.Close()
+	if err := exportRecords(conn, fmt.Sprintf("EXPORT %s %s", *entity, strings.ToUpper(*format)), output); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
+
+// exportRecords copies the lines the server streams back for an EXPORT
+// command to output until the connection closes. Records never start with
+// "ERR ", so such a line means the export failed part way through.
+func exportRecords(conn net.Conn, command string, output io.Writer) error {
+	if _, err := fmt.Fprintf(conn, "%s\n", command); err != nil {
+		return err
+	}
+	closeWrite(conn)
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(output)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if bytes.HasPrefix(line, []byte("ERR ")) {
+			return errors.New(strings.TrimSpace(string(line)))
+		}
+		writer.Write(line)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func loadRecords(name string, addr string, command string, file string) error {
+	input := io.Reader(os.Stdin)
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		defer f.Close()
+		input = f
+	}
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	defer conn.Close()
+	if err := streamRecords(conn, command, input, os.Stdout); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func streamRecords(conn net.Conn, command string, input io.Reader, output io.Writer) error {
+	reader := bufio.NewReader(conn)
+	if _, err := fmt.Fprintf(conn, "%s\n", command); err != nil {
+		return err
+	}
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(response, "ERR ") {
+		return errors.New(strings.TrimSpace(response))
+	}
+
+	writer := bufio.NewWriter(conn)
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxBulkLineSize)
+	for scanner.Scan() {
+		writer.Write(scanner.Bytes())
+		writer.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	writer.WriteString("END\n")
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	closeWrite(conn)
+
+	report, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	output.Write(report)
+	if !strings.Contains(strings.SplitN(string(report), "\n", 2)[0], " failed 0") {
+		return errors.New("some records failed to load")
+	}
+	return nil
+}
+
+func closeWrite(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.CloseWrite()
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/engine"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func startEngine(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error finding a free port: %v", err)
+	}
+	port := fmt.Sprint(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+
+	config := engine.DefaultConfig()
+	config.Port = port
+	config.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	go engine.New(config).Start()
+
+	address := "127.0.0.1:" + port
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			return address
+		}
+	}
+	t.Fatalf("Server did not start on %s", address)
+	return ""
+}
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Error writing %s: %v", path, err)
+	}
+	return path
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v", path, err)
+	}
+	return string(content)
+}
+
+func TestImportAndExportJSONL(t *testing.T) {
+	// Arrange
+	address := startEngine(t)
+	lines := make([]string, 2500)
+	for i := range lines {
+		lines[i] = fmt.Sprintf(`{"id":%d,"n":%d,"name":"car %d"}`, i+1, i*10, i+1)
+	}
+	content := strings.Join(lines, "\n") + "\n"
+	input := writeFile(t, "cars.jsonl", content)
+	output := filepath.Join(t.TempDir(), "export.jsonl")
+
+	// Act
+	importErr := runImport([]string{"-addr", address, "-entity", "car", "-file", input})
+	exportErr := runExport([]string{"-addr", address, "-entity", "car", "-file", output})
+
+	// Assert
+	testutil.AssertNil(t, importErr, "import error")
+	testutil.AssertNil(t, exportErr, "export error")
+	testutil.AssertEquals(t, content, readFile(t, output), "exported file")
+}
+
+func TestImportAndExportCSV(t *testing.T) {
+	// Arrange
+	address := startEngine(t)
+	content := "id,name:string,tags:list,year:int\n" +
+		"1,\"bmw, m3\",['a'],2020\n" +
+		"2,audi,,2018\n"
+	input := writeFile(t, "cars.csv", content)
+	output := filepath.Join(t.TempDir(), "export.csv")
+
+	// Act
+	importErr := runImport([]string{"-addr", address, "-entity", "car", "-format", "csv", "-file", input})
+	exportErr := runExport([]string{"-addr", address, "-entity", "car", "-format", "csv", "-file", output})
+
+	// Assert
+	testutil.AssertNil(t, importErr, "import error")
+	testutil.AssertNil(t, exportErr, "export error")
+	testutil.AssertEquals(t, content, readFile(t, output), "exported file")
+}
+
+func TestImportReportsFailedRecords(t *testing.T) {
+	// Arrange
+	address := startEngine(t)
+	input := writeFile(t, "cars.jsonl", `{"id":1,"name":"bmw"}`+"\n"+`{"name":"audi"}`+"\n")
+
+	// Act
+	err := runImport([]string{"-addr", address, "-entity", "car", "-file", input})
+
+	// Assert
+	testutil.AssertNotNil(t, err, "import error")
+	testutil.AssertContains(t, err.Error(), "some records failed to load")
+}
+
+func TestExportReportsServerErrors(t *testing.T) {
+	// Arrange
+	address := startEngine(t)
+	output := filepath.Join(t.TempDir(), "export.xml")
+
+	// Act
+	err := runExport([]string{"-addr", address, "-entity", "car", "-format", "xml", "-file", output})
+
+	// Assert
+	testutil.AssertNotNil(t, err, "export error")
+	testutil.AssertContains(t, err.Error(), "export: ERR ")
+	testutil.AssertEquals(t, "", readFile(t, output), "exported file")
+}
@@ -1,7 +1,78 @@
 package main
 
-import "github.com/gabrielluciano/liondb/internal/database/engine"
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/gabrielluciano/liondb/internal/database/engine"
+	"github.com/gabrielluciano/liondb/internal/database/server"
+)
 
 func main() {
-	engine.Start()
+	subcommands := map[string]func(args []string) error{
+		"bulk":   runBulk,
+		"import": runImport,
+		"export": runExport,
+	}
+	if len(os.Args) > 1 {
+		if run, found := subcommands[os.Args[1]]; found {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	config := engine.DefaultConfig()
+	flag.StringVar(&config.Port, "port", config.Port, "TCP port the server listens on")
+	flag.BoolVar(&config.StrictEntities, "strict-entities", config.StrictEntities,
+		"reject reads on entities that were never created instead of treating them as empty")
+	flag.StringVar(&config.ReplicationPort, "replication-port", config.ReplicationPort,
+		"TCP port followers connect to for replication; empty disables the replication log")
+	flag.IntVar(&config.ReplicationBacklog, "replication-backlog", config.ReplicationBacklog,
+		"number of recent writes kept for followers to catch up without a full resync")
+	flag.StringVar(&config.ReplicaOf, "replica-of", config.ReplicaOf,
+		"address of a primary to follow; the server becomes a read-only replica")
+	flag.StringVar(&config.RaftId, "raft-id", config.RaftId,
+		"id of this node in a raft cluster; empty disables raft consensus")
+	flag.StringVar(&config.RaftAddress, "raft-address", config.RaftAddress,
+		"host:port for raft traffic; defaults to this node's entry in -raft-peers")
+	flag.StringVar(&config.RaftPeers, "raft-peers", config.RaftPeers,
+		"initial cluster members as id=host:port pairs separated by commas; empty to join an existing cluster")
+	flag.StringVar(&config.RaftDir, "raft-dir", config.RaftDir,
+		"directory for the raft log and snapshots; empty keeps them in memory")
+	flag.StringVar(&config.ShardId, "shard-id", config.ShardId,
+		"id of this node in a sharded cluster; empty disables sharding")
+	flag.StringVar(&config.ShardNodes, "shard-nodes", config.ShardNodes,
+		"cluster nodes as id=host:port pairs separated by commas, pointing at each node's client port")
+	flag.IntVar(&config.ChangeBacklog, "change-backlog", config.ChangeBacklog,
+		"number of change events kept for resuming SUBSCRIBE streams; 0 uses the default")
+	flag.IntVar(&config.PubSubBuffer, "pubsub-buffer", config.PubSubBuffer,
+		"messages buffered per pub/sub subscriber before it is disconnected as a slow consumer; 0 uses the default")
+	flag.StringVar(&config.HTTPPort, "http-port", config.HTTPPort,
+		"TCP port for the HTTP /metrics, /healthz and /readyz endpoints; empty disables it")
+	flag.BoolVar(&config.LogCommands, "log-commands", config.LogCommands,
+		"log every command handled along with its duration")
+	flag.DurationVar(&config.SlowLogThreshold, "slowlog-threshold", config.SlowLogThreshold,
+		"commands taking at least this long are kept in the slow log; 0 uses the default of 10ms, negative disables it")
+	flag.IntVar(&config.SlowLogSize, "slowlog-size", config.SlowLogSize,
+		"number of slow commands kept; 0 uses the default")
+	flag.StringVar(&config.TraceFile, "trace-file", config.TraceFile,
+		"file to append a span per command to as OTLP/JSON lines; empty disables tracing")
+	logLevel := flag.String("log-level", "info", "minimum log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "log output format: text or json")
+	flag.Parse()
+
+	logger, err := server.NewLogger(os.Stderr, *logFormat, *logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+	config.Logger = logger
+
+	engine.New(config).Start()
 }
@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"math"
+	"strings"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+	"github.com/google/btree"
+)
+
+type aggregator struct {
+	operation string
+	count     int64
+	intSum    int64
+	floatSum  float64
+	useFloat  bool
+	numbers   int64
+	extreme   interface{}
+}
+
+type aggregateGroup struct {
+	key        interface{}
+	aggregator *aggregator
+}
+
+func (e *Engine) aggregateRecords(parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	groups, err := e.aggregateGroups(parsedCommand)
+	if err != nil {
+		return nil, err
+	}
+	return serializeAggregate(parsedCommand, groups, serializer)
+}
+
+// aggregateGroups aggregates the matching records of this node, keyed by the
+// value of the GROUP BY attribute.
+func (e *Engine) aggregateGroups(parsedCommand *parser.ParsedCommand) (*btree.BTreeG[*aggregateGroup], error) {
+	s, err := e.getStorage(parsedCommand.Entity, false)
+	if err != nil {
+		return nil, err
+	}
+	id := parsedCommand.Id
+	if id.Upper != 0 && id.Lower > id.Upper {
+		return nil, &InvalidIdError{"invalid id range"}
+	}
+
+	groups := newAggregateGroups()
+	matches := e.recordMatcher(parsedCommand)
+	s.IterateOverRange(id.Lower, id.Upper, func(record *storage.Record) bool {
+		if !matches(record) {
+			return true
+		}
+		var key interface{}
+		if parsedCommand.GroupBy != "" {
+			key = attributeValue(record, parsedCommand.GroupBy)
+		}
+		group := aggregateGroupFor(groups, key, parsedCommand.Operation)
+		if parsedCommand.Attribute == "" {
+			group.aggregator.count++
+		} else if value := attributeValue(record, parsedCommand.Attribute); value != nil {
+			group.aggregator.add(value)
+		}
+		return true
+	})
+	return groups, nil
+}
+
+// Groups are keyed with storage.CompareValues, so equal numbers of different
+// types (5 and 5.0) fall in the same group, which keeps the key of its first
+// record.
+func newAggregateGroups() *btree.BTreeG[*aggregateGroup] {
+	return btree.NewG(16, func(a, b *aggregateGroup) bool {
+		return storage.CompareValues(a.key, b.key) < 0
+	})
+}
+
+func aggregateGroupFor(groups *btree.BTreeG[*aggregateGroup], key interface{}, operation string) *aggregateGroup {
+	group, found := groups.Get(&aggregateGroup{key: key})
+	if !found {
+		group = &aggregateGroup{key: key, aggregator: &aggregator{operation: operation}}
+		groups.ReplaceOrInsert(group)
+	}
+	return group
+}
+
+func serializeAggregate(parsedCommand *parser.ParsedCommand, groups *btree.BTreeG[*aggregateGroup], serializer recordSerializer) ([]byte, error) {
+	resultColumn := strings.ToLower(parsedCommand.Operation)
+	if parsedCommand.GroupBy == "" {
+		result := (&aggregator{operation: parsedCommand.Operation}).result()
+		if group, found := groups.Get(&aggregateGroup{}); found {
+			result = group.aggregator.result()
+		}
+		return serializer.serializeRow([]string{resultColumn}, []interface{}{result})
+	}
+
+	rows := make([][]interface{}, 0, groups.Len())
+	groups.Ascend(func(group *aggregateGroup) bool {
+		rows = append(rows, []interface{}{group.key, group.aggregator.result()})
+		return true
+	})
+	return serializer.serializeRows([]string{parsedCommand.GroupBy, resultColumn}, rows)
+}
+
+func (a *aggregator) add(value interface{}) {
+	a.count++
+	switch a.operation {
+	case "SUM", "AVG":
+		a.addNumber(value)
+	case "MIN", "MAX":
+		a.addExtreme(value)
+	}
+}
+
+func (a *aggregator) addExtreme(value interface{}) {
+	if a.extreme == nil {
+		a.extreme = value
+		return
+	}
+	comparison := storage.CompareValues(value, a.extreme)
+	if (a.operation == "MIN" && comparison < 0) || (a.operation == "MAX" && comparison > 0) {
+		a.extreme = value
+	}
+}
+
+func (a *aggregator) addNumber(value interface{}) {
+	var integer int64
+	isInteger := true
+	switch v := value.(type) {
+	case int:
+		integer = int64(v)
+	case int64:
+		integer = v
+	case uint:
+		isInteger = uint64(v) <= math.MaxInt64
+		integer = int64(v)
+	case uint64:
+		isInteger = v <= math.MaxInt64
+		integer = int64(v)
+	case float64:
+		isInteger = false
+	default:
+		return
+	}
+	a.numbers++
+	a.floatSum += toFloat64(value)
+	if !isInteger {
+		a.useFloat = true
+		return
+	}
+	a.addInteger(integer)
+}
+
+func (a *aggregator) addInteger(integer int64) {
+	sum := a.intSum + integer
+	if (integer > 0 && sum < a.intSum) || (integer < 0 && sum > a.intSum) {
+		a.useFloat = true
+	}
+	a.intSum = sum
+}
+
+// merge adds the partial aggregate of another node.
+func (a *aggregator) merge(other *aggregator) {
+	a.count += other.count
+	a.numbers += other.numbers
+	a.floatSum += other.floatSum
+	a.useFloat = a.useFloat || other.useFloat
+	a.addInteger(other.intSum)
+	if other.extreme != nil {
+		a.addExtreme(other.extreme)
+	}
+}
+
+// result is null for SUM and AVG when no numeric value was aggregated, so an
+// empty sum is not mistaken for a total of 0.
+func (a *aggregator) result() interface{} {
+	switch a.operation {
+	case "COUNT":
+		return a.count
+	case "SUM":
+		if a.numbers == 0 {
+			return nil
+		}
+		if a.useFloat {
+			return a.floatSum
+		}
+		return a.intSum
+	case "AVG":
+		if a.numbers == 0 {
+			return nil
+		}
+		return a.floatSum / float64(a.numbers)
+	default:
+		return a.extreme
+	}
+}
+
+func toFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case float64:
+		return v
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func insertOrders(e *Engine, session *server.Session) {
+	e.messageHandler(session, "NEW order:1 customer 'ana' total 10 status 'paid'")
+	e.messageHandler(session, "NEW order:2 customer 'bob' total 25.5 status 'paid'")
+	e.messageHandler(session, "NEW order:3 customer 'ana' total 7 status 'open'")
+	e.messageHandler(session, "NEW order:4 customer 'ana' total 3 status 'paid'")
+	e.messageHandler(session, "NEW order:5 customer 'carl' status 'open'")
+}
+
+func TestAggregateRecords(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	insertOrders(e, session)
+
+	tests := []struct {
+		command  string
+		expected string
+	}{
+		{"COUNT order", "count 5"},
+		{"COUNT order total", "count 4"},
+		{"COUNT order[2:4]", "count 3"},
+		{"SUM order total", "sum 45.5"},
+		{"SUM order total WHERE customer = 'ana'", "sum 20"},
+		{"SUM order total WHERE customer = 'nobody'", "sum null"},
+		{"SUM order customer", "sum null"},
+		{"AVG order total WHERE status = paid AND total < 20", "avg 6.5"},
+		{"AVG order total WHERE customer = 'carl'", "avg null"},
+		{"MIN order total", "min 3"},
+		{"MAX order customer", "max 'carl'"},
+		{"COUNT order GROUP BY customer", "customer 'ana' count 3\ncustomer 'bob' count 1\ncustomer 'carl' count 1"},
+		{"SUM order total WHERE status = 'paid' GROUP BY customer", "customer 'ana' sum 13\ncustomer 'bob' sum 25.5"},
+		{"COUNT order WHERE total > 100 GROUP BY customer", ""},
+	}
+
+	for _, test := range tests {
+		// Act
+		result := e.messageHandler(session, test.command)
+
+		// Assert
+		testutil.AssertEquals(t, test.expected, string(result), test.command)
+	}
+}
+
+func TestAggregateRecordsJSON(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	insertOrders(e, session)
+	e.messageHandler(session, "FORMAT json")
+
+	// Act
+	single := e.messageHandler(session, "COUNT order")
+	grouped := e.messageHandler(session, "MAX order total GROUP BY status")
+
+	// Assert
+	testutil.AssertEquals(t, `{"count":5}`, string(single), "single")
+	testutil.AssertEquals(t, `[{"status":"open","max":7},{"status":"paid","max":25.5}]`, string(grouped), "grouped")
+}
+
+func TestAggregateGroupsEqualNumbersTogether(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW m:1 v 5")
+	e.messageHandler(session, "NEW m:2 v 5.0")
+	e.messageHandler(session, "NEW m:3 v 5u")
+	e.messageHandler(session, "NEW m:4 v 'five'")
+
+	// Act
+	result := e.messageHandler(session, "COUNT m GROUP BY v")
+
+	// Assert
+	testutil.AssertEquals(t, "v 5 count 3\nv 'five' count 1", string(result), "result")
+}
+
+func TestAggregateSumOverflowFallsBackToFloat(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW counter:1 value 9223372036854775807")
+	e.messageHandler(session, "NEW counter:2 value 1")
+
+	// Act
+	result := e.messageHandler(session, "SUM counter value")
+
+	// Assert
+	testutil.AssertEquals(t, "sum 9223372036854776000.0", string(result), "result")
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+func (e *Engine) modifyAttribute(parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	if parsedCommand.Id.Lower != parsedCommand.Id.Upper || parsedCommand.Id.Lower == uint(0) {
+		return nil, &InvalidIdError{"invalid id"}
+	}
+	s, err := e.getStorage(parsedCommand.Entity, false)
+	if err != nil {
+		return nil, err
+	}
+
+	path := parsedCommand.Attribute
+	operand := (*parsedCommand.Data)[path]
+	schema := e.getSchema(parsedCommand.Entity)
+	var result interface{}
+	found, err := s.ModifyRecord(parsedCommand.Id.Lower, func(data storage.Data) error {
+		current, _ := data.GetPath(path)
+		value, err := applyOperation(parsedCommand.Operation, path, current, operand)
+		if err != nil {
+			return err
+		}
+		if schema != nil {
+			validated := storage.Data{path: value}
+			if err := schema.ValidateUpdate(validated); err != nil {
+				return err
+			}
+			value = validated[path]
+		}
+		if err := data.SetPath(path, value); err != nil {
+			return &InvalidDataError{err.Error()}
+		}
+		result = value
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, recordNotFound(parsedCommand.Entity, parsedCommand.Id.Lower)
+	}
+	return serializer.serializeRow([]string{path}, []interface{}{result})
+}
+
+func applyOperation(operation, path string, current, operand interface{}) (interface{}, error) {
+	switch operation {
+	case "INCR":
+		return incrementValue(path, current, operand)
+	case "DECR":
+		negated, err := negateValue(path, operand)
+		if err != nil {
+			return nil, err
+		}
+		return incrementValue(path, current, negated)
+	default:
+		return appendValue(path, current, operand)
+	}
+}
+
+func incrementValue(path string, current, amount interface{}) (interface{}, error) {
+	if current == nil {
+		current = int64(0)
+	}
+	if !isNumber(current) {
+		return nil, &InvalidDataError{fmt.Sprintf("attribute %s is not a number", path)}
+	}
+
+	_, currentIsFloat := current.(float64)
+	_, amountIsFloat := amount.(float64)
+	if currentIsFloat || amountIsFloat {
+		return toFloat64(current) + toFloat64(amount), nil
+	}
+
+	if unsigned, ok := current.(uint64); ok {
+		switch a := amount.(type) {
+		case uint64:
+			if unsigned > math.MaxUint64-a {
+				return nil, incrementOverflow(path)
+			}
+			return unsigned + a, nil
+		case int64:
+			if a < 0 && uint64(-(a+1))+1 > unsigned {
+				return nil, incrementOverflow(path)
+			}
+			if a >= 0 && unsigned > math.MaxUint64-uint64(a) {
+				return nil, incrementOverflow(path)
+			}
+			return unsigned + uint64(a), nil
+		}
+	}
+
+	signed := toInt64(current)
+	switch a := amount.(type) {
+	case uint64:
+		if a > math.MaxInt64 || signed > math.MaxInt64-int64(a) {
+			return nil, incrementOverflow(path)
+		}
+		return signed + int64(a), nil
+	case int64:
+		if (a > 0 && signed > math.MaxInt64-a) || (a < 0 && signed < math.MinInt64-a) {
+			return nil, incrementOverflow(path)
+		}
+		return signed + a, nil
+	}
+	return nil, &InvalidDataError{fmt.Sprintf("invalid amount for attribute %s", path)}
+}
+
+func negateValue(path string, amount interface{}) (interface{}, error) {
+	switch a := amount.(type) {
+	case int64:
+		if a == math.MinInt64 {
+			return nil, incrementOverflow(path)
+		}
+		return -a, nil
+	case uint64:
+		if a > math.MaxInt64+1 {
+			return nil, incrementOverflow(path)
+		}
+		return int64(-a), nil
+	case float64:
+		return -a, nil
+	}
+	return nil, &InvalidDataError{fmt.Sprintf("invalid amount for attribute %s", path)}
+}
+
+func appendValue(path string, current, value interface{}) (interface{}, error) {
+	switch c := current.(type) {
+	case nil:
+		if _, isString := value.(string); isString {
+			return value, nil
+		}
+		return []interface{}{value}, nil
+	case string:
+		suffix, isString := value.(string)
+		if !isString {
+			return nil, &InvalidDataError{fmt.Sprintf("attribute %s is a string and can only be appended with strings", path)}
+		}
+		return c + suffix, nil
+	case []interface{}:
+		return append(c, value), nil
+	default:
+		return nil, &InvalidDataError{fmt.Sprintf("attribute %s is not a string or list", path)}
+	}
+}
+
+func isNumber(value interface{}) bool {
+	switch value.(type) {
+	case int, int64, uint, uint64, float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int64:
+		return v
+	case uint:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
+func incrementOverflow(path string) error {
+	return &InvalidDataError{fmt.Sprintf("increment overflows attribute %s", path)}
+}
@@ -0,0 +1,135 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestIncrementAndDecrement(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW counter:1 views 10 stats {score 1.5}")
+
+	// Act
+	incrResult := e.messageHandler(session, "INCR counter:1 views 5")
+	defaultResult := e.messageHandler(session, "INCR counter:1 views")
+	decrResult := e.messageHandler(session, "DECR counter:1 views 20")
+	floatResult := e.messageHandler(session, "INCR counter:1 stats.score 0.25")
+	missingResult := e.messageHandler(session, "INCR counter:1 likes")
+	missingRecordResult := e.messageHandler(session, "INCR counter:2 views")
+
+	// Assert
+	testutil.AssertEquals(t, "views 15", string(incrResult), "incr result")
+	testutil.AssertEquals(t, "views 16", string(defaultResult), "default result")
+	testutil.AssertEquals(t, "views -4", string(decrResult), "decr result")
+	testutil.AssertEquals(t, "stats.score 1.75", string(floatResult), "float result")
+	testutil.AssertEquals(t, "likes 1", string(missingResult), "missing result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND record counter:2 not found", string(missingRecordResult), "missing record result")
+}
+
+func TestIncrementInvalid(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW counter:1 name 'home' views 9223372036854775807")
+
+	// Act
+	stringResult := e.messageHandler(session, "INCR counter:1 name")
+	overflowResult := e.messageHandler(session, "INCR counter:1 views")
+	amountResult := e.messageHandler(session, "INCR counter:1 views 'a'")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR INVALID_DATA attribute name is not a number", string(stringResult), "string result")
+	testutil.AssertEquals(t, "ERR INVALID_DATA increment overflows attribute views", string(overflowResult), "overflow result")
+	testutil.AssertEquals(t, "ERR PARSE Error parsing data: INCR expects a numeric amount", string(amountResult), "amount result")
+}
+
+func TestAppend(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW post:1 title 'Hello' tags ['a'] views 1")
+
+	// Act
+	stringResult := e.messageHandler(session, "APPEND post:1 title ', world'")
+	listResult := e.messageHandler(session, "APPEND post:1 tags 'b'")
+	missingResult := e.messageHandler(session, "APPEND post:1 comments {author 'john'}")
+	invalidResult := e.messageHandler(session, "APPEND post:1 views 2")
+
+	// Assert
+	testutil.AssertEquals(t, "title 'Hello, world'", string(stringResult), "string result")
+	testutil.AssertEquals(t, "tags ['a', 'b']", string(listResult), "list result")
+	testutil.AssertEquals(t, "comments [{author 'john'}]", string(missingResult), "missing result")
+	testutil.AssertEquals(t, "ERR INVALID_DATA attribute views is not a string or list", string(invalidResult), "invalid result")
+}
+
+func TestIncrementConcurrent(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	e.messageHandler(server.NewSession("test"), "NEW counter:1 views 0")
+	var wg sync.WaitGroup
+
+	// Act
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			session := server.NewSession("test")
+			e.messageHandler(session, "INCR counter:1 views 2")
+			e.messageHandler(session, "DECR counter:1 views")
+		}()
+	}
+	wg.Wait()
+	result := e.messageHandler(server.NewSession("test"), "GET counter:1")
+
+	// Assert
+	testutil.AssertEquals(t, "id 1 views 50", string(result), "result")
+}
+
+func TestIncrementConcurrentWithReads(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	e.messageHandler(server.NewSession("test"), "NEW counter:1 views 0 label 'a'")
+	var wg sync.WaitGroup
+	reads := make(chan string, 200)
+
+	// Act
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			e.messageHandler(server.NewSession("test"), "INCR counter:1 views")
+		}()
+		go func() {
+			defer wg.Done()
+			reads <- string(e.messageHandler(server.NewSession("test"), "GET counter:1"))
+		}()
+	}
+	wg.Wait()
+	close(reads)
+	result := e.messageHandler(server.NewSession("test"), "GET counter:1")
+
+	// Assert
+	testutil.AssertEquals(t, "id 1 label 'a' views 100", string(result), "result")
+	for read := range reads {
+		testutil.AssertContains(t, read, "id 1 label 'a' views ")
+	}
+}
+
+func TestIncrementValidatesSchema(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "SCHEMA counter views:int")
+	e.messageHandler(session, "NEW counter:1 views 1")
+
+	// Act
+	result := e.messageHandler(session, "INCR counter:1 views 0.5")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR VALIDATION attribute views must be int, got 1.5", string(result), "result")
+}
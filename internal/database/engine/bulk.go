@@ -0,0 +1,262 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+const (
+	bulkBatchSize           = 1000
+	bulkMaxReportedFailures = 100
+)
+
+type bulkFailure struct {
+	line int
+	err  error
+}
+
+type bulkReport struct {
+	conflict string
+	inserted int
+	skipped  int
+	replaced int
+	failed   int
+	failures []bulkFailure
+}
+
+type bulkLoad struct {
+	entity     string
+	storage    *storage.Storage
+	schema     *Schema
+	format     string
+	columns    []parser.CSVColumn
+	line       int
+	batch      []*storage.Record
+	batchLines []int
+	routed     bool
+	report     bulkReport
+}
+
+func (e *Engine) startBulkLoad(session *server.Session, parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	s, err := e.getStorage(parsedCommand.Entity, true)
+	if err != nil {
+		return nil, err
+	}
+	load := &bulkLoad{
+		entity:  parsedCommand.Entity,
+		storage: s,
+		schema:  e.getSchema(parsedCommand.Entity),
+		routed:  e.cluster != nil && !isPeerSession(session),
+		report:  bulkReport{conflict: "FAIL"},
+	}
+	if parsedCommand.Operation == "IMPORT" {
+		load.format = parsedCommand.Args[0]
+		load.report.conflict = parsedCommand.Args[1]
+	}
+	session.Set("bulk", load)
+	return []byte("1"), nil
+}
+
+func (e *Engine) handleBulkLine(session *server.Session, load *bulkLoad, line string) []byte {
+	if strings.ToUpper(strings.TrimSpace(line)) == "END" {
+		e.flushBulkLoad(load)
+		sort.Slice(load.report.failures, func(i, j int) bool {
+			return load.report.failures[i].line < load.report.failures[j].line
+		})
+		session.Set("bulk", nil)
+		return sessionSerializer(session).serializeBulkReport(&load.report)
+	}
+
+	load.line++
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+	if load.format == "CSV" && load.columns == nil {
+		columns, err := parser.ParseCSVHeader(line)
+		if err != nil {
+			load.report.fail(load.line, err)
+			columns = []parser.CSVColumn{}
+		}
+		load.columns = columns
+		return nil
+	}
+	record, err := load.prepareRecord(line)
+	if err != nil {
+		load.report.fail(load.line, err)
+		return nil
+	}
+	load.batch = append(load.batch, record)
+	load.batchLines = append(load.batchLines, load.line)
+	if len(load.batch) >= bulkBatchSize {
+		e.flushBulkLoad(load)
+	}
+	return nil
+}
+
+func (load *bulkLoad) prepareRecord(line string) (*storage.Record, error) {
+	record, err := load.decodeRecord(line)
+	if err != nil {
+		return nil, err
+	}
+	data, err := expandPaths(record.Data)
+	if err != nil {
+		return nil, err
+	}
+	if load.schema != nil {
+		if err := load.schema.ValidateRecord(*data); err != nil {
+			return nil, err
+		}
+	}
+	record.Data = data
+	return record, nil
+}
+
+// revalidate checks the pending batch against a schema installed after its
+// records were prepared.
+func (load *bulkLoad) revalidate() {
+	if load.schema == nil {
+		return
+	}
+	valid := 0
+	for i, record := range load.batch {
+		if err := load.schema.ValidateRecord(*record.Data); err != nil {
+			load.report.fail(load.batchLines[i], err)
+			continue
+		}
+		load.batch[valid], load.batchLines[valid] = record, load.batchLines[i]
+		valid++
+	}
+	load.batch = load.batch[:valid]
+	load.batchLines = load.batchLines[:valid]
+}
+
+func (load *bulkLoad) decodeRecord(line string) (*storage.Record, error) {
+	switch load.format {
+	case "JSONL":
+		return parser.DeserializeRecordExtendedJSON(line)
+	case "CSV":
+		if len(load.columns) == 0 {
+			return nil, &InvalidDataError{"invalid csv header"}
+		}
+		return parser.DeserializeRecordCSV(load.columns, line)
+	default:
+		return parser.ParseRecordLine(line)
+	}
+}
+
+func (e *Engine) flushBulkLoad(load *bulkLoad) {
+	if e.cluster != nil {
+		e.cluster.writesMu.RLock()
+		defer e.cluster.writesMu.RUnlock()
+	}
+	if load.routed {
+		e.flushRemoteRecords(load)
+	}
+	if e.log != nil {
+		e.writeMu.Lock()
+		defer e.writeMu.Unlock()
+	}
+	var inserted []bool
+	var errs []error
+	ids := make([]uint, len(load.batch))
+	for i, record := range load.batch {
+		ids[i] = record.Id
+	}
+	e.withHooks(load.entity, ids, func() {
+		e.schemaMu.RLock()
+		defer e.schemaMu.RUnlock()
+		if schema := e.getSchema(load.entity); schema != load.schema {
+			load.schema = schema
+			load.revalidate()
+		}
+		if load.report.conflict == "REPLACE" {
+			inserted, errs = load.storage.PutRecords(load.batch)
+		} else {
+			inserted, errs = load.storage.InsertRecords(load.batch)
+		}
+	})
+	commands := make([]string, 0)
+	for i, record := range load.batch {
+		switch {
+		case errs != nil && errs[i] != nil:
+			load.report.fail(load.batchLines[i], errs[i])
+		case inserted[i]:
+			load.report.inserted++
+			if e.log != nil {
+				commands = append(commands, recordCommand("NEW", load.entity, record))
+			}
+		case load.report.conflict == "REPLACE":
+			load.report.replaced++
+			if e.log != nil {
+				commands = append(commands, recordCommand("SET", load.entity, record))
+			}
+		case load.report.conflict == "SKIP":
+			load.report.skipped++
+		default:
+			load.report.fail(load.batchLines[i], &ConflictError{fmt.Sprintf("record %s:%d already exists", load.entity, record.Id)})
+		}
+	}
+	if len(commands) > 0 {
+		e.log.append(commands...)
+	}
+	load.batch = load.batch[:0]
+	load.batchLines = load.batchLines[:0]
+}
+
+func (e *Engine) flushRemoteRecords(load *bulkLoad) {
+	records := make(map[string][]*storage.Record)
+	lines := make(map[string][]int)
+	local := 0
+	for i, record := range load.batch {
+		key := recordKey(load.entity, record.Id)
+		owner := e.cluster.ring.Owner(key)
+		if pendingOwner, moving := e.cluster.pendingOwner(key); moving {
+			load.report.fail(load.batchLines[i], &MovedError{fmt.Sprintf("record %s is moving to node %s", key, pendingOwner)})
+			continue
+		}
+		if owner == e.cluster.self {
+			load.batch[local], load.batchLines[local] = record, load.batchLines[i]
+			local++
+			continue
+		}
+		records[owner] = append(records[owner], record)
+		lines[owner] = append(lines[owner], load.batchLines[i])
+	}
+	load.batch = load.batch[:local]
+	load.batchLines = load.batchLines[:local]
+
+	owners := make([]string, 0, len(records))
+	for owner := range records {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+	for _, owner := range owners {
+		results, err := e.transferRecords(owner, load.entity, records[owner], load.report.conflict)
+		for i, line := range lines[owner] {
+			switch {
+			case err != nil:
+				load.report.fail(line, err)
+			case results[i].err == nil && results[i].replaced:
+				load.report.replaced++
+			case results[i].err == nil:
+				load.report.inserted++
+			case load.report.conflict == "SKIP" && ErrorCode(results[i].err) == ErrCodeConflict:
+				load.report.skipped++
+			default:
+				load.report.fail(line, results[i].err)
+			}
+		}
+	}
+}
+
+func (report *bulkReport) fail(line int, err error) {
+	report.failed++
+	if len(report.failures) < bulkMaxReportedFailures {
+		report.failures = append(report.failures, bulkFailure{line: line, err: err})
+	}
+}
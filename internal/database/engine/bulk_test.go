@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestBulkLoad(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:2 name 'fiat'")
+
+	// Act
+	startResult := e.messageHandler(session, "BULK car")
+	textResult := e.messageHandler(session, "id 1 name 'bmw' specs {hp 300}")
+	jsonResult := e.messageHandler(session, `{"id":3,"name":"audi"}`)
+	e.messageHandler(session, "")
+	e.messageHandler(session, "id 2 name 'duplicated'")
+	e.messageHandler(session, "name 'missing id'")
+	endResult := e.messageHandler(session, "END")
+	countResult := e.messageHandler(session, "COUNT car")
+	getResult := e.messageHandler(session, "GET car:1")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(startResult), "start result")
+	testutil.AssertEquals(t, 0, len(textResult), "text result")
+	testutil.AssertEquals(t, 0, len(jsonResult), "json result")
+	testutil.AssertEquals(t, "inserted 2 failed 2\n"+
+		"line 4 ERR CONFLICT record car:2 already exists\n"+
+		"line 5 ERR PARSE Error deserializing record: missing id", string(endResult), "end result")
+	testutil.AssertEquals(t, "count 3", string(countResult), "count result")
+	testutil.AssertEquals(t, "id 1 name 'bmw' specs {hp 300}", string(getResult), "get result")
+}
+
+func TestBulkLoadValidatesSchema(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "FORMAT json")
+	e.messageHandler(session, "SCHEMA car name:string")
+	e.messageHandler(session, "BULK car")
+
+	// Act
+	e.messageHandler(session, "id 1 name 'bmw'")
+	e.messageHandler(session, "id 2 year 2020")
+	result := e.messageHandler(session, "end")
+
+	// Assert
+	testutil.AssertEquals(t, `{"inserted":1,"failed":1,"errors":[{"line":2,"code":"VALIDATION","message":"unknown attribute year"}]}`, string(result), "result")
+}
+
+func TestBulkLoadFlushesBatches(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "BULK car")
+
+	// Act
+	for id := 1; id <= bulkBatchSize+1; id++ {
+		e.messageHandler(session, fmt.Sprintf("id %d", id))
+	}
+	recordsBeforeEnd := e.storages["car"].Len()
+	endResult := e.messageHandler(session, "END")
+
+	// Assert
+	testutil.AssertEquals(t, bulkBatchSize, recordsBeforeEnd, "records before end")
+	testutil.AssertEquals(t, fmt.Sprintf("inserted %d failed 0", bulkBatchSize+1), string(endResult), "end result")
+}
@@ -0,0 +1,237 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+const defaultChangeBacklog = 10000
+
+// Dropping or renaming an entity is recorded as one change to the entity as a
+// whole, without an id.
+const (
+	changeDrop   storage.ChangeType = "drop"
+	changeRename storage.ChangeType = "rename"
+)
+
+type changeEvent struct {
+	seq    uint64
+	change storage.Change
+	// renamedTo is the new name of the entity of a rename.
+	renamedTo string
+}
+
+type changeFeed struct {
+	mu       sync.Mutex
+	id       string
+	events   []changeEvent
+	capacity int
+	lastSeq  uint64
+	changed  chan struct{}
+}
+
+type subscription struct {
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func newChangeFeed(capacity int) *changeFeed {
+	if capacity <= 0 {
+		capacity = defaultChangeBacklog
+	}
+	return &changeFeed{id: newReplicationId(), capacity: capacity, changed: make(chan struct{})}
+}
+
+func (feed *changeFeed) record(change storage.Change) {
+	feed.append(changeEvent{change: change})
+}
+
+func (feed *changeFeed) recordEntity(changeType storage.ChangeType, entity string, renamedTo string) {
+	feed.append(changeEvent{change: storage.Change{Type: changeType, Entity: entity}, renamedTo: renamedTo})
+}
+
+func (feed *changeFeed) append(event changeEvent) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	feed.lastSeq++
+	event.seq = feed.lastSeq
+	feed.events = append(feed.events, event)
+	if len(feed.events) > 2*feed.capacity {
+		feed.events = append([]changeEvent(nil), feed.events[len(feed.events)-feed.capacity:]...)
+	}
+	close(feed.changed)
+	feed.changed = make(chan struct{})
+}
+
+func (feed *changeFeed) reset() {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	feed.id = newReplicationId()
+	feed.events = nil
+	feed.lastSeq = 0
+	close(feed.changed)
+	feed.changed = make(chan struct{})
+}
+
+func (feed *changeFeed) position() (string, uint64) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	return feed.id, feed.lastSeq
+}
+
+func (feed *changeFeed) since(id string, seq uint64) ([]changeEvent, <-chan struct{}, error) {
+	feed.mu.Lock()
+	defer feed.mu.Unlock()
+	if id != feed.id || seq > feed.lastSeq || (len(feed.events) > 0 && seq+1 < feed.events[0].seq) {
+		return nil, nil, &NotFoundError{fmt.Sprintf("change position %s is no longer available", formatChangePosition(id, seq))}
+	}
+	start := sort.Search(len(feed.events), func(i int) bool { return feed.events[i].seq > seq })
+	return append([]changeEvent(nil), feed.events[start:]...), feed.changed, nil
+}
+
+func formatChangePosition(id string, seq uint64) string {
+	return id + "-" + strconv.FormatUint(seq, 10)
+}
+
+func parseChangePosition(position string) (string, uint64, error) {
+	id, seqText, found := strings.Cut(position, "-")
+	seq, err := strconv.ParseUint(seqText, 10, 64)
+	if !found || id == "" || err != nil {
+		return "", 0, &InvalidArgumentError{"invalid change position " + position}
+	}
+	return id, seq, nil
+}
+
+func (e *Engine) activeSubscription(session *server.Session) *subscription {
+	sub, ok := session.Get("subscription").(*subscription)
+	if !ok {
+		return nil
+	}
+	select {
+	case <-sub.stopped:
+		return nil
+	default:
+		return sub
+	}
+}
+
+func (e *Engine) subscribe(session *server.Session, parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	id, seq := e.changes.position()
+	if len(parsedCommand.Args) > 0 {
+		var err error
+		if id, seq, err = parseChangePosition(parsedCommand.Args[0]); err != nil {
+			return nil, err
+		}
+		if _, _, err := e.changes.since(id, seq); err != nil {
+			return nil, err
+		}
+	}
+	ack, err := serializer.serializeRow([]string{"subscribed", "position"}, []interface{}{parsedCommand.Entity, formatChangePosition(id, seq)})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := session.Push(ack); err != nil {
+		return nil, &InvalidOperationError{"changes can only be streamed over a connection"}
+	}
+	sub := &subscription{stop: make(chan struct{}), stopped: make(chan struct{})}
+	session.Set("subscription", sub)
+	go e.streamChanges(session, sub, parsedCommand.Entity, id, seq, serializer)
+	return nil, nil
+}
+
+func (e *Engine) streamChanges(session *server.Session, sub *subscription, entity string, id string, seq uint64, serializer recordSerializer) {
+	defer close(sub.stopped)
+	for {
+		events, changed, err := e.changes.since(id, seq)
+		if err != nil {
+			session.Push(serializer.serializeError(err))
+			return
+		}
+		for _, event := range events {
+			seq = event.seq
+			if entity != "*" && entity != event.change.Entity && entity != event.renamedTo {
+				continue
+			}
+			serialized, err := serializeChange(id, event, serializer)
+			if err != nil {
+				serialized = serializer.serializeError(err)
+			}
+			if session.Push(serialized) != nil {
+				return
+			}
+		}
+		select {
+		case <-sub.stop:
+			return
+		case <-session.Done():
+			return
+		case <-e.done:
+			return
+		default:
+		}
+		if len(events) > 0 {
+			continue
+		}
+		select {
+		case <-changed:
+		case <-sub.stop:
+			return
+		case <-session.Done():
+			return
+		case <-e.done:
+			return
+		}
+	}
+}
+
+func serializeChange(id string, event changeEvent, serializer recordSerializer) ([]byte, error) {
+	switch event.change.Type {
+	case changeDrop:
+		return serializer.serializeRow(
+			[]string{"position", "op", "entity"},
+			[]interface{}{formatChangePosition(id, event.seq), string(event.change.Type), event.change.Entity},
+		)
+	case changeRename:
+		return serializer.serializeRow(
+			[]string{"position", "op", "entity", "renamed_to"},
+			[]interface{}{formatChangePosition(id, event.seq), string(event.change.Type), event.change.Entity, event.renamedTo},
+		)
+	}
+	columns := []string{"position", "op", "entity", "id"}
+	row := []interface{}{formatChangePosition(id, event.seq), string(event.change.Type), event.change.Entity, int64(event.change.Id)}
+	if event.change.Type != storage.ChangeInsert {
+		columns = append(columns, "old")
+		row = append(row, changeData(event.change.Old))
+	}
+	if event.change.Type != storage.ChangeDelete {
+		columns = append(columns, "new")
+		row = append(row, changeData(event.change.New))
+	}
+	return serializer.serializeRow(columns, row)
+}
+
+func changeData(data storage.Data) storage.Data {
+	if data == nil {
+		return storage.Data{}
+	}
+	return data
+}
+
+func (e *Engine) unsubscribe(session *server.Session) []byte {
+	sub := e.activeSubscription(session)
+	if sub == nil {
+		return []byte("0")
+	}
+	sub.stopOnce.Do(func() { close(sub.stop) })
+	<-sub.stopped
+	return []byte("1")
+}
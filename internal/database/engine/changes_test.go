@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func serveEngine(t *testing.T, e *Engine) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	s := server.New("")
+	s.SetMessageHandler(e.serveMessage)
+	e.pubsub = s.PubSub()
+	e.server = s
+	go s.Serve(listener)
+	return listener.Addr().String()
+}
+
+func dialEngine(t *testing.T, address string) *testClient {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (c *testClient) send(t *testing.T, command string) string {
+	c.conn.Write([]byte(command + "\n"))
+	return c.read(t)
+}
+
+func (c *testClient) read(t *testing.T) string {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Error reading from server: %v", err)
+	}
+	return strings.TrimSuffix(line, "\n")
+}
+
+func positionOf(line string) string {
+	_, rest, _ := strings.Cut(line, "position '")
+	position, _, _ := strings.Cut(rest, "'")
+	return position
+}
+
+func TestSubscribeStreamsChanges(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	defer e.Close()
+	address := serveEngine(t, e)
+	subscriber := dialEngine(t, address)
+	writer := server.NewSession("test")
+
+	// Act
+	ack := subscriber.send(t, "SUBSCRIBE car")
+	e.messageHandler(writer, "NEW car:1 name 'bmw' year 2020")
+	e.messageHandler(writer, "NEW truck:1 name 'volvo'")
+	e.messageHandler(writer, "UPD car:1 year 2021")
+	e.messageHandler(writer, "INCR car:1 year 1")
+	e.messageHandler(writer, "DEL car:1")
+	inserted := subscriber.read(t)
+	updated := subscriber.read(t)
+	incremented := subscriber.read(t)
+	deleted := subscriber.read(t)
+
+	// Assert
+	position := positionOf(ack)
+	testutil.AssertEquals(t, "subscribed 'car' position '"+position+"'", ack, "ack")
+	testutil.AssertTrue(t, strings.HasSuffix(position, "-0"), "initial position")
+	testutil.AssertContains(t, inserted, "op 'insert' entity 'car' id 1 new {name 'bmw' year 2020}")
+	testutil.AssertContains(t, updated, "op 'update' entity 'car' id 1 old {name 'bmw' year 2020} new {name 'bmw' year 2021}")
+	testutil.AssertContains(t, incremented, "op 'update' entity 'car' id 1 old {name 'bmw' year 2021} new {name 'bmw' year 2022}")
+	testutil.AssertContains(t, deleted, "op 'delete' entity 'car' id 1 old {name 'bmw' year 2022}")
+	testutil.AssertTrue(t, strings.HasSuffix(positionOf(deleted), "-5"), "delete position")
+}
+
+func TestSubscribeResumesFromPosition(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	defer e.Close()
+	address := serveEngine(t, e)
+	writer := server.NewSession("test")
+	first := dialEngine(t, address)
+	first.send(t, "SUBSCRIBE *")
+	e.messageHandler(writer, "NEW car:1 name 'bmw'")
+	seen := first.read(t)
+	first.conn.Close()
+	e.messageHandler(writer, "NEW car:2 name 'audi'")
+	e.messageHandler(writer, "DROP car")
+
+	// Act
+	second := dialEngine(t, address)
+	ack := second.send(t, "SUBSCRIBE * FROM "+positionOf(seen))
+	missed := []string{second.read(t), second.read(t)}
+	expired := dialEngine(t, address).send(t, "SUBSCRIBE car FROM 0011223344556677-3")
+
+	// Assert
+	testutil.AssertEquals(t, positionOf(seen), positionOf(ack), "resumed position")
+	testutil.AssertContains(t, missed[0], "op 'insert' entity 'car' id 2 new {name 'audi'}")
+	testutil.AssertContains(t, missed[1], "op 'drop' entity 'car'")
+	testutil.AssertEquals(t, "ERR NOT_FOUND change position 0011223344556677-3 is no longer available", expired, "expired position")
+}
+
+func TestSubscribeStreamsOneChangePerRename(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	defer e.Close()
+	address := serveEngine(t, e)
+	writer := server.NewSession("test")
+	e.messageHandler(writer, "NEW car:1 name 'bmw'")
+	e.messageHandler(writer, "NEW car:2 name 'audi'")
+	subscriber := dialEngine(t, address)
+	subscriber.send(t, "SUBSCRIBE vehicle")
+
+	// Act
+	e.messageHandler(writer, "RENAME car vehicle")
+	e.messageHandler(writer, "NEW vehicle:3 name 'fiat'")
+	renamed := subscriber.read(t)
+	inserted := subscriber.read(t)
+
+	// Assert
+	testutil.AssertTrue(t, strings.HasSuffix(positionOf(renamed), "-3"), "rename position")
+	testutil.AssertContains(t, renamed, "op 'rename' entity 'car' renamed_to 'vehicle'")
+	testutil.AssertContains(t, inserted, "op 'insert' entity 'vehicle' id 3 new {name 'fiat'}")
+}
+
+func TestSubscribeDropsPositionsOutsideBacklog(t *testing.T) {
+	// Arrange
+	e := New(Config{ChangeBacklog: 2})
+	defer e.Close()
+	address := serveEngine(t, e)
+	writer := server.NewSession("test")
+	subscriber := dialEngine(t, address)
+	start := positionOf(subscriber.send(t, "SUBSCRIBE car"))
+	subscriber.send(t, "UNSUBSCRIBE")
+	for i := 1; i <= 5; i++ {
+		e.messageHandler(writer, "UPSERT car:1 count 1")
+	}
+
+	// Act
+	response := subscriber.send(t, "SUBSCRIBE car FROM "+start)
+
+	// Assert
+	testutil.AssertEquals(t, "ERR NOT_FOUND change position "+start+" is no longer available", response, "response")
+}
+
+func TestSubscribedConnectionOnlyAcceptsUnsubscribe(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	defer e.Close()
+	subscriber := dialEngine(t, serveEngine(t, e))
+	subscriber.send(t, "FORMAT json")
+	ack := subscriber.send(t, "SUBSCRIBE car")
+	e.messageHandler(server.NewSession("test"), "NEW car:1 name 'bmw'")
+	event := subscriber.read(t)
+
+	// Act
+	rejected := subscriber.send(t, "GET car")
+	unsubscribed := subscriber.send(t, "UNSUBSCRIBE")
+	record := subscriber.send(t, "GET car:1")
+	again := subscriber.send(t, "UNSUBSCRIBE")
+
+	// Assert
+	testutil.AssertContains(t, ack, `{"subscribed":"car","position":"`)
+	testutil.AssertContains(t, event, `"op":"insert","entity":"car","id":1,"new":{"name":"bmw"}}`)
+	testutil.AssertEquals(t, `{"error":{"code":"INVALID_OPERATION","message":"connection is streaming changes, send UNSUBSCRIBE first"}}`, rejected, "rejected")
+	testutil.AssertEquals(t, "1", unsubscribed, "unsubscribed")
+	testutil.AssertEquals(t, `{"id":1,"name":"bmw"}`, record, "record")
+	testutil.AssertEquals(t, "0", again, "unsubscribe again")
+}
@@ -0,0 +1,560 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/database/sharding"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+const clusterDialTimeout = time.Second
+
+var routedOperations = map[string]bool{
+	"NEW":    true,
+	"UPD":    true,
+	"SET":    true,
+	"UNSET":  true,
+	"UPSERT": true,
+	"INCR":   true,
+	"DECR":   true,
+	"APPEND": true,
+	"DEL":    true,
+	"GET":    true,
+}
+
+var scatteredOperations = map[string]bool{
+	"GET":    true,
+	"COUNT":  true,
+	"SUM":    true,
+	"AVG":    true,
+	"MIN":    true,
+	"MAX":    true,
+	"STATS":  true,
+	"EXPORT": true,
+}
+
+type clusterState struct {
+	self        string
+	ring        *sharding.Ring
+	mu          sync.Mutex
+	peers       map[string]*clusterPeer
+	rebalanceMu sync.Mutex
+	// writesMu is held for reading by admitted writes and for writing while
+	// the pending ring is installed or committed.
+	writesMu sync.RWMutex
+	pending  atomic.Pointer[sharding.Ring]
+	// adopted holds the keys of the copies received for the pending ring.
+	adoptedMu sync.Mutex
+	adopted   map[string]bool
+}
+
+type clusterPeer struct {
+	address string
+	format  string
+	mu      sync.Mutex
+	conn    net.Conn
+	reader  *bufio.Reader
+}
+
+func newClusterState(self string, nodes map[string]string) *clusterState {
+	ring := sharding.NewRing(sharding.DefaultVirtualNodes)
+	ring.Set(nodes)
+	return &clusterState{self: self, ring: ring, peers: make(map[string]*clusterPeer)}
+}
+
+func (c *clusterState) execute(node string, format string, commands ...string) ([][]byte, error) {
+	address := c.ring.Address(node)
+	if address == "" {
+		return nil, &InternalError{fmt.Sprintf("node %s is not part of the cluster", node)}
+	}
+	return c.executeAt(node, address, format, commands...)
+}
+
+func (c *clusterState) executeAt(node string, address string, format string, commands ...string) ([][]byte, error) {
+	c.mu.Lock()
+	key := address + "|" + format
+	p, found := c.peers[key]
+	if !found {
+		p = &clusterPeer{address: address, format: format}
+		c.peers[key] = p
+	}
+	c.mu.Unlock()
+	responses, err := p.execute(commands)
+	if err != nil {
+		return nil, &InternalError{fmt.Sprintf("node %s at %s is unavailable: %v", node, address, err)}
+	}
+	return responses, nil
+}
+
+func (c *clusterState) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range c.peers {
+		p.mu.Lock()
+		if p.conn != nil {
+			p.conn.Close()
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *clusterPeer) execute(commands []string) ([][]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return nil, err
+		}
+	}
+	responses, err := p.roundTrip(commands)
+	if err != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+	return responses, err
+}
+
+func (p *clusterPeer) connect() error {
+	conn, err := net.DialTimeout("tcp", p.address, clusterDialTimeout)
+	if err != nil {
+		return err
+	}
+	p.conn = conn
+	p.reader = bufio.NewReaderSize(conn, 64*1024)
+	setup := []string{"CLUSTER LOCAL"}
+	switch p.format {
+	case "json":
+		setup = append(setup, "FORMAT json")
+	case transferFormat:
+		setup = append(setup, "CLUSTER TRANSFER")
+	case partialFormat:
+		setup = append(setup, "CLUSTER PARTIAL")
+	}
+	for _, command := range setup {
+		if _, err := p.roundTrip([]string{command}); err != nil {
+			conn.Close()
+			p.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *clusterPeer) roundTrip(commands []string) ([][]byte, error) {
+	writer := bufio.NewWriter(p.conn)
+	for _, command := range commands {
+		writer.WriteString(command)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+	responses := make([][]byte, len(commands))
+	for i := range responses {
+		header, err := p.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		length, err := strconv.Atoi(strings.TrimSuffix(header, "\n"))
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("invalid response frame %q", strings.TrimSpace(header))
+		}
+		frame := make([]byte, length+1)
+		if _, err := io.ReadFull(p.reader, frame); err != nil {
+			return nil, err
+		}
+		responses[i] = frame[:length]
+	}
+	return responses, nil
+}
+
+func frameResponse(response []byte) []byte {
+	framed := make([]byte, 0, len(response)+12)
+	framed = strconv.AppendInt(framed, int64(len(response)), 10)
+	framed = append(framed, '\n')
+	return append(framed, response...)
+}
+
+func isPeerSession(session *server.Session) bool {
+	return session.Get("peer") == true
+}
+
+func parseNodeAddresses(list string) (map[string]string, error) {
+	nodes := make(map[string]string)
+	if list == "" {
+		return nodes, nil
+	}
+	for _, node := range strings.Split(list, ",") {
+		id, address, found := strings.Cut(strings.TrimSpace(node), "=")
+		if !found || id == "" || address == "" {
+			return nil, fmt.Errorf("invalid node %q, expected id=host:port", node)
+		}
+		nodes[id] = address
+	}
+	return nodes, nil
+}
+
+func formatNodeAddresses(nodes map[string]string) string {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	list := make([]string, len(ids))
+	for i, id := range ids {
+		list[i] = id + "=" + nodes[id]
+	}
+	return strings.Join(list, ",")
+}
+
+func serializerFormat(serializer recordSerializer) string {
+	if _, ok := serializer.(jsonSerializer); ok {
+		return "json"
+	}
+	return "text"
+}
+
+func (e *Engine) routeCommand(command string, parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, bool) {
+	operation := parsedCommand.Operation
+	id := parsedCommand.Id
+	var response []byte
+	var err error
+	switch {
+	case routesToOwner(parsedCommand):
+		owner := e.cluster.ring.Owner(recordKey(parsedCommand.Entity, id.Lower))
+		if owner == e.cluster.self {
+			return nil, false
+		}
+		var responses [][]byte
+		if responses, err = e.cluster.execute(owner, serializerFormat(serializer), command); err == nil {
+			return responses[0], true
+		}
+	case scatteredOperations[operation]:
+		response, err = e.scatterOperation(command, parsedCommand, serializer)
+	case operation == "ENTITIES":
+		response, err = e.clusterEntities(serializer)
+	case operation == "DROP" || operation == "RENAME" || ((operation == "SCHEMA" || operation == "TRIGGER") && isWriteOperation(parsedCommand)):
+		response, err = e.broadcastOperation(command, parsedCommand)
+	default:
+		return nil, false
+	}
+	if err != nil {
+		return serializer.serializeError(err), true
+	}
+	return response, true
+}
+
+func recordKey(entity string, id uint) string {
+	return entity + ":" + strconv.FormatUint(uint64(id), 10)
+}
+
+func (e *Engine) gatherRecords(entity string, id parser.Id) (*storage.Storage, bool, error) {
+	gathered := storage.New(entity)
+	found := false
+	for _, node := range e.cluster.ring.NodeIds() {
+		if node == e.cluster.self {
+			records, err := e.scanLocalRecords(entity, id)
+			if err != nil {
+				continue
+			}
+			found = true
+			for _, record := range records {
+				gathered.InsertRecord(cloneRecord(record))
+			}
+			continue
+		}
+		responses, err := e.cluster.execute(node, "text", "CLUSTER SCAN "+scanTarget(entity, id))
+		if err != nil {
+			return nil, false, err
+		}
+		response := string(responses[0])
+		if strings.HasPrefix(response, "ERR "+ErrCodeNotFound) {
+			continue
+		}
+		if strings.HasPrefix(response, "ERR ") {
+			return nil, false, &InternalError{fmt.Sprintf("node %s: %s", node, response)}
+		}
+		found = true
+		for _, line := range strings.Split(response, "\n") {
+			if line == "" {
+				continue
+			}
+			record, err := parser.DeserializeRecordExtendedJSON(line)
+			if err != nil {
+				return nil, false, &InternalError{fmt.Sprintf("node %s: %v", node, err)}
+			}
+			gathered.InsertRecord(record)
+		}
+	}
+	return gathered, found, nil
+}
+
+func cloneRecord(record *storage.Record) *storage.Record {
+	data := storage.Data{}
+	if record.Data != nil {
+		data = record.Data.Clone()
+	}
+	return &storage.Record{Id: record.Id, Data: &data}
+}
+
+func scanTarget(entity string, id parser.Id) string {
+	if id.Lower == 0 && id.Upper == 0 {
+		return entity
+	}
+	bound := func(value uint) string {
+		if value == 0 {
+			return ""
+		}
+		return strconv.FormatUint(uint64(value), 10)
+	}
+	return entity + "[" + bound(id.Lower) + ":" + bound(id.Upper) + "]"
+}
+
+// scanLocalRecords returns the records in range that this node owns. Copies
+// received for a rebalance that is not committed yet are left out, so they
+// are not counted twice.
+func (e *Engine) scanLocalRecords(entity string, id parser.Id) ([]*storage.Record, error) {
+	e.mu.RLock()
+	s, found := e.storages[entity]
+	e.mu.RUnlock()
+	if !found {
+		return nil, entityNotFound(entity)
+	}
+	records := make([]*storage.Record, 0)
+	s.IterateOverRange(id.Lower, id.Upper, func(record *storage.Record) bool {
+		if e.cluster.owns(recordKey(entity, record.Id)) {
+			records = append(records, record)
+		}
+		return true
+	})
+	return records, nil
+}
+
+func (e *Engine) clusterEntities(serializer recordSerializer) ([]byte, error) {
+	counts := make(map[string]int64)
+	for _, node := range e.cluster.ring.NodeIds() {
+		var response []byte
+		if node == e.cluster.self {
+			response, _ = e.listEntities(textSerializer{})
+		} else {
+			responses, err := e.cluster.execute(node, "text", "ENTITIES")
+			if err != nil {
+				return nil, err
+			}
+			response = responses[0]
+		}
+		for _, line := range strings.Split(string(response), "\n") {
+			row, err := parser.ParseData(line)
+			if err != nil || row == nil {
+				continue
+			}
+			name, _ := (*row)["entity"].(string)
+			records, _ := (*row)["records"].(int64)
+			if name != "" {
+				counts[name] += records
+			}
+		}
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := make([][]interface{}, len(names))
+	for i, name := range names {
+		rows[i] = []interface{}{name, counts[name]}
+	}
+	return serializer.serializeRows([]string{"entity", "records"}, rows)
+}
+
+func (e *Engine) broadcastOperation(command string, parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	var firstErr error
+	succeeded := false
+	for _, node := range e.cluster.ring.NodeIds() {
+		if node == e.cluster.self {
+			if _, err := e.dispatchOperation(parsedCommand, textSerializer{}); err != nil {
+				firstErr = preferError(firstErr, err)
+			} else {
+				succeeded = true
+			}
+			continue
+		}
+		responses, err := e.cluster.execute(node, "text", command)
+		if err != nil {
+			return nil, err
+		}
+		if err := remoteError(responses[0]); err != nil {
+			firstErr = preferError(firstErr, err)
+		} else {
+			succeeded = true
+		}
+	}
+	if firstErr != nil && (!succeeded || ErrorCode(firstErr) != ErrCodeNotFound) {
+		return nil, firstErr
+	}
+	return []byte("1"), nil
+}
+
+func preferError(current error, err error) error {
+	if current == nil || ErrorCode(current) == ErrCodeNotFound {
+		return err
+	}
+	return current
+}
+
+func remoteError(response []byte) error {
+	text := string(response)
+	if !strings.HasPrefix(text, "ERR ") {
+		return nil
+	}
+	code, message, _ := strings.Cut(strings.TrimPrefix(text, "ERR "), " ")
+	switch code {
+	case ErrCodeNotFound:
+		return &NotFoundError{message}
+	case ErrCodeConflict:
+		return &ConflictError{message}
+	case ErrCodeInvalidId:
+		return &InvalidIdError{message}
+	case ErrCodeInvalidData:
+		return &InvalidDataError{message}
+	case ErrCodeInvalidArgument:
+		return &InvalidArgumentError{message}
+	case ErrCodeValidation:
+		return &ValidationError{message}
+	case ErrCodeMoved:
+		return &MovedError{message}
+	default:
+		return &InternalError{message}
+	}
+}
+
+func (e *Engine) clusterCommand(session *server.Session, parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	if e.cluster == nil {
+		return nil, &InvalidOperationError{"cluster mode is not enabled"}
+	}
+	if len(parsedCommand.Args) == 0 {
+		nodes := e.cluster.ring.Nodes()
+		ids := e.cluster.ring.NodeIds()
+		rows := make([][]interface{}, len(ids))
+		for i, id := range ids {
+			rows[i] = []interface{}{id, nodes[id], id == e.cluster.self}
+		}
+		return serializer.serializeRows([]string{"node", "address", "self"}, rows)
+	}
+
+	switch parsedCommand.Args[0] {
+	case "LOCAL":
+		session.Set("peer", true)
+		return []byte("1"), nil
+	case "SCAN":
+		records, err := e.scanLocalRecords(parsedCommand.Entity, parsedCommand.Id)
+		if err != nil {
+			return nil, err
+		}
+		return serializeJSONLines(records)
+	case "TRANSFER":
+		session.Set("peer", true)
+		session.Set("transfer", true)
+		return []byte("1"), nil
+	case "PARTIAL":
+		session.Set("peer", true)
+		session.Set("partial", true)
+		return []byte("1"), nil
+	case "PREPARE":
+		return e.prepareRebalance(parsedCommand.Args[1])
+	case "COPY":
+		return e.copyMovingRecords()
+	case "COMMIT":
+		return e.commitRebalance(parsedCommand.Args[1])
+	case "ABORT":
+		return e.abortRebalance(parsedCommand.Args[1])
+	case "REBALANCE":
+		return e.rebalance()
+	}
+
+	nodes := e.cluster.ring.Nodes()
+	id := parsedCommand.Args[1]
+	_, exists := nodes[id]
+	switch parsedCommand.Args[0] {
+	case "ADD":
+		if exists {
+			return nil, &InvalidArgumentError{fmt.Sprintf("node %s already exists", id)}
+		}
+		nodes[id] = parsedCommand.Args[2]
+	case "REMOVE":
+		if !exists {
+			return nil, &NotFoundError{fmt.Sprintf("node %s not found", id)}
+		}
+		if len(nodes) == 1 {
+			return nil, &InvalidArgumentError{fmt.Sprintf("cannot remove the last node %s", id)}
+		}
+		delete(nodes, id)
+	}
+	return e.changeClusterNodes(nodes)
+}
+
+func (e *Engine) schemaCommands() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.schemas))
+	for name := range e.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	commands := make([]string, len(names))
+	for i, name := range names {
+		commands[i] = schemaCommand(name, e.schemas[name])
+	}
+	return append(commands, e.triggerCommands()...)
+}
+
+type transferResult struct {
+	replaced bool
+	err      error
+}
+
+func (e *Engine) transferRecords(node string, entity string, records []*storage.Record, conflict string) ([]transferResult, error) {
+	commands := make([]string, len(records))
+	for i, record := range records {
+		commands[i] = recordCommand("NEW", entity, record)
+	}
+	responses, err := e.cluster.execute(node, "text", commands...)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]transferResult, len(records))
+	retries := make([]int, 0)
+	for i, response := range responses {
+		results[i].err = remoteError(response)
+		if conflict == "REPLACE" && results[i].err != nil && ErrorCode(results[i].err) == ErrCodeConflict {
+			retries = append(retries, i)
+		}
+	}
+	if len(retries) == 0 {
+		return results, nil
+	}
+
+	commands = commands[:0]
+	for _, i := range retries {
+		commands = append(commands, recordCommand("SET", entity, records[i]))
+	}
+	if responses, err = e.cluster.execute(node, "text", commands...); err != nil {
+		return nil, err
+	}
+	for j, i := range retries {
+		results[i] = transferResult{replaced: true, err: remoteError(responses[j])}
+	}
+	return results, nil
+}
@@ -0,0 +1,475 @@
+package engine
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/database/sharding"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+type testShard struct {
+	engine  *Engine
+	address string
+}
+
+func listenShards(t *testing.T, ids ...string) (map[string]net.Listener, map[string]string) {
+	listeners := make(map[string]net.Listener)
+	nodes := make(map[string]string)
+	for _, id := range ids {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Error listening: %v", err)
+		}
+		t.Cleanup(func() { listener.Close() })
+		listeners[id] = listener
+		nodes[id] = listener.Addr().String()
+	}
+	return listeners, nodes
+}
+
+func startShard(t *testing.T, id string, listener net.Listener, nodes map[string]string) *testShard {
+	e := New(DefaultConfig())
+	e.cluster = newClusterState(id, nodes)
+	s := server.New("")
+	s.SetMessageHandler(e.serveMessage)
+	go s.Serve(listener)
+	t.Cleanup(e.Close)
+	return &testShard{engine: e, address: listener.Addr().String()}
+}
+
+func startShards(t *testing.T, ids ...string) map[string]*testShard {
+	listeners, nodes := listenShards(t, ids...)
+	shards := make(map[string]*testShard)
+	for _, id := range ids {
+		shards[id] = startShard(t, id, listeners[id], nodes)
+	}
+	return shards
+}
+
+func localCount(shard *testShard, entity string) int {
+	shard.engine.mu.RLock()
+	defer shard.engine.mu.RUnlock()
+	if s, found := shard.engine.storages[entity]; found {
+		return s.Len()
+	}
+	return 0
+}
+
+func assertOwnedLocally(t *testing.T, shards map[string]*testShard, entity string) {
+	for id, shard := range shards {
+		shard.engine.mu.RLock()
+		s, found := shard.engine.storages[entity]
+		shard.engine.mu.RUnlock()
+		if !found {
+			continue
+		}
+		for _, record := range s.GetAllRecords(false) {
+			testutil.AssertEquals(t, id, shard.engine.cluster.ring.Owner(recordKey(entity, record.Id)), fmt.Sprintf("owner of %s:%d", entity, record.Id))
+		}
+	}
+}
+
+func TestClusterRoutesSingleRecordCommands(t *testing.T) {
+	// Arrange
+	shards := startShards(t, "s1", "s2", "s3")
+	session := server.NewSession("test")
+
+	// Act
+	for i := 1; i <= 30; i++ {
+		shards["s1"].engine.messageHandler(session, fmt.Sprintf("NEW car:%d name 'car%d' year %d", i, i, 2000+i))
+	}
+	updated := shards["s3"].engine.messageHandler(session, "UPD car:7 color 'red'")
+	incremented := shards["s2"].engine.messageHandler(session, "INCR car:8 year 10")
+	deleted := shards["s2"].engine.messageHandler(session, "DEL car:9")
+	conflict := shards["s3"].engine.messageHandler(session, "NEW car:1 name 'again'")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(updated), "update")
+	testutil.AssertEquals(t, "year 2018", string(incremented), "increment")
+	testutil.AssertEquals(t, "1", string(deleted), "delete")
+	testutil.AssertEquals(t, "ERR CONFLICT record car:1 already exists", string(conflict), "conflict")
+	total := 0
+	for id, shard := range shards {
+		count := localCount(shard, "car")
+		testutil.AssertTrue(t, count > 0, id+" holds records")
+		total += count
+	}
+	testutil.AssertEquals(t, 29, total, "total records")
+	assertOwnedLocally(t, shards, "car")
+	for id, shard := range shards {
+		testutil.AssertEquals(t, "id 7 color 'red' name 'car7' year 2007", string(shard.engine.messageHandler(session, "GET car:7")), id+" get")
+	}
+}
+
+func TestClusterScatterGather(t *testing.T) {
+	// Arrange
+	shards := startShards(t, "s1", "s2", "s3")
+	session := server.NewSession("test")
+	for i := 1; i <= 20; i++ {
+		shards["s2"].engine.messageHandler(session, fmt.Sprintf("NEW car:%d price %d", i, i*10))
+	}
+	coordinator := shards["s3"].engine
+
+	// Act
+	rangeGet := coordinator.messageHandler(session, "GET car[5:8]")
+	ordered := coordinator.messageHandler(session, "GET car WHERE price >= 150 ORDER BY price DESC LIMIT 2")
+	count := coordinator.messageHandler(session, "COUNT car")
+	sum := coordinator.messageHandler(session, "SUM car price")
+	entities := coordinator.messageHandler(session, "ENTITIES")
+	stats := coordinator.messageHandler(session, "STATS car")
+	missing := coordinator.messageHandler(session, "GET truck")
+
+	// Assert
+	testutil.AssertEquals(t, "id 5 price 50\nid 6 price 60\nid 7 price 70\nid 8 price 80", string(rangeGet), "range get")
+	testutil.AssertContains(t, string(ordered), "id 20 price 200\nid 19 price 190")
+	testutil.AssertEquals(t, "count 20", string(count), "count")
+	testutil.AssertEquals(t, "sum 2100", string(sum), "sum")
+	testutil.AssertEquals(t, "entity 'car' records 20", string(entities), "entities")
+	testutil.AssertEquals(t, "entity 'car' records 20 min_id 1 max_id 20 attributes 1", string(stats), "stats")
+	testutil.AssertEquals(t, "", string(missing), "missing entity")
+}
+
+func TestClusterMergesPartialResults(t *testing.T) {
+	// Arrange
+	shards := startShards(t, "s1", "s2", "s3")
+	single := New(DefaultConfig())
+	session := server.NewSession("test")
+	for i := 1; i <= 30; i++ {
+		command := fmt.Sprintf("NEW car:%d price %d brand '%s' rating %d.5", i, (i*7)%31, []string{"bmw", "audi", "fiat"}[i%3], i%4)
+		shards["s1"].engine.messageHandler(session, command)
+		single.messageHandler(session, command)
+	}
+	coordinator := shards["s2"].engine
+	commands := []string{
+		"GET car WHERE price > 10 ORDER BY price LIMIT 4 OFFSET 2",
+		"GET car ORDER BY brand, price DESC LIMIT 5",
+		"GET car[3:25] ORDER BY id DESC LIMIT 3 OFFSET 1",
+		"GET car WHERE brand = 'fiat' FIELDS price",
+		"COUNT car WHERE price < 20 GROUP BY brand",
+		"AVG car rating GROUP BY brand",
+		"SUM car price",
+		"MIN car price WHERE brand = 'audi'",
+		"MAX car brand",
+		"STATS car",
+	}
+
+	for _, command := range commands {
+		// Act
+		clustered := coordinator.messageHandler(session, command)
+		expected := single.messageHandler(session, command)
+
+		// Assert
+		testutil.AssertEquals(t, string(expected), string(clustered), command)
+	}
+}
+
+func TestClusterPagesWithMergedCursors(t *testing.T) {
+	// Arrange
+	shards := startShards(t, "s1", "s2", "s3")
+	session := server.NewSession("test")
+	for i := 1; i <= 30; i++ {
+		shards["s3"].engine.messageHandler(session, fmt.Sprintf("NEW car:%d price %d", i, (i*7)%31))
+	}
+	coordinator := shards["s1"].engine
+	command := "GET car ORDER BY price LIMIT 7"
+	prices := make([]string, 0)
+
+	// Act
+	for page := 0; page < 10; page++ {
+		lines := strings.Split(string(coordinator.messageHandler(session, command)), "\n")
+		last := lines[len(lines)-1]
+		if !strings.HasPrefix(last, "cursor ") {
+			prices = append(prices, lines...)
+			break
+		}
+		prices = append(prices, lines[:len(lines)-1]...)
+		command = "GET car ORDER BY price LIMIT 7 CURSOR " + strings.TrimPrefix(last, "cursor ")
+	}
+
+	// Assert
+	testutil.AssertEquals(t, 30, len(prices), "records")
+	for i, line := range prices {
+		testutil.AssertContains(t, line, fmt.Sprintf("price %d", i+1))
+	}
+}
+
+func TestClusterQueriesSkipRecordsOwnedElsewhere(t *testing.T) {
+	// Arrange
+	shards := startShards(t, "s1", "s2")
+	session := server.NewSession("test")
+	for i := 1; i <= 20; i++ {
+		shards["s1"].engine.messageHandler(session, fmt.Sprintf("NEW car:%d price %d", i, i))
+	}
+	stale := shards["s1"].engine
+	var copied uint
+	for i := uint(1); i <= 20 && copied == 0; i++ {
+		if stale.cluster.ring.Owner(recordKey("car", i)) == "s2" {
+			copied = i
+		}
+	}
+	owned, _ := shards["s2"].engine.getStorage("car", false)
+	record, _ := owned.GetRecord(copied)
+	s, _ := stale.getStorage("car", false)
+	s.AdoptRecord(cloneRecord(record))
+
+	// Act
+	count := stale.messageHandler(session, "COUNT car")
+	records := stale.messageHandler(session, fmt.Sprintf("GET car[%d:%d]", copied, copied+1))
+	stats := stale.messageHandler(session, "STATS car")
+
+	// Assert
+	testutil.AssertEquals(t, "count 20", string(count), "count")
+	testutil.AssertEquals(t, fmt.Sprintf("id %d price %d\nid %d price %d", copied, copied, copied+1, copied+1), string(records), "records")
+	testutil.AssertEquals(t, "entity 'car' records 20 min_id 1 max_id 20 attributes 1", string(stats), "stats")
+}
+
+func TestClusterForwardsSessionFormat(t *testing.T) {
+	// Arrange
+	shards := startShards(t, "s1", "s2")
+	session := server.NewSession("test")
+	shards["s1"].engine.messageHandler(session, "FORMAT json")
+	for i := 1; i <= 10; i++ {
+		shards["s1"].engine.messageHandler(session, fmt.Sprintf("NEW car:%d name 'car%d'", i, i))
+	}
+
+	// Act
+	responses := make([]string, 0)
+	for i := 1; i <= 10; i++ {
+		responses = append(responses, string(shards["s1"].engine.messageHandler(session, fmt.Sprintf("GET car:%d", i))))
+	}
+
+	// Assert
+	for i, response := range responses {
+		testutil.AssertEquals(t, fmt.Sprintf(`{"id":%d,"name":"car%d"}`, i+1, i+1), response, "response")
+	}
+}
+
+func TestClusterBroadcastsEntityCommands(t *testing.T) {
+	// Arrange
+	shards := startShards(t, "s1", "s2", "s3")
+	session := server.NewSession("test")
+	coordinator := shards["s1"].engine
+	for i := 1; i <= 10; i++ {
+		coordinator.messageHandler(session, fmt.Sprintf("NEW car:%d name 'car%d'", i, i))
+	}
+
+	// Act
+	schema := coordinator.messageHandler(session, "SCHEMA car name:string year:int=2000")
+	invalid := make([]string, 0)
+	for i := 11; i <= 15; i++ {
+		invalid = append(invalid, string(coordinator.messageHandler(session, fmt.Sprintf("NEW car:%d name 1", i))))
+	}
+	renamed := coordinator.messageHandler(session, "RENAME car vehicle")
+	dropped := coordinator.messageHandler(session, "DROP vehicle")
+	droppedAgain := coordinator.messageHandler(session, "DROP vehicle")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(schema), "schema")
+	for _, response := range invalid {
+		testutil.AssertEquals(t, "ERR VALIDATION attribute name must be string, got 1", response, "validation")
+	}
+	for id, shard := range shards {
+		testutil.AssertEquals(t, 0, localCount(shard, "car"), id+" car records")
+		testutil.AssertEquals(t, 0, localCount(shard, "vehicle"), id+" vehicle records")
+	}
+	testutil.AssertEquals(t, "1", string(renamed), "rename")
+	testutil.AssertEquals(t, "1", string(dropped), "drop")
+	testutil.AssertEquals(t, "ERR NOT_FOUND entity vehicle not found", string(droppedAgain), "drop again")
+}
+
+func TestClusterRebalancesWhenNodeJoins(t *testing.T) {
+	// Arrange
+	listeners, nodes := listenShards(t, "s1", "s2", "s3")
+	initial := map[string]string{"s1": nodes["s1"], "s2": nodes["s2"]}
+	shards := map[string]*testShard{
+		"s1": startShard(t, "s1", listeners["s1"], initial),
+		"s2": startShard(t, "s2", listeners["s2"], initial),
+	}
+	session := server.NewSession("test")
+	coordinator := shards["s1"].engine
+	coordinator.messageHandler(session, "SCHEMA car price:int")
+	for i := 1; i <= 100; i++ {
+		coordinator.messageHandler(session, fmt.Sprintf("NEW car:%d price %d", i, i))
+	}
+	shards["s3"] = startShard(t, "s3", listeners["s3"], map[string]string{"s3": nodes["s3"]})
+
+	// Act
+	moved := coordinator.messageHandler(session, "CLUSTER ADD s3 "+nodes["s3"])
+	status := shards["s3"].engine.messageHandler(session, "CLUSTER")
+
+	// Assert
+	testutil.AssertEquals(t, fmt.Sprint(localCount(shards["s3"], "car")), string(moved), "moved")
+	testutil.AssertTrue(t, localCount(shards["s3"], "car") > 10, "s3 received records")
+	assertOwnedLocally(t, shards, "car")
+	testutil.AssertEquals(t, "count 100", string(shards["s3"].engine.messageHandler(session, "COUNT car")), "count")
+	testutil.AssertEquals(t, "ERR VALIDATION attribute price must be int, got 'x'", string(shards["s3"].engine.messageHandler(session, "NEW car:101 price 'x'")), "schema on new node")
+	testutil.AssertEquals(t, fmt.Sprintf("node 's1' address '%s' self false\nnode 's2' address '%s' self false\nnode 's3' address '%s' self true",
+		nodes["s1"], nodes["s2"], nodes["s3"]), string(status), "status")
+}
+
+func TestClusterRebalanceRemovesMovedRecordsSilently(t *testing.T) {
+	// Arrange
+	listeners, nodes := listenShards(t, "s1", "s2")
+	shards := map[string]*testShard{"s1": startShard(t, "s1", listeners["s1"], map[string]string{"s1": nodes["s1"]})}
+	session := server.NewSession("test")
+	source := shards["s1"].engine
+	for i := 1; i <= 40; i++ {
+		source.messageHandler(session, fmt.Sprintf("NEW car:%d price %d", i, i))
+	}
+	source.messageHandler(session, "TRIGGER audit ON car AFTER DELETE RUN 'NEW log:$id deleted true'")
+	deletes := 0
+	source.RegisterHook("car", BeforeDelete, func(ctx *HookContext) error {
+		deletes++
+		return nil
+	})
+	_, seqBefore := source.changes.position()
+	shards["s2"] = startShard(t, "s2", listeners["s2"], map[string]string{"s2": nodes["s2"]})
+
+	// Act
+	moved := source.messageHandler(session, "CLUSTER ADD s2 "+nodes["s2"])
+
+	// Assert
+	_, seqAfter := source.changes.position()
+	testutil.AssertTrue(t, localCount(shards["s2"], "car") > 0, "s2 received records")
+	testutil.AssertEquals(t, fmt.Sprint(localCount(shards["s2"], "car")), string(moved), "moved")
+	testutil.AssertEquals(t, 0, deletes, "delete hooks")
+	testutil.AssertEquals(t, seqBefore, seqAfter, "change events")
+	testutil.AssertEquals(t, "", string(source.messageHandler(session, "GET log")), "trigger effects")
+}
+
+func movingIds(nodes map[string]string, node string, entity string, count int) (moving []uint, staying []uint) {
+	ring := sharding.NewRing(sharding.DefaultVirtualNodes)
+	ring.Set(nodes)
+	for id := uint(1); id <= uint(count); id++ {
+		if ring.Owner(recordKey(entity, id)) == node {
+			moving = append(moving, id)
+		} else {
+			staying = append(staying, id)
+		}
+	}
+	return moving, staying
+}
+
+func TestClusterRejectsWritesToMovingRecords(t *testing.T) {
+	// Arrange
+	listeners, nodes := listenShards(t, "s1", "s2")
+	source := startShard(t, "s1", listeners["s1"], map[string]string{"s1": nodes["s1"]}).engine
+	target := startShard(t, "s2", listeners["s2"], map[string]string{"s2": nodes["s2"]}).engine
+	session := server.NewSession("test")
+	peer := server.NewSession("peer")
+	peer.Set("peer", true)
+	for i := 1; i <= 40; i++ {
+		source.messageHandler(session, fmt.Sprintf("NEW car:%d price %d", i, i))
+	}
+	moving, staying := movingIds(nodes, "s2", "car", 40)
+	list := formatNodeAddresses(nodes)
+	source.prepareRebalance(list)
+	target.prepareRebalance(list)
+
+	// Act
+	movingWrite := source.messageHandler(session, fmt.Sprintf("UPD car:%d price 0", moving[0]))
+	stayingWrite := source.messageHandler(session, fmt.Sprintf("UPD car:%d price 0", staying[0]))
+	movingRead := source.messageHandler(session, fmt.Sprintf("GET car:%d", moving[0]))
+	copied, copyErr := source.copyMovingRecords()
+	countDuringCopy := source.messageHandler(session, "COUNT car")
+	source.commitRebalance(list)
+	staleForward := source.messageHandler(peer, fmt.Sprintf("UPD car:%d price 0", moving[0]))
+	target.commitRebalance(list)
+	committedWrite := source.messageHandler(session, fmt.Sprintf("UPD car:%d price 0", moving[0]))
+
+	// Assert
+	testutil.AssertEquals(t, fmt.Sprintf("ERR MOVED record car:%d is moving to node s2", moving[0]), string(movingWrite), "moving write")
+	testutil.AssertEquals(t, "1", string(stayingWrite), "staying write")
+	testutil.AssertEquals(t, fmt.Sprintf("id %d price %d", moving[0], moving[0]), string(movingRead), "moving read")
+	testutil.AssertNil(t, copyErr, "copy error")
+	testutil.AssertEquals(t, fmt.Sprint(len(moving)), string(copied), "copied")
+	testutil.AssertEquals(t, "count 40", string(countDuringCopy), "count during copy")
+	testutil.AssertEquals(t, fmt.Sprintf("ERR MOVED record car:%d is owned by node s2", moving[0]), string(staleForward), "stale forward")
+	testutil.AssertEquals(t, "1", string(committedWrite), "committed write")
+	testutil.AssertEquals(t, len(staying), localCount(&testShard{engine: source}, "car"), "source records")
+	testutil.AssertEquals(t, len(moving), localCount(&testShard{engine: target}, "car"), "target records")
+	testutil.AssertEquals(t, fmt.Sprintf("id %d price 0", moving[0]), string(target.messageHandler(session, fmt.Sprintf("GET car:%d", moving[0]))), "moved record")
+}
+
+func TestClusterRebalanceNeverOverwritesTargetRecords(t *testing.T) {
+	// Arrange
+	listeners, nodes := listenShards(t, "s1", "s2")
+	source := startShard(t, "s1", listeners["s1"], map[string]string{"s1": nodes["s1"]}).engine
+	target := startShard(t, "s2", listeners["s2"], map[string]string{"s2": nodes["s2"]}).engine
+	session := server.NewSession("test")
+	for i := 1; i <= 40; i++ {
+		source.messageHandler(session, fmt.Sprintf("NEW car:%d price %d", i, i))
+	}
+	moving, _ := movingIds(nodes, "s2", "car", 40)
+	taken := moving[len(moving)-1]
+	target.messageHandler(session, fmt.Sprintf("NEW car:%d price -1", taken))
+
+	// Act
+	response := source.messageHandler(session, "CLUSTER ADD s2 "+nodes["s2"])
+
+	// Assert
+	testutil.AssertEquals(t, fmt.Sprintf("ERR INTERNAL copying to node s2: record car:%d already exists", taken), string(response), "response")
+	testutil.AssertEquals(t, 40, localCount(&testShard{engine: source}, "car"), "source records")
+	testutil.AssertEquals(t, 1, localCount(&testShard{engine: target}, "car"), "target records")
+	testutil.AssertEquals(t, fmt.Sprintf("id %d price -1", taken), string(target.messageHandler(session, fmt.Sprintf("GET car:%d", taken))), "target record")
+	testutil.AssertTrue(t, source.cluster.pending.Load() == nil, "source pending ring")
+	testutil.AssertTrue(t, target.cluster.pending.Load() == nil, "target pending ring")
+	testutil.AssertEquals(t, "1", string(source.messageHandler(session, fmt.Sprintf("UPD car:%d price 0", moving[0]))), "write after abort")
+}
+
+func TestClusterRebalancesWhenNodeLeaves(t *testing.T) {
+	// Arrange
+	shards := startShards(t, "s1", "s2", "s3")
+	session := server.NewSession("test")
+	for i := 1; i <= 60; i++ {
+		shards["s1"].engine.messageHandler(session, fmt.Sprintf("NEW car:%d price %d", i, i))
+	}
+	leaving := localCount(shards["s2"], "car")
+
+	// Act
+	moved := shards["s1"].engine.messageHandler(session, "CLUSTER REMOVE s2")
+	missing := shards["s1"].engine.messageHandler(session, "CLUSTER REMOVE s9")
+
+	// Assert
+	testutil.AssertEquals(t, fmt.Sprint(leaving), string(moved), "moved")
+	testutil.AssertEquals(t, 0, localCount(shards["s2"], "car"), "s2 records")
+	testutil.AssertEquals(t, 60, localCount(shards["s1"], "car")+localCount(shards["s3"], "car"), "remaining records")
+	testutil.AssertEquals(t, "count 60", string(shards["s3"].engine.messageHandler(session, "COUNT car")), "count")
+	testutil.AssertEquals(t, "ERR NOT_FOUND node s9 not found", string(missing), "missing node")
+}
+
+func TestClusterBulkLoad(t *testing.T) {
+	// Arrange
+	shards := startShards(t, "s1", "s2", "s3")
+	session := server.NewSession("test")
+	coordinator := shards["s2"].engine
+	coordinator.messageHandler(session, "NEW car:3 name 'existing'")
+
+	// Act
+	coordinator.messageHandler(session, "IMPORT car JSONL ON CONFLICT SKIP")
+	for i := 1; i <= 40; i++ {
+		coordinator.messageHandler(session, fmt.Sprintf(`{"id":%d,"name":"car%d"}`, i, i))
+	}
+	report := coordinator.messageHandler(session, "END")
+
+	// Assert
+	testutil.AssertEquals(t, "inserted 39 skipped 1 failed 0", string(report), "report")
+	assertOwnedLocally(t, shards, "car")
+	testutil.AssertEquals(t, "count 40", string(shards["s1"].engine.messageHandler(session, "COUNT car")), "count")
+	testutil.AssertEquals(t, "id 3 name 'existing'", string(shards["s1"].engine.messageHandler(session, "GET car:3")), "skipped record")
+}
+
+func TestClusterNotEnabled(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+
+	// Act
+	response := e.messageHandler(server.NewSession("test"), "CLUSTER")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR INVALID_OPERATION cluster mode is not enabled", string(response), "response")
+}
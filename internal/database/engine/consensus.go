@@ -0,0 +1,174 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/raft"
+)
+
+const (
+	raftTickInterval  = 100 * time.Millisecond
+	raftCommitTimeout = 5 * time.Second
+)
+
+type raftCommand struct {
+	Format  string `json:"format"`
+	Command string `json:"command"`
+}
+
+type raftMachine struct {
+	e *Engine
+}
+
+func (m raftMachine) Apply(data []byte) []byte {
+	var command raftCommand
+	if err := json.Unmarshal(data, &command); err != nil {
+		return SerializeError(&InternalError{"invalid raft command"})
+	}
+	var serializer recordSerializer = textSerializer{}
+	if command.Format == "json" {
+		serializer = jsonSerializer{}
+	}
+	parsedCommand, err := parser.ParseCommand(command.Command)
+	if err != nil {
+		return serializer.serializeError(err)
+	}
+	return m.e.executeOperation(parsedCommand, serializer)
+}
+
+func (m raftMachine) Snapshot() ([]byte, error) {
+	return []byte(strings.Join(m.e.snapshotCommands(), "\n")), nil
+}
+
+func (m raftMachine) Restore(data []byte) error {
+	m.e.restoreSnapshot(strings.Split(string(data), "\n"))
+	return nil
+}
+
+func (e *Engine) startRaft() error {
+	members, err := parseNodeAddresses(e.config.RaftPeers)
+	if err != nil {
+		return err
+	}
+	address := e.config.RaftAddress
+	if address == "" {
+		address = members[e.config.RaftId]
+	}
+	_, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid raft address %q for %s", address, e.config.RaftId)
+	}
+
+	var store raft.Storage = raft.NewMemoryStorage()
+	if e.config.RaftDir != "" {
+		if store, err = raft.OpenFileStorage(e.config.RaftDir); err != nil {
+			return err
+		}
+	}
+	transport := raft.NewTCPTransport()
+	node, err := raft.NewNode(raft.Config{Id: e.config.RaftId, Members: members}, store, raftMachine{e}, transport)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return err
+	}
+	e.raft = node
+	e.raftTransport = transport
+	e.logger.Info("raft node started", "id", e.config.RaftId, "address", address)
+	go transport.Serve(listener, node)
+	go node.Run(raftTickInterval, e.done)
+	return nil
+}
+
+func (e *Engine) executeConsensusOperation(command string, serializer recordSerializer) []byte {
+	format := "text"
+	if _, ok := serializer.(jsonSerializer); ok {
+		format = "json"
+	}
+	data, _ := json.Marshal(raftCommand{Format: format, Command: command})
+	result, err := e.raft.Propose(data)
+	if err != nil {
+		return serializer.serializeError(consensusError(err))
+	}
+	response, err := e.awaitConsensus(result)
+	if err != nil {
+		return serializer.serializeError(err)
+	}
+	return response
+}
+
+func (e *Engine) awaitConsensus(result <-chan raft.Result) ([]byte, error) {
+	select {
+	case committed := <-result:
+		if committed.Err != nil {
+			return nil, consensusError(committed.Err)
+		}
+		return committed.Response, nil
+	case <-time.After(raftCommitTimeout):
+		return nil, &InternalError{"timed out waiting for a majority to commit"}
+	case <-e.done:
+		return nil, &InternalError{"engine closed"}
+	}
+}
+
+func consensusError(err error) error {
+	var notLeader *raft.NotLeaderError
+	var membershipErr *raft.MembershipError
+	switch {
+	case errors.As(err, &notLeader):
+		return &NotLeaderError{err.Error()}
+	case errors.As(err, &membershipErr):
+		return &InvalidArgumentError{err.Error()}
+	case errors.Is(err, raft.ErrConfigChangeInProgress):
+		return &ConflictError{err.Error()}
+	default:
+		return &InternalError{err.Error()}
+	}
+}
+
+func (e *Engine) raftInfo(parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	if e.raft == nil {
+		return nil, &InvalidOperationError{"raft consensus is not enabled"}
+	}
+	if len(parsedCommand.Args) == 0 {
+		status := e.raft.Status()
+		ids := make([]string, 0, len(status.Members))
+		for id := range status.Members {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		members := make([]string, len(ids))
+		for i, id := range ids {
+			members[i] = id + "=" + status.Members[id]
+		}
+		return serializer.serializeRow(
+			[]string{"id", "state", "term", "leader", "commit", "applied", "snapshot", "members"},
+			[]interface{}{status.Id, status.State.String(), int64(status.Term), status.Leader,
+				int64(status.Commit), int64(status.Applied), int64(status.SnapshotIndex), strings.Join(members, ",")},
+		)
+	}
+
+	var result <-chan raft.Result
+	var err error
+	if parsedCommand.Args[0] == "ADD" {
+		result, err = e.raft.AddMember(parsedCommand.Args[1], parsedCommand.Args[2])
+	} else {
+		result, err = e.raft.RemoveMember(parsedCommand.Args[1])
+	}
+	if err != nil {
+		return nil, consensusError(err)
+	}
+	if _, err := e.awaitConsensus(result); err != nil {
+		return nil, err
+	}
+	return []byte("1"), nil
+}
@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/raft"
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func startRaftCluster(t *testing.T, ids ...string) (*raft.Network, map[string]*Engine) {
+	network := raft.NewNetwork()
+	members := make(map[string]string)
+	for _, id := range ids {
+		members[id] = id + ":7200"
+	}
+	engines := make(map[string]*Engine)
+	for _, id := range ids {
+		engines[id] = startRaftEngine(t, network, id, members)
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				network.Run(1)
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+		<-stopped
+		for _, e := range engines {
+			e.Close()
+		}
+	})
+	return network, engines
+}
+
+func startRaftEngine(t *testing.T, network *raft.Network, id string, members map[string]string) *Engine {
+	e := New(DefaultConfig())
+	node, err := raft.NewNode(raft.Config{Id: id, Members: members}, raft.NewMemoryStorage(), raftMachine{e}, network)
+	if err != nil {
+		t.Fatalf("Error creating raft node: %v", err)
+	}
+	e.raft = node
+	network.Add(node)
+	return e
+}
+
+func waitForRaftLeader(t *testing.T, engines map[string]*Engine) *Engine {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, e := range engines {
+			if e.raft.Status().State == raft.Leader {
+				return e
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("no raft leader elected")
+	return nil
+}
+
+func waitForRaftApplied(t *testing.T, leader *Engine, engines map[string]*Engine) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		caughtUp := true
+		for _, e := range engines {
+			caughtUp = caughtUp && e.raft.Status().Applied >= leader.raft.Status().Commit
+		}
+		if caughtUp {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("raft followers did not apply committed entries")
+}
+
+func TestRaftReplicatesWrites(t *testing.T) {
+	// Arrange
+	_, engines := startRaftCluster(t, "n1", "n2", "n3")
+	leader := waitForRaftLeader(t, engines)
+	session := server.NewSession("test")
+
+	// Act
+	responses := []string{
+		string(leader.messageHandler(session, "SCHEMA car name:string year:int?")),
+		string(leader.messageHandler(session, "NEW car:1 name 'bmw' year 2020")),
+		string(leader.messageHandler(session, "NEW car:2 name 'audi'")),
+		string(leader.messageHandler(session, "UPD car:1 year 2021")),
+		string(leader.messageHandler(session, "DEL car:2")),
+	}
+	waitForRaftApplied(t, leader, engines)
+
+	// Assert
+	for _, response := range responses {
+		testutil.AssertEquals(t, "1", response, "response")
+	}
+	for id, e := range engines {
+		testutil.AssertEquals(t, "id 1 name 'bmw' year 2021", string(e.messageHandler(session, "GET car")), id+" records")
+		testutil.AssertEquals(t, "name 'string' year 'int?'", string(e.messageHandler(session, "SCHEMA car")), id+" schema")
+	}
+}
+
+func TestRaftReturnsCommandErrors(t *testing.T) {
+	// Arrange
+	_, engines := startRaftCluster(t, "n1", "n2", "n3")
+	leader := waitForRaftLeader(t, engines)
+	session := server.NewSession("test")
+	leader.messageHandler(session, "NEW car:1 name 'bmw'")
+
+	// Act
+	conflict := leader.messageHandler(session, "NEW car:1 name 'audi'")
+	leader.messageHandler(session, "FORMAT json")
+	jsonResponse := leader.messageHandler(session, "INCR car:1 name")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR CONFLICT record car:1 already exists", string(conflict), "conflict")
+	testutil.AssertContains(t, string(jsonResponse), `"code":"INVALID_DATA"`)
+}
+
+func TestRaftFollowerRejectsWrites(t *testing.T) {
+	// Arrange
+	_, engines := startRaftCluster(t, "n1", "n2", "n3")
+	leader := waitForRaftLeader(t, engines)
+	var follower *Engine
+	for _, e := range engines {
+		if e != leader {
+			follower = e
+		}
+	}
+	session := server.NewSession("test")
+	leader.messageHandler(session, "NEW car:1 name 'bmw'")
+	waitForRaftApplied(t, leader, engines)
+
+	// Act
+	write := follower.messageHandler(session, "NEW car:2 name 'audi'")
+	bulk := leader.messageHandler(session, "BULK car")
+	read := follower.messageHandler(session, "GET car")
+
+	// Assert
+	testutil.AssertContains(t, string(write), "ERR NOT_LEADER not the leader, current leader is "+leader.raft.Status().Id)
+	testutil.AssertEquals(t, "ERR INVALID_OPERATION bulk loads are not supported with raft consensus", string(bulk), "bulk")
+	testutil.AssertEquals(t, "id 1 name 'bmw'", string(read), "read")
+}
+
+func TestRaftMembership(t *testing.T) {
+	// Arrange
+	network, engines := startRaftCluster(t, "n1", "n2", "n3")
+	leader := waitForRaftLeader(t, engines)
+	session := server.NewSession("test")
+	leader.messageHandler(session, "NEW car:1 name 'bmw'")
+	joining := startRaftEngine(t, network, "n4", nil)
+	defer joining.Close()
+
+	// Act
+	added := leader.messageHandler(session, "RAFT ADD n4 n4:7200")
+	duplicated := leader.messageHandler(session, "RAFT ADD n4 n4:7200")
+	leader.messageHandler(session, "NEW car:2 name 'audi'")
+	waitForRaftApplied(t, leader, map[string]*Engine{"n4": joining})
+	status := string(joining.messageHandler(session, "RAFT"))
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(added), "added")
+	testutil.AssertEquals(t, "ERR INVALID_ARGUMENT member n4 already exists", string(duplicated), "duplicated")
+	testutil.AssertEquals(t, "id 1 name 'bmw'\nid 2 name 'audi'", string(joining.messageHandler(session, "GET car")), "joined records")
+	testutil.AssertContains(t, status, "id 'n4' state 'follower'")
+	testutil.AssertContains(t, status, "members 'n1=n1:7200,n2=n2:7200,n3=n3:7200,n4=n4:7200'")
+}
+
+func TestRaftMachineSnapshot(t *testing.T) {
+	// Arrange
+	source := New(DefaultConfig())
+	session := server.NewSession("test")
+	source.messageHandler(session, "SCHEMA car name:string tags:list?")
+	source.messageHandler(session, "NEW car:1 name 'bmw' tags ['a']")
+	source.messageHandler(session, "NEW user:7 name 'ana'")
+	target := New(DefaultConfig())
+	target.messageHandler(session, "NEW stale:1 name 'old'")
+
+	// Act
+	data, err := raftMachine{source}.Snapshot()
+	restoreErr := raftMachine{target}.Restore(data)
+
+	// Assert
+	testutil.AssertNil(t, err, "snapshot error")
+	testutil.AssertNil(t, restoreErr, "restore error")
+	testutil.AssertEquals(t, string(source.messageHandler(session, "ENTITIES")), string(target.messageHandler(session, "ENTITIES")), "entities")
+	testutil.AssertEquals(t, "id 1 name 'bmw' tags ['a']", string(target.messageHandler(session, "GET car")), "records")
+	testutil.AssertEquals(t, "name 'string' tags 'list?'", string(target.messageHandler(session, "SCHEMA car")), "schema")
+}
+
+func TestRaftNotEnabled(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+
+	// Act
+	response := e.messageHandler(server.NewSession("test"), "RAFT")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR INVALID_OPERATION raft consensus is not enabled", string(response), "response")
+}
@@ -1,141 +1,604 @@
 package engine
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/raft"
 	"github.com/gabrielluciano/liondb/internal/database/server"
 	"github.com/gabrielluciano/liondb/internal/database/storage"
 )
 
-var storages map[string]*storage.Storage
+type Config struct {
+	Port               string
+	StrictEntities     bool
+	ReplicationPort    string
+	ReplicationBacklog int
+	ReplicaOf          string
+	RaftId             string
+	RaftAddress        string
+	RaftPeers          string
+	RaftDir            string
+	ShardId            string
+	ShardNodes         string
+	ChangeBacklog      int
+	PubSubBuffer       int
+	HTTPPort           string
+	Logger             *slog.Logger
+	LogCommands        bool
+	SlowLogThreshold   time.Duration
+	SlowLogSize        int
+	TraceFile          string
+}
+
+type Engine struct {
+	config    Config
+	mu        sync.RWMutex
+	storages  map[string]*storage.Storage
+	schemas   map[string]*Schema
+	schemaMu  sync.RWMutex
+	writeMu   sync.Mutex
+	log       *replicationLog
+	replica   *replicaState
+	followers atomic.Int64
+	changes   *changeFeed
+	hooks     *hookSet
+	pubsub    *server.PubSub
+	server    *server.Server
+	metrics   *engineMetrics
+	logger    *slog.Logger
+	slowLog   *slowLog
+	tracer    *spanExporter
+	startedAt time.Time
+	loading   atomic.Bool
+	done      chan struct{}
+	closeOnce sync.Once
+	closeMu   sync.Mutex
+	listeners []net.Listener
 
-func Start() {
-	initializeStorage()
-	initializeServer()
+	raft          *raft.Node
+	raftTransport *raft.TCPTransport
+	cluster       *clusterState
 }
 
-func initializeStorage() {
-	storages = make(map[string]*storage.Storage)
+func DefaultConfig() Config {
+	return Config{Port: "7123"}
 }
 
-func initializeServer() {
-	server := server.New("7123")
-	server.SetMessageHandler(messageHandler)
-	server.Listen()
+func New(config Config) *Engine {
+	e := &Engine{
+		config:    config,
+		storages:  make(map[string]*storage.Storage),
+		schemas:   make(map[string]*Schema),
+		changes:   newChangeFeed(config.ChangeBacklog),
+		hooks:     newHookSet(),
+		done:      make(chan struct{}),
+		startedAt: time.Now(),
+	}
+	e.metrics = e.newMetrics()
+	e.slowLog = newSlowLog(config.SlowLogThreshold, config.SlowLogSize)
+	e.logger = config.Logger
+	if e.logger == nil {
+		e.logger = slog.Default()
+	}
+	if config.ReplicationPort != "" {
+		e.log = newReplicationLog(config.ReplicationBacklog)
+	}
+	if config.ReplicaOf != "" {
+		e.replica = &replicaState{primary: config.ReplicaOf}
+	}
+	return e
 }
 
-func messageHandler(command string) []byte {
+func (e *Engine) Start() {
+	e.loading.Store(true)
+	e.server = server.New(e.config.Port)
+	e.server.SetPubSubBuffer(e.config.PubSubBuffer)
+	e.server.SetMessageHandler(e.serveMessage)
+	e.server.SetLogger(e.logger)
+	e.server.SetCommandLogging(e.config.LogCommands)
+	e.pubsub = e.server.PubSub()
+	if e.config.HTTPPort != "" {
+		listener, err := net.Listen("tcp", ":"+e.config.HTTPPort)
+		if err != nil {
+			panic(err)
+		}
+		e.logger.Info("http endpoints started", "port", e.config.HTTPPort)
+		go e.ServeMonitoring(listener)
+	}
+	if e.log != nil {
+		listener, err := net.Listen("tcp", ":"+e.config.ReplicationPort)
+		if err != nil {
+			panic(err)
+		}
+		e.logger.Info("replication started", "port", e.config.ReplicationPort)
+		go e.ServeReplication(listener)
+	}
+	if e.replica != nil {
+		go e.FollowPrimary()
+	}
+	if e.config.RaftId != "" {
+		if err := e.startRaft(); err != nil {
+			panic(err)
+		}
+	}
+	if e.config.ShardId != "" {
+		nodes, err := parseNodeAddresses(e.config.ShardNodes)
+		if err != nil {
+			panic(err)
+		}
+		e.cluster = newClusterState(e.config.ShardId, nodes)
+	}
+	if e.config.TraceFile != "" {
+		tracer, err := openSpanExporter(e.config.TraceFile)
+		if err != nil {
+			panic(err)
+		}
+		e.tracer = tracer
+	}
+	e.loading.Store(false)
+	e.server.Listen()
+}
+
+func (e *Engine) serveMessage(session *server.Session, command string) []byte {
+	peer := isPeerSession(session)
+	response := e.messageHandler(session, command)
+	if peer || isPeerSession(session) {
+		return frameResponse(response)
+	}
+	return response
+}
+
+func (e *Engine) messageHandler(session *server.Session, command string) (response []byte) {
+	if load, ok := session.Get("bulk").(*bulkLoad); ok {
+		return e.handleBulkLine(session, load, command)
+	}
+
+	serializer := sessionSerializer(session)
 	parsedCommand, err := parser.ParseCommand(command)
 	if err != nil {
-		return []byte(fmt.Sprintf("Error processing command: %v", err))
+		e.metrics.parseErrors.Inc()
+		return serializer.serializeError(err)
 	}
+	start := time.Now()
+	scanned := e.scannedRecords(parsedCommand.Entity)
+	defer func() {
+		e.observeCommand(session, command, parsedCommand, start, scanned, response)
+	}()
 
-	_, ok := storages[parsedCommand.Entity]
-	if !ok {
-		storages[parsedCommand.Entity] = storage.New(parsedCommand.Entity)
+	if parsedCommand.Operation == "UNSUBSCRIBE" && len(parsedCommand.Args) == 0 {
+		return e.unsubscribe(session)
+	}
+	if e.activeSubscription(session) != nil {
+		return serializer.serializeError(&InvalidOperationError{"connection is streaming changes, send UNSUBSCRIBE first"})
 	}
-	return executeOperation(parsedCommand)
+	if parsedCommand.Operation == "FORMAT" {
+		session.Set("format", parsedCommand.Args[0])
+		return []byte("1")
+	}
+	if isChannelCommand(parsedCommand) {
+		response, err := e.channelCommand(session, parsedCommand, serializer)
+		if err != nil {
+			return serializer.serializeError(err)
+		}
+		return response
+	}
+	if parsedCommand.Operation == "SUBSCRIBE" {
+		response, err := e.subscribe(session, parsedCommand, serializer)
+		if err != nil {
+			return serializer.serializeError(err)
+		}
+		return response
+	}
+	if parsedCommand.Operation == "CLUSTER" {
+		response, err := e.clusterCommand(session, parsedCommand, serializer)
+		if err != nil {
+			return serializer.serializeError(err)
+		}
+		return response
+	}
+	if e.replica != nil && isWriteOperation(parsedCommand) {
+		return serializer.serializeError(&ReadOnlyError{"replica is read-only"})
+	}
+	if e.cluster != nil && isTransferSession(session) {
+		response, err := e.adoptRecord(parsedCommand)
+		if err != nil {
+			return serializer.serializeError(err)
+		}
+		return response
+	}
+	if e.cluster != nil && isPartialSession(session) {
+		response, err := e.partialOperation(parsedCommand)
+		if err != nil {
+			return serializer.serializeError(err)
+		}
+		return response
+	}
+	if e.cluster != nil && routesToOwner(parsedCommand) {
+		release, err := e.cluster.admit(session, parsedCommand)
+		if err != nil {
+			return serializer.serializeError(err)
+		}
+		defer release()
+	}
+	if e.cluster != nil && !isPeerSession(session) {
+		if response, routed := e.routeCommand(command, parsedCommand, serializer); routed {
+			return response
+		}
+	}
+	if e.raft != nil && isWriteOperation(parsedCommand) {
+		if parsedCommand.Operation == "BULK" || parsedCommand.Operation == "IMPORT" {
+			return serializer.serializeError(&InvalidOperationError{"bulk loads are not supported with raft consensus"})
+		}
+		return e.executeConsensusOperation(command, serializer)
+	}
+	if parsedCommand.Operation == "BULK" || parsedCommand.Operation == "IMPORT" {
+		response, err := e.startBulkLoad(session, parsedCommand)
+		if err != nil {
+			return serializer.serializeError(err)
+		}
+		return response
+	}
+
+	if parsedCommand.Operation == "EXPORT" {
+		return e.streamExport(session, parsedCommand, serializer)
+	}
+
+	if e.log != nil && isWriteOperation(parsedCommand) {
+		return e.executeReplicatedOperation(command, parsedCommand, serializer)
+	}
+	return e.executeOperation(parsedCommand, serializer)
 }
 
-func executeOperation(parsedCommand *parser.ParsedCommand) []byte {
+// observeCommand feeds a finished command into the metrics, the slow log and,
+// when enabled, the trace file.
+func (e *Engine) observeCommand(session *server.Session, command string, parsedCommand *parser.ParsedCommand, start time.Time, scannedBefore uint64, response []byte) {
+	end := time.Now()
+	duration := end.Sub(start)
+	e.metrics.observe(parsedCommand.Operation, duration)
+	scanned := uint64(0)
+	if scannedAfter := e.scannedRecords(parsedCommand.Entity); scannedAfter > scannedBefore {
+		scanned = scannedAfter - scannedBefore
+	}
+	e.slowLog.record(slowLogEntry{
+		start:    start,
+		duration: duration,
+		command:  command,
+		entity:   parsedCommand.Entity,
+		scanned:  scanned,
+		client:   session.RemoteAddr,
+	})
+	if e.tracer == nil {
+		return
+	}
+	span := commandSpan{
+		operation: parsedCommand.Operation,
+		command:   command,
+		entity:    parsedCommand.Entity,
+		client:    session.RemoteAddr,
+		scanned:   scanned,
+		start:     start,
+		end:       end,
+	}
+	if isErrorResponse(response) {
+		span.err = string(response)
+	}
+	if err := e.tracer.export(span); err != nil {
+		e.logger.Warn("error exporting span", "error", err)
+	}
+}
+
+// scannedRecords returns how many records have been visited in the entity's
+// storage. Commands running concurrently on the same entity add to the same
+// counter, so the difference around a command is an upper bound.
+func (e *Engine) scannedRecords(entity string) uint64 {
+	e.mu.RLock()
+	s, found := e.storages[entity]
+	e.mu.RUnlock()
+	if !found {
+		return 0
+	}
+	return s.Scanned()
+}
+
+func isErrorResponse(response []byte) bool {
+	return bytes.HasPrefix(response, []byte("ERR ")) || bytes.HasPrefix(response, []byte(`{"error":`))
+}
+
+func sessionSerializer(session *server.Session) recordSerializer {
+	if session.Get("format") == "json" {
+		return jsonSerializer{}
+	}
+	return textSerializer{}
+}
+
+func (e *Engine) executeOperation(parsedCommand *parser.ParsedCommand, serializer recordSerializer) []byte {
+	response, err := e.dispatchOperation(parsedCommand, serializer)
+	if err != nil {
+		return serializer.serializeError(err)
+	}
+	return response
+}
+
+func (e *Engine) dispatchOperation(parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	if !hookedOperations[parsedCommand.Operation] {
+		return e.dispatchCommand(parsedCommand, serializer)
+	}
+	var response []byte
+	var err error
+	e.withHooks(parsedCommand.Entity, []uint{parsedCommand.Id.Lower}, func() {
+		response, err = e.dispatchCommand(parsedCommand, serializer)
+	})
+	return response, err
+}
+
+func (e *Engine) dispatchCommand(parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	if schemaCheckedOperations[parsedCommand.Operation] {
+		e.schemaMu.RLock()
+		defer e.schemaMu.RUnlock()
+	}
 	switch parsedCommand.Operation {
 	case "NEW":
-		return insertRecord(parsedCommand)
+		return e.insertRecord(parsedCommand)
 	case "UPD":
-		return updateRecord(parsedCommand)
+		return e.updateRecord(parsedCommand)
+	case "SET":
+		return e.replaceRecord(parsedCommand)
+	case "UNSET":
+		return e.unsetAttributes(parsedCommand)
+	case "UPSERT":
+		return e.upsertRecord(parsedCommand)
+	case "INCR", "DECR", "APPEND":
+		return e.modifyAttribute(parsedCommand, serializer)
 	case "GET":
-		return getRecords(parsedCommand)
+		return e.getRecords(parsedCommand, serializer)
 	case "DEL":
-		return deleteRecord(parsedCommand)
+		return e.deleteRecord(parsedCommand)
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		return e.aggregateRecords(parsedCommand, serializer)
+	case "ENTITIES":
+		return e.listEntities(serializer)
+	case "DROP":
+		return e.dropEntity(parsedCommand)
+	case "RENAME":
+		return e.renameEntity(parsedCommand)
+	case "STATS":
+		return e.entityStats(parsedCommand, serializer)
+	case "SCHEMA":
+		return e.defineSchema(parsedCommand, serializer)
+	case "TRIGGER":
+		return e.triggerCommand(parsedCommand, serializer)
+	case "SLOWLOG":
+		return e.slowlogCommand(parsedCommand, serializer)
+	case "PING":
+		return ping(parsedCommand)
+	case "INFO":
+		return e.info(serializer)
+	case "EXPORT":
+		return e.exportBuffered(parsedCommand)
+	case "REPLICATION":
+		return e.replicationInfo(serializer)
+	case "RAFT":
+		return e.raftInfo(parsedCommand, serializer)
 	default:
-		return []byte("Error processing command: invalid operation")
+		return nil, &InvalidOperationError{fmt.Sprintf("invalid operation %s", parsedCommand.Operation)}
 	}
 }
 
-func insertRecord(parsedCommand *parser.ParsedCommand) []byte {
-	s := storages[parsedCommand.Entity]
+func (e *Engine) insertRecord(parsedCommand *parser.ParsedCommand) ([]byte, error) {
 	if parsedCommand.Id.Lower != parsedCommand.Id.Upper || parsedCommand.Id.Lower == uint(0) {
-		return []byte("Error processing command: invalid id")
+		return nil, &InvalidIdError{"invalid id"}
+	}
+	s, err := e.getStorage(parsedCommand.Entity, true)
+	if err != nil {
+		return nil, err
+	}
+	data, err := expandPaths(parsedCommand.Data)
+	if err != nil {
+		return nil, err
 	}
-	inserted := s.InsertRecord(&storage.Record{
+	if schema := e.getSchema(parsedCommand.Entity); schema != nil {
+		if err := schema.ValidateRecord(*data); err != nil {
+			return nil, err
+		}
+	}
+	inserted, err := s.InsertRecord(&storage.Record{
 		Id:   parsedCommand.Id.Lower,
-		Data: parsedCommand.Data,
+		Data: data,
 	})
+	if err != nil {
+		return nil, err
+	}
 	if !inserted {
-		return []byte("0")
+		return nil, &ConflictError{fmt.Sprintf("record %s:%d already exists", parsedCommand.Entity, parsedCommand.Id.Lower)}
 	}
-	return []byte("1")
+	return []byte("1"), nil
 }
 
-func updateRecord(parsedCommand *parser.ParsedCommand) []byte {
-	s := storages[parsedCommand.Entity]
+func (e *Engine) updateRecord(parsedCommand *parser.ParsedCommand) ([]byte, error) {
 	if parsedCommand.Id.Lower != parsedCommand.Id.Upper || parsedCommand.Id.Lower == uint(0) {
-		return []byte("Error processing command: invalid id")
+		return nil, &InvalidIdError{"invalid id"}
 	}
-	updated := s.UpdateRecord(&storage.Record{
+	s, err := e.getStorage(parsedCommand.Entity, false)
+	if err != nil {
+		return nil, err
+	}
+	data := parsedCommand.Data
+	if schema := e.getSchema(parsedCommand.Entity); schema != nil && data != nil {
+		validated := data.Clone()
+		if err := schema.ValidateUpdate(validated); err != nil {
+			return nil, err
+		}
+		data = &validated
+	}
+	updated, err := s.UpdateRecord(&storage.Record{
 		Id:   parsedCommand.Id.Lower,
-		Data: parsedCommand.Data,
+		Data: data,
 	})
+	var rejected *storage.RejectedError
+	if errors.As(err, &rejected) || errors.Is(err, storage.ErrDropped) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, &InvalidDataError{err.Error()}
+	}
 	if !updated {
-		return []byte("0")
+		return nil, recordNotFound(parsedCommand.Entity, parsedCommand.Id.Lower)
 	}
-	return []byte("1")
+	return []byte("1"), nil
 }
 
-func getRecords(parsedCommand *parser.ParsedCommand) []byte {
-	s := storages[parsedCommand.Entity]
-	if parsedCommand.Id.Lower == 0 && parsedCommand.Id.Upper == 0 {
-		return getAllRecords(s)
+func (e *Engine) replaceRecord(parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	if parsedCommand.Id.Lower != parsedCommand.Id.Upper || parsedCommand.Id.Lower == uint(0) {
+		return nil, &InvalidIdError{"invalid id"}
+	}
+	s, err := e.getStorage(parsedCommand.Entity, false)
+	if err != nil {
+		return nil, err
+	}
+	data, err := expandPaths(parsedCommand.Data)
+	if err != nil {
+		return nil, err
+	}
+	if schema := e.getSchema(parsedCommand.Entity); schema != nil {
+		if err := schema.ValidateRecord(*data); err != nil {
+			return nil, err
+		}
+	}
+	replaced, err := s.ReplaceRecord(&storage.Record{
+		Id:   parsedCommand.Id.Lower,
+		Data: data,
+	})
+	if err != nil {
+		return nil, err
 	}
-	if parsedCommand.Id.Lower == parsedCommand.Id.Upper {
-		return getSingleRecord(parsedCommand.Id.Lower, s)
+	if !replaced {
+		return nil, recordNotFound(parsedCommand.Entity, parsedCommand.Id.Lower)
 	}
-	return []byte("Internal error")
+	return []byte("1"), nil
 }
 
-func getSingleRecord(id uint, s *storage.Storage) []byte {
-	record, found := s.GetRecord(id)
+func (e *Engine) unsetAttributes(parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	if parsedCommand.Id.Lower != parsedCommand.Id.Upper || parsedCommand.Id.Lower == uint(0) {
+		return nil, &InvalidIdError{"invalid id"}
+	}
+	s, err := e.getStorage(parsedCommand.Entity, false)
+	if err != nil {
+		return nil, err
+	}
+	if schema := e.getSchema(parsedCommand.Entity); schema != nil {
+		if err := schema.ValidateUnset(parsedCommand.Fields); err != nil {
+			return nil, err
+		}
+	}
+	removed, found, err := s.UnsetAttributes(parsedCommand.Id.Lower, parsedCommand.Fields)
+	if err != nil {
+		return nil, err
+	}
 	if !found {
-		return []byte("0")
+		return nil, recordNotFound(parsedCommand.Entity, parsedCommand.Id.Lower)
 	}
+	return []byte(strconv.Itoa(removed)), nil
+}
 
-	response, err := SerializeRecord(record)
-	if err != nil {
-		return []byte(err.Error())
+func (e *Engine) upsertRecord(parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	if parsedCommand.Id.Lower != parsedCommand.Id.Upper || parsedCommand.Id.Lower == uint(0) {
+		return nil, &InvalidIdError{"invalid id"}
 	}
-	return response
+	if _, err := e.getStorage(parsedCommand.Entity, true); err != nil {
+		return nil, err
+	}
+	response, err := e.updateRecord(parsedCommand)
+	if ErrorCode(err) != ErrCodeNotFound {
+		return response, err
+	}
+	response, err = e.insertRecord(parsedCommand)
+	if ErrorCode(err) == ErrCodeConflict {
+		return e.updateRecord(parsedCommand)
+	}
+	return response, err
 }
 
-func getAllRecords(s *storage.Storage) []byte {
-	records := s.GetAllRecords(false)
-	if len(records) == 0 {
-		return []byte("0")
+func (e *Engine) getRecords(parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	s, err := e.getStorage(parsedCommand.Entity, false)
+	if err != nil {
+		return nil, err
 	}
-	response := make([]byte, 0)
-	for _, record := range records {
-		serialized, err := SerializeRecord(record)
-		if err != nil {
-			return []byte("Error deserializing data")
-		}
-		response = append(response, serialized...)
-		response = append(response, '\n')
+	id := parsedCommand.Id
+	if id.Lower != 0 && id.Lower == id.Upper {
+		return getSingleRecord(parsedCommand, s, serializer)
+	}
+	if id.Upper != 0 && id.Lower > id.Upper {
+		return nil, &InvalidIdError{"invalid id range"}
 	}
-	return response[:len(response)-1]
+	records, cursor, err := selectRecords(parsedCommand, s, e.recordMatcher(parsedCommand))
+	if err != nil {
+		return nil, err
+	}
+	records = projectRecords(records, parsedCommand.Fields)
+	if parsedCommand.Limit > 0 || parsedCommand.Offset > 0 || parsedCommand.Cursor != "" || cursor != "" {
+		return serializer.serializePage(records, cursor)
+	}
+	return serializer.serializeRecords(records)
+}
+
+func getSingleRecord(parsedCommand *parser.ParsedCommand, s *storage.Storage, serializer recordSerializer) ([]byte, error) {
+	record, found := s.GetRecord(parsedCommand.Id.Lower)
+	if !found {
+		return nil, recordNotFound(s.Name(), parsedCommand.Id.Lower)
+	}
+
+	return serializer.serializeRecord(projectRecord(record, parsedCommand.Fields))
 }
 
-func deleteRecord(parsedCommand *parser.ParsedCommand) []byte {
+func (e *Engine) deleteRecord(parsedCommand *parser.ParsedCommand) ([]byte, error) {
 	if parsedCommand.Id.Lower == 0 && parsedCommand.Id.Upper == 0 {
-		return []byte("Error processing command: invalid id")
+		return nil, &InvalidIdError{"invalid id"}
 	}
 	if parsedCommand.Id.Lower != parsedCommand.Id.Upper {
-		return []byte("Error processing command: invalid id")
+		return nil, &InvalidIdError{"invalid id"}
+	}
+	s, err := e.getStorage(parsedCommand.Entity, false)
+	if err != nil {
+		return nil, err
+	}
+	_, deleted, err := s.DeleteRecord(parsedCommand.Id.Lower)
+	if err != nil {
+		return nil, err
 	}
-	s := storages[parsedCommand.Entity]
-	_, deleted := s.DeleteRecord(parsedCommand.Id.Lower)
 	if !deleted {
-		return []byte("0")
+		return nil, recordNotFound(parsedCommand.Entity, parsedCommand.Id.Lower)
 	}
 
-	return []byte("1")
+	return []byte("1"), nil
+}
+
+// expandPaths nests top-level dot path keys, whichever syntax the data came
+// in: the JSON body {"engine.hp": 300} is stored as {engine {hp 300}}, just
+// like the token engine.hp 300. Records are replayed as text commands by
+// snapshots, replication and shard transfers, so a literal top-level dotted
+// key could not survive them anyway. Keys of nested objects are kept as is.
+func expandPaths(data *storage.Data) (*storage.Data, error) {
+	expanded := &storage.Data{}
+	if data == nil {
+		return expanded, nil
+	}
+	for path, value := range *data {
+		if err := expanded.SetPath(path, value); err != nil {
+			return nil, &InvalidDataError{err.Error()}
+		}
+	}
+	return expanded, nil
+}
+
+func recordNotFound(entity string, id uint) error {
+	return &NotFoundError{fmt.Sprintf("record %s:%d not found", entity, id)}
 }
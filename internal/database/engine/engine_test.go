@@ -1,17 +1,20 @@
 package engine
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/server"
 	"github.com/gabrielluciano/liondb/internal/database/storage"
 	"github.com/gabrielluciano/liondb/internal/testutil"
 )
 
 func TestInsertRecord(t *testing.T) {
 	// Arrange
-	initializeStorage()
-	storages["car"] = storage.New("car")
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
 	parsedCommand := &parser.ParsedCommand{
 		Operation: "NEW",
 		Entity:    "car",
@@ -22,7 +25,7 @@ func TestInsertRecord(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(parsedCommand)
+	result := e.executeOperation(parsedCommand, textSerializer{})
 
 	// Assert
 	testutil.AssertEquals(t, "1", string(result), "result")
@@ -30,8 +33,8 @@ func TestInsertRecord(t *testing.T) {
 
 func TestInsertRecordDuplicated(t *testing.T) {
 	// Arrange
-	initializeStorage()
-	storages["car"] = storage.New("car")
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
 	parsedCommand := &parser.ParsedCommand{
 		Operation: "NEW",
 		Entity:    "car",
@@ -40,19 +43,19 @@ func TestInsertRecordDuplicated(t *testing.T) {
 			"name": "bmw",
 		},
 	}
-	executeOperation(parsedCommand)
+	e.executeOperation(parsedCommand, textSerializer{})
 
 	// Act
-	result := executeOperation(parsedCommand)
+	result := e.executeOperation(parsedCommand, textSerializer{})
 
 	// Assert
-	testutil.AssertEquals(t, "0", string(result), "result")
+	testutil.AssertEquals(t, "ERR CONFLICT record car:1 already exists", string(result), "result")
 }
 
 func TestInsertRecordInvalidId(t *testing.T) {
 	// Arrange
-	initializeStorage()
-	storages["car"] = storage.New("car")
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
 	parsedCommand := &parser.ParsedCommand{
 		Operation: "NEW",
 		Entity:    "car",
@@ -63,16 +66,16 @@ func TestInsertRecordInvalidId(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(parsedCommand)
+	result := e.executeOperation(parsedCommand, textSerializer{})
 
 	// Assert
-	testutil.AssertContains(t, string(result), "invalid id")
+	testutil.AssertContains(t, string(result), "ERR INVALID_ID invalid id")
 }
 
 func TestUpdateRecord(t *testing.T) {
 	// Arrange
-	initializeStorage()
-	storages["car"] = storage.New("car")
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
 	parsedCommand := &parser.ParsedCommand{
 		Operation: "NEW",
 		Entity:    "car",
@@ -81,7 +84,7 @@ func TestUpdateRecord(t *testing.T) {
 			"name": "bmw",
 		},
 	}
-	executeOperation(parsedCommand)
+	e.executeOperation(parsedCommand, textSerializer{})
 
 	updateParsedCommand := &parser.ParsedCommand{
 		Operation: "UPD",
@@ -93,16 +96,47 @@ func TestUpdateRecord(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(updateParsedCommand)
+	result := e.executeOperation(updateParsedCommand, textSerializer{})
 
 	// Assert
 	testutil.AssertEquals(t, "1", string(result), "result")
 }
 
+func TestUpdateNestedPath(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	e.messageHandler(server.NewSession("test"), "NEW user:1 address {city 'SP' zip 123} tags ['a','b']")
+
+	// Act
+	result := e.messageHandler(server.NewSession("test"), "UPD user:1 address.city 'RJ' tags.0 'c'")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(result), "result")
+	record, _ := e.storages["user"].GetRecord(1)
+	city, _ := record.Data.GetPath("address.city")
+	zip, _ := record.Data.GetPath("address.zip")
+	tag, _ := record.Data.GetPath("tags.0")
+	testutil.AssertEquals(t, "RJ", city, "city")
+	testutil.AssertEquals(t, int64(123), zip, "zip")
+	testutil.AssertEquals(t, "c", tag, "tag")
+}
+
+func TestUpdateInvalidNestedPath(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	e.messageHandler(server.NewSession("test"), "NEW user:1 name 'John'")
+
+	// Act
+	result := e.messageHandler(server.NewSession("test"), "UPD user:1 name.first 'J'")
+
+	// Assert
+	testutil.AssertContains(t, string(result), "ERR INVALID_DATA")
+}
+
 func TestUpdateInexistentRecord(t *testing.T) {
 	// Arrange
-	initializeStorage()
-	storages["car"] = storage.New("car")
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
 	updateParsedCommand := &parser.ParsedCommand{
 		Operation: "UPD",
 		Entity:    "car",
@@ -113,16 +147,16 @@ func TestUpdateInexistentRecord(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(updateParsedCommand)
+	result := e.executeOperation(updateParsedCommand, textSerializer{})
 
 	// Assert
-	testutil.AssertEquals(t, "0", string(result), "result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND record car:1 not found", string(result), "result")
 }
 
 func TestUpdateInvalidId(t *testing.T) {
 	// Arrange
-	initializeStorage()
-	storages["car"] = storage.New("car")
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
 	updateParsedCommand := &parser.ParsedCommand{
 		Operation: "UPD",
 		Entity:    "car",
@@ -133,20 +167,20 @@ func TestUpdateInvalidId(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(updateParsedCommand)
+	result := e.executeOperation(updateParsedCommand, textSerializer{})
 
 	// Assert
-	testutil.AssertContains(t, string(result), "invalid id")
+	testutil.AssertContains(t, string(result), "ERR INVALID_ID invalid id")
 }
 
 func TestGetSingleRecord(t *testing.T) {
 	// Arrange
-	initializeStorage()
-	storages["car"] = storage.New("car")
-	storages["car"].InsertRecord(&storage.Record{
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
+	e.storages["car"].InsertRecord(&storage.Record{
 		Id: 1,
 		Data: &storage.Data{
-			"name": "'mercedes'",
+			"name": "mercedes",
 		},
 	})
 	parsedCommand := &parser.ParsedCommand{
@@ -156,7 +190,7 @@ func TestGetSingleRecord(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(parsedCommand)
+	result := e.executeOperation(parsedCommand, textSerializer{})
 
 	// Assert
 	testutil.AssertContains(t, string(result), "id 1")
@@ -165,8 +199,8 @@ func TestGetSingleRecord(t *testing.T) {
 
 func TestGetSingleRecordEmpty(t *testing.T) {
 	// Arrange
-	initializeStorage()
-	storages["car"] = storage.New("car")
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
 	parsedCommand := &parser.ParsedCommand{
 		Operation: "GET",
 		Entity:    "car",
@@ -174,26 +208,26 @@ func TestGetSingleRecordEmpty(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(parsedCommand)
+	result := e.executeOperation(parsedCommand, textSerializer{})
 
 	// Assert
-	testutil.AssertEquals(t, "0", string(result), "result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND record car:1 not found", string(result), "result")
 }
 
 func TestGetAllRecords(t *testing.T) {
 	// Arrange
-	initializeStorage()
-	storages["car"] = storage.New("car")
-	storages["car"].InsertRecord(&storage.Record{
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
+	e.storages["car"].InsertRecord(&storage.Record{
 		Id: 1,
 		Data: &storage.Data{
-			"name": "'mercedes'",
+			"name": "mercedes",
 		},
 	})
-	storages["car"].InsertRecord(&storage.Record{
+	e.storages["car"].InsertRecord(&storage.Record{
 		Id: 2,
 		Data: &storage.Data{
-			"name": "'bmw'",
+			"name": "bmw",
 		},
 	})
 	parsedCommand := &parser.ParsedCommand{
@@ -203,7 +237,7 @@ func TestGetAllRecords(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(parsedCommand)
+	result := e.executeOperation(parsedCommand, textSerializer{})
 
 	// Assert
 	testutil.AssertContains(t, string(result), "id 1")
@@ -214,8 +248,8 @@ func TestGetAllRecords(t *testing.T) {
 
 func TestGetAllRecordsEmpty(t *testing.T) {
 	// Arrange
-	initializeStorage()
-	storages["car"] = storage.New("car")
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
 	parsedCommand := &parser.ParsedCommand{
 		Operation: "GET",
 		Entity:    "car",
@@ -223,19 +257,19 @@ func TestGetAllRecordsEmpty(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(parsedCommand)
+	result := e.executeOperation(parsedCommand, textSerializer{})
 
 	// Assert
-	testutil.AssertEquals(t, "0", string(result), "result")
+	testutil.AssertEquals(t, "", string(result), "result")
 }
 
 func TestDeleteRecord(t *testing.T) {
-	initializeStorage()
-	storages["car"] = storage.New("car")
-	storages["car"].InsertRecord(&storage.Record{
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
+	e.storages["car"].InsertRecord(&storage.Record{
 		Id: 1,
 		Data: &storage.Data{
-			"name": "'mercedes'",
+			"name": "mercedes",
 		},
 	})
 	parsedCommand := &parser.ParsedCommand{
@@ -245,17 +279,17 @@ func TestDeleteRecord(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(parsedCommand)
+	result := e.executeOperation(parsedCommand, textSerializer{})
 
 	// Assert
 	testutil.AssertEquals(t, "1", string(result), "result")
-	_, found := storages["car"].GetRecord(1)
+	_, found := e.storages["car"].GetRecord(1)
 	testutil.AssertFalse(t, found, "found")
 }
 
 func TestDeleteRecordEmpty(t *testing.T) {
-	initializeStorage()
-	storages["car"] = storage.New("car")
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
 	parsedCommand := &parser.ParsedCommand{
 		Operation: "DEL",
 		Entity:    "car",
@@ -263,15 +297,15 @@ func TestDeleteRecordEmpty(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(parsedCommand)
+	result := e.executeOperation(parsedCommand, textSerializer{})
 
 	// Assert
-	testutil.AssertEquals(t, "0", string(result), "result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND record car:1 not found", string(result), "result")
 }
 
 func TestDeleteRecordInvalidId(t *testing.T) {
-	initializeStorage()
-	storages["car"] = storage.New("car")
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
 	parsedCommand := &parser.ParsedCommand{
 		Operation: "DEL",
 		Entity:    "car",
@@ -279,16 +313,16 @@ func TestDeleteRecordInvalidId(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(parsedCommand)
+	result := e.executeOperation(parsedCommand, textSerializer{})
 
 	// Assert
-	testutil.AssertContains(t, string(result), "invalid id")
+	testutil.AssertContains(t, string(result), "ERR INVALID_ID invalid id")
 }
 
 func TestInvalidOperation(t *testing.T) {
 	// Arrange
-	initializeStorage()
-	storages["car"] = storage.New("car")
+	e := New(DefaultConfig())
+	e.storages["car"] = storage.New("car")
 	parsedCommand := &parser.ParsedCommand{
 		Operation: "APT",
 		Entity:    "car",
@@ -296,30 +330,439 @@ func TestInvalidOperation(t *testing.T) {
 	}
 
 	// Act
-	result := executeOperation(parsedCommand)
+	result := e.executeOperation(parsedCommand, textSerializer{})
 
 	// Assert
-	testutil.AssertContains(t, string(result), "invalid operation")
+	testutil.AssertContains(t, string(result), "ERR INVALID_OPERATION invalid operation")
 }
 
 func TestMessageHandler(t *testing.T) {
 	// Arrange
-	initializeStorage()
+	e := New(DefaultConfig())
 
 	// Act
-	result := messageHandler("GET cliente:1")
+	result := e.messageHandler(server.NewSession("test"), "GET cliente:1")
 
 	// Assert
-	testutil.AssertEquals(t, string(result), "0", "result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND record cliente:1 not found", string(result), "result")
 }
 
 func TestMessageHandlerInvalidCommand(t *testing.T) {
 	// Arrange
-	initializeStorage()
+	e := New(DefaultConfig())
+
+	// Act
+	result := e.messageHandler(server.NewSession("test"), "GET cliente abc")
+
+	// Assert
+	testutil.AssertContains(t, string(result), "ERR PARSE ")
+}
+
+func TestMessageHandlerJSONFormat(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+
+	// Act
+	formatResult := e.messageHandler(session, "FORMAT json")
+	insertResult := e.messageHandler(session, `NEW car:1 {"name": "bmw  x5", "year": 2020, "tags": ["a"]}`)
+	getResult := e.messageHandler(session, "GET car:1")
+	allResult := e.messageHandler(session, "GET car")
+	errorResult := e.messageHandler(session, "GET car:2")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(formatResult), "format result")
+	testutil.AssertEquals(t, "1", string(insertResult), "insert result")
+	testutil.AssertEquals(t, `{"id":1,"name":"bmw  x5","tags":["a"],"year":2020}`, string(getResult), "get result")
+	testutil.AssertEquals(t, `[{"id":1,"name":"bmw  x5","tags":["a"],"year":2020}]`, string(allResult), "all result")
+	testutil.AssertEquals(t, `{"error":{"code":"NOT_FOUND","message":"record car:2 not found"}}`, string(errorResult), "error result")
+}
+
+func TestMessageHandlerJSONDotPaths(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "FORMAT json")
+
+	// Act
+	insertResult := e.messageHandler(session, `NEW car:1 {"engine.hp": 300, "specs": {"a.b": 1}}`)
+	updateResult := e.messageHandler(session, `UPD car:1 {"engine.cc": 2000}`)
+	getResult := e.messageHandler(session, "GET car:1")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(insertResult), "insert result")
+	testutil.AssertEquals(t, "1", string(updateResult), "update result")
+	testutil.AssertEquals(t, `{"id":1,"engine":{"cc":2000,"hp":300},"specs":{"a.b":1}}`, string(getResult), "get result")
+}
+
+func TestMessageHandlerFormatIsPerSession(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	jsonSession := server.NewSession("json")
+	textSession := server.NewSession("text")
+	e.messageHandler(jsonSession, "FORMAT json")
+	e.messageHandler(textSession, "NEW car:1 name 'bmw'")
+
+	// Act
+	jsonResult := e.messageHandler(jsonSession, "GET car:1")
+	textResult := e.messageHandler(textSession, "GET car:1")
+
+	// Assert
+	testutil.AssertEquals(t, `{"id":1,"name":"bmw"}`, string(jsonResult), "json result")
+	testutil.AssertEquals(t, "id 1 name 'bmw'", string(textResult), "text result")
+}
+
+func TestGetRecordsInRange(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	for _, command := range []string{"NEW car:1 name 'bmw'", "NEW car:2 name 'audi'", "NEW car:3 name 'fiat'"} {
+		e.messageHandler(session, command)
+	}
+
+	// Act
+	result := e.messageHandler(session, "GET car[2:]")
+	invalidResult := e.messageHandler(session, "GET car[3:2]")
+
+	// Assert
+	testutil.AssertEquals(t, "id 2 name 'audi'\nid 3 name 'fiat'", string(result), "result")
+	testutil.AssertContains(t, string(invalidResult), "ERR INVALID_ID")
+}
+
+func TestGetRecordFields(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW user:1 name 'John' email 'john@mail.com' age 30 address {city 'SP' zip 123}")
+
+	// Act
+	result := e.messageHandler(session, "GET user:1 FIELDS name address.city missing")
+
+	// Assert
+	testutil.AssertEquals(t, "id 1 address {city 'SP'} name 'John'", string(result), "result")
+	record, _ := e.storages["user"].GetRecord(1)
+	zip, _ := record.Data.GetPath("address.zip")
+	testutil.AssertEquals(t, int64(123), zip, "zip")
+}
+
+func TestGetRecordFieldsFromLists(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW l:1 tags ['a', 'b', 'c'] items [{sku 1 qty 2}, {sku 3 qty 4}]")
+
+	// Act
+	single := e.messageHandler(session, "GET l:1 FIELDS tags.0")
+	several := e.messageHandler(session, "GET l:1 FIELDS tags.2 tags.0 tags.9 items.1.sku")
+	missing := e.messageHandler(session, "GET l:1 FIELDS tags.9 tags.x")
+
+	// Assert
+	testutil.AssertEquals(t, "id 1 tags ['a']", string(single), "single")
+	testutil.AssertEquals(t, "id 1 items [{sku 3}] tags ['a', 'c']", string(several), "several")
+	testutil.AssertEquals(t, "id 1", string(missing), "missing")
+}
+
+func TestGetRecordFieldsDoesNotShareNestedData(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW user:1 address {city 'SP' zip 123}")
+
+	// Act
+	e.messageHandler(session, "GET user:1 FIELDS address address.city.name")
+
+	// Assert
+	record, _ := e.storages["user"].GetRecord(1)
+	city, _ := record.Data.GetPath("address.city")
+	testutil.AssertEquals(t, "SP", city, "city")
+}
+
+func TestGetRecordsInRangeFieldsJSON(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW user:1 name 'John' age 30")
+	e.messageHandler(session, "NEW user:2 name 'Mary' age 25")
+	e.messageHandler(session, "FORMAT json")
+
+	// Act
+	result := e.messageHandler(session, "GET user[1:2] FIELDS name")
+
+	// Assert
+	testutil.AssertEquals(t, `[{"id":1,"name":"John"},{"id":2,"name":"Mary"}]`, string(result), "result")
+}
+
+func TestGetRecordsPagination(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	for id := 1; id <= 5; id++ {
+		e.messageHandler(session, fmt.Sprintf("NEW car:%d n %d", id, id))
+	}
+
+	// Act
+	firstPage := string(e.messageHandler(session, "GET car LIMIT 2"))
+	firstCursor := firstPage[strings.LastIndex(firstPage, " ")+1:]
+	secondPage := string(e.messageHandler(session, "GET car LIMIT 2 CURSOR "+firstCursor))
+	secondCursor := secondPage[strings.LastIndex(secondPage, " ")+1:]
+	lastPage := string(e.messageHandler(session, "GET car LIMIT 2 CURSOR "+secondCursor))
+	offsetPage := string(e.messageHandler(session, "GET car[2:4] OFFSET 1"))
+
+	// Assert
+	testutil.AssertEquals(t, "id 1 n 1\nid 2 n 2\ncursor "+firstCursor, firstPage, "first page")
+	testutil.AssertEquals(t, "id 3 n 3\nid 4 n 4\ncursor "+secondCursor, secondPage, "second page")
+	testutil.AssertEquals(t, "id 5 n 5", lastPage, "last page")
+	testutil.AssertEquals(t, "id 3 n 3\nid 4 n 4", offsetPage, "offset page")
+}
+
+func TestGetRecordsPaginationWithOffset(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	for id := 1; id <= 8; id++ {
+		e.messageHandler(session, fmt.Sprintf("NEW car:%d n %d", id, 9-id))
+	}
+
+	for _, command := range []string{"GET car LIMIT 2 OFFSET 2", "GET car ORDER BY n DESC LIMIT 2 OFFSET 2"} {
+		// Act
+		ids := make([]string, 0)
+		page := string(e.messageHandler(session, command))
+		for {
+			lines := strings.Split(page, "\n")
+			last := lines[len(lines)-1]
+			if strings.HasPrefix(last, "cursor ") {
+				lines = lines[:len(lines)-1]
+			}
+			for _, line := range lines {
+				ids = append(ids, strings.Fields(line)[1])
+			}
+			if !strings.HasPrefix(last, "cursor ") {
+				break
+			}
+			page = string(e.messageHandler(session, command+" CURSOR "+strings.TrimPrefix(last, "cursor ")))
+		}
+
+		// Assert
+		testutil.AssertEquals(t, "3 4 5 6 7 8", strings.Join(ids, " "), command)
+	}
+}
+
+func TestGetRecordsPaginationJSON(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+	e.messageHandler(session, "NEW car:2 name 'audi'")
+	e.messageHandler(session, "FORMAT json")
+
+	// Act
+	firstPage := string(e.messageHandler(session, "GET car LIMIT 1"))
+	lastPage := string(e.messageHandler(session, "GET car LIMIT 1 CURSOR "+encodeCursor("car", cursorPosition{lastId: 1})))
+
+	// Assert
+	testutil.AssertEquals(t, `{"records":[{"id":1,"name":"bmw"}],"cursor":"`+encodeCursor("car", cursorPosition{lastId: 1})+`"}`, firstPage, "first page")
+	testutil.AssertEquals(t, `{"records":[{"id":2,"name":"audi"}],"cursor":null}`, lastPage, "last page")
+}
+
+func TestGetRecordsInvalidCursor(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+
+	// Act
+	malformedResult := e.messageHandler(session, "GET car LIMIT 1 CURSOR !!!")
+	otherEntityResult := e.messageHandler(session, "GET car LIMIT 1 CURSOR "+encodeCursor("user", cursorPosition{lastId: 1}))
+
+	// Assert
+	testutil.AssertEquals(t, "ERR INVALID_ARGUMENT invalid cursor", string(malformedResult), "malformed result")
+	testutil.AssertEquals(t, "ERR INVALID_ARGUMENT invalid cursor", string(otherEntityResult), "other entity result")
+}
+
+func TestGetRecordsOrderBy(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 brand 'bmw' year 2020")
+	e.messageHandler(session, "NEW car:2 brand 'audi' year 2018")
+	e.messageHandler(session, "NEW car:3 brand 'bmw' year 2022")
+	e.messageHandler(session, "NEW car:4 brand 'audi' year 2018.5")
+	e.messageHandler(session, "NEW car:5 year 2019")
+
+	// Act
+	byBrand := string(e.messageHandler(session, "GET car ORDER BY brand ASC, year DESC FIELDS year"))
+	byIdDesc := string(e.messageHandler(session, "GET car[2:4] ORDER BY id DESC FIELDS year"))
+
+	// Assert
+	testutil.AssertEquals(t, "id 5 year 2019\nid 4 year 2018.5\nid 2 year 2018\nid 3 year 2022\nid 1 year 2020",
+		byBrand, "by brand")
+	testutil.AssertEquals(t, "id 4 year 2018.5\nid 3 year 2022\nid 2 year 2018", byIdDesc, "by id desc")
+}
+
+func TestGetRecordsOrderByMixedTypes(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW item:1 value 'text'")
+	e.messageHandler(session, "NEW item:2 value 10")
+	e.messageHandler(session, "NEW item:3 value null")
+	e.messageHandler(session, "NEW item:4 value true")
+	e.messageHandler(session, "NEW item:5 value 2.5")
+	e.messageHandler(session, "NEW item:6 value 3u")
+
+	// Act
+	result := string(e.messageHandler(session, "GET item ORDER BY value"))
+
+	// Assert
+	testutil.AssertEquals(t, "id 3 value null\nid 4 value true\nid 5 value 2.5\nid 6 value 3u\n"+
+		"id 2 value 10\nid 1 value 'text'", result, "result")
+}
+
+func TestGetRecordsOrderByPagination(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	for id := 1; id <= 7; id++ {
+		e.messageHandler(session, fmt.Sprintf("NEW car:%d rank %d", id, id%3))
+	}
+	expected := []string{
+		"id 6 rank 0\nid 3 rank 0\nid 7 rank 1",
+		"id 4 rank 1\nid 1 rank 1\nid 5 rank 2",
+		"id 2 rank 2",
+	}
+
+	// Act & Assert
+	cursor := ""
+	for i, expectedPage := range expected {
+		command := "GET car ORDER BY rank, id DESC LIMIT 3"
+		if cursor != "" {
+			command += " CURSOR " + cursor
+		}
+		page := string(e.messageHandler(session, command))
+		records, cursorLine, _ := strings.Cut(page, "\ncursor ")
+		testutil.AssertEquals(t, expectedPage, records, fmt.Sprintf("page %d", i))
+		cursor = cursorLine
+	}
+	testutil.AssertEquals(t, "", cursor, "last cursor")
+}
+
+func TestGetRecordsOrderByWithoutLimitIsBounded(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	for id := 1; id <= sortedPageSize+1; id++ {
+		e.messageHandler(session, fmt.Sprintf("NEW car:%d n %d", id, id))
+	}
+
+	// Act
+	firstPage := string(e.messageHandler(session, "GET car ORDER BY n DESC"))
+	lines := strings.Split(firstPage, "\n")
+	cursor := strings.TrimPrefix(lines[len(lines)-1], "cursor ")
+	lastPage := string(e.messageHandler(session, "GET car ORDER BY n DESC CURSOR "+cursor))
+
+	// Assert
+	testutil.AssertEquals(t, sortedPageSize+1, len(lines), "first page lines")
+	testutil.AssertEquals(t, fmt.Sprintf("id %d n %d", sortedPageSize+1, sortedPageSize+1), lines[0], "first record")
+	testutil.AssertEquals(t, "id 1 n 1", lastPage, "last page")
+}
+
+func TestGetRecordsOrderByIdDescPagination(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	for id := 1; id <= 3; id++ {
+		e.messageHandler(session, fmt.Sprintf("NEW car:%d", id))
+	}
+
+	// Act
+	firstPage := string(e.messageHandler(session, "GET car ORDER BY id DESC LIMIT 2"))
+	records, cursor, _ := strings.Cut(firstPage, "\ncursor ")
+	lastPage := string(e.messageHandler(session, "GET car ORDER BY id DESC LIMIT 2 CURSOR "+cursor))
+
+	// Assert
+	testutil.AssertEquals(t, "id 3\nid 2", records, "first page")
+	testutil.AssertEquals(t, "id 1", lastPage, "last page")
+}
+
+func TestGetRecordsOrderByCursorMismatch(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+
+	// Act
+	result := e.messageHandler(session, "GET car ORDER BY rank LIMIT 2 CURSOR "+encodeCursor("car", cursorPosition{lastId: 1}))
+
+	// Assert
+	testutil.AssertEquals(t, "ERR INVALID_ARGUMENT invalid cursor", string(result), "result")
+}
+
+func TestGetRecordsWhere(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 brand 'bmw' year 2020")
+	e.messageHandler(session, "NEW car:2 brand 'audi' year 2018")
+	e.messageHandler(session, "NEW car:3 brand 'bmw' year 2022")
+	e.messageHandler(session, "NEW car:4 brand 'fiat' year '2019'")
+
+	// Act
+	byBrand := string(e.messageHandler(session, "GET car WHERE brand = 'bmw' AND year >= 2021 FIELDS year"))
+	byYear := string(e.messageHandler(session, "GET car WHERE year < 2021 ORDER BY year DESC FIELDS brand"))
+	missing := string(e.messageHandler(session, "GET car WHERE color = null LIMIT 1"))
+
+	// Assert
+	testutil.AssertEquals(t, "id 3 year 2022", byBrand, "by brand")
+	testutil.AssertEquals(t, "id 1 brand 'bmw'\nid 2 brand 'audi'", byYear, "by year")
+	testutil.AssertEquals(t, "id 1 brand 'bmw' year 2020\ncursor "+encodeCursor("car", cursorPosition{lastId: 1}), missing, "missing")
+}
+
+func TestReplaceRecord(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 brand 'bmw' year 2020 color 'red'")
+
+	// Act
+	replaceResult := e.messageHandler(session, "SET car:1 brand 'audi' specs.hp 300")
+	missingResult := e.messageHandler(session, "SET car:2 brand 'fiat'")
+	getResult := e.messageHandler(session, "GET car:1")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(replaceResult), "replace result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND record car:2 not found", string(missingResult), "missing result")
+	testutil.AssertEquals(t, "id 1 brand 'audi' specs {hp 300}", string(getResult), "get result")
+}
+
+func TestUnsetAttributes(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 brand 'bmw' color 'red' specs {hp 300 torque 400}")
+
+	// Act
+	unsetResult := e.messageHandler(session, "UNSET car:1 color, specs.torque")
+	unsetMissingResult := e.messageHandler(session, "UNSET car:1 color")
+	missingRecordResult := e.messageHandler(session, "UNSET car:2 color")
+	getResult := e.messageHandler(session, "GET car:1")
+
+	// Assert
+	testutil.AssertEquals(t, "2", string(unsetResult), "unset result")
+	testutil.AssertEquals(t, "0", string(unsetMissingResult), "unset missing result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND record car:2 not found", string(missingRecordResult), "missing record result")
+	testutil.AssertEquals(t, "id 1 brand 'bmw' specs {hp 300}", string(getResult), "get result")
+}
+
+func TestUpsertRecord(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
 
 	// Act
-	result := messageHandler("GET cliente abc")
+	insertResult := e.messageHandler(session, "UPSERT car:1 brand 'bmw' year 2020")
+	updateResult := e.messageHandler(session, "UPSERT car:1 year 2021")
+	getResult := e.messageHandler(session, "GET car:1")
 
 	// Assert
-	testutil.AssertContains(t, string(result), "Error processing command")
+	testutil.AssertEquals(t, "1", string(insertResult), "insert result")
+	testutil.AssertEquals(t, "1", string(updateResult), "update result")
+	testutil.AssertEquals(t, "id 1 brand 'bmw' year 2021", string(getResult), "get result")
 }
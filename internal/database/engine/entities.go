@@ -0,0 +1,119 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+func (e *Engine) getStorage(entity string, create bool) (*storage.Storage, error) {
+	e.mu.RLock()
+	s, found := e.storages[entity]
+	e.mu.RUnlock()
+	if found {
+		return s, nil
+	}
+	if !create {
+		if e.config.StrictEntities {
+			return nil, entityNotFound(entity)
+		}
+		return storage.New(entity), nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if s, found := e.storages[entity]; found {
+		return s, nil
+	}
+	s = storage.New(entity)
+	s.SetChangeGuard(e.beforeChange)
+	s.SetChangeHandler(e.afterChange)
+	e.storages[entity] = s
+	return s, nil
+}
+
+func (e *Engine) listEntities(serializer recordSerializer) ([]byte, error) {
+	e.mu.RLock()
+	names := make([]string, 0, len(e.storages))
+	for name := range e.storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := make([][]interface{}, len(names))
+	for i, name := range names {
+		rows[i] = []interface{}{name, int64(e.storages[name].Len())}
+	}
+	e.mu.RUnlock()
+
+	return serializer.serializeRows([]string{"entity", "records"}, rows)
+}
+
+func (e *Engine) dropEntity(parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	e.schemaMu.Lock()
+	defer e.schemaMu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, found := e.storages[parsedCommand.Entity]
+	if !found {
+		return nil, entityNotFound(parsedCommand.Entity)
+	}
+	e.changes.recordEntity(changeDrop, parsedCommand.Entity, "")
+	delete(e.storages, parsedCommand.Entity)
+	delete(e.schemas, parsedCommand.Entity)
+	s.Drop()
+	return []byte("1"), nil
+}
+
+func (e *Engine) renameEntity(parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	newName := parsedCommand.Args[0]
+	e.schemaMu.Lock()
+	defer e.schemaMu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	s, found := e.storages[parsedCommand.Entity]
+	if !found {
+		return nil, entityNotFound(parsedCommand.Entity)
+	}
+	if _, found := e.storages[newName]; found {
+		return nil, &ConflictError{fmt.Sprintf("entity %s already exists", newName)}
+	}
+	e.changes.recordEntity(changeRename, parsedCommand.Entity, newName)
+	delete(e.storages, parsedCommand.Entity)
+	s.Rename(newName)
+	e.storages[newName] = s
+	if schema, found := e.schemas[parsedCommand.Entity]; found {
+		delete(e.schemas, parsedCommand.Entity)
+		e.schemas[newName] = schema
+	}
+	return []byte("1"), nil
+}
+
+func (e *Engine) entityStats(parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	e.mu.RLock()
+	s, found := e.storages[parsedCommand.Entity]
+	e.mu.RUnlock()
+	if !found {
+		return nil, entityNotFound(parsedCommand.Entity)
+	}
+
+	attributes := make(map[string]bool)
+	s.IterateOverRecords(func(record *storage.Record) bool {
+		if record.Data != nil {
+			for attribute := range *record.Data {
+				attributes[attribute] = true
+			}
+		}
+		return true
+	})
+	lowest, highest := s.IdBounds()
+	return serializer.serializeRow(
+		[]string{"entity", "records", "min_id", "max_id", "attributes"},
+		[]interface{}{s.Name(), int64(s.Len()), int64(lowest), int64(highest), int64(len(attributes))},
+	)
+}
+
+func entityNotFound(entity string) error {
+	return &NotFoundError{fmt.Sprintf("entity %s not found", entity)}
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestReadsDoNotCreateEntities(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+
+	// Act
+	getResult := e.messageHandler(session, "GET car")
+	countResult := e.messageHandler(session, "COUNT car")
+	entitiesResult := e.messageHandler(session, "ENTITIES")
+
+	// Assert
+	testutil.AssertEquals(t, "", string(getResult), "get result")
+	testutil.AssertEquals(t, "count 0", string(countResult), "count result")
+	testutil.AssertEquals(t, "", string(entitiesResult), "entities result")
+}
+
+func TestStrictEntities(t *testing.T) {
+	// Arrange
+	e := New(Config{StrictEntities: true})
+	session := server.NewSession("test")
+
+	// Act
+	getResult := e.messageHandler(session, "GET car:1")
+	insertResult := e.messageHandler(session, "NEW car:1 name 'bmw'")
+	getAfterInsertResult := e.messageHandler(session, "GET car:1")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR NOT_FOUND entity car not found", string(getResult), "get result")
+	testutil.AssertEquals(t, "1", string(insertResult), "insert result")
+	testutil.AssertEquals(t, "id 1 name 'bmw'", string(getAfterInsertResult), "get after insert result")
+}
+
+func TestListEntities(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW user:1 name 'John'")
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+	e.messageHandler(session, "NEW car:2 name 'audi'")
+
+	// Act
+	result := e.messageHandler(session, "ENTITIES")
+
+	// Assert
+	testutil.AssertEquals(t, "entity 'car' records 2\nentity 'user' records 1", string(result), "result")
+}
+
+func TestDropEntity(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+
+	// Act
+	dropResult := e.messageHandler(session, "DROP car")
+	dropAgainResult := e.messageHandler(session, "DROP car")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(dropResult), "drop result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND entity car not found", string(dropAgainResult), "drop again result")
+	testutil.AssertEquals(t, "", string(e.messageHandler(session, "GET car")), "get result")
+}
+
+func TestRenameEntity(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+	e.messageHandler(session, "NEW user:1 name 'John'")
+
+	// Act
+	renameResult := e.messageHandler(session, "RENAME car vehicle")
+	conflictResult := e.messageHandler(session, "RENAME vehicle user")
+	missingResult := e.messageHandler(session, "RENAME car auto")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(renameResult), "rename result")
+	testutil.AssertEquals(t, "ERR CONFLICT entity user already exists", string(conflictResult), "conflict result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND entity car not found", string(missingResult), "missing result")
+	testutil.AssertEquals(t, "id 1 name 'bmw'", string(e.messageHandler(session, "GET vehicle:1")), "get result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND record vehicle:2 not found", string(e.messageHandler(session, "GET vehicle:2")), "not found result")
+}
+
+func TestEntityStats(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:3 name 'bmw'")
+	e.messageHandler(session, "NEW car:9 name 'audi' year 2020")
+
+	// Act
+	result := e.messageHandler(session, "STATS car")
+	missingResult := e.messageHandler(session, "STATS user")
+
+	// Assert
+	testutil.AssertEquals(t, "entity 'car' records 2 min_id 3 max_id 9 attributes 2", string(result), "result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND entity user not found", string(missingResult), "missing result")
+}
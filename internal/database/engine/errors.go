@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"errors"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+const (
+	ErrCodeParse            = "PARSE"
+	ErrCodeSerialization    = "SERIALIZATION"
+	ErrCodeNotFound         = "NOT_FOUND"
+	ErrCodeConflict         = "CONFLICT"
+	ErrCodeInvalidId        = "INVALID_ID"
+	ErrCodeInvalidOperation = "INVALID_OPERATION"
+	ErrCodeInvalidData      = "INVALID_DATA"
+	ErrCodeInvalidArgument  = "INVALID_ARGUMENT"
+	ErrCodeValidation       = "VALIDATION"
+	ErrCodeReadOnly         = "READ_ONLY"
+	ErrCodeNotLeader        = "NOT_LEADER"
+	ErrCodeRejected         = "REJECTED"
+	ErrCodeMoved            = "MOVED"
+	ErrCodeInternal         = "INTERNAL"
+)
+
+type NotFoundError struct {
+	message string
+}
+
+func (err *NotFoundError) Error() string {
+	return err.message
+}
+
+type ConflictError struct {
+	message string
+}
+
+func (err *ConflictError) Error() string {
+	return err.message
+}
+
+type InvalidIdError struct {
+	message string
+}
+
+func (err *InvalidIdError) Error() string {
+	return err.message
+}
+
+type InvalidOperationError struct {
+	message string
+}
+
+func (err *InvalidOperationError) Error() string {
+	return err.message
+}
+
+type InvalidDataError struct {
+	message string
+}
+
+func (err *InvalidDataError) Error() string {
+	return err.message
+}
+
+type InvalidArgumentError struct {
+	message string
+}
+
+func (err *InvalidArgumentError) Error() string {
+	return err.message
+}
+
+type ValidationError struct {
+	message string
+}
+
+func (err *ValidationError) Error() string {
+	return err.message
+}
+
+type ReadOnlyError struct {
+	message string
+}
+
+func (err *ReadOnlyError) Error() string {
+	return err.message
+}
+
+type NotLeaderError struct {
+	message string
+}
+
+func (err *NotLeaderError) Error() string {
+	return err.message
+}
+
+type RejectedError struct {
+	message string
+}
+
+func (err *RejectedError) Error() string {
+	return err.message
+}
+
+// MovedError rejects a command for a record this node does not own, or one
+// that is being copied to another node; the client should retry it.
+type MovedError struct {
+	message string
+}
+
+func (err *MovedError) Error() string {
+	return err.message
+}
+
+type InternalError struct {
+	message string
+}
+
+func (err *InternalError) Error() string {
+	return err.message
+}
+
+func ErrorCode(err error) string {
+	var parseErr *parser.ParseError
+	var serializationErr *SerializationError
+	var notFoundErr *NotFoundError
+	var conflictErr *ConflictError
+	var invalidIdErr *InvalidIdError
+	var invalidOperationErr *InvalidOperationError
+	var invalidDataErr *InvalidDataError
+	var invalidArgumentErr *InvalidArgumentError
+	var validationErr *ValidationError
+	var readOnlyErr *ReadOnlyError
+	var notLeaderErr *NotLeaderError
+	var rejectedErr *RejectedError
+	var movedErr *MovedError
+
+	switch {
+	case errors.As(err, &parseErr):
+		return ErrCodeParse
+	case errors.As(err, &serializationErr):
+		return ErrCodeSerialization
+	case errors.As(err, &notFoundErr), errors.Is(err, storage.ErrDropped):
+		return ErrCodeNotFound
+	case errors.As(err, &conflictErr):
+		return ErrCodeConflict
+	case errors.As(err, &invalidIdErr):
+		return ErrCodeInvalidId
+	case errors.As(err, &invalidOperationErr):
+		return ErrCodeInvalidOperation
+	case errors.As(err, &invalidDataErr):
+		return ErrCodeInvalidData
+	case errors.As(err, &invalidArgumentErr):
+		return ErrCodeInvalidArgument
+	case errors.As(err, &validationErr):
+		return ErrCodeValidation
+	case errors.As(err, &readOnlyErr):
+		return ErrCodeReadOnly
+	case errors.As(err, &notLeaderErr):
+		return ErrCodeNotLeader
+	case errors.As(err, &rejectedErr):
+		return ErrCodeRejected
+	case errors.As(err, &movedErr):
+		return ErrCodeMoved
+	default:
+		return ErrCodeInternal
+	}
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestErrorCode(t *testing.T) {
+	_, parseErr := parser.ParseCommand("GET")
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{parseErr, ErrCodeParse},
+		{&SerializationError{"bad value"}, ErrCodeSerialization},
+		{&NotFoundError{"not found"}, ErrCodeNotFound},
+		{&ConflictError{"duplicated"}, ErrCodeConflict},
+		{&InvalidIdError{"invalid id"}, ErrCodeInvalidId},
+		{&InvalidOperationError{"invalid operation"}, ErrCodeInvalidOperation},
+		{&InvalidDataError{"invalid data"}, ErrCodeInvalidData},
+		{&InvalidArgumentError{"invalid argument"}, ErrCodeInvalidArgument},
+		{&ValidationError{"validation"}, ErrCodeValidation},
+		{&ReadOnlyError{"read only"}, ErrCodeReadOnly},
+		{&NotLeaderError{"not leader"}, ErrCodeNotLeader},
+		{&RejectedError{"rejected"}, ErrCodeRejected},
+		{&MovedError{"moved"}, ErrCodeMoved},
+		{storage.ErrDropped, ErrCodeNotFound},
+		{&InternalError{"internal"}, ErrCodeInternal},
+		{errors.New("unknown"), ErrCodeInternal},
+		{fmt.Errorf("wrapped: %w", &NotFoundError{"not found"}), ErrCodeNotFound},
+	}
+
+	for _, test := range tests {
+		testutil.AssertEquals(t, test.expected, ErrorCode(test.err), test.err.Error())
+	}
+}
+
+func TestSerializeError(t *testing.T) {
+	// Arrange
+	err := &NotFoundError{"record car:1\nnot found"}
+
+	// Act
+	serialized := SerializeError(err)
+
+	// Assert
+	testutil.AssertEquals(t, "ERR NOT_FOUND record car:1 not found", string(serialized), "serialized")
+}
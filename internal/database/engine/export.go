@@ -0,0 +1,249 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+// exportBatchSize is the number of records read from the storage and sent to
+// the client at a time while exporting.
+const exportBatchSize = 1000
+
+// streamExport sends an export to the session's connection one batch at a
+// time, so the entity is never serialized into a single response. An error
+// met part way through ends the stream with an error line, and an empty
+// entity sends nothing at all. Sessions without a connection, and cluster
+// peers whose responses are framed, get the whole export as the response.
+func (e *Engine) streamExport(session *server.Session, parsedCommand *parser.ParsedCommand, serializer recordSerializer) []byte {
+	if !session.Connected() || isPeerSession(session) {
+		return e.executeOperation(parsedCommand, serializer)
+	}
+	err := e.exportEntity(parsedCommand, session.Push)
+	if err != nil {
+		return serializer.serializeError(err)
+	}
+	return nil
+}
+
+// exportEntity serializes the entity's records in id order and hands them to
+// emit in batches of lines. Records are read a batch at a time, so writes
+// made during the export may or may not be included.
+func (e *Engine) exportEntity(parsedCommand *parser.ParsedCommand, emit func(batch []byte) error) error {
+	s, err := e.getStorage(parsedCommand.Entity, false)
+	if err != nil {
+		return err
+	}
+	if parsedCommand.Args[0] == "CSV" {
+		return exportCSV(s, emit)
+	}
+	return exportJSONL(s, emit)
+}
+
+// exportBuffered runs an export into a single response.
+func (e *Engine) exportBuffered(parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	batches := make([][]byte, 0)
+	err := e.exportEntity(parsedCommand, func(batch []byte) error {
+		batches = append(batches, batch)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.Join(batches, []byte("\n")), nil
+}
+
+// iterateInBatches calls fn with the storage's records in id order,
+// exportBatchSize at a time, holding the storage lock only while a batch is
+// collected.
+func iterateInBatches(s *storage.Storage, fn func(records []*storage.Record) error) error {
+	lower := uint(0)
+	for {
+		records := make([]*storage.Record, 0, exportBatchSize)
+		s.IterateOverRange(lower, 0, func(record *storage.Record) bool {
+			records = append(records, record)
+			return len(records) < exportBatchSize
+		})
+		if len(records) == 0 {
+			return nil
+		}
+		if err := fn(records); err != nil {
+			return err
+		}
+		if len(records) < exportBatchSize {
+			return nil
+		}
+		lower = records[len(records)-1].Id + 1
+	}
+}
+
+func exportJSONL(s *storage.Storage, emit func(batch []byte) error) error {
+	return iterateInBatches(s, func(records []*storage.Record) error {
+		lines, err := serializeJSONLines(records)
+		if err != nil {
+			return err
+		}
+		return emit(lines)
+	})
+}
+
+func serializeJSONLines(records []*storage.Record) ([]byte, error) {
+	lines := make([][]byte, len(records))
+	for i, record := range records {
+		serialized, err := SerializeRecordExtendedJSON(record)
+		if err != nil {
+			return nil, err
+		}
+		lines[i] = serialized
+	}
+	return bytes.Join(lines, []byte("\n")), nil
+}
+
+// exportCSV makes a first pass over the records to find the columns and
+// their types for the header, then a second one to write the rows. A record
+// that gained an attribute or changed an attribute's type in between fails
+// the export, since its row would not match the header.
+func exportCSV(s *storage.Storage, emit func(batch []byte) error) error {
+	types := make(map[string]string)
+	iterateInBatches(s, func(records []*storage.Record) error {
+		addCSVColumnTypes(types, records)
+		return nil
+	})
+	columns := csvColumns(types)
+	header := []string{"id"}
+	for _, column := range columns {
+		header = append(header, column.Name+":"+column.Type)
+	}
+	if err := emit(encodeCSVRows([][]string{header})); err != nil {
+		return err
+	}
+
+	return iterateInBatches(s, func(records []*storage.Record) error {
+		rows := make([][]string, len(records))
+		for i, record := range records {
+			row, err := csvRow(record, columns, types)
+			if err != nil {
+				return err
+			}
+			rows[i] = row
+		}
+		return emit(encodeCSVRows(rows))
+	})
+}
+
+func csvRow(record *storage.Record, columns []parser.CSVColumn, types map[string]string) ([]string, error) {
+	changed := &SerializationError{message: fmt.Sprintf("record %d changed during the export", record.Id)}
+	if record.Data != nil {
+		for attribute, value := range *record.Data {
+			columnType, found := types[attribute]
+			if !found || columnType != "any" && columnType != csvFieldType(value) {
+				return nil, changed
+			}
+		}
+	}
+	row := []string{strconv.FormatUint(uint64(record.Id), 10)}
+	for _, column := range columns {
+		value, found := interface{}(nil), false
+		if record.Data != nil {
+			value, found = (*record.Data)[column.Name]
+		}
+		if !found {
+			row = append(row, "")
+			continue
+		}
+		field, err := encodeCSVField(column.Type, value)
+		if err != nil {
+			return nil, &SerializationError{message: err.Error()}
+		}
+		row = append(row, field)
+	}
+	return row, nil
+}
+
+func encodeCSVRows(rows [][]string) []byte {
+	buffer := bytes.Buffer{}
+	writer := csv.NewWriter(&buffer)
+	writer.WriteAll(rows)
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+}
+
+func addCSVColumnTypes(types map[string]string, records []*storage.Record) {
+	for _, record := range records {
+		if record.Data == nil {
+			continue
+		}
+		for attribute, value := range *record.Data {
+			valueType := csvFieldType(value)
+			if previous, found := types[attribute]; found && previous != valueType {
+				valueType = "any"
+			}
+			types[attribute] = valueType
+		}
+	}
+}
+
+func csvColumns(types map[string]string) []parser.CSVColumn {
+	attributes := make([]string, 0, len(types))
+	for attribute := range types {
+		attributes = append(attributes, attribute)
+	}
+	sort.Strings(attributes)
+	columns := make([]parser.CSVColumn, len(attributes))
+	for i, attribute := range attributes {
+		columns[i] = parser.CSVColumn{Name: attribute, Type: types[attribute]}
+	}
+	return columns
+}
+
+func csvFieldType(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if v == "" || strings.ContainsAny(v, "\r\n") {
+			return "any"
+		}
+		return "string"
+	case int, int64:
+		return "int"
+	case uint, uint64:
+		return "uint"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "timestamp"
+	case time.Duration:
+		return "duration"
+	case storage.Data, map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "list"
+	default:
+		return "any"
+	}
+}
+
+func encodeCSVField(fieldType string, value interface{}) (string, error) {
+	switch fieldType {
+	case "string":
+		return value.(string), nil
+	case "float":
+		return serializeFloat(value.(float64))
+	case "timestamp":
+		return value.(time.Time).Format(time.RFC3339Nano), nil
+	case "duration":
+		return value.(time.Duration).String(), nil
+	case "int", "uint", "bool":
+		return fmt.Sprint(value), nil
+	default:
+		return SerializeValue(value)
+	}
+}
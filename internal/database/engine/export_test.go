@@ -0,0 +1,186 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestExportJSONL(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 name 'bmw' price 10.0 at t'2024-01-02T03:04:05Z' ttl d'1m0s' serial 7u")
+	e.messageHandler(session, "NEW car:2 specs {hp 300 tags ['a']}")
+
+	// Act
+	result := e.messageHandler(session, "EXPORT car")
+
+	// Assert
+	testutil.AssertEquals(t, `{"id":1,"at":{"$timestamp":"2024-01-02T03:04:05Z"},"name":"bmw","price":10.0,"serial":{"$uint":"7"},"ttl":{"$duration":"1m0s"}}`+"\n"+
+		`{"id":2,"specs":{"hp":300,"tags":["a"]}}`, string(result), "result")
+}
+
+func TestExportCSV(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 name 'bmw, m3' year 2020 price 10.5 specs {hp 300}")
+	e.messageHandler(session, "NEW car:2 name 'audi' year '2018' electric true")
+
+	// Act
+	result := e.messageHandler(session, "EXPORT car CSV")
+
+	// Assert
+	testutil.AssertEquals(t, "id,electric:bool,name:string,price:float,specs:object,year:any\n"+
+		"1,,\"bmw, m3\",10.5,{hp 300},2020\n"+
+		"2,true,audi,,,'2018'", string(result), "result")
+}
+
+func TestStreamedExportOfEmptyEntitySendsNothing(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	defer e.Close()
+	address := serveEngine(t, e)
+	client := dialEngine(t, address)
+	client.send(t, "NEW car:1 name 'bmw'")
+	client.send(t, "DEL car:1")
+
+	// Act
+	client.conn.Write([]byte("EXPORT car\nEXPORT truck CSV\nEXPORT bike\nPING\n"))
+	csvHeader := client.read(t)
+	next := client.read(t)
+
+	// Assert
+	testutil.AssertEquals(t, "id", csvHeader, "csv header")
+	testutil.AssertEquals(t, "PONG", next, "next response")
+}
+
+func TestImportRoundTrip(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 name 'bmw' note 'a\\nb' price 1.0 at t'2024-01-02T03:04:05Z' serial 7u tags [1, 'x'] nothing null")
+	e.messageHandler(session, "NEW car:2 name '' year 2020")
+	expected := string(e.messageHandler(session, "GET car"))
+
+	for _, format := range []string{"JSONL", "CSV"} {
+		exported := string(e.messageHandler(session, "EXPORT car "+format))
+		e.messageHandler(session, "DROP copy")
+
+		// Act
+		e.messageHandler(session, "IMPORT copy "+format)
+		for _, line := range strings.Split(exported, "\n") {
+			e.messageHandler(session, line)
+		}
+		report := e.messageHandler(session, "END")
+
+		// Assert
+		testutil.AssertEquals(t, "inserted 2 failed 0", string(report), format+" report")
+		testutil.AssertEquals(t, expected, string(e.messageHandler(session, "GET copy")), format+" records")
+	}
+}
+
+func TestImportRoundTripKeepsRecordIds(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	rejected := []string{
+		string(e.messageHandler(session, "NEW user:1 id 5 name 'x'")),
+		string(e.messageHandler(session, `NEW user:1 {"id": 5, "name": "x"}`)),
+	}
+	e.messageHandler(session, "NEW user:1 owner {id 5} name 'x'")
+	updated := string(e.messageHandler(session, "UPD user:1 id.x 5"))
+	expected := "id 1 name 'x' owner {id 5}"
+
+	for _, format := range []string{"JSONL", "CSV"} {
+		exported := string(e.messageHandler(session, "EXPORT user "+format))
+		e.messageHandler(session, "DROP copy")
+
+		// Act
+		e.messageHandler(session, "IMPORT copy "+format)
+		for _, line := range strings.Split(exported, "\n") {
+			e.messageHandler(session, line)
+		}
+		report := e.messageHandler(session, "END")
+
+		// Assert
+		testutil.AssertEquals(t, "inserted 1 failed 0", string(report), format+" report")
+		testutil.AssertEquals(t, expected, string(e.messageHandler(session, "GET copy")), format+" records")
+	}
+	for _, response := range append(rejected, updated) {
+		testutil.AssertContains(t, response, "invalid attribute id")
+	}
+	testutil.AssertEquals(t, expected, string(e.messageHandler(session, "GET user:1")), "record")
+}
+
+func TestImportConflicts(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+	lines := []string{`{"id":1,"name":"audi"}`, `{"id":2,"name":"fiat"}`}
+	importLines := func(command string) string {
+		e.messageHandler(session, command)
+		for _, line := range lines {
+			e.messageHandler(session, line)
+		}
+		return string(e.messageHandler(session, "END"))
+	}
+
+	// Act
+	failResult := importLines("IMPORT car")
+	skipResult := importLines("IMPORT car JSONL ON CONFLICT SKIP")
+	lines[0] = `{"id":1,"name":"vw"}`
+	replaceResult := importLines("IMPORT car ON CONFLICT REPLACE")
+	getResult := e.messageHandler(session, "GET car")
+
+	// Assert
+	testutil.AssertEquals(t, "inserted 1 failed 1\nline 1 ERR CONFLICT record car:1 already exists", failResult, "fail result")
+	testutil.AssertEquals(t, "inserted 0 skipped 2 failed 0", skipResult, "skip result")
+	testutil.AssertEquals(t, "inserted 0 replaced 2 failed 0", replaceResult, "replace result")
+	testutil.AssertEquals(t, "id 1 name 'vw'\nid 2 name 'fiat'", string(getResult), "get result")
+}
+
+func TestImportCSVInvalidHeader(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "IMPORT car CSV")
+
+	// Act
+	e.messageHandler(session, "name:string")
+	e.messageHandler(session, "bmw")
+	result := e.messageHandler(session, "END")
+
+	// Assert
+	testutil.AssertEquals(t, "inserted 0 failed 2\n"+
+		"line 1 ERR PARSE Error parsing csv header: first column must be id\n"+
+		"line 2 ERR INVALID_DATA invalid csv header", string(result), "result")
+}
+
+func TestExportCSVRowRejectsChangedRecords(t *testing.T) {
+	// Arrange
+	data := storage.Data{"name": "bmw", "year": "2020"}
+	record := &storage.Record{Id: 1, Data: &data}
+	types := map[string]string{"name": "string", "year": "int"}
+	columns := csvColumns(types)
+
+	// Act
+	_, typeErr := csvRow(record, columns, types)
+	delete(types, "year")
+	_, attributeErr := csvRow(record, csvColumns(types), types)
+	data["year"] = 2020
+	types["year"] = "int"
+	row, err := csvRow(record, csvColumns(types), types)
+
+	// Assert
+	testutil.AssertEquals(t, ErrCodeSerialization, ErrorCode(typeErr), "type error code")
+	testutil.AssertEquals(t, "Serialization error: record 1 changed during the export", typeErr.Error(), "type error")
+	testutil.AssertNotNil(t, attributeErr, "attribute error")
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, "1,bmw,2020", strings.Join(row, ","), "row")
+}
@@ -0,0 +1,456 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+const maxHookDepth = 8
+
+type HookPoint int
+
+const (
+	BeforeInsert HookPoint = iota
+	AfterInsert
+	BeforeUpdate
+	AfterUpdate
+	BeforeDelete
+	AfterDelete
+)
+
+var hookPoints = map[string]HookPoint{
+	"BEFORE INSERT": BeforeInsert,
+	"AFTER INSERT":  AfterInsert,
+	"BEFORE UPDATE": BeforeUpdate,
+	"AFTER UPDATE":  AfterUpdate,
+	"BEFORE DELETE": BeforeDelete,
+	"AFTER DELETE":  AfterDelete,
+}
+
+var hookedOperations = map[string]bool{
+	"NEW":    true,
+	"UPD":    true,
+	"DEL":    true,
+	"SET":    true,
+	"UNSET":  true,
+	"UPSERT": true,
+	"INCR":   true,
+	"DECR":   true,
+	"APPEND": true,
+}
+
+// HookContext describes the mutation a hook runs for. Old is nil for inserts
+// and New is nil for deletes. Before hooks may modify New to change what gets
+// stored.
+type HookContext struct {
+	Entity  string
+	Id      uint
+	Old     storage.Data
+	New     storage.Data
+	effects []string
+}
+
+// Enqueue schedules a command to run once the mutation that fired the hook
+// completes. Hooks run while the record is locked, so any further reads or
+// writes must go through Enqueue.
+func (ctx *HookContext) Enqueue(command string) {
+	ctx.effects = append(ctx.effects, command)
+}
+
+// Hook is called for a record mutation. An error returned from a before hook
+// rejects the mutation; errors from after hooks are only logged.
+type Hook func(ctx *HookContext) error
+
+type hookSet struct {
+	mu        sync.RWMutex
+	hooks     map[string]map[HookPoint][]Hook
+	triggers  map[string]*trigger
+	records   map[string]*hookedRecord
+	restoring atomic.Bool
+}
+
+// hookedRecord serializes the writes to a record while hooks are registered,
+// so the side effects its hooks enqueue belong to the write holding it.
+type hookedRecord struct {
+	mu      sync.Mutex
+	writers int
+	effects []string
+}
+
+type trigger struct {
+	name   string
+	entity string
+	timing string
+	event  string
+	point  HookPoint
+	args   []string
+}
+
+func newHookSet() *hookSet {
+	return &hookSet{
+		hooks:    make(map[string]map[HookPoint][]Hook),
+		triggers: make(map[string]*trigger),
+		records:  make(map[string]*hookedRecord),
+	}
+}
+
+// RegisterHook adds a hook for mutations of the entity at the given point.
+// The entity "*" matches every entity.
+func (e *Engine) RegisterHook(entity string, point HookPoint, hook Hook) {
+	e.hooks.mu.Lock()
+	defer e.hooks.mu.Unlock()
+	if e.hooks.hooks[entity] == nil {
+		e.hooks.hooks[entity] = make(map[HookPoint][]Hook)
+	}
+	e.hooks.hooks[entity][point] = append(e.hooks.hooks[entity][point], hook)
+}
+
+func (hs *hookSet) active() bool {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+	return len(hs.hooks) > 0 || len(hs.triggers) > 0
+}
+
+func (hs *hookSet) lookup(entity string, point HookPoint) []Hook {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+	hooks := make([]Hook, 0)
+	hooks = append(hooks, hs.hooks[entity][point]...)
+	if entity != "*" {
+		hooks = append(hooks, hs.hooks["*"][point]...)
+	}
+	for _, t := range hs.sortedTriggersLocked() {
+		if t.point == point && (t.entity == entity || t.entity == "*") {
+			hooks = append(hooks, t.run)
+		}
+	}
+	return hooks
+}
+
+func (hs *hookSet) sortedTriggersLocked() []*trigger {
+	triggers := make([]*trigger, 0, len(hs.triggers))
+	for _, t := range hs.triggers {
+		triggers = append(triggers, t)
+	}
+	sort.Slice(triggers, func(i, j int) bool { return triggers[i].name < triggers[j].name })
+	return triggers
+}
+
+func (hs *hookSet) enqueue(key string, effects []string) {
+	if len(effects) == 0 {
+		return
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	record := hs.records[key]
+	if record == nil {
+		// Hooks were registered during the write, which did not lock the
+		// record: the next write to it runs the effects.
+		record = &hookedRecord{}
+		hs.records[key] = record
+	}
+	record.effects = append(record.effects, effects...)
+}
+
+// lockRecords waits for the hooked writes to the records to finish. Records
+// are locked in key order, so writes to overlapping records cannot deadlock.
+func (hs *hookSet) lockRecords(keys []string) []*hookedRecord {
+	hs.mu.Lock()
+	records := make([]*hookedRecord, len(keys))
+	for i, key := range keys {
+		if hs.records[key] == nil {
+			hs.records[key] = &hookedRecord{}
+		}
+		records[i] = hs.records[key]
+		records[i].writers++
+	}
+	hs.mu.Unlock()
+
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return keys[order[i]] < keys[order[j]] })
+	for _, i := range order {
+		records[i].mu.Lock()
+	}
+	return records
+}
+
+// unlockRecords releases the records and returns the side effects their
+// hooks enqueued.
+func (hs *hookSet) unlockRecords(keys []string, records []*hookedRecord) []string {
+	hs.mu.Lock()
+	effects := make([]string, 0)
+	for i, record := range records {
+		effects = append(effects, record.effects...)
+		record.effects = nil
+		record.writers--
+		if record.writers == 0 {
+			delete(hs.records, keys[i])
+		}
+	}
+	hs.mu.Unlock()
+
+	for _, record := range records {
+		record.mu.Unlock()
+	}
+	return effects
+}
+
+func hookPointsFor(changeType storage.ChangeType) (HookPoint, HookPoint) {
+	switch changeType {
+	case storage.ChangeInsert:
+		return BeforeInsert, AfterInsert
+	case storage.ChangeUpdate:
+		return BeforeUpdate, AfterUpdate
+	default:
+		return BeforeDelete, AfterDelete
+	}
+}
+
+func (e *Engine) beforeChange(change *storage.Change) error {
+	if e.hooks.restoring.Load() {
+		return nil
+	}
+	point, _ := hookPointsFor(change.Type)
+	hooks := e.hooks.lookup(change.Entity, point)
+	if len(hooks) == 0 {
+		return nil
+	}
+	ctx := &HookContext{Entity: change.Entity, Id: change.Id, Old: change.Old, New: change.New}
+	if ctx.New == nil && change.Type != storage.ChangeDelete {
+		ctx.New = storage.Data{}
+	}
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			if ErrorCode(err) == ErrCodeInternal {
+				return &RejectedError{err.Error()}
+			}
+			return err
+		}
+	}
+	// Inserts and updates run with schemaMu held, and the hooks may have
+	// changed the record after the schema checked it.
+	if change.Type != storage.ChangeDelete {
+		if schema := e.checkedSchema(change.Entity); schema != nil {
+			if err := schema.ValidateRecord(ctx.New); err != nil {
+				return &ValidationError{fmt.Sprintf("record %s:%d after before hooks: %s", change.Entity, change.Id, err.Error())}
+			}
+		}
+	}
+	change.New = ctx.New
+	e.hooks.enqueue(recordKey(change.Entity, change.Id), ctx.effects)
+	return nil
+}
+
+func (e *Engine) afterChange(change storage.Change) {
+	e.changes.record(change)
+	if e.hooks.restoring.Load() {
+		return
+	}
+	_, point := hookPointsFor(change.Type)
+	hooks := e.hooks.lookup(change.Entity, point)
+	if len(hooks) == 0 {
+		return
+	}
+	ctx := &HookContext{Entity: change.Entity, Id: change.Id, Old: change.Old, New: change.New}
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			e.logger.Warn("after hook failed", "change", change.Type, "entity", change.Entity, "id", change.Id, "error", err)
+		}
+	}
+	e.hooks.enqueue(recordKey(change.Entity, change.Id), ctx.effects)
+}
+
+// withHooks runs a mutation of the records with the given ids and then the
+// side effects their hooks enqueued.
+func (e *Engine) withHooks(entity string, ids []uint, write func()) {
+	if !e.hooks.active() {
+		write()
+		return
+	}
+	e.runSideEffects(e.hookedWrite(entity, ids, write))
+}
+
+// hookedWrite runs a mutation with its records locked against other hooked
+// writes, which leaves writes to other records running, and returns the side
+// effects the hooks enqueued for them.
+func (e *Engine) hookedWrite(entity string, ids []uint, write func()) []string {
+	keys := make([]string, 0, len(ids))
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			keys = append(keys, recordKey(entity, id))
+		}
+	}
+	records := e.hooks.lockRecords(keys)
+	write()
+	return e.hooks.unlockRecords(keys, records)
+}
+
+func (e *Engine) runSideEffects(effects []string) {
+	for depth := 0; len(effects) > 0; depth++ {
+		if depth == maxHookDepth {
+			e.logger.Warn("hook side effects exceeded max depth", "depth", maxHookDepth, "dropped", len(effects))
+			return
+		}
+		next := make([]string, 0)
+		for _, command := range effects {
+			next = append(next, e.runSideEffect(command)...)
+		}
+		effects = next
+	}
+}
+
+func (e *Engine) runSideEffect(command string) []string {
+	parsedCommand, err := parser.ParseCommand(command)
+	if err != nil {
+		e.logger.Warn("hook side effect failed", "command", command, "error", err)
+		return nil
+	}
+	if e.cluster != nil {
+		if routesToOwner(parsedCommand) && isWriteOperation(parsedCommand) {
+			key := recordKey(parsedCommand.Entity, parsedCommand.Id.Lower)
+			if owner, moving := e.cluster.pendingOwner(key); moving {
+				e.logger.Warn("hook side effect failed", "command", command, "error", &MovedError{fmt.Sprintf("record %s is moving to node %s", key, owner)})
+				return nil
+			}
+		}
+		if response, routed := e.routeCommand(command, parsedCommand, textSerializer{}); routed {
+			if err := remoteError(response); err != nil {
+				e.logger.Warn("hook side effect failed", "command", command, "error", err)
+			}
+			return nil
+		}
+	}
+	effects := e.hookedWrite(parsedCommand.Entity, []uint{parsedCommand.Id.Lower}, func() {
+		_, err = e.dispatchCommand(parsedCommand, textSerializer{})
+	})
+	if err != nil {
+		e.logger.Warn("hook side effect failed", "command", command, "error", err)
+	}
+	return effects
+}
+
+// restoreSnapshot replaces all data with the snapshot commands without firing
+// hooks, since their effects are already part of the snapshot.
+func (e *Engine) restoreSnapshot(commands []string) {
+	e.hooks.restoring.Store(true)
+	defer e.hooks.restoring.Store(false)
+	e.hooks.mu.Lock()
+	e.hooks.triggers = make(map[string]*trigger)
+	e.hooks.mu.Unlock()
+	e.resetData()
+	for _, command := range commands {
+		if command != "" {
+			e.applyReplicated(command)
+		}
+	}
+}
+
+func (e *Engine) triggerCommand(parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	switch {
+	case len(parsedCommand.Args) == 0:
+		return e.listTriggers(serializer)
+	case parsedCommand.Args[0] == "DROP" && parsedCommand.Entity == "":
+		e.hooks.mu.Lock()
+		defer e.hooks.mu.Unlock()
+		if _, found := e.hooks.triggers[parsedCommand.Args[1]]; !found {
+			return nil, &NotFoundError{fmt.Sprintf("trigger %s not found", parsedCommand.Args[1])}
+		}
+		delete(e.hooks.triggers, parsedCommand.Args[1])
+		return []byte("1"), nil
+	}
+
+	name := parsedCommand.Args[0]
+	if parsedCommand.Args[3] == "COPY" {
+		if err := e.checkCopyTrigger(parsedCommand.Entity, parsedCommand.Args[4], parsedCommand.Args[5]); err != nil {
+			return nil, err
+		}
+	}
+	t := &trigger{
+		name:   name,
+		entity: parsedCommand.Entity,
+		timing: parsedCommand.Args[1],
+		event:  parsedCommand.Args[2],
+		point:  hookPoints[parsedCommand.Args[1]+" "+parsedCommand.Args[2]],
+		args:   parsedCommand.Args[3:],
+	}
+	e.hooks.mu.Lock()
+	defer e.hooks.mu.Unlock()
+	if _, found := e.hooks.triggers[name]; found {
+		return nil, &ConflictError{fmt.Sprintf("trigger %s already exists", name)}
+	}
+	e.hooks.triggers[name] = t
+	return []byte("1"), nil
+}
+
+// checkCopyTrigger rejects a COPY trigger that would write an attribute the
+// schema of the entity does not declare, or a value of another type.
+func (e *Engine) checkCopyTrigger(entity, source, target string) error {
+	schema := e.getSchema(entity)
+	if schema == nil {
+		return nil
+	}
+	targetField, found := schema.byName[target]
+	if !found {
+		return &ValidationError{fmt.Sprintf("trigger copies to attribute %s, which the schema of %s does not declare", target, entity)}
+	}
+	sourceField, found := schema.byName[source]
+	if found && targetField.Type != "any" && sourceField.Type != targetField.Type {
+		return &ValidationError{fmt.Sprintf("trigger copies %s of type %s to %s of type %s", source, sourceField.Type, target, targetField.Type)}
+	}
+	return nil
+}
+
+func (e *Engine) listTriggers(serializer recordSerializer) ([]byte, error) {
+	e.hooks.mu.RLock()
+	triggers := e.hooks.sortedTriggersLocked()
+	e.hooks.mu.RUnlock()
+	rows := make([][]interface{}, len(triggers))
+	for i, t := range triggers {
+		rows[i] = []interface{}{t.name, t.entity, t.timing, t.event, t.action()}
+	}
+	return serializer.serializeRows([]string{"name", "entity", "when", "event", "action"}, rows)
+}
+
+func (e *Engine) triggerCommands() []string {
+	e.hooks.mu.RLock()
+	defer e.hooks.mu.RUnlock()
+	triggers := e.hooks.sortedTriggersLocked()
+	commands := make([]string, len(triggers))
+	for i, t := range triggers {
+		commands[i] = t.command()
+	}
+	return commands
+}
+
+func (t *trigger) action() string {
+	if t.args[0] == "RUN" {
+		quoted, _ := SerializeValue(t.args[1])
+		return "RUN " + quoted
+	}
+	return "COPY " + t.args[1] + " TO " + t.args[2]
+}
+
+func (t *trigger) command() string {
+	return fmt.Sprintf("TRIGGER %s ON %s %s %s %s", t.name, t.entity, t.timing, t.event, t.action())
+}
+
+func (t *trigger) run(ctx *HookContext) error {
+	if t.args[0] == "RUN" {
+		ctx.Enqueue(parser.ExpandTriggerCommand(t.args[1], ctx.Entity, ctx.Id))
+		return nil
+	}
+	if value, found := ctx.New[t.args[1]]; found {
+		ctx.New[t.args[2]] = storage.CloneValue(value)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestHookRejectsMutation(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.RegisterHook("car", BeforeUpdate, func(ctx *HookContext) error {
+		if ctx.New["year"] != ctx.Old["year"] {
+			return errors.New("year is frozen")
+		}
+		return nil
+	})
+	e.RegisterHook("car", BeforeDelete, func(ctx *HookContext) error {
+		return &ValidationError{"cars cannot be deleted"}
+	})
+	e.messageHandler(session, "NEW car:1 name 'bmw' year 2020")
+
+	// Act
+	updated := e.messageHandler(session, "UPD car:1 year 2021")
+	incremented := e.messageHandler(session, "INCR car:1 year")
+	renamed := e.messageHandler(session, "UPD car:1 name 'audi'")
+	deleted := e.messageHandler(session, "DEL car:1")
+	record := e.messageHandler(session, "GET car:1")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR REJECTED year is frozen", string(updated), "updated")
+	testutil.AssertEquals(t, "ERR REJECTED year is frozen", string(incremented), "incremented")
+	testutil.AssertEquals(t, "1", string(renamed), "renamed")
+	testutil.AssertEquals(t, "ERR VALIDATION cars cannot be deleted", string(deleted), "deleted")
+	testutil.AssertEquals(t, "id 1 name 'audi' year 2020", string(record), "record")
+}
+
+func TestHookModifiesRecord(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.RegisterHook("*", BeforeInsert, func(ctx *HookContext) error {
+		ctx.New["source"] = ctx.Entity
+		return nil
+	})
+
+	// Act
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+	e.messageHandler(session, "NEW truck:1")
+	car := e.messageHandler(session, "GET car:1")
+	truck := e.messageHandler(session, "GET truck:1")
+
+	// Assert
+	testutil.AssertEquals(t, "id 1 name 'bmw' source 'car'", string(car), "car")
+	testutil.AssertEquals(t, "id 1 source 'truck'", string(truck), "truck")
+}
+
+func TestHookSideEffectsMaintainDerivedCount(t *testing.T) {
+	// Arrange
+	output := &strings.Builder{}
+	logger, _ := server.NewLogger(output, "text", "info")
+	e := New(Config{Logger: logger})
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW stats:1 cars 0")
+	e.RegisterHook("car", AfterInsert, func(ctx *HookContext) error {
+		ctx.Enqueue("INCR stats:1 cars")
+		return nil
+	})
+	e.RegisterHook("car", AfterDelete, func(ctx *HookContext) error {
+		ctx.Enqueue("DECR stats:1 cars")
+		return errors.New("after hook errors are only logged")
+	})
+
+	// Act
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+	e.messageHandler(session, "NEW car:2 name 'audi'")
+	e.messageHandler(session, "NEW car:1 name 'duplicated'")
+	e.messageHandler(session, "BULK car")
+	e.messageHandler(session, "id 3 name 'fiat'")
+	e.messageHandler(session, "END")
+	deleted := e.messageHandler(session, "DEL car:2")
+	stats := e.messageHandler(session, "GET stats:1")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(deleted), "deleted")
+	testutil.AssertEquals(t, "id 1 cars 2", string(stats), "stats")
+	testutil.AssertContains(t, output.String(), `level=WARN msg="after hook failed" change=delete entity=car id=2 error="after hook errors are only logged"`)
+}
+
+func TestHookSideEffectsStopAtMaxDepth(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW counter:1 n 0")
+	e.RegisterHook("counter", AfterUpdate, func(ctx *HookContext) error {
+		ctx.Enqueue("INCR counter:1 n")
+		return nil
+	})
+
+	// Act
+	e.messageHandler(session, "INCR counter:1 n")
+	counter := e.messageHandler(session, "GET counter:1")
+
+	// Assert
+	testutil.AssertEquals(t, "id 1 n 9", string(counter), "counter")
+}
+
+func TestHookedWritesToOtherRecordsRunConcurrently(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW slow:1 n 0")
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	e.RegisterHook("slow", BeforeUpdate, func(ctx *HookContext) error {
+		close(blocked)
+		<-release
+		return nil
+	})
+	e.RegisterHook("car", AfterInsert, func(ctx *HookContext) error {
+		ctx.Enqueue(fmt.Sprintf("NEW log:%d car %d", ctx.Id, ctx.Id))
+		return nil
+	})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		e.messageHandler(server.NewSession("slow"), "UPD slow:1 n 1")
+	}()
+	<-blocked
+
+	// Act
+	logs := make([]string, 0)
+	for i := 1; i <= 3; i++ {
+		e.messageHandler(session, fmt.Sprintf("NEW car:%d", i))
+		logs = append(logs, string(e.messageHandler(session, fmt.Sprintf("GET log:%d", i))))
+	}
+	close(release)
+	wg.Wait()
+
+	// Assert
+	testutil.AssertEquals(t, "id 1 car 1,id 2 car 2,id 3 car 3", strings.Join(logs, ","), "logs")
+	testutil.AssertEquals(t, "id 1 n 1", string(e.messageHandler(session, "GET slow:1")), "slow")
+}
+
+func TestTriggers(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+
+	// Act
+	empty := e.messageHandler(session, "TRIGGER")
+	copied := e.messageHandler(session, "TRIGGER slug ON post BEFORE INSERT COPY title TO slug")
+	run := e.messageHandler(session, "TRIGGER audit ON post AFTER DELETE RUN 'NEW log:$id entity \\'$entity\\''")
+	duplicated := e.messageHandler(session, "TRIGGER audit ON car AFTER DELETE RUN 'DEL car:$id'")
+	e.messageHandler(session, "NEW post:7 title 'hello'")
+	e.messageHandler(session, "DEL post:7")
+	post := e.messageHandler(session, "NEW post:8 title 'again'")
+	dropped := e.messageHandler(session, "TRIGGER DROP slug")
+	missing := e.messageHandler(session, "TRIGGER DROP slug")
+	e.messageHandler(session, "NEW post:9 title 'plain'")
+	list := e.messageHandler(session, "TRIGGER")
+	log := e.messageHandler(session, "GET log:7")
+	posts := e.messageHandler(session, "GET post")
+
+	// Assert
+	testutil.AssertEquals(t, "", string(empty), "empty list")
+	testutil.AssertEquals(t, "1", string(copied), "copy trigger")
+	testutil.AssertEquals(t, "1", string(run), "run trigger")
+	testutil.AssertEquals(t, "ERR CONFLICT trigger audit already exists", string(duplicated), "duplicated")
+	testutil.AssertEquals(t, "1", string(post), "post")
+	testutil.AssertEquals(t, "1", string(dropped), "dropped")
+	testutil.AssertEquals(t, "ERR NOT_FOUND trigger slug not found", string(missing), "missing")
+	testutil.AssertEquals(t, `name 'audit' entity 'post' when 'AFTER' event 'DELETE' action 'RUN \'NEW log:$id entity \\\'$entity\\\'\''`, string(list), "list")
+	testutil.AssertEquals(t, "id 7 entity 'post'", string(log), "log")
+	testutil.AssertEquals(t, "id 8 slug 'again' title 'again'\nid 9 title 'plain'", string(posts), "posts")
+}
+
+func TestTriggersAreReplayedFromSnapshot(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "TRIGGER slug ON post BEFORE INSERT COPY title TO slug")
+	e.messageHandler(session, "TRIGGER audit ON post AFTER INSERT RUN 'NEW log:$id'")
+	e.messageHandler(session, "NEW post:1 title 'hello'")
+	snapshot := e.snapshotCommands()
+	restored := New(DefaultConfig())
+
+	// Act
+	restored.restoreSnapshot(snapshot)
+	restored.messageHandler(session, "NEW post:2 title 'again'")
+
+	// Assert
+	testutil.AssertEquals(t, "TRIGGER audit ON post AFTER INSERT RUN 'NEW log:$id'", snapshot[len(snapshot)-2], "trigger command")
+	testutil.AssertEquals(t, "TRIGGER slug ON post BEFORE INSERT COPY title TO slug", snapshot[len(snapshot)-1], "copy trigger command")
+	testutil.AssertEquals(t, "id 1 slug 'hello' title 'hello'\nid 2 slug 'again' title 'again'", string(restored.messageHandler(session, "GET post")), "posts")
+	testutil.AssertEquals(t, "id 1\nid 2", string(restored.messageHandler(session, "GET log")), "log")
+}
+
+func TestBeforeHooksAreCheckedAgainstSchema(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "SCHEMA p n:int name:string")
+	e.RegisterHook("p", BeforeUpdate, func(ctx *HookContext) error {
+		ctx.New["extra"] = true
+		return nil
+	})
+
+	// Act
+	conflicting := e.messageHandler(session, "TRIGGER cp ON p BEFORE INSERT COPY name TO n")
+	undeclared := e.messageHandler(session, "TRIGGER extra ON p BEFORE UPDATE COPY name TO extra")
+	e.messageHandler(session, "SCHEMA p NONE")
+	e.messageHandler(session, "TRIGGER cp ON p BEFORE INSERT COPY name TO n")
+	e.messageHandler(session, "SCHEMA p n:int name:string")
+	inserted := e.messageHandler(session, "NEW p:1 n 1 name 'abc'")
+	e.messageHandler(session, "TRIGGER DROP cp")
+	e.messageHandler(session, "NEW p:2 n 2 name 'abc'")
+	updated := e.messageHandler(session, "UPD p:2 n 3")
+	records := e.messageHandler(session, "GET p")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR VALIDATION trigger copies name of type string to n of type int", string(conflicting), "conflicting")
+	testutil.AssertEquals(t, "ERR VALIDATION trigger copies to attribute extra, which the schema of p does not declare", string(undeclared), "undeclared")
+	testutil.AssertEquals(t, "ERR VALIDATION record p:1 after before hooks: attribute n must be int, got 'abc'", string(inserted), "inserted")
+	testutil.AssertEquals(t, "ERR VALIDATION record p:2 after before hooks: unknown attribute extra", string(updated), "updated")
+	testutil.AssertEquals(t, "id 2 n 2 name 'abc'", string(records), "records")
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+)
+
+// Version is reported by INFO and can be set at build time with
+// -ldflags "-X github.com/gabrielluciano/liondb/internal/database/engine.Version=...".
+var Version = "dev"
+
+func ping(parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	if len(parsedCommand.Args) > 0 {
+		return []byte(parsedCommand.Args[0]), nil
+	}
+	return []byte("PONG"), nil
+}
+
+func (e *Engine) info(serializer recordSerializer) ([]byte, error) {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	connections := int64(0)
+	if e.server != nil {
+		connections = e.server.Connections()
+	}
+	e.mu.RLock()
+	entities := int64(len(e.storages))
+	e.mu.RUnlock()
+	persistence := "memory"
+	if e.config.RaftDir != "" {
+		persistence = "raft-log"
+	}
+	ready, _ := e.readiness()
+	return serializer.serializeRow(
+		[]string{"version", "uptime", "memory", "connections", "entities", "persistence", "ready"},
+		[]interface{}{Version, time.Since(e.startedAt).Round(time.Millisecond), int64(memory.Alloc), connections, entities, persistence, ready},
+	)
+}
+
+// readiness reports whether the engine has finished loading its data and can
+// serve consistent reads, or why it has not.
+func (e *Engine) readiness() (bool, string) {
+	switch {
+	case e.closed():
+		return false, "engine is closed"
+	case e.loading.Load():
+		return false, "engine is starting"
+	case e.hooks.restoring.Load():
+		return false, "restoring snapshot"
+	case e.replica != nil && !e.replica.connected.Load():
+		return false, "replica has not synced with its primary"
+	case e.raft != nil:
+		status := e.raft.Status()
+		if status.Leader == "" {
+			return false, "raft has no leader"
+		}
+		if status.LeaderCommit == 0 {
+			return false, "raft has not heard from its leader"
+		}
+		if status.Applied < status.Commit {
+			return false, "raft is replaying its log"
+		}
+		if status.Applied < status.LeaderCommit {
+			return false, "raft is catching up with its leader"
+		}
+	}
+	return true, ""
+}
+
+func (e *Engine) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if e.closed() {
+		http.Error(w, "engine is closed", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func (e *Engine) serveReadiness(w http.ResponseWriter, r *http.Request) {
+	if ready, reason := e.readiness(); !ready {
+		http.Error(w, reason, http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ready\n"))
+}
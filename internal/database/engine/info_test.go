@@ -0,0 +1,53 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestPingAndInfo(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+
+	// Act
+	pong := e.messageHandler(session, "PING")
+	echo := e.messageHandler(session, "PING hello there")
+	info := e.messageHandler(session, "INFO")
+
+	// Assert
+	testutil.AssertEquals(t, "PONG", string(pong), "pong")
+	testutil.AssertEquals(t, "hello there", string(echo), "echo")
+	testutil.AssertContains(t, string(info), "version 'dev' uptime d'")
+	testutil.AssertContains(t, string(info), " connections 0 entities 1 persistence 'memory' ready true")
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	replica := New(Config{ReplicaOf: "127.0.0.1:1"})
+
+	// Act
+	healthCode, health := scrape(t, e, "/healthz")
+	readyCode, ready := scrape(t, e, "/readyz")
+	e.loading.Store(true)
+	loadingCode, loading := scrape(t, e, "/readyz")
+	e.loading.Store(false)
+	replicaCode, replicaReason := scrape(t, replica, "/readyz")
+	e.Close()
+	closedCode, _ := scrape(t, e, "/healthz")
+
+	// Assert
+	testutil.AssertEquals(t, 200, healthCode, "health code")
+	testutil.AssertEquals(t, "ok\n", health, "health")
+	testutil.AssertEquals(t, 200, readyCode, "ready code")
+	testutil.AssertEquals(t, "ready\n", ready, "ready")
+	testutil.AssertEquals(t, 503, loadingCode, "loading code")
+	testutil.AssertEquals(t, "engine is starting\n", loading, "loading")
+	testutil.AssertEquals(t, 503, replicaCode, "replica code")
+	testutil.AssertEquals(t, "replica has not synced with its primary\n", replicaReason, "replica reason")
+	testutil.AssertEquals(t, 503, closedCode, "closed code")
+}
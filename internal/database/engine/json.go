@@ -0,0 +1,267 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) serializeRecord(record *storage.Record) ([]byte, error) {
+	return SerializeRecordJSON(record)
+}
+
+func (jsonSerializer) serializeRecords(records []*storage.Record) ([]byte, error) {
+	return SerializeRecordsJSON(records)
+}
+
+func (jsonSerializer) serializePage(records []*storage.Record, cursor string) ([]byte, error) {
+	serializedRecords, err := SerializeRecordsJSON(records)
+	if err != nil {
+		return nil, err
+	}
+	serializedCursor := []byte("null")
+	if cursor != "" {
+		serializedCursor, _ = marshalJSON(cursor)
+	}
+	response := append([]byte(`{"records":`), serializedRecords...)
+	response = append(response, `,"cursor":`...)
+	response = append(response, serializedCursor...)
+	return append(response, '}'), nil
+}
+
+func (jsonSerializer) serializeRow(columns []string, row []interface{}) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	buffer.WriteByte('{')
+	for i, column := range columns {
+		value, err := jsonValue(row[i])
+		if err != nil {
+			return nil, &SerializationError{message: err.Error()}
+		}
+		encodedColumn, _ := marshalJSON(column)
+		encodedValue, err := marshalJSON(value)
+		if err != nil {
+			return nil, &SerializationError{message: err.Error()}
+		}
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		buffer.Write(encodedColumn)
+		buffer.WriteByte(':')
+		buffer.Write(encodedValue)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+func (serializer jsonSerializer) serializeRows(columns []string, rows [][]interface{}) ([]byte, error) {
+	serializedRows := make([][]byte, len(rows))
+	for i, row := range rows {
+		serializedRow, err := serializer.serializeRow(columns, row)
+		if err != nil {
+			return nil, err
+		}
+		serializedRows[i] = serializedRow
+	}
+	return append(append([]byte{'['}, bytes.Join(serializedRows, []byte{','})...), ']'), nil
+}
+
+func (jsonSerializer) serializeBulkReport(report *bulkReport) []byte {
+	type jsonBulkFailure struct {
+		Line    int    `json:"line"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	failures := make([]jsonBulkFailure, len(report.failures))
+	for i, failure := range report.failures {
+		failures[i] = jsonBulkFailure{Line: failure.line, Code: ErrorCode(failure.err), Message: failure.err.Error()}
+	}
+	encoded, _ := marshalJSON(struct {
+		Inserted int               `json:"inserted"`
+		Skipped  *int              `json:"skipped,omitempty"`
+		Replaced *int              `json:"replaced,omitempty"`
+		Failed   int               `json:"failed"`
+		Errors   []jsonBulkFailure `json:"errors"`
+	}{report.inserted, conflictCount(report, "SKIP", report.skipped), conflictCount(report, "REPLACE", report.replaced), report.failed, failures})
+	return encoded
+}
+
+func conflictCount(report *bulkReport, conflict string, count int) *int {
+	if report.conflict != conflict {
+		return nil
+	}
+	return &count
+}
+
+func (jsonSerializer) serializeError(err error) []byte {
+	return SerializeErrorJSON(err)
+}
+
+type jsonError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func SerializeRecordJSON(record *storage.Record) ([]byte, error) {
+	return serializeRecordJSON(record, jsonValue)
+}
+
+func SerializeRecordExtendedJSON(record *storage.Record) ([]byte, error) {
+	return serializeRecordJSON(record, extendedJSONValue)
+}
+
+func serializeRecordJSON(record *storage.Record, convert func(value interface{}) (interface{}, error)) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	buffer.WriteString(`{"id":`)
+	buffer.WriteString(strconv.FormatUint(uint64(record.Id), 10))
+	if record.Data != nil {
+		for _, key := range record.Data.Keys() {
+			value, err := convert((*record.Data)[key])
+			if err != nil {
+				return []byte{}, &SerializationError{message: err.Error()}
+			}
+			encodedKey, _ := marshalJSON(key)
+			encodedValue, err := marshalJSON(value)
+			if err != nil {
+				return []byte{}, &SerializationError{message: err.Error()}
+			}
+			buffer.WriteByte(',')
+			buffer.Write(encodedKey)
+			buffer.WriteByte(':')
+			buffer.Write(encodedValue)
+		}
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes(), nil
+}
+
+func SerializeRecordsJSON(records []*storage.Record) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	buffer.WriteByte('[')
+	for i, record := range records {
+		serialized, err := SerializeRecordJSON(record)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		buffer.Write(serialized)
+	}
+	buffer.WriteByte(']')
+	return buffer.Bytes(), nil
+}
+
+func SerializeErrorJSON(err error) []byte {
+	encoded, _ := marshalJSON(map[string]jsonError{
+		"error": {Code: ErrorCode(err), Message: err.Error()},
+	})
+	return encoded
+}
+
+func jsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, errors.New("error serializing non-finite float")
+		}
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case time.Duration:
+		return v.String(), nil
+	case storage.Data:
+		return jsonObject(v)
+	case map[string]interface{}:
+		return jsonObject(storage.Data(v))
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, nested := range v {
+			converted, err := jsonValue(nested)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		return list, nil
+	case nil, bool, int, int64, uint, uint64, string:
+		return v, nil
+	default:
+		return nil, errors.New("error serializing value")
+	}
+}
+
+func extendedJSONValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		serialized, err := serializeFloat(v)
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(serialized), nil
+	case time.Time:
+		return map[string]string{"$timestamp": v.Format(time.RFC3339Nano)}, nil
+	case time.Duration:
+		return map[string]string{"$duration": v.String()}, nil
+	case uint:
+		return map[string]string{"$uint": strconv.FormatUint(uint64(v), 10)}, nil
+	case uint64:
+		return map[string]string{"$uint": strconv.FormatUint(v, 10)}, nil
+	case storage.Data:
+		return extendedJSONObject(v)
+	case map[string]interface{}:
+		return extendedJSONObject(storage.Data(v))
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, nested := range v {
+			converted, err := extendedJSONValue(nested)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		return list, nil
+	default:
+		return jsonValue(v)
+	}
+}
+
+func extendedJSONObject(object storage.Data) (map[string]interface{}, error) {
+	converted := make(map[string]interface{}, len(object))
+	for key, nested := range object {
+		value, err := extendedJSONValue(nested)
+		if err != nil {
+			return nil, err
+		}
+		converted[key] = value
+	}
+	return converted, nil
+}
+
+func jsonObject(object storage.Data) (map[string]interface{}, error) {
+	converted := make(map[string]interface{}, len(object))
+	for key, nested := range object {
+		value, err := jsonValue(nested)
+		if err != nil {
+			return nil, err
+		}
+		converted[key] = value
+	}
+	return converted, nil
+}
+
+func marshalJSON(value interface{}) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buffer.Bytes(), []byte("\n")), nil
+}
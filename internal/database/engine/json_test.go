@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestSerializeRecordJSON(t *testing.T) {
+	// Arrange
+	record := &storage.Record{
+		Id: 1,
+		Data: &storage.Data{
+			"name":    "John <Silva>",
+			"age":     int64(45),
+			"weight":  75.8,
+			"smoker":  false,
+			"spouse":  nil,
+			"address": storage.Data{"zip": uint64(123), "city": "SP"},
+			"tags":    []interface{}{"a", 90 * time.Second},
+			"born":    time.Date(1979, 3, 1, 10, 30, 0, 0, time.UTC),
+		},
+	}
+
+	// Act
+	serialized, err := SerializeRecordJSON(record)
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, `{"id":1,"address":{"city":"SP","zip":123},"age":45,`+
+		`"born":"1979-03-01T10:30:00Z","name":"John <Silva>","smoker":false,"spouse":null,`+
+		`"tags":["a","1m30s"],"weight":75.8}`, string(serialized), "serialized")
+}
+
+func TestJSONFormatWritesASingleIdKey(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "FORMAT json")
+
+	// Act
+	rejected := e.messageHandler(session, `NEW user:1 {"id": 5, "name": "x"}`)
+	e.messageHandler(session, `NEW user:1 {"name": "x", "owner": {"id": 5}}`)
+	record := e.messageHandler(session, "GET user:1")
+
+	// Assert
+	testutil.AssertEquals(t, `{"error":{"code":"PARSE","message":"Error parsing data: invalid attribute id, id is reserved for the record id"}}`,
+		string(rejected), "rejected")
+	testutil.AssertEquals(t, `{"id":1,"name":"x","owner":{"id":5}}`, string(record), "record")
+}
+
+func TestSerializeRecordsJSON(t *testing.T) {
+	// Arrange
+	records := []*storage.Record{
+		{Id: 1, Data: &storage.Data{"name": "bmw"}},
+		{Id: 2, Data: &storage.Data{"name": "audi"}},
+	}
+
+	// Act
+	serialized, err := SerializeRecordsJSON(records)
+	empty, emptyErr := SerializeRecordsJSON(nil)
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertNil(t, emptyErr, "empty error")
+	testutil.AssertEquals(t, `[{"id":1,"name":"bmw"},{"id":2,"name":"audi"}]`, string(serialized), "serialized")
+	testutil.AssertEquals(t, `[]`, string(empty), "empty")
+}
+
+func TestSerializeErrorJSON(t *testing.T) {
+	// Act
+	serialized := SerializeErrorJSON(recordNotFound("car", 1))
+
+	// Assert
+	testutil.AssertEquals(t, `{"error":{"code":"NOT_FOUND","message":"record car:1 not found"}}`,
+		string(serialized), "serialized")
+}
@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/metrics"
+)
+
+type engineMetrics struct {
+	registry    *metrics.Registry
+	commands    *metrics.Counter
+	parseErrors *metrics.Counter
+	latency     *metrics.Histogram
+}
+
+func (e *Engine) newMetrics() *engineMetrics {
+	registry := metrics.NewRegistry()
+	m := &engineMetrics{
+		registry:    registry,
+		commands:    registry.NewCounter("liondb_commands_total", "Commands executed, by operation.", "operation"),
+		parseErrors: registry.NewCounter("liondb_parse_errors_total", "Commands rejected because they could not be parsed."),
+		latency:     registry.NewHistogram("liondb_command_duration_seconds", "Time spent executing commands, by operation.", nil, "operation"),
+	}
+	registry.NewGaugeFunc("liondb_connections_active", "Client connections currently open.", nil, func() []metrics.Sample {
+		if e.server == nil {
+			return []metrics.Sample{{}}
+		}
+		return []metrics.Sample{{Value: float64(e.server.Connections())}}
+	})
+	registry.NewCounterFunc("liondb_bytes_received_total", "Bytes read from client connections.", nil, func() []metrics.Sample {
+		if e.server == nil {
+			return []metrics.Sample{{}}
+		}
+		return []metrics.Sample{{Value: float64(e.server.BytesReceived())}}
+	})
+	registry.NewCounterFunc("liondb_bytes_sent_total", "Bytes written to client connections.", nil, func() []metrics.Sample {
+		if e.server == nil {
+			return []metrics.Sample{{}}
+		}
+		return []metrics.Sample{{Value: float64(e.server.BytesSent())}}
+	})
+	registry.NewGaugeFunc("liondb_entity_records", "Records stored, by entity.", []string{"entity"}, e.entityRecordSamples)
+	return m
+}
+
+func (m *engineMetrics) observe(operation string, duration time.Duration) {
+	m.commands.Inc(operation)
+	m.latency.Observe(duration.Seconds(), operation)
+}
+
+func (e *Engine) entityRecordSamples() []metrics.Sample {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	samples := make([]metrics.Sample, 0, len(e.storages))
+	for name, s := range e.storages {
+		samples = append(samples, metrics.Sample{Labels: []string{name}, Value: float64(s.Len())})
+	}
+	return samples
+}
+
+func (e *Engine) monitoringHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e.metrics.registry)
+	mux.HandleFunc("/healthz", e.serveHealth)
+	mux.HandleFunc("/readyz", e.serveReadiness)
+	return mux
+}
+
+func (e *Engine) ServeMonitoring(listener net.Listener) {
+	e.closeMu.Lock()
+	e.listeners = append(e.listeners, listener)
+	e.closeMu.Unlock()
+	http.Serve(listener, e.monitoringHandler())
+}
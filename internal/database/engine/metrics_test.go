@@ -0,0 +1,49 @@
+package engine
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func scrape(t *testing.T, e *Engine, path string) (int, string) {
+	recorder := httptest.NewRecorder()
+	e.monitoringHandler().ServeHTTP(recorder, httptest.NewRequest("GET", path, nil))
+	body, err := io.ReadAll(recorder.Body)
+	if err != nil {
+		t.Fatalf("Error reading response: %v", err)
+	}
+	return recorder.Code, string(body)
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	defer e.Close()
+	client := dialEngine(t, serveEngine(t, e))
+	client.send(t, "NEW car:1 name 'bmw'")
+	client.send(t, "NEW car:2 name 'audi'")
+	client.send(t, "NEW truck:1 name 'volvo'")
+	client.send(t, "GET car:1")
+	client.send(t, "DEL car:2")
+	client.send(t, "BOGUS")
+
+	// Act
+	code, body := scrape(t, e, "/metrics")
+
+	// Assert
+	testutil.AssertEquals(t, 200, code, "status code")
+	testutil.AssertContains(t, body, "# TYPE liondb_commands_total counter\n")
+	testutil.AssertContains(t, body, "liondb_commands_total{operation=\"NEW\"} 3\n")
+	testutil.AssertContains(t, body, "liondb_commands_total{operation=\"GET\"} 1\n")
+	testutil.AssertContains(t, body, "liondb_commands_total{operation=\"DEL\"} 1\n")
+	testutil.AssertContains(t, body, "liondb_parse_errors_total 1\n")
+	testutil.AssertContains(t, body, "liondb_connections_active 1\n")
+	testutil.AssertContains(t, body, "liondb_entity_records{entity=\"car\"} 1\n")
+	testutil.AssertContains(t, body, "liondb_entity_records{entity=\"truck\"} 1\n")
+	testutil.AssertContains(t, body, "liondb_bytes_received_total 94\n")
+	testutil.AssertContains(t, body, "liondb_command_duration_seconds_count{operation=\"NEW\"} 3\n")
+	testutil.AssertContains(t, body, "liondb_command_duration_seconds_bucket{operation=\"GET\",le=\"+Inf\"} 1\n")
+}
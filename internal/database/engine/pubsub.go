@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"strconv"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/server"
+)
+
+func isChannelCommand(parsedCommand *parser.ParsedCommand) bool {
+	switch parsedCommand.Operation {
+	case "PUBLISH":
+		return true
+	case "SUBSCRIBE", "UNSUBSCRIBE":
+		return parsedCommand.Entity == "" && len(parsedCommand.Args) > 0
+	}
+	return false
+}
+
+func (e *Engine) channelCommand(session *server.Session, parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	if e.pubsub == nil {
+		return nil, &InvalidOperationError{"pub/sub is not available without a server"}
+	}
+	if parsedCommand.Operation == "PUBLISH" {
+		delivered := e.pubsub.Publish(parsedCommand.Args[0], (*parsedCommand.Data)["message"])
+		return []byte(strconv.Itoa(delivered)), nil
+	}
+
+	format := channelMessageFormatter(serializer)
+	names := parsedCommand.Args[1:]
+	var subscriptions int
+	switch {
+	case parsedCommand.Operation == "SUBSCRIBE" && parsedCommand.Args[0] == "CHANNEL":
+		subscriptions = e.pubsub.Subscribe(session, format, names...)
+	case parsedCommand.Operation == "SUBSCRIBE":
+		subscriptions = e.pubsub.SubscribePattern(session, format, names...)
+	case parsedCommand.Args[0] == "CHANNEL":
+		subscriptions = e.pubsub.Unsubscribe(session, names...)
+	default:
+		subscriptions = e.pubsub.UnsubscribePattern(session, names...)
+	}
+	return serializer.serializeRow([]string{"subscriptions"}, []interface{}{int64(subscriptions)})
+}
+
+func channelMessageFormatter(serializer recordSerializer) server.MessageFormatter {
+	return func(message server.Message) []byte {
+		columns := []string{"channel", "message"}
+		row := []interface{}{message.Channel, message.Payload}
+		if message.Pattern != "" {
+			columns = []string{"pattern", "channel", "message"}
+			row = []interface{}{message.Pattern, message.Channel, message.Payload}
+		}
+		serialized, err := serializer.serializeRow(columns, row)
+		if err != nil {
+			return serializer.serializeError(err)
+		}
+		return serialized
+	}
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestPublishToChannelSubscribers(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	defer e.Close()
+	address := serveEngine(t, e)
+	subscriber := dialEngine(t, address)
+	jsonSubscriber := dialEngine(t, address)
+	publisher := dialEngine(t, address)
+	jsonSubscriber.send(t, "FORMAT json")
+
+	// Act
+	subscribed := subscriber.send(t, "SUBSCRIBE CHANNEL news alerts")
+	patterned := jsonSubscriber.send(t, "SUBSCRIBE PATTERN news.*")
+	first := publisher.send(t, "PUBLISH news 'hello world'")
+	second := publisher.send(t, "PUBLISH news.sport {score 3}")
+	message := subscriber.read(t)
+	jsonMessage := jsonSubscriber.read(t)
+	unsubscribed := subscriber.send(t, "UNSUBSCRIBE CHANNEL news")
+	third := publisher.send(t, "PUBLISH news 'nobody'")
+	record := subscriber.send(t, "NEW car:1 name 'bmw'")
+
+	// Assert
+	testutil.AssertEquals(t, "subscriptions 2", subscribed, "subscribed")
+	testutil.AssertEquals(t, `{"subscriptions":1}`, patterned, "patterned")
+	testutil.AssertEquals(t, "1", first, "first deliveries")
+	testutil.AssertEquals(t, "1", second, "second deliveries")
+	testutil.AssertEquals(t, "channel 'news' message 'hello world'", message, "message")
+	testutil.AssertEquals(t, `{"pattern":"news.*","channel":"news.sport","message":{"score":3}}`, jsonMessage, "json message")
+	testutil.AssertEquals(t, "subscriptions 1", unsubscribed, "unsubscribed")
+	testutil.AssertEquals(t, "0", third, "third deliveries")
+	testutil.AssertEquals(t, "1", record, "commands still work")
+}
+
+func TestPublishWithoutServer(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+
+	// Act
+	response := e.messageHandler(server.NewSession("test"), "PUBLISH news 'hello'")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR INVALID_OPERATION pub/sub is not available without a server", string(response), "response")
+}
@@ -0,0 +1,407 @@
+package engine
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+// sortedPageSize bounds the records kept in memory by an ORDER BY on
+// attributes other than id when no LIMIT is given; the rest of the result is
+// reached through the returned cursor.
+const sortedPageSize = 1000
+
+type cursorPosition struct {
+	lastId uint
+	values []interface{}
+}
+
+// recordMatcher reports whether a record is selected by the query's
+// conditions. A clustered node only answers for the records it owns.
+func (e *Engine) recordMatcher(parsedCommand *parser.ParsedCommand) func(record *storage.Record) bool {
+	if e.cluster == nil {
+		return func(record *storage.Record) bool {
+			return matchesConditions(record, parsedCommand.Where)
+		}
+	}
+	return func(record *storage.Record) bool {
+		return matchesConditions(record, parsedCommand.Where) && e.cluster.owns(recordKey(parsedCommand.Entity, record.Id))
+	}
+}
+
+func selectRecords(parsedCommand *parser.ParsedCommand, s *storage.Storage, matches func(record *storage.Record) bool) ([]*storage.Record, string, error) {
+	if !sortsByAttributes(parsedCommand) {
+		return selectRecordsById(parsedCommand, s, matches)
+	}
+	return selectRecordsSorted(parsedCommand, s, matches)
+}
+
+// sortsByAttributes reports whether the query orders by attributes other
+// than id, which needs its matches sorted in memory.
+func sortsByAttributes(parsedCommand *parser.ParsedCommand) bool {
+	orderBy := parsedCommand.OrderBy
+	return !(len(orderBy) == 0 || len(orderBy) == 1 && orderBy[0].Attribute == "id")
+}
+
+func selectRecordsById(parsedCommand *parser.ParsedCommand, s *storage.Storage, matches func(record *storage.Record) bool) ([]*storage.Record, string, error) {
+	descending := len(parsedCommand.OrderBy) == 1 && parsedCommand.OrderBy[0].Descending
+	lower, upper := parsedCommand.Id.Lower, parsedCommand.Id.Upper
+	if parsedCommand.Cursor != "" {
+		position, err := decodeCursor(parsedCommand.Entity, parsedCommand.Cursor, 0)
+		if err != nil {
+			return nil, "", err
+		}
+		if descending {
+			if position.lastId <= 1 {
+				return []*storage.Record{}, "", nil
+			}
+			if upper == 0 || upper > position.lastId-1 {
+				upper = position.lastId - 1
+			}
+		} else {
+			lower = max(lower, position.lastId+1)
+		}
+	}
+
+	offset := pageOffset(parsedCommand)
+	records := make([]*storage.Record, 0)
+	skipped := 0
+	hasMore := false
+	iterator := func(record *storage.Record) bool {
+		if !matches(record) {
+			return true
+		}
+		if skipped < offset {
+			skipped++
+			return true
+		}
+		if parsedCommand.Limit > 0 && len(records) == parsedCommand.Limit {
+			hasMore = true
+			return false
+		}
+		records = append(records, record)
+		return true
+	}
+	if descending {
+		s.IterateOverRangeDescending(lower, upper, iterator)
+	} else {
+		s.IterateOverRange(lower, upper, iterator)
+	}
+
+	cursor := ""
+	if hasMore {
+		cursor = encodeCursor(parsedCommand.Entity, cursorPosition{lastId: records[len(records)-1].Id})
+	}
+	return records, cursor, nil
+}
+
+func selectRecordsSorted(parsedCommand *parser.ParsedCommand, s *storage.Storage, matches func(record *storage.Record) bool) ([]*storage.Record, string, error) {
+	orderBy := parsedCommand.OrderBy
+	var position *cursorPosition
+	if parsedCommand.Cursor != "" {
+		decoded, err := decodeCursor(parsedCommand.Entity, parsedCommand.Cursor, len(orderBy))
+		if err != nil {
+			return nil, "", err
+		}
+		position = &decoded
+	}
+
+	offset := pageOffset(parsedCommand)
+	limit := pageLimit(parsedCommand)
+	sorter := &recordSorter{orderBy: orderBy, bound: offset + limit + 1}
+	s.IterateOverRange(parsedCommand.Id.Lower, parsedCommand.Id.Upper, func(record *storage.Record) bool {
+		if !matches(record) {
+			return true
+		}
+		if position == nil || comparePosition(record, orderBy, *position) > 0 {
+			sorter.add(record)
+		}
+		return true
+	})
+	records := sorter.sorted()
+
+	if offset >= len(records) {
+		return []*storage.Record{}, "", nil
+	}
+	records = records[offset:]
+	cursor := ""
+	if len(records) > limit {
+		records = records[:limit]
+		last := records[len(records)-1]
+		cursor = encodeCursor(parsedCommand.Entity, cursorPosition{lastId: last.Id, values: orderValues(last, orderBy)})
+	}
+	return records, cursor, nil
+}
+
+// pageOffset is the number of matching records to skip. A cursor already
+// points past the records skipped on the first page, so OFFSET is ignored
+// when paging on with it.
+func pageOffset(parsedCommand *parser.ParsedCommand) int {
+	if parsedCommand.Cursor != "" {
+		return 0
+	}
+	return parsedCommand.Offset
+}
+
+// pageLimit is the number of records returned at most, 0 when unbounded.
+func pageLimit(parsedCommand *parser.ParsedCommand) int {
+	if parsedCommand.Limit == 0 && sortsByAttributes(parsedCommand) {
+		return sortedPageSize
+	}
+	return parsedCommand.Limit
+}
+
+func matchesConditions(record *storage.Record, conditions []parser.Condition) bool {
+	for _, condition := range conditions {
+		if !matchesCondition(attributeValue(record, condition.Attribute), condition) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesCondition(value interface{}, condition parser.Condition) bool {
+	comparable := storage.CompareValues(value, condition.Value)
+	sameKind := storage.SameKind(value, condition.Value)
+	switch condition.Operator {
+	case "=":
+		return comparable == 0
+	case "!=":
+		return comparable != 0
+	case "<":
+		return sameKind && comparable < 0
+	case "<=":
+		return sameKind && comparable <= 0
+	case ">":
+		return sameKind && comparable > 0
+	case ">=":
+		return sameKind && comparable >= 0
+	default:
+		return false
+	}
+}
+
+func attributeValue(record *storage.Record, attribute string) interface{} {
+	if attribute == "id" {
+		return uint64(record.Id)
+	}
+	if record.Data == nil {
+		return nil
+	}
+	value, _ := record.Data.GetPath(attribute)
+	return value
+}
+
+type recordSorter struct {
+	orderBy []parser.OrderKey
+	bound   int
+	records []*storage.Record
+}
+
+func (sorter *recordSorter) add(record *storage.Record) {
+	if len(sorter.records) < sorter.bound {
+		heap.Push(sorter, record)
+		return
+	}
+	if compareRecords(record, sorter.records[0], sorter.orderBy) < 0 {
+		sorter.records[0] = record
+		heap.Fix(sorter, 0)
+	}
+}
+
+func (sorter *recordSorter) sorted() []*storage.Record {
+	sort.Slice(sorter.records, func(i, j int) bool {
+		return compareRecords(sorter.records[i], sorter.records[j], sorter.orderBy) < 0
+	})
+	return sorter.records
+}
+
+func (sorter *recordSorter) Len() int {
+	return len(sorter.records)
+}
+
+func (sorter *recordSorter) Less(i, j int) bool {
+	return compareRecords(sorter.records[i], sorter.records[j], sorter.orderBy) > 0
+}
+
+func (sorter *recordSorter) Swap(i, j int) {
+	sorter.records[i], sorter.records[j] = sorter.records[j], sorter.records[i]
+}
+
+func (sorter *recordSorter) Push(record any) {
+	sorter.records = append(sorter.records, record.(*storage.Record))
+}
+
+func (sorter *recordSorter) Pop() any {
+	last := sorter.records[len(sorter.records)-1]
+	sorter.records = sorter.records[:len(sorter.records)-1]
+	return last
+}
+
+func compareRecords(a, b *storage.Record, orderBy []parser.OrderKey) int {
+	return compareOrder(orderValues(a, orderBy), a.Id, orderValues(b, orderBy), b.Id, orderBy)
+}
+
+func comparePosition(record *storage.Record, orderBy []parser.OrderKey, position cursorPosition) int {
+	return compareOrder(orderValues(record, orderBy), record.Id, position.values, position.lastId, orderBy)
+}
+
+func compareOrder(valuesA []interface{}, idA uint, valuesB []interface{}, idB uint, orderBy []parser.OrderKey) int {
+	for i, orderKey := range orderBy {
+		result := storage.CompareValues(valuesA[i], valuesB[i])
+		if orderKey.Descending {
+			result = -result
+		}
+		if result != 0 {
+			return result
+		}
+	}
+	switch {
+	case idA < idB:
+		return -1
+	case idA > idB:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func orderValues(record *storage.Record, orderBy []parser.OrderKey) []interface{} {
+	values := make([]interface{}, len(orderBy))
+	for i, orderKey := range orderBy {
+		values[i] = attributeValue(record, orderKey.Attribute)
+	}
+	return values
+}
+
+func projectRecords(records []*storage.Record, fields []string) []*storage.Record {
+	if len(fields) == 0 {
+		return records
+	}
+	projected := make([]*storage.Record, len(records))
+	for i, record := range records {
+		projected[i] = projectRecord(record, fields)
+	}
+	return projected
+}
+
+// projectRecord keeps only the given attribute paths. Containers keep their
+// kind, so selecting tags.0 and tags.2 from a list yields a list holding
+// those two elements in index order.
+func projectRecord(record *storage.Record, fields []string) *storage.Record {
+	if len(fields) == 0 || record.Data == nil {
+		return record
+	}
+	selection := projection{}
+	for _, field := range fields {
+		selection.add(strings.Split(field, "."))
+	}
+	projected, _ := selection.project(*record.Data)
+	data := projected.(storage.Data)
+	return &storage.Record{Id: record.Id, Data: &data}
+}
+
+// projection is a tree of selected path segments; a nil subtree selects the
+// whole value below it.
+type projection map[string]projection
+
+func (p projection) add(segments []string) {
+	child, found := p[segments[0]]
+	if found && child == nil {
+		return
+	}
+	if len(segments) == 1 {
+		p[segments[0]] = nil
+		return
+	}
+	if child == nil {
+		child = projection{}
+		p[segments[0]] = child
+	}
+	child.add(segments[1:])
+}
+
+func (p projection) project(value interface{}) (interface{}, bool) {
+	if p == nil {
+		return storage.CloneValue(value), true
+	}
+	switch node := value.(type) {
+	case storage.Data:
+		projected := storage.Data{}
+		for key, child := range p {
+			if nested, found := node[key]; found {
+				if childValue, found := child.project(nested); found {
+					projected[key] = childValue
+				}
+			}
+		}
+		return projected, len(projected) > 0
+	case []interface{}:
+		type element struct {
+			index int
+			child projection
+		}
+		elements := make([]element, 0, len(p))
+		for key, child := range p {
+			if index, err := strconv.Atoi(key); err == nil && index >= 0 && index < len(node) {
+				elements = append(elements, element{index, child})
+			}
+		}
+		sort.Slice(elements, func(i, j int) bool { return elements[i].index < elements[j].index })
+		projected := make([]interface{}, 0, len(elements))
+		for _, element := range elements {
+			if childValue, found := element.child.project(node[element.index]); found {
+				projected = append(projected, childValue)
+			}
+		}
+		return projected, len(projected) > 0
+	default:
+		return nil, false
+	}
+}
+
+func encodeCursor(entity string, position cursorPosition) string {
+	payload := entity + ":" + strconv.FormatUint(uint64(position.lastId), 10)
+	if len(position.values) > 0 {
+		serializedValues, err := SerializeValue(position.values)
+		if err == nil {
+			payload += ":" + serializedValues
+		}
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(payload))
+}
+
+func decodeCursor(entity string, cursor string, expectedValues int) (cursorPosition, error) {
+	invalidCursor := &InvalidArgumentError{"invalid cursor"}
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return cursorPosition{}, invalidCursor
+	}
+	cursorEntity, rest, _ := strings.Cut(string(decoded), ":")
+	if cursorEntity != entity {
+		return cursorPosition{}, invalidCursor
+	}
+	idText, valuesText, _ := strings.Cut(rest, ":")
+	lastId, err := strconv.ParseUint(idText, 10, strconv.IntSize)
+	if err != nil {
+		return cursorPosition{}, invalidCursor
+	}
+
+	position := cursorPosition{lastId: uint(lastId)}
+	if valuesText != "" {
+		data, err := parser.ParseData("values " + valuesText)
+		if err != nil {
+			return cursorPosition{}, invalidCursor
+		}
+		position.values, _ = (*data)["values"].([]interface{})
+	}
+	if len(position.values) != expectedValues {
+		return cursorPosition{}, invalidCursor
+	}
+	return position, nil
+}
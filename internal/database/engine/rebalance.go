@@ -0,0 +1,375 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/database/sharding"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+// A membership change moves records in three steps driven by the node that
+// received it. PREPARE gives every node the new ring as pending; from then on
+// writes to records whose owner changes are rejected. COPY has every node
+// insert the records it is giving away into their new owners, never
+// overwriting what the owner holds. Only once every copy is acknowledged does
+// COMMIT switch each node to the new ring and evict the records it no longer
+// owns. A failure before COMMIT sends ABORT, which drops the copies again.
+
+const transferFormat = "transfer"
+
+func isTransferSession(session *server.Session) bool {
+	return session.Get("transfer") == true
+}
+
+// routesToOwner reports whether the command addresses a single record and is
+// therefore executed by the node owning it.
+func routesToOwner(parsedCommand *parser.ParsedCommand) bool {
+	id := parsedCommand.Id
+	return routedOperations[parsedCommand.Operation] && id.Lower != 0 && id.Lower == id.Upper
+}
+
+func (c *clusterState) pendingOwner(key string) (string, bool) {
+	pending := c.pending.Load()
+	if pending == nil {
+		return "", false
+	}
+	owner := pending.Owner(key)
+	return owner, owner != c.ring.Owner(key)
+}
+
+// owns reports whether the record is served by this node, which excludes
+// copies received for a rebalance that is not committed yet.
+func (c *clusterState) owns(key string) bool {
+	if c.ring.Owner(key) != c.self {
+		return false
+	}
+	c.adoptedMu.Lock()
+	defer c.adoptedMu.Unlock()
+	return !c.adopted[key]
+}
+
+// takeAdopted returns and forgets the keys adopted for the pending ring.
+func (c *clusterState) takeAdopted() map[string]bool {
+	c.adoptedMu.Lock()
+	defer c.adoptedMu.Unlock()
+	adopted := c.adopted
+	c.adopted = nil
+	return adopted
+}
+
+// admit checks a single record command before it is routed or executed.
+// Peers only forward commands to the owner, so a peer command for a record
+// owned elsewhere comes from a node with an outdated ring. Writes to records
+// being moved are rejected until the move is committed. The returned release
+// must be called once the command is done; PREPARE waits for admitted writes
+// so none of them is missed by the copy.
+func (c *clusterState) admit(session *server.Session, parsedCommand *parser.ParsedCommand) (func(), error) {
+	key := recordKey(parsedCommand.Entity, parsedCommand.Id.Lower)
+	if owner := c.ring.Owner(key); isPeerSession(session) && owner != c.self {
+		return nil, &MovedError{fmt.Sprintf("record %s is owned by node %s", key, owner)}
+	}
+	if !isWriteOperation(parsedCommand) {
+		return func() {}, nil
+	}
+	c.writesMu.RLock()
+	if owner, moving := c.pendingOwner(key); moving {
+		c.writesMu.RUnlock()
+		return nil, &MovedError{fmt.Sprintf("record %s is moving to node %s", key, owner)}
+	}
+	return c.writesMu.RUnlock, nil
+}
+
+func (e *Engine) prepareRebalance(list string) ([]byte, error) {
+	nodes, err := parseNodeAddresses(list)
+	if err != nil {
+		return nil, &InvalidArgumentError{err.Error()}
+	}
+	pending := sharding.NewRing(sharding.DefaultVirtualNodes)
+	pending.Set(nodes)
+	e.cluster.writesMu.Lock()
+	defer e.cluster.writesMu.Unlock()
+	if current := e.cluster.pending.Load(); current != nil {
+		if formatNodeAddresses(current.Nodes()) == list {
+			return []byte("1"), nil
+		}
+		return nil, &InvalidOperationError{"a rebalance is already in progress"}
+	}
+	e.cluster.pending.Store(pending)
+	return []byte("1"), nil
+}
+
+// copyMovingRecords inserts every local record whose owner changes under the
+// pending ring into its new owner and returns how many were copied.
+func (e *Engine) copyMovingRecords() ([]byte, error) {
+	pending := e.cluster.pending.Load()
+	if pending == nil {
+		return nil, &InvalidOperationError{"no rebalance in progress"}
+	}
+	copied, err := e.copyRecords(func(key string) string {
+		if owner := pending.Owner(key); owner != e.cluster.self {
+			return owner
+		}
+		return ""
+	}, pending.Address, nil)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.Itoa(copied)), nil
+}
+
+func (e *Engine) commitRebalance(list string) ([]byte, error) {
+	e.cluster.writesMu.Lock()
+	pending := e.cluster.pending.Load()
+	if pending == nil || formatNodeAddresses(pending.Nodes()) != list {
+		e.cluster.writesMu.Unlock()
+		return nil, &InvalidOperationError{"no matching rebalance in progress"}
+	}
+	e.cluster.ring.Set(pending.Nodes())
+	e.cluster.pending.Store(nil)
+	e.cluster.takeAdopted()
+	e.cluster.writesMu.Unlock()
+
+	e.evictRecords(func(key string) bool { return e.cluster.ring.Owner(key) != e.cluster.self })
+	return []byte("1"), nil
+}
+
+// abortRebalance drops the pending ring along with the copies received for
+// it.
+func (e *Engine) abortRebalance(list string) ([]byte, error) {
+	e.cluster.writesMu.Lock()
+	pending := e.cluster.pending.Load()
+	if pending == nil || formatNodeAddresses(pending.Nodes()) != list {
+		e.cluster.writesMu.Unlock()
+		return []byte("1"), nil
+	}
+	e.cluster.pending.Store(nil)
+	adopted := e.cluster.takeAdopted()
+	e.cluster.writesMu.Unlock()
+
+	e.evictRecords(func(key string) bool { return adopted[key] })
+	return []byte("1"), nil
+}
+
+// rebalance hands records this node holds but does not own to their owners,
+// keeping any that the owner already holds.
+func (e *Engine) rebalance() ([]byte, error) {
+	e.cluster.rebalanceMu.Lock()
+	defer e.cluster.rebalanceMu.Unlock()
+	if e.cluster.pending.Load() != nil {
+		return nil, &InvalidOperationError{"a rebalance is already in progress"}
+	}
+	moved := 0
+	_, err := e.copyRecords(func(key string) string {
+		if owner := e.cluster.ring.Owner(key); owner != e.cluster.self {
+			return owner
+		}
+		return ""
+	}, e.cluster.ring.Address, func(s *storage.Storage, record *storage.Record) {
+		s.EvictRecord(record.Id)
+		moved++
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.Itoa(moved)), nil
+}
+
+// copyRecords adopts the local records for which target names another node
+// into that node, calling copied for each one acknowledged. Records the
+// target already holds fail the copy.
+func (e *Engine) copyRecords(target func(key string) string, address func(node string) string, copied func(s *storage.Storage, record *storage.Record)) (int, error) {
+	e.mu.RLock()
+	names := make([]string, 0, len(e.storages))
+	for name := range e.storages {
+		names = append(names, name)
+	}
+	e.mu.RUnlock()
+	sort.Strings(names)
+
+	total := 0
+	for _, name := range names {
+		e.mu.RLock()
+		s, found := e.storages[name]
+		schema := e.schemas[name]
+		e.mu.RUnlock()
+		if !found {
+			continue
+		}
+		groups := make(map[string][]*storage.Record)
+		s.IterateOverRecords(func(record *storage.Record) bool {
+			if owner := target(recordKey(name, record.Id)); owner != "" {
+				groups[owner] = append(groups[owner], cloneRecord(record))
+			}
+			return true
+		})
+		owners := make([]string, 0, len(groups))
+		for owner := range groups {
+			owners = append(owners, owner)
+		}
+		sort.Strings(owners)
+		for _, owner := range owners {
+			ownerAddress := address(owner)
+			if schema != nil {
+				if _, err := e.cluster.executeAt(owner, ownerAddress, "text", schemaCommand(name, schema)); err != nil {
+					return total, err
+				}
+			}
+			commands := make([]string, len(groups[owner]))
+			for i, record := range groups[owner] {
+				commands[i] = recordCommand("NEW", name, record)
+			}
+			responses, err := e.cluster.executeAt(owner, ownerAddress, transferFormat, commands...)
+			if err != nil {
+				return total, err
+			}
+			var firstErr error
+			for i, response := range responses {
+				if err := remoteError(response); err != nil {
+					firstErr = preferError(firstErr, err)
+					continue
+				}
+				total++
+				if copied != nil {
+					copied(s, groups[owner][i])
+				}
+			}
+			if firstErr != nil {
+				return total, &InternalError{fmt.Sprintf("copying to node %s: %v", owner, firstErr)}
+			}
+		}
+	}
+	return total, nil
+}
+
+func (e *Engine) evictRecords(evict func(key string) bool) {
+	e.mu.RLock()
+	storages := make(map[string]*storage.Storage, len(e.storages))
+	for name, s := range e.storages {
+		storages[name] = s
+	}
+	e.mu.RUnlock()
+	for name, s := range storages {
+		ids := make([]uint, 0)
+		s.IterateOverRecords(func(record *storage.Record) bool {
+			if evict(recordKey(name, record.Id)) {
+				ids = append(ids, record.Id)
+			}
+			return true
+		})
+		for _, id := range ids {
+			s.EvictRecord(id)
+		}
+	}
+}
+
+// adoptRecord stores a record copied from another node. Copies bypass hooks
+// and change events, since the record was not written, only moved.
+func (e *Engine) adoptRecord(parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	if parsedCommand.Operation != "NEW" || !routesToOwner(parsedCommand) {
+		return nil, &InvalidOperationError{"only NEW is accepted on a transfer connection"}
+	}
+	s, err := e.getStorage(parsedCommand.Entity, true)
+	if err != nil {
+		return nil, err
+	}
+	data, err := expandPaths(parsedCommand.Data)
+	if err != nil {
+		return nil, err
+	}
+	adopted, err := s.AdoptRecord(&storage.Record{Id: parsedCommand.Id.Lower, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	if !adopted {
+		return nil, &ConflictError{fmt.Sprintf("record %s:%d already exists", parsedCommand.Entity, parsedCommand.Id.Lower)}
+	}
+	if e.cluster.pending.Load() != nil {
+		e.cluster.adoptedMu.Lock()
+		if e.cluster.adopted == nil {
+			e.cluster.adopted = make(map[string]bool)
+		}
+		e.cluster.adopted[recordKey(parsedCommand.Entity, parsedCommand.Id.Lower)] = true
+		e.cluster.adoptedMu.Unlock()
+	}
+	return []byte("1"), nil
+}
+
+// changeClusterNodes moves the cluster to the given nodes, running each step
+// of the rebalance on every node before starting the next.
+func (e *Engine) changeClusterNodes(nodes map[string]string) ([]byte, error) {
+	e.cluster.rebalanceMu.Lock()
+	defer e.cluster.rebalanceMu.Unlock()
+	previous := e.cluster.ring.Nodes()
+	targets := make(map[string]string)
+	for id, address := range previous {
+		targets[id] = address
+	}
+	for id, address := range nodes {
+		targets[id] = address
+	}
+	ids := make([]string, 0, len(targets))
+	for id := range targets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	schemas := e.schemaCommands()
+	for _, id := range ids {
+		if _, existed := previous[id]; !existed && len(schemas) > 0 {
+			if _, err := e.cluster.executeAt(id, targets[id], "text", schemas...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	list := formatNodeAddresses(nodes)
+	step := func(id string, command string, local func() ([]byte, error)) ([]byte, error) {
+		if id == e.cluster.self {
+			return local()
+		}
+		responses, err := e.cluster.executeAt(id, targets[id], "text", command)
+		if err != nil {
+			return nil, err
+		}
+		if err := remoteError(responses[0]); err != nil {
+			return nil, &InternalError{fmt.Sprintf("node %s: %v", id, err)}
+		}
+		return responses[0], nil
+	}
+	abort := func() {
+		for _, id := range ids {
+			step(id, "CLUSTER ABORT "+list, func() ([]byte, error) { return e.abortRebalance(list) })
+		}
+	}
+
+	for _, id := range ids {
+		if _, err := step(id, "CLUSTER PREPARE "+list, func() ([]byte, error) { return e.prepareRebalance(list) }); err != nil {
+			abort()
+			return nil, err
+		}
+	}
+	moved := int64(0)
+	for _, id := range ids {
+		response, err := step(id, "CLUSTER COPY", e.copyMovingRecords)
+		if err != nil {
+			abort()
+			return nil, err
+		}
+		count, _ := strconv.ParseInt(string(response), 10, 64)
+		moved += count
+	}
+	var firstErr error
+	for _, id := range ids {
+		if _, err := step(id, "CLUSTER COMMIT "+list, func() ([]byte, error) { return e.commitRebalance(list) }); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return []byte(strconv.FormatInt(moved, 10)), nil
+}
@@ -0,0 +1,431 @@
+package engine
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+const (
+	defaultReplicationBacklog = 10000
+	replicationRetryInterval  = 100 * time.Millisecond
+	replicationDialTimeout    = time.Second
+)
+
+var writeOperations = map[string]bool{
+	"NEW":    true,
+	"UPD":    true,
+	"DEL":    true,
+	"SET":    true,
+	"UNSET":  true,
+	"UPSERT": true,
+	"INCR":   true,
+	"DECR":   true,
+	"APPEND": true,
+	"DROP":   true,
+	"RENAME": true,
+	"BULK":   true,
+	"IMPORT": true,
+}
+
+type replicationEntry struct {
+	seq     uint64
+	command string
+}
+
+type replicationLog struct {
+	mu       sync.Mutex
+	changed  *sync.Cond
+	id       string
+	entries  []replicationEntry
+	capacity int
+	lastSeq  uint64
+	closed   bool
+}
+
+type replicaState struct {
+	primary   string
+	mu        sync.Mutex
+	primaryId string
+	conn      net.Conn
+	seq       atomic.Uint64
+	connected atomic.Bool
+}
+
+func newReplicationLog(capacity int) *replicationLog {
+	if capacity <= 0 {
+		capacity = defaultReplicationBacklog
+	}
+	log := &replicationLog{id: newReplicationId(), capacity: capacity}
+	log.changed = sync.NewCond(&log.mu)
+	return log
+}
+
+func newReplicationId() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func (log *replicationLog) append(commands ...string) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	for _, command := range commands {
+		log.lastSeq++
+		log.entries = append(log.entries, replicationEntry{seq: log.lastSeq, command: command})
+	}
+	if len(log.entries) > 2*log.capacity {
+		log.entries = append([]replicationEntry(nil), log.entries[len(log.entries)-log.capacity:]...)
+	}
+	log.changed.Broadcast()
+}
+
+func (log *replicationLog) last() uint64 {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return log.lastSeq
+}
+
+func (log *replicationLog) covers(seq uint64) bool {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return seq <= log.lastSeq && (len(log.entries) == 0 || seq+1 >= log.entries[0].seq)
+}
+
+func (log *replicationLog) waitSince(seq uint64) ([]replicationEntry, bool) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	for log.lastSeq == seq && !log.closed {
+		log.changed.Wait()
+	}
+	if log.closed || (len(log.entries) > 0 && seq+1 < log.entries[0].seq) {
+		return nil, false
+	}
+	start := sort.Search(len(log.entries), func(i int) bool { return log.entries[i].seq > seq })
+	return append([]replicationEntry(nil), log.entries[start:]...), true
+}
+
+func (log *replicationLog) close() {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.closed = true
+	log.changed.Broadcast()
+}
+
+func isWriteOperation(parsedCommand *parser.ParsedCommand) bool {
+	if parsedCommand.Operation == "SCHEMA" {
+		return len(parsedCommand.Schema) > 0 || len(parsedCommand.Args) > 0
+	}
+	if parsedCommand.Operation == "TRIGGER" {
+		return len(parsedCommand.Args) > 0
+	}
+	return writeOperations[parsedCommand.Operation]
+}
+
+func (e *Engine) executeReplicatedOperation(command string, parsedCommand *parser.ParsedCommand, serializer recordSerializer) []byte {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+	response, err := e.dispatchOperation(parsedCommand, serializer)
+	if err != nil {
+		return serializer.serializeError(err)
+	}
+	e.log.append(command)
+	return response
+}
+
+func (e *Engine) ServeReplication(listener net.Listener) {
+	e.closeMu.Lock()
+	e.listeners = append(e.listeners, listener)
+	e.closeMu.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go e.serveFollower(conn)
+	}
+}
+
+func (e *Engine) serveFollower(conn net.Conn) {
+	defer conn.Close()
+	e.followers.Add(1)
+	defer e.followers.Add(-1)
+
+	request, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	var followerId string
+	var followerSeq uint64
+	if _, err := fmt.Sscanf(request, "SYNC %s %d", &followerId, &followerSeq); err != nil {
+		fmt.Fprintf(conn, "ERR %s invalid sync request\n", ErrCodeInvalidArgument)
+		return
+	}
+
+	writer := bufio.NewWriter(conn)
+	seq := followerSeq
+	if followerId == e.log.id && e.log.covers(followerSeq) {
+		fmt.Fprintf(writer, "CONTINUE %s %d\n", e.log.id, seq)
+	} else {
+		var snapshot []string
+		seq, snapshot = e.snapshot()
+		fmt.Fprintf(writer, "FULLSYNC %s %d %d\n", e.log.id, seq, len(snapshot))
+		for _, command := range snapshot {
+			writer.WriteString(command)
+			writer.WriteByte('\n')
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return
+	}
+
+	for {
+		entries, ok := e.log.waitSince(seq)
+		if !ok {
+			return
+		}
+		for _, entry := range entries {
+			writer.WriteString(strconv.FormatUint(entry.seq, 10))
+			writer.WriteByte(' ')
+			writer.WriteString(entry.command)
+			writer.WriteByte('\n')
+			seq = entry.seq
+		}
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (e *Engine) snapshot() (uint64, []string) {
+	e.writeMu.Lock()
+	defer e.writeMu.Unlock()
+	return e.log.last(), e.snapshotCommands()
+}
+
+func (e *Engine) snapshotCommands() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.storages))
+	for name := range e.storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	commands := make([]string, 0)
+	for _, name := range names {
+		if schema, found := e.schemas[name]; found {
+			commands = append(commands, schemaCommand(name, schema))
+		}
+		for _, record := range e.storages[name].GetAllRecords(false) {
+			commands = append(commands, recordCommand("NEW", name, record))
+		}
+	}
+	return append(commands, e.triggerCommands()...)
+}
+
+func schemaCommand(entity string, schema *Schema) string {
+	definitions := make([]string, len(schema.fields))
+	for i, field := range schema.fields {
+		definition := field.Name + ":" + field.Type
+		if field.Optional {
+			definition += "?"
+		}
+		if field.HasDefault {
+			serializedDefault, _ := SerializeValue(field.Default)
+			definition += "=" + serializedDefault
+		}
+		definitions[i] = definition
+	}
+	return "SCHEMA " + entity + " " + strings.Join(definitions, " ")
+}
+
+func recordCommand(operation string, entity string, record *storage.Record) string {
+	serialized, _ := SerializeRecord(record)
+	return fmt.Sprintf("%s %s:%d%s", operation, entity, record.Id, strings.TrimPrefix(string(serialized), fmt.Sprintf("id %d", record.Id)))
+}
+
+func (e *Engine) FollowPrimary() {
+	for {
+		err := e.syncFromPrimary()
+		e.replica.connected.Store(false)
+		if e.closed() {
+			return
+		}
+		e.logger.Warn("replication from primary interrupted", "primary", e.replica.primary, "error", err)
+		select {
+		case <-e.done:
+			return
+		case <-time.After(replicationRetryInterval):
+		}
+	}
+}
+
+func (e *Engine) syncFromPrimary() error {
+	conn, err := net.DialTimeout("tcp", e.replica.primary, replicationDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	e.replica.mu.Lock()
+	if e.closed() {
+		e.replica.mu.Unlock()
+		return net.ErrClosed
+	}
+	e.replica.conn = conn
+	primaryId := e.replica.primaryId
+	e.replica.mu.Unlock()
+	if primaryId == "" {
+		primaryId = "-"
+	}
+
+	if _, err := fmt.Fprintf(conn, "SYNC %s %d\n", primaryId, e.replica.seq.Load()); err != nil {
+		return err
+	}
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	var mode string
+	var seq uint64
+	var count int
+	fields, err := fmt.Sscanf(header, "%s %s %d %d", &mode, &primaryId, &seq, &count)
+	if fields < 3 || (mode != "CONTINUE" && mode != "FULLSYNC") {
+		return fmt.Errorf("invalid sync response %q", strings.TrimSpace(header))
+	}
+	if mode == "FULLSYNC" {
+		snapshot := make([]string, count)
+		for i := range snapshot {
+			if snapshot[i], err = reader.ReadString('\n'); err != nil {
+				return err
+			}
+		}
+		for i, command := range snapshot {
+			snapshot[i] = strings.TrimSuffix(command, "\n")
+		}
+		e.restoreSnapshot(snapshot)
+	}
+	e.replica.mu.Lock()
+	e.replica.primaryId = primaryId
+	e.replica.mu.Unlock()
+	e.replica.seq.Store(seq)
+	e.replica.connected.Store(true)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		seqText, command, _ := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		entrySeq, err := strconv.ParseUint(seqText, 10, 64)
+		if err != nil || entrySeq != e.replica.seq.Load()+1 {
+			return fmt.Errorf("unexpected replication entry %q", seqText)
+		}
+		if err := e.applyReplicated(command); err != nil {
+			e.logger.Error("error applying replicated command, resyncing", "seq", entrySeq, "command", command, "error", err)
+			e.replica.mu.Lock()
+			e.replica.primaryId = ""
+			e.replica.mu.Unlock()
+			return err
+		}
+		e.replica.seq.Store(entrySeq)
+	}
+}
+
+// applyReplicated runs a command the primary already executed successfully,
+// so an error means the replica has diverged from the primary. The caller
+// then forgets the primary's id, which makes the next SYNC a FULLSYNC.
+func (e *Engine) applyReplicated(command string) error {
+	parsedCommand, err := parser.ParseCommand(command)
+	if err != nil {
+		return err
+	}
+	_, err = e.dispatchOperation(parsedCommand, textSerializer{})
+	return err
+}
+
+func (e *Engine) resetData() {
+	e.schemaMu.Lock()
+	defer e.schemaMu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, s := range e.storages {
+		s.Drop()
+	}
+	e.storages = make(map[string]*storage.Storage)
+	e.schemas = make(map[string]*Schema)
+	e.changes.reset()
+}
+
+func (e *Engine) replicationInfo(serializer recordSerializer) ([]byte, error) {
+	switch {
+	case e.log != nil:
+		return serializer.serializeRow(
+			[]string{"role", "id", "seq", "followers"},
+			[]interface{}{"primary", e.log.id, int64(e.log.last()), e.followers.Load()},
+		)
+	case e.replica != nil:
+		e.replica.mu.Lock()
+		primaryId := e.replica.primaryId
+		e.replica.mu.Unlock()
+		return serializer.serializeRow(
+			[]string{"role", "primary", "id", "seq", "connected"},
+			[]interface{}{"replica", e.replica.primary, primaryId, int64(e.replica.seq.Load()), e.replica.connected.Load()},
+		)
+	default:
+		return serializer.serializeRow([]string{"role"}, []interface{}{"standalone"})
+	}
+}
+
+func (e *Engine) closed() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *Engine) Close() {
+	e.closeOnce.Do(func() {
+		close(e.done)
+		e.closeMu.Lock()
+		for _, listener := range e.listeners {
+			listener.Close()
+		}
+		e.closeMu.Unlock()
+		if e.log != nil {
+			e.log.close()
+		}
+		if e.tracer != nil {
+			e.tracer.close()
+		}
+		if e.raft != nil {
+			e.raft.Stop()
+		}
+		if e.raftTransport != nil {
+			e.raftTransport.Close()
+		}
+		if e.cluster != nil {
+			e.cluster.close()
+		}
+		if e.replica != nil {
+			e.replica.mu.Lock()
+			if e.replica.conn != nil {
+				e.replica.conn.Close()
+			}
+			e.replica.mu.Unlock()
+		}
+	})
+}
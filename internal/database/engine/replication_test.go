@@ -0,0 +1,201 @@
+package engine
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func startReplicationPair(t *testing.T, backlog int) (*Engine, *Engine) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	primary := New(Config{ReplicationPort: "0", ReplicationBacklog: backlog})
+	go primary.ServeReplication(listener)
+	follower := New(Config{ReplicaOf: listener.Addr().String()})
+	go follower.FollowPrimary()
+	t.Cleanup(func() {
+		follower.Close()
+		primary.Close()
+	})
+	return primary, follower
+}
+
+func waitForReplication(t *testing.T, primary, follower *Engine) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if follower.replica.connected.Load() && follower.replica.seq.Load() == primary.log.last() {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("follower did not catch up: seq %d, primary seq %d", follower.replica.seq.Load(), primary.log.last())
+}
+
+func TestReplicationStreamsWrites(t *testing.T) {
+	// Arrange
+	primary, follower := startReplicationPair(t, 0)
+	session := server.NewSession("test")
+
+	// Act
+	primary.messageHandler(session, "SCHEMA car name:string year:int? tags:list?")
+	primary.messageHandler(session, "NEW car:1 name 'bmw' year 2020")
+	primary.messageHandler(session, "NEW car:2 name 'audi' tags []")
+	primary.messageHandler(session, "UPD car:1 year 2021")
+	primary.messageHandler(session, "INCR car:1 year")
+	primary.messageHandler(session, "APPEND car:2 tags 'a'")
+	primary.messageHandler(session, "DEL car:2")
+	primary.messageHandler(session, "NEW car:3 name 'fiat'")
+	primary.messageHandler(session, "NEW car:1 name 'duplicated'")
+	waitForReplication(t, primary, follower)
+
+	// Assert
+	testutil.AssertEquals(t, int64(8), int64(primary.log.last()), "primary seq")
+	testutil.AssertEquals(t,
+		string(primary.messageHandler(session, "GET car")),
+		string(follower.messageHandler(session, "GET car")), "follower records")
+	testutil.AssertEquals(t,
+		string(primary.messageHandler(session, "SCHEMA car")),
+		string(follower.messageHandler(session, "SCHEMA car")), "follower schema")
+}
+
+func TestReplicationFollowerIsReadOnly(t *testing.T) {
+	// Arrange
+	_, follower := startReplicationPair(t, 0)
+	session := server.NewSession("test")
+
+	// Act
+	insertResult := follower.messageHandler(session, "NEW car:1 name 'bmw'")
+	bulkResult := follower.messageHandler(session, "BULK car")
+	schemaResult := follower.messageHandler(session, "SCHEMA car name:string")
+	getResult := follower.messageHandler(session, "GET car")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR READ_ONLY replica is read-only", string(insertResult), "insert result")
+	testutil.AssertEquals(t, "ERR READ_ONLY replica is read-only", string(bulkResult), "bulk result")
+	testutil.AssertEquals(t, "ERR READ_ONLY replica is read-only", string(schemaResult), "schema result")
+	testutil.AssertEquals(t, "", string(getResult), "get result")
+}
+
+func TestReplicationSnapshotForExistingData(t *testing.T) {
+	// Arrange
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	primary := New(Config{ReplicationPort: "0"})
+	defer primary.Close()
+	go primary.ServeReplication(listener)
+	session := server.NewSession("test")
+	primary.messageHandler(session, "SCHEMA car name:string color:string='black' at:timestamp specs:object")
+	primary.messageHandler(session, "NEW car:1 name 'bmw' at t'2024-01-02T03:04:05Z' specs {hp 300}")
+	primary.messageHandler(session, "NEW user:7 name 'ana'")
+
+	// Act
+	follower := New(Config{ReplicaOf: listener.Addr().String()})
+	defer follower.Close()
+	go follower.FollowPrimary()
+	waitForReplication(t, primary, follower)
+
+	// Assert
+	testutil.AssertEquals(t, "id 1 at t'2024-01-02T03:04:05Z' color 'black' name 'bmw' specs {hp 300}", string(follower.messageHandler(session, "GET car:1")), "car")
+	testutil.AssertEquals(t, "id 7 name 'ana'", string(follower.messageHandler(session, "GET user:7")), "user")
+	testutil.AssertEquals(t, "name 'string' color 'string=\\'black\\'' at 'timestamp' specs 'object'", string(follower.messageHandler(session, "SCHEMA car")), "schema")
+}
+
+func TestReplicationCatchesUpAfterDisconnect(t *testing.T) {
+	for _, backlog := range []int{100, 1} {
+		// Arrange
+		primary, follower := startReplicationPair(t, backlog)
+		session := server.NewSession("test")
+		primary.messageHandler(session, "NEW counter:1 views 0")
+		waitForReplication(t, primary, follower)
+
+		// Act
+		follower.replica.mu.Lock()
+		follower.replica.conn.Close()
+		follower.replica.mu.Unlock()
+		for i := 0; i < 5; i++ {
+			primary.messageHandler(session, "INCR counter:1 views")
+		}
+		primary.messageHandler(session, "NEW counter:2 views 1")
+		waitForReplication(t, primary, follower)
+
+		// Assert
+		testutil.AssertEquals(t, "id 1 views 5\nid 2 views 1", string(follower.messageHandler(session, "GET counter")), "follower records")
+	}
+}
+
+func TestReplicationResyncsWhenACommandFails(t *testing.T) {
+	// Arrange
+	primary, follower := startReplicationPair(t, 0)
+	session := server.NewSession("test")
+	primary.messageHandler(session, "NEW car:1 name 'bmw'")
+	waitForReplication(t, primary, follower)
+	parsedCommand, _ := parser.ParseCommand("NEW car:2 name 'diverged'")
+	follower.dispatchOperation(parsedCommand, textSerializer{})
+
+	// Act
+	primary.messageHandler(session, "NEW car:2 name 'audi'")
+	primary.messageHandler(session, "NEW car:3 name 'fiat'")
+	waitForReplication(t, primary, follower)
+
+	// Assert
+	testutil.AssertEquals(t, "id 1 name 'bmw'\nid 2 name 'audi'\nid 3 name 'fiat'", string(follower.messageHandler(session, "GET car")), "follower records")
+}
+
+func TestReplicationBulkLoad(t *testing.T) {
+	// Arrange
+	primary, follower := startReplicationPair(t, 0)
+	session := server.NewSession("test")
+	primary.messageHandler(session, "NEW car:1 name 'bmw'")
+
+	// Act
+	primary.messageHandler(session, "IMPORT car JSONL ON CONFLICT REPLACE")
+	primary.messageHandler(session, `{"id":1,"name":"audi","serial":{"$uint":"7"}}`)
+	primary.messageHandler(session, `{"id":2,"name":"fiat"}`)
+	primary.messageHandler(session, "END")
+	waitForReplication(t, primary, follower)
+
+	// Assert
+	testutil.AssertEquals(t, "id 1 name 'audi' serial 7u\nid 2 name 'fiat'", string(follower.messageHandler(session, "GET car")), "follower records")
+}
+
+func TestReplicationInfo(t *testing.T) {
+	// Arrange
+	primary, follower := startReplicationPair(t, 0)
+	session := server.NewSession("test")
+	primary.messageHandler(session, "NEW car:1 name 'bmw'")
+	waitForReplication(t, primary, follower)
+
+	// Act
+	primaryResult := primary.messageHandler(session, "REPLICATION")
+	followerResult := follower.messageHandler(session, "REPLICATION")
+	standaloneResult := New(DefaultConfig()).messageHandler(session, "REPLICATION")
+
+	// Assert
+	testutil.AssertEquals(t, "role 'primary' id '"+primary.log.id+"' seq 1 followers 1", string(primaryResult), "primary result")
+	testutil.AssertEquals(t, "role 'replica' primary '"+follower.replica.primary+"' id '"+primary.log.id+"' seq 1 connected true", string(followerResult), "follower result")
+	testutil.AssertEquals(t, "role 'standalone'", string(standaloneResult), "standalone result")
+}
+
+func TestReplicationLogBacklog(t *testing.T) {
+	// Arrange
+	log := newReplicationLog(2)
+
+	// Act
+	log.append("NEW a:1", "NEW a:2", "NEW a:3", "NEW a:4", "NEW a:5")
+	entries, ok := log.waitSince(3)
+	_, trimmedOk := log.waitSince(1)
+
+	// Assert
+	testutil.AssertTrue(t, ok, "ok")
+	testutil.AssertEquals(t, 2, len(entries), "entries")
+	testutil.AssertEquals(t, "NEW a:4", entries[0].command, "first entry")
+	testutil.AssertFalse(t, trimmedOk, "trimmed ok")
+	testutil.AssertTrue(t, log.covers(3), "covers 3")
+	testutil.AssertFalse(t, log.covers(1), "covers 1")
+	testutil.AssertFalse(t, log.covers(6), "covers 6")
+}
@@ -0,0 +1,290 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+	"github.com/google/btree"
+)
+
+// A query over many records runs on every node against the records it owns,
+// and each node answers with a partial result: the first OFFSET+LIMIT+1
+// matches in query order for GET, the partial state of every group for an
+// aggregate and its own counts for STATS. The node that received the query
+// merges them, so only the records that can reach the result cross the
+// network.
+
+const partialFormat = "partial"
+
+var partialColumns = []string{"group", "count", "int_sum", "float_sum", "float", "numbers", "extreme"}
+
+func isPartialSession(session *server.Session) bool {
+	return session.Get("partial") == true
+}
+
+func (e *Engine) scatterOperation(command string, parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	if parsedCommand.Operation == "EXPORT" {
+		return e.exportGathered(parsedCommand, serializer)
+	}
+	partials, err := e.collectPartials(command, parsedCommand)
+	if err != nil {
+		return nil, err
+	}
+	switch parsedCommand.Operation {
+	case "GET":
+		return mergeRecords(parsedCommand, partials, serializer)
+	case "STATS":
+		return mergeStats(parsedCommand, partials, serializer)
+	default:
+		return mergeAggregates(parsedCommand, partials, serializer)
+	}
+}
+
+// exportGathered exports the records of every node. An export holds the
+// whole entity anyway, so it is built from the gathered records.
+func (e *Engine) exportGathered(parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	gathered, found, err := e.gatherRecords(parsedCommand.Entity, parsedCommand.Id)
+	if err != nil {
+		return nil, err
+	}
+	merged := New(Config{StrictEntities: e.config.StrictEntities})
+	if found {
+		merged.storages[parsedCommand.Entity] = gathered
+		if schema := e.getSchema(parsedCommand.Entity); schema != nil {
+			merged.schemas[parsedCommand.Entity] = schema
+		}
+	}
+	return merged.dispatchOperation(parsedCommand, serializer)
+}
+
+// collectPartials runs the query on every node and returns the partial
+// results of the nodes that have the entity.
+func (e *Engine) collectPartials(command string, parsedCommand *parser.ParsedCommand) ([][]byte, error) {
+	partials := make([][]byte, 0)
+	var notFound error
+	for _, node := range e.cluster.ring.NodeIds() {
+		var partial []byte
+		var err error
+		if node == e.cluster.self {
+			partial, err = e.partialOperation(parsedCommand)
+		} else {
+			responses, executeErr := e.cluster.execute(node, partialFormat, command)
+			if executeErr != nil {
+				return nil, executeErr
+			}
+			partial, err = responses[0], remoteError(responses[0])
+		}
+		if ErrorCode(err) == ErrCodeNotFound {
+			notFound = err
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		partials = append(partials, partial)
+	}
+	if len(partials) == 0 && notFound != nil {
+		return nil, notFound
+	}
+	return partials, nil
+}
+
+// partialOperation answers a scattered query with this node's share of it.
+func (e *Engine) partialOperation(parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	switch parsedCommand.Operation {
+	case "GET":
+		return e.partialRecords(parsedCommand)
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		groups, err := e.aggregateGroups(parsedCommand)
+		if err != nil {
+			return nil, err
+		}
+		return serializePartialGroups(groups)
+	case "STATS":
+		return e.partialStats(parsedCommand)
+	default:
+		return nil, &InvalidOperationError{fmt.Sprintf("%s cannot be run on a part of the cluster", parsedCommand.Operation)}
+	}
+}
+
+// partialRecords returns every record that can make it into the page: the
+// first OFFSET+LIMIT matches, plus one more to tell whether the page is the
+// last one. Fields are projected once the page is merged, since ORDER BY may
+// use attributes outside them.
+func (e *Engine) partialRecords(parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	s, err := e.getStorage(parsedCommand.Entity, false)
+	if err != nil {
+		return nil, err
+	}
+	id := parsedCommand.Id
+	if id.Upper != 0 && id.Lower > id.Upper {
+		return nil, &InvalidIdError{"invalid id range"}
+	}
+	query := *parsedCommand
+	query.Offset = 0
+	query.Fields = nil
+	if limit := pageLimit(parsedCommand); limit > 0 {
+		query.Limit = pageOffset(parsedCommand) + limit + 1
+	}
+	records, _, err := selectRecords(&query, s, e.recordMatcher(parsedCommand))
+	if err != nil {
+		return nil, err
+	}
+	return serializeJSONLines(records)
+}
+
+func mergeRecords(parsedCommand *parser.ParsedCommand, partials [][]byte, serializer recordSerializer) ([]byte, error) {
+	records := make([]*storage.Record, 0)
+	for _, partial := range partials {
+		for _, line := range strings.Split(string(partial), "\n") {
+			if line == "" {
+				continue
+			}
+			record, err := parser.DeserializeRecordExtendedJSON(line)
+			if err != nil {
+				return nil, &InternalError{fmt.Sprintf("invalid partial result: %v", err)}
+			}
+			records = append(records, record)
+		}
+	}
+	orderBy := parsedCommand.OrderBy
+	sort.Slice(records, func(i, j int) bool {
+		return compareRecords(records[i], records[j], orderBy) < 0
+	})
+
+	records = records[min(pageOffset(parsedCommand), len(records)):]
+	cursor := ""
+	if limit := pageLimit(parsedCommand); limit > 0 && len(records) > limit {
+		records = records[:limit]
+		last := records[len(records)-1]
+		position := cursorPosition{lastId: last.Id}
+		if sortsByAttributes(parsedCommand) {
+			position.values = orderValues(last, orderBy)
+		}
+		cursor = encodeCursor(parsedCommand.Entity, position)
+	}
+	records = projectRecords(records, parsedCommand.Fields)
+	if parsedCommand.Limit > 0 || parsedCommand.Offset > 0 || parsedCommand.Cursor != "" || cursor != "" {
+		return serializer.serializePage(records, cursor)
+	}
+	return serializer.serializeRecords(records)
+}
+
+func serializePartialGroups(groups *btree.BTreeG[*aggregateGroup]) ([]byte, error) {
+	rows := make([][]interface{}, 0, groups.Len())
+	groups.Ascend(func(group *aggregateGroup) bool {
+		a := group.aggregator
+		rows = append(rows, []interface{}{group.key, a.count, a.intSum, a.floatSum, a.useFloat, a.numbers, a.extreme})
+		return true
+	})
+	return textSerializer{}.serializeRows(partialColumns, rows)
+}
+
+func mergeAggregates(parsedCommand *parser.ParsedCommand, partials [][]byte, serializer recordSerializer) ([]byte, error) {
+	groups := newAggregateGroups()
+	for _, partial := range partials {
+		for _, line := range strings.Split(string(partial), "\n") {
+			row, err := parser.ParseData(line)
+			if err != nil {
+				return nil, &InternalError{fmt.Sprintf("invalid partial result: %v", err)}
+			}
+			if row == nil {
+				continue
+			}
+			other := &aggregator{operation: parsedCommand.Operation}
+			other.count, _ = (*row)["count"].(int64)
+			other.intSum, _ = (*row)["int_sum"].(int64)
+			other.floatSum = toFloat64((*row)["float_sum"])
+			other.useFloat, _ = (*row)["float"].(bool)
+			other.numbers, _ = (*row)["numbers"].(int64)
+			other.extreme = (*row)["extreme"]
+			aggregateGroupFor(groups, (*row)["group"], parsedCommand.Operation).aggregator.merge(other)
+		}
+	}
+	return serializeAggregate(parsedCommand, groups, serializer)
+}
+
+// partialStats counts the records this node owns, which leaves out copies
+// received for a rebalance that is not committed yet.
+func (e *Engine) partialStats(parsedCommand *parser.ParsedCommand) ([]byte, error) {
+	e.mu.RLock()
+	s, found := e.storages[parsedCommand.Entity]
+	e.mu.RUnlock()
+	if !found {
+		return nil, entityNotFound(parsedCommand.Entity)
+	}
+
+	var records int64
+	var lowest, highest uint
+	attributes := make(map[string]bool)
+	matches := e.recordMatcher(&parser.ParsedCommand{Entity: parsedCommand.Entity})
+	s.IterateOverRecords(func(record *storage.Record) bool {
+		if !matches(record) {
+			return true
+		}
+		records++
+		if lowest == 0 {
+			lowest = record.Id
+		}
+		highest = record.Id
+		if record.Data != nil {
+			for attribute := range *record.Data {
+				attributes[attribute] = true
+			}
+		}
+		return true
+	})
+	return textSerializer{}.serializeRow(
+		[]string{"records", "min_id", "max_id", "attributes"},
+		[]interface{}{records, int64(lowest), int64(highest), sortedAttributes(attributes)},
+	)
+}
+
+func mergeStats(parsedCommand *parser.ParsedCommand, partials [][]byte, serializer recordSerializer) ([]byte, error) {
+	var records, lowest, highest int64
+	attributes := make(map[string]bool)
+	for _, partial := range partials {
+		row, err := parser.ParseData(string(partial))
+		if err != nil || row == nil {
+			return nil, &InternalError{fmt.Sprintf("invalid partial result %q", partial)}
+		}
+		count, _ := (*row)["records"].(int64)
+		if count == 0 {
+			continue
+		}
+		minId, _ := (*row)["min_id"].(int64)
+		maxId, _ := (*row)["max_id"].(int64)
+		if records == 0 || minId < lowest {
+			lowest = minId
+		}
+		highest = max(highest, maxId)
+		records += count
+		names, _ := (*row)["attributes"].([]interface{})
+		for _, name := range names {
+			if attribute, ok := name.(string); ok {
+				attributes[attribute] = true
+			}
+		}
+	}
+	return serializer.serializeRow(
+		[]string{"entity", "records", "min_id", "max_id", "attributes"},
+		[]interface{}{parsedCommand.Entity, records, lowest, highest, int64(len(attributes))},
+	)
+}
+
+func sortedAttributes(attributes map[string]bool) []interface{} {
+	names := make([]string, 0, len(attributes))
+	for name := range attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sorted := make([]interface{}, len(names))
+	for i, name := range names {
+		sorted[i] = name
+	}
+	return sorted
+}
@@ -0,0 +1,296 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+type Schema struct {
+	fields []parser.SchemaField
+	byName map[string]parser.SchemaField
+}
+
+func NewSchema(fields []parser.SchemaField) (*Schema, error) {
+	schema := &Schema{fields: fields, byName: make(map[string]parser.SchemaField)}
+	for i, field := range fields {
+		if field.HasDefault {
+			value, err := coerceValue(field, field.Default)
+			if err != nil {
+				return nil, err
+			}
+			fields[i].Default = value
+			field.Default = value
+		}
+		schema.byName[field.Name] = field
+	}
+	return schema, nil
+}
+
+// schemaCheckedOperations hold schemaMu for reading from the schema lookup to
+// the storage write, so a schema cannot be installed in between.
+var schemaCheckedOperations = map[string]bool{
+	"NEW":    true,
+	"UPD":    true,
+	"SET":    true,
+	"UNSET":  true,
+	"UPSERT": true,
+	"INCR":   true,
+	"DECR":   true,
+	"APPEND": true,
+}
+
+func (e *Engine) getSchema(entity string) *Schema {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.schemas[entity]
+}
+
+// checkedSchema returns the schema of the entity to a caller holding
+// schemaMu. Schemas are only changed with both schemaMu and mu held, so it
+// does not take mu, which change guards running under a storage lock must
+// not wait for.
+func (e *Engine) checkedSchema(entity string) *Schema {
+	return e.schemas[entity]
+}
+
+func (e *Engine) defineSchema(parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	if len(parsedCommand.Args) == 1 && parsedCommand.Args[0] == "NONE" {
+		e.schemaMu.Lock()
+		defer e.schemaMu.Unlock()
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if _, found := e.schemas[parsedCommand.Entity]; !found {
+			return nil, schemaNotFound(parsedCommand.Entity)
+		}
+		delete(e.schemas, parsedCommand.Entity)
+		return []byte("1"), nil
+	}
+	if len(parsedCommand.Schema) == 0 {
+		schema := e.getSchema(parsedCommand.Entity)
+		if schema == nil {
+			return nil, schemaNotFound(parsedCommand.Entity)
+		}
+		columns, descriptions, err := schema.describe()
+		if err != nil {
+			return nil, err
+		}
+		return serializer.serializeRow(columns, descriptions)
+	}
+
+	schema, err := NewSchema(parsedCommand.Schema)
+	if err != nil {
+		return nil, err
+	}
+	// Existing records are validated with writes blocked, but are not
+	// rewritten: defaults and coercions only apply to later writes.
+	e.schemaMu.Lock()
+	defer e.schemaMu.Unlock()
+	s, err := e.getStorage(parsedCommand.Entity, true)
+	if err != nil {
+		return nil, err
+	}
+	s.IterateOverRecords(func(record *storage.Record) bool {
+		data := storage.Data{}
+		if record.Data != nil {
+			data = record.Data.Clone()
+		}
+		if validationErr := schema.ValidateRecord(data); validationErr != nil {
+			err = &ValidationError{fmt.Sprintf("record %s:%d: %s", parsedCommand.Entity, record.Id, validationErr.Error())}
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.schemas[parsedCommand.Entity] = schema
+	return []byte("1"), nil
+}
+
+func schemaNotFound(entity string) error {
+	return &NotFoundError{fmt.Sprintf("schema for entity %s not found", entity)}
+}
+
+func (schema *Schema) ValidateRecord(data storage.Data) error {
+	for attribute := range data {
+		if _, found := schema.byName[attribute]; !found {
+			return &ValidationError{fmt.Sprintf("unknown attribute %s", attribute)}
+		}
+	}
+	for _, field := range schema.fields {
+		value, found := data[field.Name]
+		if (!found || value == nil) && field.HasDefault {
+			data[field.Name] = storage.CloneValue(field.Default)
+			continue
+		}
+		if !found && field.Optional {
+			continue
+		}
+		if !found {
+			return &ValidationError{fmt.Sprintf("missing required attribute %s", field.Name)}
+		}
+		coerced, err := coerceValue(field, value)
+		if err != nil {
+			return err
+		}
+		data[field.Name] = coerced
+	}
+	return nil
+}
+
+func (schema *Schema) ValidateUpdate(data storage.Data) error {
+	for path, value := range data {
+		attribute, nested, isNested := strings.Cut(path, ".")
+		field, found := schema.byName[attribute]
+		if !found {
+			return &ValidationError{fmt.Sprintf("unknown attribute %s", attribute)}
+		}
+		if isNested {
+			if field.Type != "object" && field.Type != "list" && field.Type != "any" {
+				return &ValidationError{fmt.Sprintf("attribute %s of type %s has no attribute %s", attribute, field.Type, nested)}
+			}
+			continue
+		}
+		coerced, err := coerceValue(field, value)
+		if err != nil {
+			return err
+		}
+		data[path] = coerced
+	}
+	return nil
+}
+
+func (schema *Schema) ValidateUnset(paths []string) error {
+	for _, path := range paths {
+		attribute, _, isNested := strings.Cut(path, ".")
+		field, found := schema.byName[attribute]
+		if !found {
+			return &ValidationError{fmt.Sprintf("unknown attribute %s", attribute)}
+		}
+		if !isNested && !field.Optional {
+			return &ValidationError{fmt.Sprintf("attribute %s is required", attribute)}
+		}
+	}
+	return nil
+}
+
+func (schema *Schema) describe() ([]string, []interface{}, error) {
+	columns := make([]string, len(schema.fields))
+	descriptions := make([]interface{}, len(schema.fields))
+	for i, field := range schema.fields {
+		description := field.Type
+		if field.Optional {
+			description += "?"
+		}
+		if field.HasDefault {
+			serializedDefault, err := SerializeValue(field.Default)
+			if err != nil {
+				return nil, nil, &SerializationError{message: err.Error()}
+			}
+			description += "=" + serializedDefault
+		}
+		columns[i] = field.Name
+		descriptions[i] = description
+	}
+	return columns, descriptions, nil
+}
+
+func coerceValue(field parser.SchemaField, value interface{}) (interface{}, error) {
+	if value == nil {
+		if field.Optional || field.Type == "any" {
+			return nil, nil
+		}
+		return nil, &ValidationError{fmt.Sprintf("attribute %s is required", field.Name)}
+	}
+
+	coerced, ok := value, false
+	switch field.Type {
+	case "any":
+		ok = true
+	case "string":
+		_, ok = value.(string)
+	case "bool":
+		_, ok = value.(bool)
+	case "int":
+		coerced, ok = coerceInt(value)
+	case "uint":
+		coerced, ok = coerceUint(value)
+	case "float":
+		coerced, ok = coerceFloat(value)
+	case "timestamp":
+		coerced, ok = coerceTimestamp(value)
+	case "duration":
+		coerced, ok = coerceDuration(value)
+	case "object":
+		_, ok = value.(storage.Data)
+	case "list":
+		_, ok = value.([]interface{})
+	}
+	if !ok {
+		serialized, _ := SerializeValue(value)
+		return nil, &ValidationError{fmt.Sprintf("attribute %s must be %s, got %s", field.Name, field.Type, serialized)}
+	}
+	return coerced, nil
+}
+
+func coerceInt(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	}
+	return nil, false
+}
+
+func coerceUint(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case uint64:
+		return v, true
+	case int64:
+		return uint64(v), v >= 0
+	case int:
+		return uint64(v), v >= 0
+	}
+	return nil, false
+}
+
+func coerceFloat(value interface{}) (interface{}, bool) {
+	switch value.(type) {
+	case float64, int, int64, uint64:
+		return toFloat64(value), true
+	}
+	return nil, false
+}
+
+func coerceTimestamp(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		timestamp, err := time.Parse(time.RFC3339Nano, v)
+		return timestamp, err == nil
+	}
+	return nil, false
+}
+
+func coerceDuration(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case time.Duration:
+		return v, true
+	case string:
+		duration, err := time.ParseDuration(v)
+		return duration, err == nil
+	}
+	return nil, false
+}
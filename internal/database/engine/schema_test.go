@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestSchemaValidatesInserts(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "SCHEMA car name:string year:int electric:bool? color:string='black'")
+
+	// Act
+	validResult := e.messageHandler(session, "NEW car:1 name 'bmw' year 2020")
+	unknownResult := e.messageHandler(session, "NEW car:2 name 'audi' year 2021 yaer 2021")
+	missingResult := e.messageHandler(session, "NEW car:3 name 'audi'")
+	typeResult := e.messageHandler(session, "NEW car:4 name 'audi' year 'new'")
+	getResult := e.messageHandler(session, "GET car:1")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(validResult), "valid result")
+	testutil.AssertEquals(t, "ERR VALIDATION unknown attribute yaer", string(unknownResult), "unknown result")
+	testutil.AssertEquals(t, "ERR VALIDATION missing required attribute year", string(missingResult), "missing result")
+	testutil.AssertEquals(t, "ERR VALIDATION attribute year must be int, got 'new'", string(typeResult), "type result")
+	testutil.AssertEquals(t, "id 1 color 'black' name 'bmw' year 2020", string(getResult), "get result")
+}
+
+func TestSchemaCoercesValues(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "SCHEMA event price:float at:timestamp")
+
+	// Act
+	insertResult := e.messageHandler(session, "NEW event:1 price 10 at '2024-01-02T03:04:05Z'")
+	getResult := e.messageHandler(session, "GET event:1")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(insertResult), "insert result")
+	testutil.AssertEquals(t, "id 1 at t'2024-01-02T03:04:05Z' price 10.0", string(getResult), "get result")
+}
+
+func TestSchemaValidatesUpdates(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "SCHEMA car name:string year:int specs:object?")
+	e.messageHandler(session, "NEW car:1 name 'bmw' year 2020")
+
+	// Act
+	validResult := e.messageHandler(session, "UPD car:1 year 2021 specs.hp 300")
+	unknownResult := e.messageHandler(session, "UPD car:1 colour 'red'")
+	nestedResult := e.messageHandler(session, "UPD car:1 name.first 'b'")
+	requiredResult := e.messageHandler(session, "UPD car:1 year null")
+	getResult := e.messageHandler(session, "GET car:1")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(validResult), "valid result")
+	testutil.AssertEquals(t, "ERR VALIDATION unknown attribute colour", string(unknownResult), "unknown result")
+	testutil.AssertEquals(t, "ERR VALIDATION attribute name of type string has no attribute first", string(nestedResult), "nested result")
+	testutil.AssertEquals(t, "ERR VALIDATION attribute year is required", string(requiredResult), "required result")
+	testutil.AssertEquals(t, "id 1 name 'bmw' specs {hp 300} year 2021", string(getResult), "get result")
+}
+
+func TestSchemaShowAndRemove(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "SCHEMA car name:string electric:bool? color:string='black'")
+
+	// Act
+	showResult := e.messageHandler(session, "SCHEMA car")
+	removeResult := e.messageHandler(session, "SCHEMA car NONE")
+	insertResult := e.messageHandler(session, "NEW car:1 anything 'goes'")
+	showAfterRemoveResult := e.messageHandler(session, "SCHEMA car")
+
+	// Assert
+	testutil.AssertEquals(t, "name 'string' electric 'bool?' color 'string=\\'black\\''", string(showResult), "show result")
+	testutil.AssertEquals(t, "1", string(removeResult), "remove result")
+	testutil.AssertEquals(t, "1", string(insertResult), "insert result")
+	testutil.AssertEquals(t, "ERR NOT_FOUND schema for entity car not found", string(showAfterRemoveResult), "show after remove result")
+}
+
+func TestSchemaRejectsInvalidExistingRecords(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+
+	// Act
+	schemaResult := e.messageHandler(session, "SCHEMA car name:string year:int")
+	insertResult := e.messageHandler(session, "NEW car:2 year 'new'")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR VALIDATION record car:1: missing required attribute year", string(schemaResult), "schema result")
+	testutil.AssertEquals(t, "1", string(insertResult), "insert result")
+}
+
+func TestSchemaDefaultsOnlyApplyToLaterWrites(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+
+	// Act
+	schemaResult := e.messageHandler(session, "SCHEMA car name:string color:string='black'")
+	e.messageHandler(session, "NEW car:2 name 'audi'")
+	existing := e.messageHandler(session, "GET car:1")
+	inserted := e.messageHandler(session, "GET car:2")
+
+	// Assert
+	testutil.AssertEquals(t, "1", string(schemaResult), "schema result")
+	testutil.AssertEquals(t, "id 1 name 'bmw'", string(existing), "existing")
+	testutil.AssertEquals(t, "id 2 color 'black' name 'audi'", string(inserted), "inserted")
+}
+
+func TestSchemaInstallBlocksConcurrentWrites(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		writer := server.NewSession("writer")
+		for id := 2; id <= 500; id++ {
+			e.messageHandler(writer, fmt.Sprintf("NEW car:%d year %d", id, id))
+		}
+	}()
+
+	// Act
+	schemaResult := string(e.messageHandler(session, "SCHEMA car name:string"))
+	wg.Wait()
+
+	// Assert
+	if schemaResult == "1" {
+		invalid := e.messageHandler(session, "COUNT car year")
+		testutil.AssertEquals(t, "count 0", string(invalid), "records written without a name")
+	}
+}
+
+func TestSchemaFollowsRenameAndDrop(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "SCHEMA car name:string")
+
+	// Act
+	e.messageHandler(session, "RENAME car vehicle")
+	renamedResult := e.messageHandler(session, "NEW vehicle:1 year 2020")
+	e.messageHandler(session, "DROP vehicle")
+	droppedResult := e.messageHandler(session, "NEW vehicle:1 year 2020")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR VALIDATION unknown attribute year", string(renamedResult), "renamed result")
+	testutil.AssertEquals(t, "1", string(droppedResult), "dropped result")
+}
+
+func TestSchemaValidatesUnset(t *testing.T) {
+	// Arrange
+	e := New(DefaultConfig())
+	session := server.NewSession("test")
+	e.messageHandler(session, "SCHEMA car name:string color:string?")
+	e.messageHandler(session, "NEW car:1 name 'bmw' color 'red'")
+
+	// Act
+	requiredResult := e.messageHandler(session, "UNSET car:1 name")
+	optionalResult := e.messageHandler(session, "UNSET car:1 color")
+	replaceResult := e.messageHandler(session, "SET car:1 color 'blue'")
+
+	// Assert
+	testutil.AssertEquals(t, "ERR VALIDATION attribute name is required", string(requiredResult), "required result")
+	testutil.AssertEquals(t, "1", string(optionalResult), "optional result")
+	testutil.AssertEquals(t, "ERR VALIDATION missing required attribute name", string(replaceResult), "replace result")
+}
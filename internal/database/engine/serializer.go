@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/gabrielluciano/liondb/internal/database/storage"
 )
@@ -17,37 +21,254 @@ func (err *SerializationError) Error() string {
 	return fmt.Sprintf("Serialization error: %v", err.message)
 }
 
+type recordSerializer interface {
+	serializeRecord(record *storage.Record) ([]byte, error)
+	serializeRecords(records []*storage.Record) ([]byte, error)
+	serializePage(records []*storage.Record, cursor string) ([]byte, error)
+	serializeRow(columns []string, row []interface{}) ([]byte, error)
+	serializeRows(columns []string, rows [][]interface{}) ([]byte, error)
+	serializeBulkReport(report *bulkReport) []byte
+	serializeError(err error) []byte
+}
+
+type textSerializer struct{}
+
+func (textSerializer) serializeRecord(record *storage.Record) ([]byte, error) {
+	return SerializeRecord(record)
+}
+
+// An empty result set is an empty body, so it cannot be mistaken for a count
+// of 0.
+func (textSerializer) serializeRecords(records []*storage.Record) ([]byte, error) {
+	if len(records) == 0 {
+		return []byte{}, nil
+	}
+	response := make([]byte, 0)
+	for _, record := range records {
+		serialized, err := SerializeRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		response = append(response, serialized...)
+		response = append(response, '\n')
+	}
+	return response[:len(response)-1], nil
+}
+
+func (serializer textSerializer) serializePage(records []*storage.Record, cursor string) ([]byte, error) {
+	response, err := serializer.serializeRecords(records)
+	if err != nil || cursor == "" {
+		return response, err
+	}
+	return append(response, []byte("\ncursor "+cursor)...), nil
+}
+
+func (textSerializer) serializeRow(columns []string, row []interface{}) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	for i, column := range columns {
+		serializedValue, err := SerializeValue(row[i])
+		if err != nil {
+			return nil, &SerializationError{message: err.Error()}
+		}
+		if i > 0 {
+			buffer.WriteByte(' ')
+		}
+		buffer.WriteString(serializeKey(column))
+		buffer.WriteByte(' ')
+		buffer.WriteString(serializedValue)
+	}
+	return buffer.Bytes(), nil
+}
+
+func (serializer textSerializer) serializeRows(columns []string, rows [][]interface{}) ([]byte, error) {
+	if len(rows) == 0 {
+		return []byte{}, nil
+	}
+	serializedRows := make([][]byte, len(rows))
+	for i, row := range rows {
+		serializedRow, err := serializer.serializeRow(columns, row)
+		if err != nil {
+			return nil, err
+		}
+		serializedRows[i] = serializedRow
+	}
+	return bytes.Join(serializedRows, []byte("\n")), nil
+}
+
+func (textSerializer) serializeBulkReport(report *bulkReport) []byte {
+	buffer := bytes.Buffer{}
+	buffer.WriteString(fmt.Sprintf("inserted %d", report.inserted))
+	switch report.conflict {
+	case "SKIP":
+		buffer.WriteString(fmt.Sprintf(" skipped %d", report.skipped))
+	case "REPLACE":
+		buffer.WriteString(fmt.Sprintf(" replaced %d", report.replaced))
+	}
+	buffer.WriteString(fmt.Sprintf(" failed %d", report.failed))
+	for _, failure := range report.failures {
+		buffer.WriteString(fmt.Sprintf("\nline %d ", failure.line))
+		buffer.Write(SerializeError(failure.err))
+	}
+	return buffer.Bytes()
+}
+
+func (textSerializer) serializeError(err error) []byte {
+	return SerializeError(err)
+}
+
+// SerializeRecord encodes a record as a single line of text:
+//
+//	id <id> <key> <value> <key> <value> ...
+//
+// Keys are sorted and written bare unless they contain whitespace, quotes,
+// backslashes or any of {}[], in which case they are quoted like strings.
+// Strings are single quoted with \\, \', \n, \r, \t and \uXXXX escapes, so
+// a serialized record never spans more than one line. Other values use the
+// same literals accepted by the parser: null, true/false, 42, 42u, 4.2,
+// t'<RFC3339>', d'<duration>', {key value ...} and [value, ...].
+// parser.DeserializeRecord reverses this encoding.
 func SerializeRecord(record *storage.Record) ([]byte, error) {
 	buffer := bytes.Buffer{}
 	buffer.WriteString("id ")
 	buffer.WriteString(fmt.Sprint(record.Id))
-	for key, value := range *record.Data {
-		buffer.WriteString(" ")
-		buffer.WriteString(key)
-		buffer.WriteString(" ")
-		serializedValue, err := SerializeValue(value)
+	if record.Data == nil {
+		return buffer.Bytes(), nil
+	}
+	for _, key := range record.Data.Keys() {
+		serializedValue, err := SerializeValue((*record.Data)[key])
 		if err != nil {
 			return []byte{}, &SerializationError{message: err.Error()}
 		}
+		buffer.WriteString(" ")
+		buffer.WriteString(serializeKey(key))
+		buffer.WriteString(" ")
 		buffer.WriteString(serializedValue)
 	}
 	return buffer.Bytes(), nil
 }
 
+func SerializeError(err error) []byte {
+	message := strings.ReplaceAll(err.Error(), "\n", " ")
+	return []byte(fmt.Sprintf("ERR %s %s", ErrorCode(err), message))
+}
+
 func SerializeValue(value interface{}) (string, error) {
 	var response string
 	var err error
 	switch v := value.(type) {
+	case nil:
+		response = "null"
 	case float64:
-		response = strconv.FormatFloat(v, 'f', -1, 64)
+		response, err = serializeFloat(v)
 	case int:
 		response = strconv.Itoa(v)
+	case int64:
+		response = strconv.FormatInt(v, 10)
+	case uint:
+		response = strconv.FormatUint(uint64(v), 10) + "u"
+	case uint64:
+		response = strconv.FormatUint(v, 10) + "u"
 	case bool:
 		response = strconv.FormatBool(v)
 	case string:
-		response = v
+		response = quote(v)
+	case time.Time:
+		response = "t" + quote(v.Format(time.RFC3339Nano))
+	case time.Duration:
+		response = "d" + quote(v.String())
+	case storage.Data:
+		response, err = serializeObject(v)
+	case map[string]interface{}:
+		response, err = serializeObject(storage.Data(v))
+	case []interface{}:
+		response, err = serializeList(v)
 	default:
 		err = errors.New("error serializing value")
 	}
 	return response, err
 }
+
+func serializeObject(object storage.Data) (string, error) {
+	builder := strings.Builder{}
+	builder.WriteByte('{')
+	for i, key := range object.Keys() {
+		serializedValue, err := SerializeValue(object[key])
+		if err != nil {
+			return "", err
+		}
+		if i > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(serializeKey(key))
+		builder.WriteByte(' ')
+		builder.WriteString(serializedValue)
+	}
+	builder.WriteByte('}')
+	return builder.String(), nil
+}
+
+func serializeKey(key string) string {
+	if key == "" || strings.ContainsAny(key, "'\"\\{}[],") {
+		return quote(key)
+	}
+	for _, r := range key {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return quote(key)
+		}
+	}
+	return key
+}
+
+func serializeList(list []interface{}) (string, error) {
+	serializedValues := make([]string, len(list))
+	for i, value := range list {
+		serializedValue, err := SerializeValue(value)
+		if err != nil {
+			return "", err
+		}
+		serializedValues[i] = serializedValue
+	}
+	return "[" + strings.Join(serializedValues, ", ") + "]", nil
+}
+
+func serializeFloat(value float64) (string, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", errors.New("error serializing non-finite float")
+	}
+	format := byte('f')
+	if abs := math.Abs(value); abs != 0 && (abs >= 1e21 || abs < 1e-6) {
+		format = 'e'
+	}
+	response := strconv.FormatFloat(value, format, -1, 64)
+	if !strings.ContainsAny(response, ".e") {
+		response += ".0"
+	}
+	return response, nil
+}
+
+func quote(value string) string {
+	builder := strings.Builder{}
+	builder.WriteByte('\'')
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch c {
+		case '\'', '\\':
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case '\n':
+			builder.WriteString("\\n")
+		case '\r':
+			builder.WriteString("\\r")
+		case '\t':
+			builder.WriteString("\\t")
+		default:
+			if c < 0x20 || c == 0x7f {
+				builder.WriteString(fmt.Sprintf("\\u%04x", c))
+			} else {
+				builder.WriteByte(c)
+			}
+		}
+	}
+	builder.WriteByte('\'')
+	return builder.String()
+}
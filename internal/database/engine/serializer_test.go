@@ -1,8 +1,12 @@
 package engine
 
 import (
+	"bytes"
+	"math"
 	"testing"
+	"time"
 
+	"github.com/gabrielluciano/liondb/internal/database/parser"
 	"github.com/gabrielluciano/liondb/internal/database/storage"
 	"github.com/gabrielluciano/liondb/internal/testutil"
 )
@@ -12,7 +16,7 @@ func TestSerializeRecord(t *testing.T) {
 	record := &storage.Record{
 		Id: 1,
 		Data: &storage.Data{
-			"name":   "'John Silva'",
+			"name":   "John Silva",
 			"age":    45,
 			"weight": 75.8,
 			"smoker": false,
@@ -29,3 +33,142 @@ func TestSerializeRecord(t *testing.T) {
 	testutil.AssertContains(t, string(serialized), "weight 75.8")
 	testutil.AssertContains(t, string(serialized), "smoker false")
 }
+
+func TestSerializeRecordDeterministic(t *testing.T) {
+	// Arrange
+	record := &storage.Record{
+		Id: 7,
+		Data: &storage.Data{
+			"zeta":      int64(1),
+			"alpha":     "multi word\nline 'quoted'",
+			"address":   storage.Data{"zip": int64(123), "city": "SP"},
+			"odd key":   true,
+			"tags[0]":   nil,
+			"mid":       []interface{}{"a", "b"},
+			"backslash": "C:\\temp",
+		},
+	}
+
+	// Act
+	first, firstErr := SerializeRecord(record)
+	second, secondErr := SerializeRecord(record)
+
+	// Assert
+	testutil.AssertNil(t, firstErr, "first error")
+	testutil.AssertNil(t, secondErr, "second error")
+	testutil.AssertEquals(t, string(first), string(second), "serialized")
+	testutil.AssertEquals(t, "id 7 address {city 'SP' zip 123} alpha 'multi word\\nline \\'quoted\\'' "+
+		"backslash 'C:\\\\temp' mid ['a', 'b'] 'odd key' true 'tags[0]' null zeta 1", string(first), "serialized")
+}
+
+func TestSerializeValueTypes(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, "null"},
+		{int64(-42), "-42"},
+		{uint64(42), "42u"},
+		{3.0, "3.0"},
+		{1e21, "1e+21"},
+		{"it's\na test", "'it\\'s\\na test'"},
+		{"bell\a", "'bell\\u0007'"},
+		{time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC), "t'2024-03-01T10:30:00Z'"},
+		{90 * time.Second, "d'1m30s'"},
+		{storage.Data{"city": "SP"}, "{city 'SP'}"},
+		{[]interface{}{"a", int64(1), []interface{}{}}, "['a', 1, []]"},
+	}
+
+	for _, test := range tests {
+		// Act
+		serialized, err := SerializeValue(test.value)
+
+		// Assert
+		testutil.AssertNil(t, err, "error")
+		testutil.AssertEquals(t, test.expected, serialized, test.expected)
+	}
+}
+
+func TestSerializeValueNonFiniteFloat(t *testing.T) {
+	// Act
+	_, err := SerializeValue(math.Inf(1))
+
+	// Assert
+	testutil.AssertNotNil(t, err, "error")
+}
+
+func FuzzSerializeRecordRoundTrip(f *testing.F) {
+	f.Add("name", "John Silva", int64(45), 75.8, uint64(3), true, int64(1700000000))
+	f.Add("odd key", "it's\na\ttab\\", int64(-1), -0.0, uint64(0), false, int64(0))
+	f.Add("{}[],", "\x00\x7f\xff", int64(math.MinInt64), 1e300, uint64(math.MaxUint64), true, int64(-1))
+	f.Add("", "", int64(0), 5e-324, uint64(1), false, int64(253402300799))
+
+	f.Fuzz(func(t *testing.T, key string, text string, integer int64, float float64, unsigned uint64,
+		boolean bool, seconds int64) {
+		if math.IsNaN(float) || math.IsInf(float, 0) {
+			t.Skip()
+		}
+		timestamp := time.Unix(seconds%253402300799, 0).UTC()
+		record := &storage.Record{
+			Id: 1,
+			Data: &storage.Data{
+				key:          text,
+				"integer":    integer,
+				"float":      float,
+				"unsigned":   unsigned,
+				"boolean":    boolean,
+				"timestamp":  timestamp,
+				"duration":   time.Duration(integer),
+				"nested":     storage.Data{key: []interface{}{text, integer, nil}},
+				"emptyList":  []interface{}{},
+				"emptyValue": nil,
+			},
+		}
+
+		serialized, err := SerializeRecord(record)
+		if err != nil {
+			t.Fatalf("error serializing record: %v", err)
+		}
+		if bytes.ContainsAny(serialized, "\n\r") {
+			t.Fatalf("serialized record spans multiple lines: %q", serialized)
+		}
+		deserialized, err := parser.DeserializeRecord(string(serialized))
+		if err != nil {
+			t.Fatalf("error deserializing %q: %v", serialized, err)
+		}
+
+		testutil.AssertEquals(t, record.Id, deserialized.Id, "id")
+		testutil.AssertEquals(t, len(*record.Data), len(*deserialized.Data), "len(data)")
+		for key, value := range *record.Data {
+			if !storage.EqualValues(value, (*deserialized.Data)[key]) {
+				t.Fatalf("value of %q changed from %v to %v in %q", key, value, (*deserialized.Data)[key], serialized)
+			}
+		}
+	})
+}
+
+func FuzzDeserializeRecord(f *testing.F) {
+	f.Add("id 1 name 'John' age 45 tags ['a', 2] address {city 'SP'}")
+	f.Add("id 2 at t'2024-01-01T00:00:00+02:00' wait d'1h' big 18446744073709551615u")
+	f.Add("id 3 'odd key' '\\u00e9\\n' n null f -1e-07")
+
+	f.Fuzz(func(t *testing.T, line string) {
+		record, err := parser.DeserializeRecord(line)
+		if err != nil {
+			return
+		}
+		serialized, err := SerializeRecord(record)
+		if err != nil {
+			t.Fatalf("error serializing deserialized record %q: %v", line, err)
+		}
+		again, err := parser.DeserializeRecord(string(serialized))
+		if err != nil {
+			t.Fatalf("error deserializing %q: %v", serialized, err)
+		}
+		reserialized, err := SerializeRecord(again)
+		if err != nil {
+			t.Fatalf("error serializing %q: %v", serialized, err)
+		}
+		testutil.AssertEquals(t, string(serialized), string(reserialized), "serialized")
+	})
+}
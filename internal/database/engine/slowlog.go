@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/parser"
+)
+
+const (
+	defaultSlowLogThreshold = 10 * time.Millisecond
+	defaultSlowLogSize      = 128
+	maxSlowLogCommandLength = 1024
+)
+
+type slowLogEntry struct {
+	id       int64
+	start    time.Time
+	duration time.Duration
+	command  string
+	entity   string
+	scanned  uint64
+	client   string
+}
+
+// slowLog keeps the most recent commands that took at least threshold to
+// execute. A negative threshold disables it.
+type slowLog struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	size      int
+	lastId    int64
+	entries   []slowLogEntry
+}
+
+func newSlowLog(threshold time.Duration, size int) *slowLog {
+	if threshold == 0 {
+		threshold = defaultSlowLogThreshold
+	}
+	if size <= 0 {
+		size = defaultSlowLogSize
+	}
+	return &slowLog{threshold: threshold, size: size}
+}
+
+func (l *slowLog) record(entry slowLogEntry) {
+	if l.threshold < 0 || entry.duration < l.threshold {
+		return
+	}
+	if len(entry.command) > maxSlowLogCommandLength {
+		entry.command = entry.command[:maxSlowLogCommandLength] + "..."
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastId++
+	entry.id = l.lastId
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > l.size {
+		l.entries = append([]slowLogEntry(nil), l.entries[len(l.entries)-l.size:]...)
+	}
+}
+
+func (l *slowLog) latest(count int) []slowLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if count <= 0 || count > len(l.entries) {
+		count = len(l.entries)
+	}
+	entries := make([]slowLogEntry, count)
+	for i := range entries {
+		entries[i] = l.entries[len(l.entries)-1-i]
+	}
+	return entries
+}
+
+func (l *slowLog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+func (l *slowLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+}
+
+func (e *Engine) slowlogCommand(parsedCommand *parser.ParsedCommand, serializer recordSerializer) ([]byte, error) {
+	switch parsedCommand.Args[0] {
+	case "LEN":
+		return []byte(strconv.Itoa(e.slowLog.len())), nil
+	case "RESET":
+		e.slowLog.reset()
+		return []byte("1"), nil
+	}
+	entries := e.slowLog.latest(parsedCommand.Limit)
+	rows := make([][]interface{}, len(entries))
+	for i, entry := range entries {
+		rows[i] = []interface{}{entry.id, entry.start, entry.duration, entry.entity, int64(entry.scanned), entry.client, entry.command}
+	}
+	return serializer.serializeRows([]string{"id", "time", "duration", "entity", "scanned", "client", "command"}, rows)
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/server"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestSlowLog(t *testing.T) {
+	// Arrange
+	e := New(Config{SlowLogThreshold: time.Nanosecond, SlowLogSize: 3})
+	session := server.NewSession("10.0.0.1:5000")
+	for _, command := range []string{"NEW car:1", "NEW car:2", "NEW car:3", "NEW car:4"} {
+		e.messageHandler(session, command)
+	}
+	e.messageHandler(session, "GET car WHERE name = 'bmw'")
+
+	// Act
+	length := e.messageHandler(session, "SLOWLOG LEN")
+	latest := e.messageHandler(session, "SLOWLOG GET 2")
+	reset := e.messageHandler(session, "SLOWLOG RESET")
+	afterReset := e.messageHandler(session, "SLOWLOG")
+
+	// Assert
+	rows := strings.Split(string(latest), "\n")
+	testutil.AssertEquals(t, "3", string(length), "length")
+	testutil.AssertEquals(t, 2, len(rows), "rows")
+	testutil.AssertTrue(t, strings.HasPrefix(rows[0], "id 6 time t'"), "newest first")
+	testutil.AssertContains(t, rows[0], "entity '' scanned 0 client '10.0.0.1:5000' command 'SLOWLOG LEN'")
+	testutil.AssertContains(t, rows[1], "entity 'car' scanned 4 client '10.0.0.1:5000' command 'GET car WHERE name = \\'bmw\\''")
+	testutil.AssertEquals(t, "1", string(reset), "reset")
+	testutil.AssertContains(t, string(afterReset), "command 'SLOWLOG RESET'")
+}
+
+func TestSlowLogDisabled(t *testing.T) {
+	// Arrange
+	e := New(Config{SlowLogThreshold: -1})
+	session := server.NewSession("test")
+	e.messageHandler(session, "NEW car:1")
+
+	// Act
+	length := e.messageHandler(session, "SLOWLOG LEN")
+
+	// Assert
+	testutil.AssertEquals(t, "0", string(length), "length")
+}
+
+func TestTraceFile(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "spans.jsonl")
+	e := New(DefaultConfig())
+	tracer, err := openSpanExporter(path)
+	if err != nil {
+		t.Fatalf("Error opening trace file: %v", err)
+	}
+	e.tracer = tracer
+	session := server.NewSession("10.0.0.1:5000")
+
+	// Act
+	e.messageHandler(session, "NEW car:1 name 'bmw'")
+	e.messageHandler(session, "GET car:2")
+	e.Close()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Error reading trace file: %v", err)
+	}
+
+	// Assert
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	testutil.AssertEquals(t, 2, len(lines), "spans")
+	spans := make([]otlpSpan, len(lines))
+	for i, line := range lines {
+		var traces otlpTraces
+		if err := json.Unmarshal([]byte(line), &traces); err != nil {
+			t.Fatalf("Error decoding span %q: %v", line, err)
+		}
+		testutil.AssertEquals(t, "service.name", traces.ResourceSpans[0].Resource.Attributes[0].Key, "resource attribute")
+		spans[i] = traces.ResourceSpans[0].ScopeSpans[0].Spans[0]
+		testutil.AssertEquals(t, 32, len(spans[i].TraceId), "trace id")
+		testutil.AssertEquals(t, 16, len(spans[i].SpanId), "span id")
+		testutil.AssertEquals(t, spanKindServer, spans[i].Kind, "kind")
+	}
+	testutil.AssertEquals(t, "NEW", spans[0].Name, "insert name")
+	testutil.AssertEquals(t, spanStatusOk, spans[0].Status.Code, "insert status")
+	testutil.AssertEquals(t, "NEW car:1 name 'bmw'", *spans[0].Attributes[2].Value.StringValue, "statement")
+	testutil.AssertEquals(t, "GET", spans[1].Name, "get name")
+	testutil.AssertEquals(t, spanStatusError, spans[1].Status.Code, "get status")
+	testutil.AssertEquals(t, "ERR NOT_FOUND record car:2 not found", spans[1].Status.Message, "get status message")
+	testutil.AssertEquals(t, "10.0.0.1:5000", *spans[1].Attributes[5].Value.StringValue, "client address")
+}
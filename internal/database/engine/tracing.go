@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	spanKindServer  = 2
+	spanStatusOk    = 1
+	spanStatusError = 2
+)
+
+type commandSpan struct {
+	operation string
+	command   string
+	entity    string
+	client    string
+	scanned   uint64
+	start     time.Time
+	end       time.Time
+	err       string
+}
+
+// spanExporter appends one span per command to a file, each line an OTLP/JSON
+// ExportTraceServiceRequest as written by the OpenTelemetry collector's file
+// exporter, so the file can be replayed into any OTLP-compatible backend.
+type spanExporter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func openSpanExporter(path string) (*spanExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &spanExporter{file: file}, nil
+}
+
+func (x *spanExporter) export(span commandSpan) error {
+	attributes := []otlpAttribute{
+		stringAttribute("db.system", "liondb"),
+		stringAttribute("db.operation", span.operation),
+		stringAttribute("db.statement", span.command),
+		intAttribute("liondb.records_scanned", span.scanned),
+	}
+	if span.entity != "" {
+		attributes = append(attributes, stringAttribute("liondb.entity", span.entity))
+	}
+	if span.client != "" {
+		attributes = append(attributes, stringAttribute("client.address", span.client))
+	}
+	status := otlpStatus{Code: spanStatusOk}
+	if span.err != "" {
+		status = otlpStatus{Code: spanStatusError, Message: span.err}
+	}
+	encoded, err := json.Marshal(otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{stringAttribute("service.name", "liondb")}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "liondb"},
+			Spans: []otlpSpan{{
+				TraceId:           randomHex(16),
+				SpanId:            randomHex(8),
+				Name:              span.operation,
+				Kind:              spanKindServer,
+				StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+				EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+				Attributes:        attributes,
+				Status:            status,
+			}},
+		}},
+	}}})
+	if err != nil {
+		return err
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	_, err = x.file.Write(append(encoded, '\n'))
+	return err
+}
+
+func (x *spanExporter) close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.file.Close()
+}
+
+func stringAttribute(key string, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func intAttribute(key string, value uint64) otlpAttribute {
+	text := strconv.FormatUint(value, 10)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &text}}
+}
+
+func randomHex(size int) string {
+	id := make([]byte, size)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
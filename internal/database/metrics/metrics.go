@@ -0,0 +1,269 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var DefaultBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// Registry holds metrics and renders them in the Prometheus text exposition
+// format, in the order they were registered.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+	writer := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(writer)
+	}
+	return writer.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.Write(w)
+}
+
+type Counter struct {
+	family
+	mu     sync.Mutex
+	values map[string]*Sample
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: family{name, help, "counter", labels}, values: make(map[string]*Sample)}
+	r.register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sample, found := c.values[key]
+	if !found {
+		sample = &Sample{Labels: append([]string(nil), labelValues...)}
+		c.values[key] = sample
+	}
+	sample.Value += value
+}
+
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if sample, found := c.values[strings.Join(labelValues, "\xff")]; found {
+		return sample.Value
+	}
+	return 0
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	samples := make([]Sample, 0, len(c.values))
+	for _, sample := range c.values {
+		samples = append(samples, *sample)
+	}
+	c.mu.Unlock()
+	if len(c.labels) == 0 && len(samples) == 0 {
+		samples = append(samples, Sample{})
+	}
+	c.family.write(w, samples)
+}
+
+// Func is a metric whose samples are collected when it is written, for values
+// that already live elsewhere such as connection counts or storage sizes.
+type Func struct {
+	family
+	collect func() []Sample
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func() []Sample) *Func {
+	f := &Func{family: family{name, help, "gauge", labels}, collect: collect}
+	r.register(f)
+	return f
+}
+
+func (r *Registry) NewCounterFunc(name, help string, labels []string, collect func() []Sample) *Func {
+	f := &Func{family: family{name, help, "counter", labels}, collect: collect}
+	r.register(f)
+	return f
+}
+
+func (f *Func) write(w *bufio.Writer) {
+	f.family.write(w, f.collect())
+}
+
+type Histogram struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{
+		family:  family{name, help, "histogram", labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series, found := h.values[key]
+	if !found {
+		series = &histogramSeries{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if series, found := h.values[strings.Join(labelValues, "\xff")]; found {
+		return series.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	series := make([]histogramSeries, 0, len(h.values))
+	for _, s := range h.values {
+		series = append(series, histogramSeries{labels: s.labels, counts: append([]uint64(nil), s.counts...), count: s.count, sum: s.sum})
+	}
+	h.mu.Unlock()
+	sort.Slice(series, func(i, j int) bool { return lessLabels(series[i].labels, series[j].labels) })
+
+	h.writeHeader(w)
+	labels := append(append([]string(nil), h.labels...), "le")
+	for _, s := range series {
+		for i, bound := range h.buckets {
+			writeSample(w, h.name+"_bucket", labels, append(append([]string(nil), s.labels...), formatValue(bound)), float64(s.counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", labels, append(append([]string(nil), s.labels...), "+Inf"), float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.labels, s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.labels, float64(s.count))
+	}
+}
+
+func (f family) writeHeader(w *bufio.Writer) {
+	w.WriteString("# HELP " + f.name + " " + strings.NewReplacer("\\", `\\`, "\n", `\n`).Replace(f.help) + "\n")
+	w.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+}
+
+func (f family) write(w *bufio.Writer, samples []Sample) {
+	sort.Slice(samples, func(i, j int) bool { return lessLabels(samples[i].Labels, samples[j].Labels) })
+	f.writeHeader(w)
+	for _, sample := range samples {
+		writeSample(w, f.name, f.labels, sample.Labels, sample.Value)
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels []string, values []string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			labelValue := ""
+			if i < len(values) {
+				labelValue = values[i]
+			}
+			w.WriteString(label + `="` + escapeLabel(labelValue) + `"`)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatValue(value))
+	w.WriteByte('\n')
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer("\\", `\\`, "\"", `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+func lessLabels(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
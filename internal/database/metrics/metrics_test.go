@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func render(t *testing.T, r *Registry) string {
+	builder := strings.Builder{}
+	if err := r.Write(&builder); err != nil {
+		t.Fatalf("Error writing metrics: %v", err)
+	}
+	return builder.String()
+}
+
+func TestCounter(t *testing.T) {
+	// Arrange
+	r := NewRegistry()
+	commands := r.NewCounter("commands_total", "Commands executed.", "operation")
+	errors := r.NewCounter("errors_total", "Errors.")
+
+	// Act
+	commands.Inc("GET")
+	commands.Inc("NEW")
+	commands.Add(2, "GET")
+	output := render(t, r)
+
+	// Assert
+	testutil.AssertEquals(t, float64(3), commands.Value("GET"), "get value")
+	testutil.AssertEquals(t, float64(0), errors.Value(), "errors value")
+	testutil.AssertEquals(t, "# HELP commands_total Commands executed.\n"+
+		"# TYPE commands_total counter\n"+
+		"commands_total{operation=\"GET\"} 3\n"+
+		"commands_total{operation=\"NEW\"} 1\n"+
+		"# HELP errors_total Errors.\n"+
+		"# TYPE errors_total counter\n"+
+		"errors_total 0\n", output, "output")
+}
+
+func TestFuncs(t *testing.T) {
+	// Arrange
+	r := NewRegistry()
+	r.NewGaugeFunc("records", "Records per entity.", []string{"entity"}, func() []Sample {
+		return []Sample{{Labels: []string{"truck"}, Value: 2}, {Labels: []string{"car \"new\""}, Value: 5}}
+	})
+	r.NewCounterFunc("bytes_total", "Bytes.", nil, func() []Sample {
+		return []Sample{{Value: 1024}}
+	})
+
+	// Act
+	output := render(t, r)
+
+	// Assert
+	testutil.AssertEquals(t, "# HELP records Records per entity.\n"+
+		"# TYPE records gauge\n"+
+		"records{entity=\"car \\\"new\\\"\"} 5\n"+
+		"records{entity=\"truck\"} 2\n"+
+		"# HELP bytes_total Bytes.\n"+
+		"# TYPE bytes_total counter\n"+
+		"bytes_total 1024\n", output, "output")
+}
+
+func TestHistogram(t *testing.T) {
+	// Arrange
+	r := NewRegistry()
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "operation")
+
+	// Act
+	latency.Observe(0.05, "GET")
+	latency.Observe(0.5, "GET")
+	latency.Observe(3, "GET")
+	output := render(t, r)
+
+	// Assert
+	testutil.AssertEquals(t, uint64(3), latency.Count("GET"), "count")
+	testutil.AssertEquals(t, "# HELP latency_seconds Latency.\n"+
+		"# TYPE latency_seconds histogram\n"+
+		"latency_seconds_bucket{operation=\"GET\",le=\"0.1\"} 1\n"+
+		"latency_seconds_bucket{operation=\"GET\",le=\"1\"} 2\n"+
+		"latency_seconds_bucket{operation=\"GET\",le=\"+Inf\"} 3\n"+
+		"latency_seconds_sum{operation=\"GET\"} 3.55\n"+
+		"latency_seconds_count{operation=\"GET\"} 3\n", output, "output")
+}
+
+func TestServeHTTP(t *testing.T) {
+	// Arrange
+	r := NewRegistry()
+	r.NewCounter("up_total", "Up.").Inc()
+	recorder := httptest.NewRecorder()
+
+	// Act
+	r.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+
+	// Assert
+	testutil.AssertContains(t, recorder.Header().Get("Content-Type"), "text/plain")
+	testutil.AssertContains(t, string(body), "up_total 1\n")
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"strings"
+)
+
+var clusterActions = map[string]int{
+	"ADD":       4,
+	"REMOVE":    3,
+	"REBALANCE": 2,
+	"LOCAL":     2,
+	"SCAN":      3,
+	"PREPARE":   3,
+	"COPY":      2,
+	"COMMIT":    3,
+	"ABORT":     3,
+	"TRANSFER":  2,
+	"PARTIAL":   2,
+}
+
+func parseCluster(parts []string) (*ParsedCommand, error) {
+	parsedCommand := &ParsedCommand{Operation: "CLUSTER"}
+	if len(parts) == 1 {
+		return parsedCommand, nil
+	}
+
+	action := strings.ToUpper(parts[1])
+	if expectedParts, found := clusterActions[action]; !found || len(parts) != expectedParts {
+		return nil, &ParseError{"Error parsing command: expected CLUSTER, CLUSTER ADD <node> <address>, CLUSTER REMOVE <node> or CLUSTER REBALANCE"}
+	}
+	if action == "SCAN" {
+		entity, err := getEntity(parts[2])
+		if err != nil || !isEntityName(entity) {
+			return nil, &ParseError{"Error parsing entity: invalid entity " + parts[2]}
+		}
+		ids, err := getIds(parts[2])
+		if err != nil {
+			return nil, &ParseError{"Error parsing id: " + err.Error()}
+		}
+		parsedCommand.Entity = entity
+		parsedCommand.Id = ids
+	}
+	for _, argument := range parts[2:] {
+		if argument == "" || strings.ContainsAny(argument, "'\"\\{}") {
+			return nil, &ParseError{"Error parsing command: invalid argument " + argument}
+		}
+	}
+	parsedCommand.Args = append([]string{action}, parts[2:]...)
+	return parsedCommand, nil
+}
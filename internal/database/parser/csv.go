@@ -0,0 +1,106 @@
+package parser
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+type CSVColumn struct {
+	Name string
+	Type string
+}
+
+func ParseCSVHeader(line string) ([]CSVColumn, error) {
+	fields, err := readCSVLine(line)
+	if err != nil {
+		return nil, &ParseError{"Error parsing csv header: " + err.Error()}
+	}
+	if len(fields) == 0 || fields[0] != "id" {
+		return nil, &ParseError{"Error parsing csv header: first column must be id"}
+	}
+
+	columns := []CSVColumn{{Name: "id", Type: "uint"}}
+	names := map[string]bool{"id": true}
+	for _, field := range fields[1:] {
+		index := strings.LastIndex(field, ":")
+		if index <= 0 || !schemaTypes[field[index+1:]] {
+			return nil, &ParseError{"Error parsing csv header: invalid column " + field}
+		}
+		column := CSVColumn{Name: field[:index], Type: field[index+1:]}
+		if names[column.Name] {
+			return nil, &ParseError{"Error parsing csv header: duplicated column " + column.Name}
+		}
+		names[column.Name] = true
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+func DeserializeRecordCSV(columns []CSVColumn, line string) (*storage.Record, error) {
+	fields, err := readCSVLine(line)
+	if err != nil {
+		return nil, &ParseError{"Error deserializing record: " + err.Error()}
+	}
+	if len(fields) != len(columns) {
+		return nil, &ParseError{fmt.Sprintf("Error deserializing record: expected %d columns, got %d", len(columns), len(fields))}
+	}
+	id, err := strconv.ParseUint(fields[0], 10, strconv.IntSize)
+	if err != nil || id == 0 {
+		return nil, &ParseError{"Error deserializing record: invalid id " + fields[0]}
+	}
+
+	data := storage.Data{}
+	for i, column := range columns[1:] {
+		field := fields[i+1]
+		if field == "" {
+			continue
+		}
+		value, err := decodeCSVField(column.Type, field)
+		if err != nil {
+			return nil, &ParseError{fmt.Sprintf("Error deserializing record: column %s: %v", column.Name, err)}
+		}
+		data[column.Name] = value
+	}
+	return &storage.Record{Id: uint(id), Data: &data}, nil
+}
+
+func decodeCSVField(fieldType string, field string) (interface{}, error) {
+	switch fieldType {
+	case "string":
+		return field, nil
+	case "int":
+		return strconv.ParseInt(field, 10, 64)
+	case "uint":
+		return strconv.ParseUint(field, 10, 64)
+	case "float":
+		return strconv.ParseFloat(field, 64)
+	case "bool":
+		return strconv.ParseBool(field)
+	case "timestamp":
+		return time.Parse(time.RFC3339Nano, field)
+	case "duration":
+		return time.ParseDuration(field)
+	}
+
+	value, err := ParseValue(field)
+	if err != nil {
+		return nil, err
+	}
+	_, isObject := value.(storage.Data)
+	_, isList := value.([]interface{})
+	if (fieldType == "object" && !isObject) || (fieldType == "list" && !isList) {
+		return nil, fmt.Errorf("expected %s, got %s", fieldType, field)
+	}
+	return value, nil
+}
+
+func readCSVLine(line string) ([]string, error) {
+	reader := csv.NewReader(strings.NewReader(line))
+	reader.FieldsPerRecord = -1
+	return reader.Read()
+}
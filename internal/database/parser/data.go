@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+const structuralChars = "{}[],"
+
+type dataParser struct {
+	tokens   []string
+	position int
+}
+
+func tokenizeData(parts []string) ([]string, error) {
+	tokens := make([]string, 0, len(parts))
+	for _, part := range parts {
+		start := 0
+		for i := 0; i < len(part); i++ {
+			c := part[i]
+			if c == '\'' || c == '"' {
+				end, err := skipQuoted(part, i)
+				if err != nil {
+					return nil, err
+				}
+				i = end
+				continue
+			}
+			if strings.IndexByte(structuralChars, c) < 0 {
+				continue
+			}
+			if i > start {
+				tokens = append(tokens, part[start:i])
+			}
+			tokens = append(tokens, part[i:i+1])
+			start = i + 1
+		}
+		if start < len(part) {
+			tokens = append(tokens, part[start:])
+		}
+	}
+	return tokens, nil
+}
+
+func (p *dataParser) done() bool {
+	return p.position >= len(p.tokens)
+}
+
+func (p *dataParser) next() string {
+	token := p.tokens[p.position]
+	p.position++
+	return token
+}
+
+func (p *dataParser) parseAttributes(closing string) (storage.Data, error) {
+	data := storage.Data{}
+	for {
+		if p.done() {
+			if closing != "" {
+				return nil, fmt.Errorf("missing closing %s", closing)
+			}
+			return data, nil
+		}
+		token := p.next()
+		if token == closing {
+			return data, nil
+		}
+		if token == "," {
+			continue
+		}
+		key, err := parseKey(token)
+		if err != nil {
+			return nil, err
+		}
+		if p.done() || p.tokens[p.position] == closing {
+			return nil, fmt.Errorf("missing value for attribute %s", key)
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		data[key] = value
+	}
+}
+
+func (p *dataParser) parseList() ([]interface{}, error) {
+	list := make([]interface{}, 0)
+	for {
+		if p.done() {
+			return nil, errors.New("missing closing ]")
+		}
+		switch p.tokens[p.position] {
+		case "]":
+			p.position++
+			return list, nil
+		case ",":
+			p.position++
+			continue
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+}
+
+func (p *dataParser) parseValue() (interface{}, error) {
+	token := p.next()
+	switch token {
+	case "{":
+		return p.parseAttributes("}")
+	case "[":
+		return p.parseList()
+	case "}", "]", ",":
+		return nil, fmt.Errorf("unexpected %s", token)
+	default:
+		return parseDataTypes(token)
+	}
+}
+
+func parseKey(token string) (string, error) {
+	if strings.Contains(structuralChars, token) {
+		return "", fmt.Errorf("unexpected %s", token)
+	}
+	if isQuoted(token) {
+		return unquote(token)
+	}
+	if strings.ContainsAny(token, "'\"\\") {
+		return "", fmt.Errorf("invalid attribute name %s", token)
+	}
+	return token, nil
+}
+
+func ParseValue(text string) (interface{}, error) {
+	parts, err := splitCommand(text)
+	if err != nil {
+		return nil, &ParseError{err.Error()}
+	}
+	tokens, err := tokenizeData(parts)
+	if err != nil {
+		return nil, &ParseError{err.Error()}
+	}
+	if len(tokens) == 0 {
+		return nil, &ParseError{"missing value"}
+	}
+	parser := &dataParser{tokens: tokens}
+	value, err := parser.parseValue()
+	if err != nil {
+		return nil, &ParseError{err.Error()}
+	}
+	if !parser.done() {
+		return nil, &ParseError{"unexpected data after value"}
+	}
+	return value, nil
+}
@@ -0,0 +1,189 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+func getJSONData(body string) (*storage.Data, error) {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, &ParseError{"invalid json: " + err.Error()}
+	}
+	if strings.TrimSpace(body[decoder.InputOffset():]) != "" {
+		return nil, &ParseError{"invalid json: unexpected data after object"}
+	}
+
+	object, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, &ParseError{"invalid json: expected an object"}
+	}
+	value, err := convertJSONValue(object)
+	if err != nil {
+		return nil, &ParseError{"invalid json: " + err.Error()}
+	}
+	data := value.(storage.Data)
+	return &data, nil
+}
+
+func convertJSONValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		data := make(storage.Data, len(v))
+		for key, nested := range v {
+			converted, err := convertJSONValue(nested)
+			if err != nil {
+				return nil, err
+			}
+			data[key] = converted
+		}
+		return data, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, nested := range v {
+			converted, err := convertJSONValue(nested)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = converted
+		}
+		return list, nil
+	case json.Number:
+		return convertJSONNumber(v)
+	default:
+		return value, nil
+	}
+}
+
+func convertJSONNumber(number json.Number) (interface{}, error) {
+	text := number.String()
+	if !strings.ContainsAny(text, ".eE") {
+		if integer, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return integer, nil
+		}
+		if unsigned, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return unsigned, nil
+		}
+		return nil, fmt.Errorf("integer %s out of range", text)
+	}
+	float, err := number.Float64()
+	if err != nil {
+		return nil, errors.New("invalid number " + text)
+	}
+	return float, nil
+}
+
+func isJSONObject(part string) bool {
+	return strings.HasPrefix(part, "{")
+}
+
+func DeserializeRecordJSON(line string) (*storage.Record, error) {
+	data, err := getJSONData(line)
+	if err != nil {
+		return nil, &ParseError{"Error deserializing record: " + err.Error()}
+	}
+	var id uint64
+	switch value := (*data)["id"].(type) {
+	case int64:
+		if value > 0 {
+			id = uint64(value)
+		}
+	case uint64:
+		id = value
+	}
+	if id == 0 || id > math.MaxUint {
+		return nil, &ParseError{"Error deserializing record: missing or invalid id"}
+	}
+	delete(*data, "id")
+	return &storage.Record{Id: uint(id), Data: data}, nil
+}
+
+func DeserializeRecordExtendedJSON(line string) (*storage.Record, error) {
+	record, err := DeserializeRecordJSON(line)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range *record.Data {
+		decoded, err := decodeExtendedJSON(value)
+		if err != nil {
+			return nil, &ParseError{fmt.Sprintf("Error deserializing record: attribute %s: %v", key, err)}
+		}
+		(*record.Data)[key] = decoded
+	}
+	return record, nil
+}
+
+func decodeExtendedJSON(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case storage.Data:
+		if typed, isTyped := extendedJSONType(v); isTyped {
+			return decodeExtendedJSONType(typed, v[typed].(string))
+		}
+		for key, nested := range v {
+			decoded, err := decodeExtendedJSON(nested)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = decoded
+		}
+		return v, nil
+	case []interface{}:
+		for i, nested := range v {
+			decoded, err := decodeExtendedJSON(nested)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = decoded
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+func extendedJSONType(object storage.Data) (string, bool) {
+	if len(object) != 1 {
+		return "", false
+	}
+	for key, value := range object {
+		_, isString := value.(string)
+		switch key {
+		case "$timestamp", "$duration", "$uint":
+			return key, isString
+		}
+	}
+	return "", false
+}
+
+func decodeExtendedJSONType(typed string, text string) (interface{}, error) {
+	switch typed {
+	case "$timestamp":
+		timestamp, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp %s", text)
+		}
+		return timestamp, nil
+	case "$duration":
+		duration, err := time.ParseDuration(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration %s", text)
+		}
+		return duration, nil
+	default:
+		unsigned, err := strconv.ParseUint(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unsigned integer %s", text)
+		}
+		return unsigned, nil
+	}
+}
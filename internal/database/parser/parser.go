@@ -3,15 +3,14 @@ package parser
 import (
 	"errors"
 	"fmt"
-	"regexp"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gabrielluciano/liondb/internal/database/storage"
 )
 
-var splitCommandRegex = regexp.MustCompile("[^\\s\"']+|\"[^\"]*\"|'[^']*'")
-
 type ParseError struct {
 	msg string
 }
@@ -21,11 +20,40 @@ type Id struct {
 	Upper uint
 }
 
+type OrderKey struct {
+	Attribute  string
+	Descending bool
+}
+
+type Condition struct {
+	Attribute string
+	Operator  string
+	Value     interface{}
+}
+
+type SchemaField struct {
+	Name       string
+	Type       string
+	Optional   bool
+	Default    interface{}
+	HasDefault bool
+}
+
 type ParsedCommand struct {
 	Operation string
 	Entity    string
 	Id        Id
 	Data      *storage.Data
+	Args      []string
+	Fields    []string
+	Limit     int
+	Offset    int
+	Cursor    string
+	OrderBy   []OrderKey
+	Where     []Condition
+	Attribute string
+	GroupBy   string
+	Schema    []SchemaField
 }
 
 func (err *ParseError) Error() string {
@@ -38,6 +66,37 @@ func ParseCommand(cmd string) (*ParsedCommand, error) {
 		return nil, &ParseError{"Error parsing command: " + err.Error()}
 	}
 
+	operation := strings.ToUpper(parts[0])
+	switch operation {
+	case "FORMAT":
+		return parseFormat(parts)
+	case "PING":
+		return parsePing(cmd, parts)
+	case "ENTITIES", "DROP", "RENAME", "STATS", "BULK", "REPLICATION", "INFO":
+		return parseEntityCommand(operation, parts)
+	case "SCHEMA":
+		return parseSchema(parts)
+	case "EXPORT", "IMPORT":
+		return parseTransfer(operation, parts)
+	case "RAFT":
+		return parseRaft(parts)
+	case "CLUSTER":
+		return parseCluster(parts)
+	case "SUBSCRIBE":
+		return parseSubscribe(parts)
+	case "UNSUBSCRIBE":
+		return parseUnsubscribe(parts)
+	case "PUBLISH":
+		return parsePublish(cmd, parts)
+	case "TRIGGER":
+		return parseTrigger(parts)
+	case "SLOWLOG":
+		return parseSlowlog(parts)
+	}
+	if len(parts) < 2 {
+		return nil, &ParseError{"Error parsing command: invalid command"}
+	}
+
 	entity, err := getEntity(parts[1])
 	if err != nil {
 		return nil, &ParseError{"Error parsing entity: " + err.Error()}
@@ -48,27 +107,205 @@ func ParseCommand(cmd string) (*ParsedCommand, error) {
 		return nil, &ParseError{"Error parsing id: " + err.Error()}
 	}
 
-	data, err := getData(parts[2:])
+	switch operation {
+	case "GET":
+		parsedCommand := &ParsedCommand{Operation: operation, Entity: entity, Id: ids}
+		if err := getQuery(parsedCommand, parts[2:], getClauses); err != nil {
+			return nil, &ParseError{"Error parsing query: " + err.Error()}
+		}
+		return parsedCommand, nil
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		return parseAggregate(&ParsedCommand{Operation: operation, Entity: entity, Id: ids}, parts[2:])
+	case "UNSET":
+		return parseUnset(&ParsedCommand{Operation: operation, Entity: entity, Id: ids}, parts[2:])
+	case "INCR", "DECR", "APPEND":
+		return parseAtomic(&ParsedCommand{Operation: operation, Entity: entity, Id: ids}, parts[2:])
+	}
+
+	var data *storage.Data
+	if len(parts) > 2 && isJSONObject(parts[2]) {
+		data, err = getJSONData(remainder(cmd, 2))
+	} else {
+		data, err = ParseData(remainder(cmd, 2))
+	}
+	if err == nil {
+		err = checkDataAttributes(data)
+	}
 	if err != nil {
 		return nil, &ParseError{"Error parsing data: " + err.Error()}
 	}
 
 	return &ParsedCommand{
-		Operation: strings.ToUpper(parts[0]),
+		Operation: operation,
 		Entity:    entity,
 		Id:        ids,
 		Data:      data,
 	}, nil
 }
 
+func parseUnset(parsedCommand *ParsedCommand, parts []string) (*ParsedCommand, error) {
+	attributes := make([]string, 0)
+	for _, part := range parts {
+		for _, attribute := range strings.Split(part, ",") {
+			if attribute != "" {
+				attributes = append(attributes, attribute)
+			}
+		}
+	}
+	if len(attributes) == 0 {
+		return nil, &ParseError{"Error parsing attributes: UNSET expects at least one attribute"}
+	}
+	for _, attribute := range attributes {
+		if !isDataAttribute(attribute) {
+			return nil, &ParseError{"Error parsing attributes: invalid attribute " + attribute}
+		}
+	}
+	parsedCommand.Fields = attributes
+	return parsedCommand, nil
+}
+
+func parseAtomic(parsedCommand *ParsedCommand, parts []string) (*ParsedCommand, error) {
+	if len(parts) == 0 || !isDataAttribute(parts[0]) {
+		return nil, &ParseError{fmt.Sprintf("Error parsing attributes: %s expects an attribute", parsedCommand.Operation)}
+	}
+	if len(parts) == 1 && parsedCommand.Operation != "APPEND" {
+		parts = append(parts, "1")
+	}
+
+	data, err := getData(parts)
+	if err != nil {
+		return nil, &ParseError{"Error parsing data: " + err.Error()}
+	}
+	if len(*data) != 1 {
+		return nil, &ParseError{fmt.Sprintf("Error parsing data: %s expects a single attribute and value", parsedCommand.Operation)}
+	}
+	if parsedCommand.Operation != "APPEND" {
+		switch (*data)[parts[0]].(type) {
+		case int64, uint64, float64:
+		default:
+			return nil, &ParseError{fmt.Sprintf("Error parsing data: %s expects a numeric amount", parsedCommand.Operation)}
+		}
+	}
+	parsedCommand.Attribute = parts[0]
+	parsedCommand.Data = data
+	return parsedCommand, nil
+}
+
+func parseFormat(parts []string) (*ParsedCommand, error) {
+	if len(parts) != 2 {
+		return nil, &ParseError{"Error parsing command: FORMAT expects a single argument"}
+	}
+	format := strings.ToLower(parts[1])
+	if format != "json" && format != "text" {
+		return nil, &ParseError{"Error parsing command: invalid format " + parts[1]}
+	}
+	return &ParsedCommand{Operation: "FORMAT", Args: []string{format}}, nil
+}
+
+func parsePing(cmd string, parts []string) (*ParsedCommand, error) {
+	parsedCommand := &ParsedCommand{Operation: "PING"}
+	if len(parts) > 1 {
+		parsedCommand.Args = []string{remainder(cmd, 1)}
+	}
+	return parsedCommand, nil
+}
+
+func parseEntityCommand(operation string, parts []string) (*ParsedCommand, error) {
+	expectedParts := map[string]int{"ENTITIES": 1, "REPLICATION": 1, "INFO": 1, "DROP": 2, "STATS": 2, "BULK": 2, "RENAME": 3}[operation]
+	if len(parts) != expectedParts {
+		return nil, &ParseError{fmt.Sprintf("Error parsing command: %s expects %d argument(s)", operation, expectedParts-1)}
+	}
+	for _, name := range parts[1:] {
+		if !isEntityName(name) {
+			return nil, &ParseError{"Error parsing entity: invalid entity " + name}
+		}
+	}
+
+	parsedCommand := &ParsedCommand{Operation: operation}
+	if len(parts) > 1 {
+		parsedCommand.Entity = parts[1]
+		parsedCommand.Args = parts[2:]
+	}
+	return parsedCommand, nil
+}
+
+func isEntityName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, ":[]'\"\\{},")
+}
+
 func getParts(cmd string) ([]string, error) {
-	parts := splitCommandRegex.FindAllString(cmd, -1)
-	if len(parts) < 2 {
+	parts, err := splitCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) < 1 {
 		return nil, errors.New("invalid command")
 	}
 	return parts, nil
 }
 
+func splitCommand(cmd string) ([]string, error) {
+	spans, err := scanTokens(cmd)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(spans))
+	for i, span := range spans {
+		parts[i] = cmd[span[0]:span[1]]
+	}
+	return parts, nil
+}
+
+func remainder(cmd string, skip int) string {
+	spans, err := scanTokens(cmd)
+	if err != nil || skip >= len(spans) {
+		return ""
+	}
+	return cmd[spans[skip][0]:]
+}
+
+func scanTokens(cmd string) ([][2]int, error) {
+	spans := make([][2]int, 0)
+	start := -1
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		if c < utf8.RuneSelf && unicode.IsSpace(rune(c)) {
+			if start >= 0 {
+				spans = append(spans, [2]int{start, i})
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		if c == '\'' || c == '"' {
+			end, err := skipQuoted(cmd, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(cmd)})
+	}
+	return spans, nil
+}
+
+func skipQuoted(cmd string, start int) (int, error) {
+	quote := cmd[start]
+	for i := start + 1; i < len(cmd); i++ {
+		switch cmd[i] {
+		case '\\':
+			i++
+		case quote:
+			return i, nil
+		}
+	}
+	return 0, errors.New("unterminated string")
+}
+
 func getEntity(entityPart string) (string, error) {
 	splitChar := ":"
 	if strings.Contains(entityPart, "[") {
@@ -120,44 +357,31 @@ func parseId(idString string) (uint, error) {
 	return uint(id), nil
 }
 
-func getData(parts []string) (*storage.Data, error) {
-	if len(parts) == 0 {
-		return nil, nil
-	}
-
-	if len(parts)%2 != 0 {
-		return nil, &ParseError{"invalid data, different number of attributes and values"}
+func checkDataAttributes(data *storage.Data) error {
+	if data == nil {
+		return nil
 	}
-
-	data := &storage.Data{}
-	for i := 0; i < len(parts); i += 2 {
-		(*data)[parts[i]] = parseDataTypes(parts[i+1])
+	for key := range *data {
+		if isReservedAttribute(key) {
+			return fmt.Errorf("invalid attribute %s, id is reserved for the record id", key)
+		}
 	}
-	return data, nil
+	return nil
 }
 
-func parseDataTypes(part string) interface{} {
-	if strings.HasPrefix(part, "'") {
-		return part
-	}
-
-	if strings.ToUpper(part) == "TRUE" {
-		return true
-	}
-
-	if strings.ToUpper(part) == "FALSE" {
-		return false
+func getData(parts []string) (*storage.Data, error) {
+	if len(parts) == 0 {
+		return nil, nil
 	}
 
-	integer, err := strconv.Atoi(part)
-	if err == nil {
-		return integer
+	tokens, err := tokenizeData(parts)
+	if err != nil {
+		return nil, &ParseError{err.Error()}
 	}
-
-	float, err := strconv.ParseFloat(part, 64)
-	if err == nil {
-		return float
+	parser := &dataParser{tokens: tokens}
+	data, err := parser.parseAttributes("")
+	if err != nil {
+		return nil, &ParseError{err.Error()}
 	}
-
-	return fmt.Sprintf("'%s'", part)
+	return &data, nil
 }
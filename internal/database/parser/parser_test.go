@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gabrielluciano/liondb/internal/database/storage"
 	"github.com/gabrielluciano/liondb/internal/testutil"
@@ -194,7 +196,7 @@ func TestGetDataInteger(t *testing.T) {
 
 	// Assert
 	testutil.AssertNil(t, err, "error")
-	testutil.AssertEquals(t, (*data)["key"], 10, "value")
+	testutil.AssertEquals(t, (*data)["key"], int64(10), "value")
 }
 
 func TestGetDataFloat(t *testing.T) {
@@ -218,7 +220,7 @@ func TestGetDataString(t *testing.T) {
 
 	// Assert
 	testutil.AssertNil(t, err, "error")
-	testutil.AssertEquals(t, (*data)["key"], "'John Silva'", "value")
+	testutil.AssertEquals(t, (*data)["key"], "John Silva", "value")
 }
 
 func TestGetDataStringDefault(t *testing.T) {
@@ -230,7 +232,117 @@ func TestGetDataStringDefault(t *testing.T) {
 
 	// Assert
 	testutil.AssertNil(t, err, "error")
-	testutil.AssertEquals(t, (*data)["key"], "'word'", "value")
+	testutil.AssertEquals(t, (*data)["key"], "word", "value")
+}
+
+func TestGetDataTypedValues(t *testing.T) {
+	// Arrange
+	parts := []string{
+		"nothing", "null",
+		"big", "9223372036854775807",
+		"unsigned", "18446744073709551615u",
+		"created", "t'2024-03-01T10:30:00Z'",
+		"timeout", "d'1m30s'",
+		"quoted", "'it\\'s\\na \\u00e9scape'",
+		"plate", "1ABC",
+		"date", "2024-01-01",
+		"version", "1.2.3",
+	}
+
+	// Act
+	data, err := getData(parts)
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertNil(t, (*data)["nothing"], "nothing")
+	testutil.AssertEquals(t, int64(9223372036854775807), (*data)["big"], "big")
+	testutil.AssertEquals(t, uint64(18446744073709551615), (*data)["unsigned"], "unsigned")
+	testutil.AssertEquals(t, time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC), (*data)["created"], "created")
+	testutil.AssertEquals(t, 90*time.Second, (*data)["timeout"], "timeout")
+	testutil.AssertEquals(t, "it's\na \u00e9scape", (*data)["quoted"], "quoted")
+	testutil.AssertEquals(t, "1ABC", (*data)["plate"], "plate")
+	testutil.AssertEquals(t, "2024-01-01", (*data)["date"], "date")
+	testutil.AssertEquals(t, "1.2.3", (*data)["version"], "version")
+}
+
+func TestGetDataInvalidValues(t *testing.T) {
+	invalidValues := []string{
+		"9223372036854775808",
+		"-1u",
+		"1.5u",
+		"t'yesterday'",
+		"d'forever'",
+		"'bad \\q escape'",
+		"'\\u12'",
+		"x'quoted'",
+	}
+
+	for _, value := range invalidValues {
+		// Act
+		_, err := getData([]string{"key", value})
+
+		// Assert
+		testutil.AssertNotNil(t, err, value)
+	}
+}
+
+func TestGetDataNested(t *testing.T) {
+	// Arrange
+	parts := []string{"address", "{city", "'SP'", "zip", "123}", "tags", "['a','b',", "[1", "2]]", "empty", "{}"}
+
+	// Act
+	data, err := getData(parts)
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	city, _ := data.GetPath("address.city")
+	zip, _ := data.GetPath("address.zip")
+	tags := (*data)["tags"].([]interface{})
+	nested := tags[2].([]interface{})
+	testutil.AssertEquals(t, "SP", city, "city")
+	testutil.AssertEquals(t, int64(123), zip, "zip")
+	testutil.AssertEquals(t, 3, len(tags), "len(tags)")
+	testutil.AssertEquals(t, "a", tags[0], "tags[0]")
+	testutil.AssertEquals(t, "b", tags[1], "tags[1]")
+	testutil.AssertEquals(t, int64(2), nested[1], "nested[1]")
+	testutil.AssertEquals(t, 0, len((*data)["empty"].(storage.Data)), "len(empty)")
+}
+
+func TestGetDataNestedInvalid(t *testing.T) {
+	invalidData := [][]string{
+		{"address", "{city", "'SP'"},
+		{"address", "{city}"},
+		{"tags", "['a'"},
+		{"tags", "]"},
+		{"{", "1"},
+	}
+
+	for _, parts := range invalidData {
+		// Act
+		_, err := getData(parts)
+
+		// Assert
+		testutil.AssertNotNil(t, err, "error")
+	}
+}
+
+func TestSplitCommandEscapedQuotes(t *testing.T) {
+	// Act
+	parts, err := splitCommand("NEW note:1 text 'don\\'t stop' at t'2024-01-01T00:00:00Z'")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, 6, len(parts), "len(parts)")
+	testutil.AssertEquals(t, "'don\\'t stop'", parts[3], "text")
+	testutil.AssertEquals(t, "t'2024-01-01T00:00:00Z'", parts[5], "at")
+}
+
+func TestSplitCommandUnterminatedString(t *testing.T) {
+	// Act
+	_, err := splitCommand("NEW note:1 text 'unterminated")
+
+	// Assert
+	testutil.AssertNotNil(t, err, "error")
 }
 
 func TestParseCommandSingleArgument(t *testing.T) {
@@ -240,7 +352,7 @@ func TestParseCommandSingleArgument(t *testing.T) {
 		"cliente",
 		Id{Lower: 1, Upper: 1},
 		storage.Data{
-			"name": "'Mary'",
+			"name": "Mary",
 		}, t)
 }
 
@@ -251,7 +363,7 @@ func TestParseCommandMultipleArguments(t *testing.T) {
 		"product",
 		Id{Lower: 1, Upper: 10},
 		storage.Data{
-			"category": "'condiment'",
+			"category": "condiment",
 			"price":    17.8,
 		}, t)
 }
@@ -274,6 +386,18 @@ func testParseCommand_ShouldParse(cmd string, expectedOperation string, expected
 	}
 }
 
+func TestParseCommandNestedData(t *testing.T) {
+	// Act
+	parsedCommand, err := ParseCommand("NEW user:1 address {city 'SP' zip 123} tags ['a','b']")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	city, _ := parsedCommand.Data.GetPath("address.city")
+	tag, _ := parsedCommand.Data.GetPath("tags.1")
+	testutil.AssertEquals(t, "SP", city, "city")
+	testutil.AssertEquals(t, "b", tag, "tag")
+}
+
 func TestParseCommandInvalidNumberOfParts(t *testing.T) {
 	command := "UPD product:1 category"
 
@@ -296,3 +420,467 @@ func testParseCommand_ShouldError(cmd string, t *testing.T) {
 	_, ok := err.(*ParseError)
 	testutil.AssertTrue(t, ok, "ParseError")
 }
+
+func TestParseCommandFormat(t *testing.T) {
+	// Act
+	parsedCommand, err := ParseCommand("format JSON")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, "FORMAT", parsedCommand.Operation, "operation")
+	testutil.AssertEquals(t, "json", parsedCommand.Args[0], "format")
+}
+
+func TestParseCommandInvalidFormat(t *testing.T) {
+	testParseCommand_ShouldError("FORMAT xml", t)
+	testParseCommand_ShouldError("FORMAT json text", t)
+}
+
+func TestParseCommandJSONData(t *testing.T) {
+	// Act
+	parsedCommand, err := ParseCommand(`UPD user:1 {"name": "John  Silva", "age": 45, "big": 18446744073709551615,
+		"weight": 75.5, "address": {"city": "SP"}, "tags": ["a", null]}`)
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	data := *parsedCommand.Data
+	city, _ := data.GetPath("address.city")
+	testutil.AssertEquals(t, "John  Silva", data["name"], "name")
+	testutil.AssertEquals(t, int64(45), data["age"], "age")
+	testutil.AssertEquals(t, uint64(18446744073709551615), data["big"], "big")
+	testutil.AssertEquals(t, 75.5, data["weight"], "weight")
+	testutil.AssertEquals(t, "SP", city, "city")
+	testutil.AssertNil(t, data["tags"].([]interface{})[1], "tags[1]")
+}
+
+func TestParseCommandInvalidJSONData(t *testing.T) {
+	testParseCommand_ShouldError(`NEW user:1 {"name": }`, t)
+	testParseCommand_ShouldError(`NEW user:1 {"name": "a"} extra`, t)
+	testParseCommand_ShouldError(`NEW user:1 {"big": 99999999999999999999}`, t)
+}
+
+func TestParseCommandGetFields(t *testing.T) {
+	// Act
+	parsedCommand, err := ParseCommand("GET user[1:10] fields name, email address.city")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, uint(1), parsedCommand.Id.Lower, "lower")
+	testutil.AssertEquals(t, uint(10), parsedCommand.Id.Upper, "upper")
+	testutil.AssertEquals(t, 3, len(parsedCommand.Fields), "len(fields)")
+	testutil.AssertEquals(t, "name", parsedCommand.Fields[0], "fields[0]")
+	testutil.AssertEquals(t, "email", parsedCommand.Fields[1], "fields[1]")
+	testutil.AssertEquals(t, "address.city", parsedCommand.Fields[2], "fields[2]")
+}
+
+func TestParseCommandGetInvalidQuery(t *testing.T) {
+	testParseCommand_ShouldError("GET user:1 FIELDS", t)
+	testParseCommand_ShouldError("GET user:1 FIELDS 'name'", t)
+	testParseCommand_ShouldError("GET user:1 name", t)
+}
+
+func TestParseCommandGetPagination(t *testing.T) {
+	// Act
+	parsedCommand, err := ParseCommand("GET user LIMIT 10 OFFSET 5 CURSOR abc FIELDS name")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, 10, parsedCommand.Limit, "limit")
+	testutil.AssertEquals(t, 5, parsedCommand.Offset, "offset")
+	testutil.AssertEquals(t, "abc", parsedCommand.Cursor, "cursor")
+	testutil.AssertEquals(t, "name", parsedCommand.Fields[0], "fields[0]")
+}
+
+func TestParseCommandGetInvalidPagination(t *testing.T) {
+	testParseCommand_ShouldError("GET user LIMIT", t)
+	testParseCommand_ShouldError("GET user LIMIT 0", t)
+	testParseCommand_ShouldError("GET user LIMIT ten", t)
+	testParseCommand_ShouldError("GET user OFFSET -1", t)
+	testParseCommand_ShouldError("GET user CURSOR", t)
+}
+
+func TestParseCommandGetOrderBy(t *testing.T) {
+	// Act
+	parsedCommand, err := ParseCommand("GET car ORDER BY brand, year desc, address.city ASC LIMIT 5")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, 3, len(parsedCommand.OrderBy), "len(orderBy)")
+	testutil.AssertEquals(t, OrderKey{Attribute: "brand"}, parsedCommand.OrderBy[0], "orderBy[0]")
+	testutil.AssertEquals(t, OrderKey{Attribute: "year", Descending: true}, parsedCommand.OrderBy[1], "orderBy[1]")
+	testutil.AssertEquals(t, OrderKey{Attribute: "address.city"}, parsedCommand.OrderBy[2], "orderBy[2]")
+	testutil.AssertEquals(t, 5, parsedCommand.Limit, "limit")
+}
+
+func TestParseCommandGetInvalidOrderBy(t *testing.T) {
+	testParseCommand_ShouldError("GET car ORDER brand", t)
+	testParseCommand_ShouldError("GET car ORDER BY", t)
+	testParseCommand_ShouldError("GET car ORDER BY DESC", t)
+	testParseCommand_ShouldError("GET car ORDER BY brand DESC DESC", t)
+}
+
+func TestParseCommandGetWhere(t *testing.T) {
+	// Act
+	parsedCommand, err := ParseCommand("GET car WHERE brand = 'bmw, x' AND year >= 2020 LIMIT 2")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, 2, len(parsedCommand.Where), "len(where)")
+	testutil.AssertEquals(t, Condition{Attribute: "brand", Operator: "=", Value: "bmw, x"}, parsedCommand.Where[0], "where[0]")
+	testutil.AssertEquals(t, Condition{Attribute: "year", Operator: ">=", Value: int64(2020)}, parsedCommand.Where[1], "where[1]")
+	testutil.AssertEquals(t, 2, parsedCommand.Limit, "limit")
+}
+
+func TestParseCommandAggregate(t *testing.T) {
+	// Act
+	parsedCommand, err := ParseCommand("SUM order total WHERE status = 'paid' GROUP BY customer")
+	countCommand, countErr := ParseCommand("count order")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertNil(t, countErr, "count error")
+	testutil.AssertEquals(t, "SUM", parsedCommand.Operation, "operation")
+	testutil.AssertEquals(t, "order", parsedCommand.Entity, "entity")
+	testutil.AssertEquals(t, "total", parsedCommand.Attribute, "attribute")
+	testutil.AssertEquals(t, "customer", parsedCommand.GroupBy, "group by")
+	testutil.AssertEquals(t, 1, len(parsedCommand.Where), "len(where)")
+	testutil.AssertEquals(t, "COUNT", countCommand.Operation, "count operation")
+	testutil.AssertEquals(t, "", countCommand.Attribute, "count attribute")
+}
+
+func TestParseCommandInvalidQueries(t *testing.T) {
+	testParseCommand_ShouldError("GET car WHERE brand", t)
+	testParseCommand_ShouldError("GET car WHERE brand ~ 'bmw'", t)
+	testParseCommand_ShouldError("GET car WHERE brand = 'bmw' AND", t)
+	testParseCommand_ShouldError("GET car GROUP BY brand", t)
+	testParseCommand_ShouldError("SUM order", t)
+	testParseCommand_ShouldError("SUM order WHERE total > 1", t)
+	testParseCommand_ShouldError("COUNT order LIMIT 1", t)
+	testParseCommand_ShouldError("COUNT order GROUP customer", t)
+}
+
+func TestParseCommandEntityCommands(t *testing.T) {
+	// Act
+	entities, entitiesErr := ParseCommand("entities")
+	drop, dropErr := ParseCommand("DROP car")
+	rename, renameErr := ParseCommand("RENAME car vehicle")
+
+	// Assert
+	testutil.AssertNil(t, entitiesErr, "entities error")
+	testutil.AssertNil(t, dropErr, "drop error")
+	testutil.AssertNil(t, renameErr, "rename error")
+	testutil.AssertEquals(t, "ENTITIES", entities.Operation, "entities operation")
+	testutil.AssertEquals(t, "car", drop.Entity, "drop entity")
+	testutil.AssertEquals(t, "car", rename.Entity, "rename entity")
+	testutil.AssertEquals(t, "vehicle", rename.Args[0], "rename target")
+}
+
+func TestParseCommandInvalidEntityCommands(t *testing.T) {
+	testParseCommand_ShouldError("ENTITIES car", t)
+	testParseCommand_ShouldError("DROP", t)
+	testParseCommand_ShouldError("DROP car:1", t)
+	testParseCommand_ShouldError("RENAME car", t)
+	testParseCommand_ShouldError("STATS car[1:2]", t)
+	testParseCommand_ShouldError("INFO car", t)
+}
+
+func TestParseCommandPingAndInfo(t *testing.T) {
+	// Act
+	ping, pingErr := ParseCommand("ping")
+	echo, echoErr := ParseCommand("PING  are you there?")
+	info, infoErr := ParseCommand("INFO")
+
+	// Assert
+	testutil.AssertNil(t, pingErr, "ping error")
+	testutil.AssertNil(t, echoErr, "echo error")
+	testutil.AssertNil(t, infoErr, "info error")
+	testutil.AssertEquals(t, "PING", ping.Operation, "ping operation")
+	testutil.AssertEquals(t, 0, len(ping.Args), "ping args")
+	testutil.AssertEquals(t, "are you there?", echo.Args[0], "echo message")
+	testutil.AssertEquals(t, "INFO", info.Operation, "info operation")
+}
+
+func TestParseCommandSchema(t *testing.T) {
+	// Act
+	define, defineErr := ParseCommand("SCHEMA car name:string year:int electric:bool? color:string='black'")
+	show, showErr := ParseCommand("SCHEMA car")
+	remove, removeErr := ParseCommand("SCHEMA car none")
+
+	// Assert
+	testutil.AssertNil(t, defineErr, "define error")
+	testutil.AssertNil(t, showErr, "show error")
+	testutil.AssertNil(t, removeErr, "remove error")
+	testutil.AssertEquals(t, 4, len(define.Schema), "fields")
+	testutil.AssertEquals(t, SchemaField{Name: "name", Type: "string"}, define.Schema[0], "name field")
+	testutil.AssertEquals(t, SchemaField{Name: "electric", Type: "bool", Optional: true}, define.Schema[2], "electric field")
+	testutil.AssertEquals(t, SchemaField{Name: "color", Type: "string", Default: "black", HasDefault: true}, define.Schema[3], "color field")
+	testutil.AssertEquals(t, 0, len(show.Schema), "show fields")
+	testutil.AssertEquals(t, "NONE", remove.Args[0], "remove args")
+}
+
+func TestParseCommandInvalidSchema(t *testing.T) {
+	testParseCommand_ShouldError("SCHEMA", t)
+	testParseCommand_ShouldError("SCHEMA car:1 name:string", t)
+	testParseCommand_ShouldError("SCHEMA car name", t)
+	testParseCommand_ShouldError("SCHEMA car name:text", t)
+	testParseCommand_ShouldError("SCHEMA car name:string name:int", t)
+	testParseCommand_ShouldError("SCHEMA car year:int=", t)
+}
+
+func TestParseCommandUnset(t *testing.T) {
+	// Act
+	parsedCommand, err := ParseCommand("UNSET car:1 color, specs.hp")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, "UNSET", parsedCommand.Operation, "operation")
+	testutil.AssertEquals(t, 2, len(parsedCommand.Fields), "len(fields)")
+	testutil.AssertEquals(t, "color", parsedCommand.Fields[0], "fields[0]")
+	testutil.AssertEquals(t, "specs.hp", parsedCommand.Fields[1], "fields[1]")
+	testParseCommand_ShouldError("UNSET car:1", t)
+	testParseCommand_ShouldError("UNSET car:1 'color'", t)
+}
+
+func TestParseCommandAtomic(t *testing.T) {
+	// Act
+	incr, incrErr := ParseCommand("INCR counter:1 views")
+	decr, decrErr := ParseCommand("DECR counter:1 stats.score 0.5")
+	appendCommand, appendErr := ParseCommand("APPEND post:1 tags ['a', 'b']")
+
+	// Assert
+	testutil.AssertNil(t, incrErr, "incr error")
+	testutil.AssertNil(t, decrErr, "decr error")
+	testutil.AssertNil(t, appendErr, "append error")
+	testutil.AssertEquals(t, "views", incr.Attribute, "incr attribute")
+	testutil.AssertEquals(t, int64(1), (*incr.Data)["views"], "incr amount")
+	testutil.AssertEquals(t, 0.5, (*decr.Data)["stats.score"], "decr amount")
+	testutil.AssertEquals(t, 2, len((*appendCommand.Data)["tags"].([]interface{})), "append value")
+}
+
+func TestParseCommandInvalidAtomic(t *testing.T) {
+	testParseCommand_ShouldError("INCR counter:1", t)
+	testParseCommand_ShouldError("INCR counter:1 views 'a'", t)
+	testParseCommand_ShouldError("INCR counter:1 views 1 likes 2", t)
+	testParseCommand_ShouldError("APPEND post:1 tags", t)
+}
+
+func TestParseCommandTransfer(t *testing.T) {
+	// Act
+	export, exportErr := ParseCommand("EXPORT car")
+	exportCSV, exportCSVErr := ParseCommand("export car csv")
+	importCommand, importErr := ParseCommand("IMPORT car CSV ON CONFLICT replace")
+	importDefaults, importDefaultsErr := ParseCommand("IMPORT car")
+
+	// Assert
+	testutil.AssertNil(t, exportErr, "export error")
+	testutil.AssertNil(t, exportCSVErr, "export csv error")
+	testutil.AssertNil(t, importErr, "import error")
+	testutil.AssertNil(t, importDefaultsErr, "import defaults error")
+	testutil.AssertEquals(t, "JSONL", export.Args[0], "export format")
+	testutil.AssertEquals(t, "CSV", exportCSV.Args[0], "export csv format")
+	testutil.AssertEquals(t, "CSV", importCommand.Args[0], "import format")
+	testutil.AssertEquals(t, "REPLACE", importCommand.Args[1], "import conflict")
+	testutil.AssertEquals(t, "JSONL", importDefaults.Args[0], "import defaults format")
+	testutil.AssertEquals(t, "FAIL", importDefaults.Args[1], "import defaults conflict")
+}
+
+func TestParseCommandInvalidTransfer(t *testing.T) {
+	testParseCommand_ShouldError("EXPORT", t)
+	testParseCommand_ShouldError("EXPORT car:1", t)
+	testParseCommand_ShouldError("EXPORT car XML", t)
+	testParseCommand_ShouldError("EXPORT car CSV ON CONFLICT SKIP", t)
+	testParseCommand_ShouldError("IMPORT car ON CONFLICT", t)
+	testParseCommand_ShouldError("IMPORT car CSV ON CONFLICT MERGE", t)
+}
+
+func TestParseCommandRaft(t *testing.T) {
+	// Act
+	status, statusErr := ParseCommand("RAFT")
+	add, addErr := ParseCommand("raft add n4 127.0.0.1:7204")
+	remove, removeErr := ParseCommand("RAFT REMOVE n2")
+
+	// Assert
+	testutil.AssertNil(t, statusErr, "status error")
+	testutil.AssertNil(t, addErr, "add error")
+	testutil.AssertNil(t, removeErr, "remove error")
+	testutil.AssertEquals(t, "RAFT", status.Operation, "operation")
+	testutil.AssertEquals(t, 0, len(status.Args), "status args")
+	testutil.AssertEquals(t, "ADD", add.Args[0], "add action")
+	testutil.AssertEquals(t, "n4", add.Args[1], "add id")
+	testutil.AssertEquals(t, "127.0.0.1:7204", add.Args[2], "add address")
+	testutil.AssertEquals(t, "REMOVE", remove.Args[0], "remove action")
+	testutil.AssertEquals(t, "n2", remove.Args[1], "remove id")
+}
+
+func TestParseCommandInvalidRaft(t *testing.T) {
+	testParseCommand_ShouldError("RAFT ADD n4", t)
+	testParseCommand_ShouldError("RAFT REMOVE", t)
+	testParseCommand_ShouldError("RAFT JOIN n4", t)
+	testParseCommand_ShouldError("RAFT ADD n4 'host'", t)
+}
+
+func TestParseCommandCluster(t *testing.T) {
+	// Act
+	status, statusErr := ParseCommand("CLUSTER")
+	add, addErr := ParseCommand("cluster add s3 127.0.0.1:7125")
+	nodes, nodesErr := ParseCommand("CLUSTER PREPARE s1=127.0.0.1:7123,s2=127.0.0.1:7124")
+	scan, scanErr := ParseCommand("CLUSTER SCAN car[10:20]")
+
+	// Assert
+	testutil.AssertNil(t, statusErr, "status error")
+	testutil.AssertNil(t, addErr, "add error")
+	testutil.AssertNil(t, nodesErr, "nodes error")
+	testutil.AssertNil(t, scanErr, "scan error")
+	testutil.AssertEquals(t, 0, len(status.Args), "status args")
+	testutil.AssertEquals(t, "ADD", add.Args[0], "add action")
+	testutil.AssertEquals(t, "127.0.0.1:7125", add.Args[2], "add address")
+	testutil.AssertEquals(t, "s1=127.0.0.1:7123,s2=127.0.0.1:7124", nodes.Args[1], "nodes")
+	testutil.AssertEquals(t, "car", scan.Entity, "scan entity")
+	testutil.AssertEquals(t, Id{Lower: 10, Upper: 20}, scan.Id, "scan ids")
+}
+
+func TestParseCommandInvalidCluster(t *testing.T) {
+	testParseCommand_ShouldError("CLUSTER ADD s3", t)
+	testParseCommand_ShouldError("CLUSTER REBALANCE now", t)
+	testParseCommand_ShouldError("CLUSTER MOVE s3", t)
+	testParseCommand_ShouldError("CLUSTER SCAN", t)
+	testParseCommand_ShouldError("CLUSTER COMMIT", t)
+}
+
+func TestParseCommandSubscribe(t *testing.T) {
+	// Act
+	entity, entityErr := ParseCommand("SUBSCRIBE car")
+	all, allErr := ParseCommand("subscribe * from 3f2a9c1b00d4e5f6-42")
+	unsubscribe, unsubscribeErr := ParseCommand("UNSUBSCRIBE")
+
+	// Assert
+	testutil.AssertNil(t, entityErr, "entity error")
+	testutil.AssertNil(t, allErr, "all error")
+	testutil.AssertNil(t, unsubscribeErr, "unsubscribe error")
+	testutil.AssertEquals(t, "SUBSCRIBE", entity.Operation, "operation")
+	testutil.AssertEquals(t, "car", entity.Entity, "entity")
+	testutil.AssertEquals(t, 0, len(entity.Args), "entity args")
+	testutil.AssertEquals(t, "*", all.Entity, "all entity")
+	testutil.AssertEquals(t, "3f2a9c1b00d4e5f6-42", all.Args[0], "position")
+	testutil.AssertEquals(t, "UNSUBSCRIBE", unsubscribe.Operation, "unsubscribe operation")
+}
+
+func TestParseCommandInvalidSubscribe(t *testing.T) {
+	testParseCommand_ShouldError("SUBSCRIBE", t)
+	testParseCommand_ShouldError("SUBSCRIBE car:1", t)
+	testParseCommand_ShouldError("SUBSCRIBE car AFTER 3", t)
+	testParseCommand_ShouldError("SUBSCRIBE car FROM", t)
+	testParseCommand_ShouldError("UNSUBSCRIBE car", t)
+}
+
+func TestParseCommandChannels(t *testing.T) {
+	// Act
+	subscribe, subscribeErr := ParseCommand("SUBSCRIBE CHANNEL news alerts")
+	pattern, patternErr := ParseCommand("subscribe pattern news.*")
+	unsubscribe, unsubscribeErr := ParseCommand("UNSUBSCRIBE CHANNEL")
+	publish, publishErr := ParseCommand("PUBLISH news 'hello world'")
+	structured, structuredErr := ParseCommand("PUBLISH news {level 2}")
+
+	// Assert
+	testutil.AssertNil(t, subscribeErr, "subscribe error")
+	testutil.AssertNil(t, patternErr, "pattern error")
+	testutil.AssertNil(t, unsubscribeErr, "unsubscribe error")
+	testutil.AssertNil(t, publishErr, "publish error")
+	testutil.AssertNil(t, structuredErr, "structured error")
+	testutil.AssertEquals(t, "", subscribe.Entity, "entity")
+	testutil.AssertEquals(t, "CHANNEL news alerts", strings.Join(subscribe.Args, " "), "subscribe args")
+	testutil.AssertEquals(t, "PATTERN news.*", strings.Join(pattern.Args, " "), "pattern args")
+	testutil.AssertEquals(t, "UNSUBSCRIBE", unsubscribe.Operation, "unsubscribe operation")
+	testutil.AssertEquals(t, "CHANNEL", strings.Join(unsubscribe.Args, " "), "unsubscribe args")
+	testutil.AssertEquals(t, "news", publish.Args[0], "channel")
+	testutil.AssertEquals(t, "hello world", (*publish.Data)["message"], "message")
+	testutil.AssertEquals(t, int64(2), (*structured.Data)["message"].(storage.Data)["level"], "structured message")
+}
+
+func TestParseCommandInvalidChannels(t *testing.T) {
+	testParseCommand_ShouldError("SUBSCRIBE PATTERN news[", t)
+	testParseCommand_ShouldError("SUBSCRIBE CHANNEL 'news'", t)
+	testParseCommand_ShouldError("PUBLISH news", t)
+	testParseCommand_ShouldError("PUBLISH news 'unterminated", t)
+	testParseCommand_ShouldError("UNSUBSCRIBE news", t)
+}
+
+func TestParseCommandTrigger(t *testing.T) {
+	// Act
+	list, listErr := ParseCommand("TRIGGER")
+	drop, dropErr := ParseCommand("trigger drop slug")
+	copied, copiedErr := ParseCommand("TRIGGER slug ON post before insert COPY title TO slug")
+	run, runErr := ParseCommand("TRIGGER audit ON post AFTER DELETE RUN 'NEW log:$id entity \\'$entity\\''")
+
+	// Assert
+	testutil.AssertNil(t, listErr, "list error")
+	testutil.AssertNil(t, dropErr, "drop error")
+	testutil.AssertNil(t, copiedErr, "copy error")
+	testutil.AssertNil(t, runErr, "run error")
+	testutil.AssertEquals(t, "TRIGGER", list.Operation, "operation")
+	testutil.AssertEquals(t, 0, len(list.Args), "list args")
+	testutil.AssertEquals(t, "DROP slug", strings.Join(drop.Args, " "), "drop args")
+	testutil.AssertEquals(t, "post", copied.Entity, "entity")
+	testutil.AssertEquals(t, "slug BEFORE INSERT COPY title slug", strings.Join(copied.Args, " "), "copy args")
+	testutil.AssertEquals(t, "audit AFTER DELETE RUN NEW log:$id entity '$entity'", strings.Join(run.Args, " "), "run args")
+	testutil.AssertEquals(t, "NEW log:7 entity 'post'", ExpandTriggerCommand(run.Args[4], "post", 7), "expanded command")
+}
+
+func TestParseCommandInvalidTrigger(t *testing.T) {
+	testParseCommand_ShouldError("TRIGGER DROP", t)
+	testParseCommand_ShouldError("TRIGGER slug ON post DURING INSERT COPY title TO slug", t)
+	testParseCommand_ShouldError("TRIGGER slug ON post BEFORE UPSERT COPY title TO slug", t)
+	testParseCommand_ShouldError("TRIGGER slug ON post AFTER INSERT COPY title TO slug", t)
+	testParseCommand_ShouldError("TRIGGER slug ON post BEFORE DELETE COPY title TO slug", t)
+	testParseCommand_ShouldError("TRIGGER slug ON post BEFORE INSERT COPY title slug", t)
+	testParseCommand_ShouldError("TRIGGER audit ON post AFTER INSERT RUN NEW", t)
+	testParseCommand_ShouldError("TRIGGER audit ON post AFTER INSERT RUN 'NEW'", t)
+}
+
+func TestParseCommandSlowlog(t *testing.T) {
+	// Act
+	all, allErr := ParseCommand("SLOWLOG")
+	limited, limitedErr := ParseCommand("slowlog get 5")
+	length, lengthErr := ParseCommand("SLOWLOG LEN")
+	reset, resetErr := ParseCommand("SLOWLOG reset")
+
+	// Assert
+	testutil.AssertNil(t, allErr, "all error")
+	testutil.AssertNil(t, limitedErr, "limited error")
+	testutil.AssertNil(t, lengthErr, "length error")
+	testutil.AssertNil(t, resetErr, "reset error")
+	testutil.AssertEquals(t, "SLOWLOG", all.Operation, "operation")
+	testutil.AssertEquals(t, "GET", all.Args[0], "all action")
+	testutil.AssertEquals(t, 0, all.Limit, "all limit")
+	testutil.AssertEquals(t, "GET", limited.Args[0], "limited action")
+	testutil.AssertEquals(t, 5, limited.Limit, "limit")
+	testutil.AssertEquals(t, "LEN", length.Args[0], "length action")
+	testutil.AssertEquals(t, "RESET", reset.Args[0], "reset action")
+}
+
+func TestParseCommandInvalidSlowlog(t *testing.T) {
+	testParseCommand_ShouldError("SLOWLOG GET -1", t)
+	testParseCommand_ShouldError("SLOWLOG GET many", t)
+	testParseCommand_ShouldError("SLOWLOG LEN 3", t)
+	testParseCommand_ShouldError("SLOWLOG CLEAR", t)
+}
+
+func TestParseCommandRejectsIdAttribute(t *testing.T) {
+	commands := []string{
+		"NEW user:1 id 5",
+		"SET user:1 id.nested 5",
+		`UPSERT user:1 {"id": 5}`,
+		"UNSET user:1 id",
+		"INCR user:1 id",
+		"SCHEMA user id:int",
+		"TRIGGER copyid ON user BEFORE INSERT COPY name TO id",
+	}
+
+	for _, command := range commands {
+		// Act
+		_, err := ParseCommand(command)
+
+		// Assert
+		testutil.AssertNotNil(t, err, command)
+	}
+}
@@ -0,0 +1,207 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var queryKeywords = map[string]bool{
+	"FIELDS": true,
+	"LIMIT":  true,
+	"OFFSET": true,
+	"CURSOR": true,
+	"ORDER":  true,
+	"WHERE":  true,
+	"GROUP":  true,
+}
+
+var getClauses = map[string]bool{
+	"FIELDS": true,
+	"LIMIT":  true,
+	"OFFSET": true,
+	"CURSOR": true,
+	"ORDER":  true,
+	"WHERE":  true,
+}
+
+var aggregateClauses = map[string]bool{
+	"WHERE": true,
+	"GROUP": true,
+}
+
+var conditionOperators = map[string]bool{
+	"=":  true,
+	"!=": true,
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+}
+
+func getQuery(parsedCommand *ParsedCommand, parts []string, clauses map[string]bool) error {
+	for i := 0; i < len(parts); {
+		keyword := strings.ToUpper(parts[i])
+		if !clauses[keyword] {
+			return fmt.Errorf("unexpected %s", parts[i])
+		}
+		switch keyword {
+		case "FIELDS":
+			fields, next := clauseArguments(parts, i+1)
+			if len(fields) == 0 {
+				return fmt.Errorf("%s expects at least one attribute", keyword)
+			}
+			for _, field := range fields {
+				if !isAttributeName(field) {
+					return fmt.Errorf("invalid attribute name %s", field)
+				}
+			}
+			parsedCommand.Fields = append(parsedCommand.Fields, fields...)
+			i = next
+		case "LIMIT", "OFFSET":
+			if i+1 >= len(parts) {
+				return fmt.Errorf("%s expects a number", keyword)
+			}
+			number, err := strconv.Atoi(parts[i+1])
+			if err != nil || number < 0 || keyword == "LIMIT" && number == 0 {
+				return fmt.Errorf("invalid %s %s", keyword, parts[i+1])
+			}
+			if keyword == "LIMIT" {
+				parsedCommand.Limit = number
+			} else {
+				parsedCommand.Offset = number
+			}
+			i += 2
+		case "ORDER":
+			if i+1 >= len(parts) || strings.ToUpper(parts[i+1]) != "BY" {
+				return fmt.Errorf("%s expects BY", keyword)
+			}
+			arguments, next := clauseArguments(parts, i+2)
+			orderBy, err := getOrderKeys(arguments)
+			if err != nil {
+				return err
+			}
+			parsedCommand.OrderBy = append(parsedCommand.OrderBy, orderBy...)
+			i = next
+		case "GROUP":
+			if i+2 >= len(parts) || strings.ToUpper(parts[i+1]) != "BY" || !isAttributeName(parts[i+2]) {
+				return fmt.Errorf("%s expects BY and an attribute", keyword)
+			}
+			parsedCommand.GroupBy = parts[i+2]
+			i += 3
+		case "WHERE":
+			conditions, next, err := getConditions(parts, i+1)
+			if err != nil {
+				return err
+			}
+			parsedCommand.Where = append(parsedCommand.Where, conditions...)
+			i = next
+		case "CURSOR":
+			if i+1 >= len(parts) {
+				return fmt.Errorf("%s expects a token", keyword)
+			}
+			parsedCommand.Cursor = parts[i+1]
+			i += 2
+		}
+	}
+	return nil
+}
+
+func parseAggregate(parsedCommand *ParsedCommand, parts []string) (*ParsedCommand, error) {
+	if len(parts) > 0 && !queryKeywords[strings.ToUpper(parts[0])] {
+		if !isAttributeName(parts[0]) {
+			return nil, &ParseError{"Error parsing query: invalid attribute name " + parts[0]}
+		}
+		parsedCommand.Attribute = parts[0]
+		parts = parts[1:]
+	}
+	if parsedCommand.Attribute == "" && parsedCommand.Operation != "COUNT" {
+		return nil, &ParseError{"Error parsing query: " + parsedCommand.Operation + " expects an attribute"}
+	}
+	if err := getQuery(parsedCommand, parts, aggregateClauses); err != nil {
+		return nil, &ParseError{"Error parsing query: " + err.Error()}
+	}
+	return parsedCommand, nil
+}
+
+func getConditions(parts []string, start int) ([]Condition, int, error) {
+	conditions := make([]Condition, 0)
+	i := start
+	for {
+		if i+2 >= len(parts) {
+			return nil, 0, fmt.Errorf("WHERE expects attribute, operator and value")
+		}
+		attribute, operator := parts[i], parts[i+1]
+		if !isAttributeName(attribute) {
+			return nil, 0, fmt.Errorf("invalid attribute name %s", attribute)
+		}
+		if !conditionOperators[operator] {
+			return nil, 0, fmt.Errorf("invalid operator %s", operator)
+		}
+		value, err := parseDataTypes(parts[i+2])
+		if err != nil {
+			return nil, 0, err
+		}
+		conditions = append(conditions, Condition{Attribute: attribute, Operator: operator, Value: value})
+		i += 3
+		if i >= len(parts) || strings.ToUpper(parts[i]) != "AND" {
+			return conditions, i, nil
+		}
+		i++
+	}
+}
+
+func clauseArguments(parts []string, start int) ([]string, int) {
+	arguments := make([]string, 0)
+	i := start
+	for ; i < len(parts) && !queryKeywords[strings.ToUpper(parts[i])]; i++ {
+		for _, argument := range strings.Split(parts[i], ",") {
+			if argument != "" {
+				arguments = append(arguments, argument)
+			}
+		}
+	}
+	return arguments, i
+}
+
+func isAttributeName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "'\"\\{}[],")
+}
+
+// isDataAttribute reports whether records can hold the attribute. Queries may
+// name id, but records cannot store it: every format writes the record id
+// under that name.
+func isDataAttribute(name string) bool {
+	return isAttributeName(name) && !isReservedAttribute(name)
+}
+
+func isReservedAttribute(path string) bool {
+	top, _, _ := strings.Cut(path, ".")
+	return top == "id"
+}
+
+func getOrderKeys(arguments []string) ([]OrderKey, error) {
+	if len(arguments) == 0 {
+		return nil, fmt.Errorf("ORDER BY expects at least one attribute")
+	}
+	orderKeys := make([]OrderKey, 0)
+	for i := 0; i < len(arguments); i++ {
+		direction := strings.ToUpper(arguments[i])
+		if direction == "ASC" || direction == "DESC" {
+			return nil, fmt.Errorf("unexpected %s", arguments[i])
+		}
+		if !isAttributeName(arguments[i]) {
+			return nil, fmt.Errorf("invalid attribute name %s", arguments[i])
+		}
+		orderKey := OrderKey{Attribute: arguments[i]}
+		if i+1 < len(arguments) {
+			direction = strings.ToUpper(arguments[i+1])
+			if direction == "ASC" || direction == "DESC" {
+				orderKey.Descending = direction == "DESC"
+				i++
+			}
+		}
+		orderKeys = append(orderKeys, orderKey)
+	}
+	return orderKeys, nil
+}
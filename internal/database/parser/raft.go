@@ -0,0 +1,27 @@
+package parser
+
+import (
+	"strings"
+)
+
+func parseRaft(parts []string) (*ParsedCommand, error) {
+	parsedCommand := &ParsedCommand{Operation: "RAFT"}
+	if len(parts) == 1 {
+		return parsedCommand, nil
+	}
+
+	action := strings.ToUpper(parts[1])
+	switch {
+	case action == "ADD" && len(parts) == 4:
+	case action == "REMOVE" && len(parts) == 3:
+	default:
+		return nil, &ParseError{"Error parsing command: expected RAFT, RAFT ADD <id> <address> or RAFT REMOVE <id>"}
+	}
+	for _, argument := range parts[2:] {
+		if argument == "" || strings.ContainsAny(argument, "'\"\\{},") {
+			return nil, &ParseError{"Error parsing command: invalid argument " + argument}
+		}
+	}
+	parsedCommand.Args = append([]string{action}, parts[2:]...)
+	return parsedCommand, nil
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+func ParseData(text string) (*storage.Data, error) {
+	parts, err := splitCommand(text)
+	if err != nil {
+		return nil, &ParseError{err.Error()}
+	}
+	return getData(parts)
+}
+
+func DeserializeRecord(line string) (*storage.Record, error) {
+	parts, err := splitCommand(line)
+	if err != nil {
+		return nil, &ParseError{"Error deserializing record: " + err.Error()}
+	}
+	if len(parts) < 2 || parts[0] != "id" {
+		return nil, &ParseError{"Error deserializing record: missing id"}
+	}
+	id, err := strconv.ParseUint(parts[1], 10, strconv.IntSize)
+	if err != nil || id == 0 {
+		return nil, &ParseError{"Error deserializing record: invalid id " + parts[1]}
+	}
+
+	data, err := getData(parts[2:])
+	if err == nil {
+		err = checkDataAttributes(data)
+	}
+	if err != nil {
+		return nil, &ParseError{"Error deserializing record: " + err.Error()}
+	}
+	if data == nil {
+		data = &storage.Data{}
+	}
+	return &storage.Record{Id: uint(id), Data: data}, nil
+}
+
+func ParseRecordLine(line string) (*storage.Record, error) {
+	line = strings.TrimSpace(line)
+	if isJSONObject(line) {
+		return DeserializeRecordJSON(line)
+	}
+	return DeserializeRecord(line)
+}
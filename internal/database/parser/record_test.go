@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestDeserializeRecord(t *testing.T) {
+	// Act
+	record, err := DeserializeRecord("id 7 address {city 'SP'} 'odd key' 'multi\\nline'")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, uint(7), record.Id, "id")
+	city, _ := record.Data.GetPath("address.city")
+	testutil.AssertEquals(t, "SP", city, "city")
+	testutil.AssertEquals(t, "multi\nline", (*record.Data)["odd key"], "odd key")
+}
+
+func TestDeserializeRecordWithoutData(t *testing.T) {
+	// Act
+	record, err := DeserializeRecord("id 1")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, 0, len(*record.Data), "len(data)")
+}
+
+func TestDeserializeRecordInvalid(t *testing.T) {
+	invalidLines := []string{
+		"",
+		"name 'John'",
+		"id 0",
+		"id -1 name 'John'",
+		"id 1 name",
+		"id 1 name 'John",
+		"id 1 id 3",
+	}
+
+	for _, line := range invalidLines {
+		// Act
+		_, err := DeserializeRecord(line)
+
+		// Assert
+		testutil.AssertNotNil(t, err, line)
+		_, ok := err.(*ParseError)
+		testutil.AssertTrue(t, ok, "ParseError")
+	}
+}
+
+func TestParseData(t *testing.T) {
+	// Act
+	data, err := ParseData("name 'John  Silva' tags ['a']")
+	empty, emptyErr := ParseData("   ")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertNil(t, emptyErr, "empty error")
+	testutil.AssertEquals(t, "John  Silva", (*data)["name"], "name")
+	testutil.AssertEquals(t, "a", (*data)["tags"].([]interface{})[0], "tag")
+	testutil.AssertTrue(t, empty == (*storage.Data)(nil), "empty")
+}
+
+func TestParseRecordLine(t *testing.T) {
+	// Act
+	textRecord, textErr := ParseRecordLine("id 1 name 'bmw'")
+	jsonRecord, jsonErr := ParseRecordLine(` {"id": 2, "name": "audi", "year": 2020}`)
+	_, missingIdErr := ParseRecordLine(`{"name": "audi"}`)
+	_, invalidIdErr := ParseRecordLine(`{"id": -1}`)
+
+	// Assert
+	testutil.AssertNil(t, textErr, "text error")
+	testutil.AssertNil(t, jsonErr, "json error")
+	testutil.AssertEquals(t, uint(1), textRecord.Id, "text id")
+	testutil.AssertEquals(t, "bmw", (*textRecord.Data)["name"], "text name")
+	testutil.AssertEquals(t, uint(2), jsonRecord.Id, "json id")
+	testutil.AssertEquals(t, 2, len(*jsonRecord.Data), "json attributes")
+	testutil.AssertEquals(t, int64(2020), (*jsonRecord.Data)["year"], "json year")
+	testutil.AssertNotNil(t, missingIdErr, "missing id error")
+	testutil.AssertNotNil(t, invalidIdErr, "invalid id error")
+}
+
+func TestDeserializeRecordExtendedJSON(t *testing.T) {
+	// Act
+	record, err := DeserializeRecordExtendedJSON(`{"id":1,"at":{"$timestamp":"2024-01-02T03:04:05Z"},"ttl":{"$duration":"1m0s"},"serial":{"$uint":"7"},"price":1.0,"specs":{"tags":[{"$uint":"1"}]},"plain":{"$uint":"1","other":true}}`)
+	_, invalidErr := DeserializeRecordExtendedJSON(`{"id":1,"at":{"$timestamp":"yesterday"}}`)
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertNotNil(t, invalidErr, "invalid error")
+	testutil.AssertEquals(t, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), (*record.Data)["at"], "at")
+	testutil.AssertEquals(t, time.Minute, (*record.Data)["ttl"], "ttl")
+	testutil.AssertEquals(t, uint64(7), (*record.Data)["serial"], "serial")
+	testutil.AssertEquals(t, 1.0, (*record.Data)["price"], "price")
+	tag, _ := record.Data.GetPath("specs.tags.0")
+	testutil.AssertEquals(t, uint64(1), tag, "tag")
+	plain, _ := record.Data.GetPath("plain.$uint")
+	testutil.AssertEquals(t, "1", plain, "plain")
+}
+
+func TestDeserializeRecordCSV(t *testing.T) {
+	// Arrange
+	columns, headerErr := ParseCSVHeader("id,name:string,year:int,serial:uint,price:float,electric:bool,at:timestamp,ttl:duration,specs:object,tags:list,note:any")
+
+	// Act
+	record, err := DeserializeRecordCSV(columns, `3,"bmw, m3",2020,7,10.5,true,2024-01-02T03:04:05Z,1m0s,{hp 300},"['a', 1]",'x'`)
+	sparse, sparseErr := DeserializeRecordCSV(columns, "4,,,,,,,,,,")
+	_, countErr := DeserializeRecordCSV(columns, "5,audi")
+	_, typeErr := DeserializeRecordCSV(columns, "6,audi,old,,,,,,,,")
+	_, objectErr := DeserializeRecordCSV(columns, "7,,,,,,,,[1],,")
+
+	// Assert
+	testutil.AssertNil(t, headerErr, "header error")
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertNil(t, sparseErr, "sparse error")
+	testutil.AssertNotNil(t, countErr, "count error")
+	testutil.AssertNotNil(t, typeErr, "type error")
+	testutil.AssertNotNil(t, objectErr, "object error")
+	testutil.AssertEquals(t, uint(3), record.Id, "id")
+	testutil.AssertEquals(t, "bmw, m3", (*record.Data)["name"], "name")
+	testutil.AssertEquals(t, int64(2020), (*record.Data)["year"], "year")
+	testutil.AssertEquals(t, uint64(7), (*record.Data)["serial"], "serial")
+	testutil.AssertEquals(t, 10.5, (*record.Data)["price"], "price")
+	testutil.AssertEquals(t, true, (*record.Data)["electric"], "electric")
+	testutil.AssertEquals(t, time.Minute, (*record.Data)["ttl"], "ttl")
+	hp, _ := record.Data.GetPath("specs.hp")
+	testutil.AssertEquals(t, int64(300), hp, "hp")
+	testutil.AssertEquals(t, 2, len((*record.Data)["tags"].([]interface{})), "tags")
+	testutil.AssertEquals(t, "x", (*record.Data)["note"], "note")
+	testutil.AssertEquals(t, 0, len(*sparse.Data), "sparse attributes")
+}
+
+func TestParseCSVHeaderInvalid(t *testing.T) {
+	// Act
+	_, missingIdErr := ParseCSVHeader("name:string")
+	_, missingTypeErr := ParseCSVHeader("id,name")
+	_, invalidTypeErr := ParseCSVHeader("id,name:text")
+	_, duplicatedErr := ParseCSVHeader("id,name:string,name:int")
+
+	// Assert
+	testutil.AssertNotNil(t, missingIdErr, "missing id error")
+	testutil.AssertNotNil(t, missingTypeErr, "missing type error")
+	testutil.AssertNotNil(t, invalidTypeErr, "invalid type error")
+	testutil.AssertNotNil(t, duplicatedErr, "duplicated error")
+}
+
+func TestParseValue(t *testing.T) {
+	// Act
+	list, listErr := ParseValue("['a', {b 1}]")
+	text, textErr := ParseValue("'a b'")
+	_, trailingErr := ParseValue("1 2")
+	_, emptyErr := ParseValue("")
+
+	// Assert
+	testutil.AssertNil(t, listErr, "list error")
+	testutil.AssertNil(t, textErr, "text error")
+	testutil.AssertNotNil(t, trailingErr, "trailing error")
+	testutil.AssertNotNil(t, emptyErr, "empty error")
+	testutil.AssertEquals(t, 2, len(list.([]interface{})), "list")
+	testutil.AssertEquals(t, "a b", text, "text")
+}
@@ -0,0 +1,74 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+var schemaTypes = map[string]bool{
+	"string":    true,
+	"int":       true,
+	"uint":      true,
+	"float":     true,
+	"bool":      true,
+	"timestamp": true,
+	"duration":  true,
+	"object":    true,
+	"list":      true,
+	"any":       true,
+}
+
+func parseSchema(parts []string) (*ParsedCommand, error) {
+	if len(parts) < 2 || !isEntityName(parts[1]) {
+		return nil, &ParseError{"Error parsing entity: SCHEMA expects an entity"}
+	}
+	parsedCommand := &ParsedCommand{Operation: "SCHEMA", Entity: parts[1]}
+	if len(parts) == 3 && strings.ToUpper(parts[2]) == "NONE" {
+		parsedCommand.Args = []string{"NONE"}
+		return parsedCommand, nil
+	}
+
+	names := make(map[string]bool)
+	for _, part := range parts[2:] {
+		field, err := getSchemaField(part)
+		if err != nil {
+			return nil, &ParseError{"Error parsing schema: " + err.Error()}
+		}
+		if names[field.Name] {
+			return nil, &ParseError{"Error parsing schema: duplicated attribute " + field.Name}
+		}
+		names[field.Name] = true
+		parsedCommand.Schema = append(parsedCommand.Schema, field)
+	}
+	return parsedCommand, nil
+}
+
+func getSchemaField(part string) (SchemaField, error) {
+	name, definition, found := strings.Cut(part, ":")
+	if !found || !isDataAttribute(name) || strings.Contains(name, ".") {
+		return SchemaField{}, fmt.Errorf("invalid attribute definition %s", part)
+	}
+
+	field := SchemaField{Name: name}
+	fieldType, defaultValue, hasDefault := strings.Cut(definition, "=")
+	if strings.HasSuffix(fieldType, "?") {
+		field.Optional = true
+		fieldType = strings.TrimSuffix(fieldType, "?")
+	}
+	field.Type = strings.ToLower(fieldType)
+	if !schemaTypes[field.Type] {
+		return SchemaField{}, fmt.Errorf("invalid type %s for attribute %s", fieldType, name)
+	}
+	if hasDefault && defaultValue == "" {
+		return SchemaField{}, fmt.Errorf("missing default for attribute %s", name)
+	}
+	if hasDefault {
+		value, err := parseDataTypes(defaultValue)
+		if err != nil {
+			return SchemaField{}, fmt.Errorf("invalid default for attribute %s: %v", name, err)
+		}
+		field.Default = value
+		field.HasDefault = true
+	}
+	return field, nil
+}
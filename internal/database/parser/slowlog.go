@@ -0,0 +1,29 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+func parseSlowlog(parts []string) (*ParsedCommand, error) {
+	parsedCommand := &ParsedCommand{Operation: "SLOWLOG", Args: []string{"GET"}}
+	if len(parts) == 1 {
+		return parsedCommand, nil
+	}
+
+	action := strings.ToUpper(parts[1])
+	switch {
+	case action == "GET" && len(parts) == 2:
+	case action == "GET" && len(parts) == 3:
+		count, err := strconv.Atoi(parts[2])
+		if err != nil || count < 0 {
+			return nil, &ParseError{"Error parsing command: invalid count " + parts[2]}
+		}
+		parsedCommand.Limit = count
+	case (action == "LEN" || action == "RESET") && len(parts) == 2:
+	default:
+		return nil, &ParseError{"Error parsing command: expected SLOWLOG, SLOWLOG GET [<count>], SLOWLOG LEN or SLOWLOG RESET"}
+	}
+	parsedCommand.Args = []string{action}
+	return parsedCommand, nil
+}
@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"path"
+	"strings"
+
+	"github.com/gabrielluciano/liondb/internal/database/storage"
+)
+
+func parseSubscribe(parts []string) (*ParsedCommand, error) {
+	if len(parts) > 2 && isChannelKind(parts[1]) {
+		return parseChannels("SUBSCRIBE", parts, 1)
+	}
+	if len(parts) != 2 && (len(parts) != 4 || strings.ToUpper(parts[2]) != "FROM") {
+		return nil, &ParseError{"Error parsing command: expected SUBSCRIBE <entity|*> [FROM <position>], SUBSCRIBE CHANNEL <name>... or SUBSCRIBE PATTERN <pattern>..."}
+	}
+	if parts[1] != "*" && !isEntityName(parts[1]) {
+		return nil, &ParseError{"Error parsing entity: invalid entity " + parts[1]}
+	}
+	parsedCommand := &ParsedCommand{Operation: "SUBSCRIBE", Entity: parts[1]}
+	if len(parts) == 4 {
+		if strings.ContainsAny(parts[3], "'\"\\{},") {
+			return nil, &ParseError{"Error parsing command: invalid position " + parts[3]}
+		}
+		parsedCommand.Args = []string{parts[3]}
+	}
+	return parsedCommand, nil
+}
+
+func parseUnsubscribe(parts []string) (*ParsedCommand, error) {
+	if len(parts) > 1 && isChannelKind(parts[1]) {
+		return parseChannels("UNSUBSCRIBE", parts, 0)
+	}
+	if len(parts) != 1 {
+		return nil, &ParseError{"Error parsing command: expected UNSUBSCRIBE, UNSUBSCRIBE CHANNEL [<name>...] or UNSUBSCRIBE PATTERN [<pattern>...]"}
+	}
+	return &ParsedCommand{Operation: "UNSUBSCRIBE"}, nil
+}
+
+func parsePublish(cmd string, parts []string) (*ParsedCommand, error) {
+	if len(parts) < 3 {
+		return nil, &ParseError{"Error parsing command: expected PUBLISH <channel> <message>"}
+	}
+	if !isChannelName(parts[1]) {
+		return nil, &ParseError{"Error parsing command: invalid channel " + parts[1]}
+	}
+	message, err := ParseValue(remainder(cmd, 2))
+	if err != nil {
+		return nil, &ParseError{"Error parsing message: " + err.Error()}
+	}
+	return &ParsedCommand{Operation: "PUBLISH", Args: []string{parts[1]}, Data: &storage.Data{"message": message}}, nil
+}
+
+func parseChannels(operation string, parts []string, minimum int) (*ParsedCommand, error) {
+	kind := strings.ToUpper(parts[1])
+	names := parts[2:]
+	if len(names) < minimum {
+		return nil, &ParseError{"Error parsing command: " + operation + " " + kind + " expects at least one name"}
+	}
+	for _, name := range names {
+		if !isChannelName(name) {
+			return nil, &ParseError{"Error parsing command: invalid channel " + name}
+		}
+		if _, err := path.Match(name, ""); kind == "PATTERN" && err != nil {
+			return nil, &ParseError{"Error parsing command: invalid pattern " + name}
+		}
+	}
+	return &ParsedCommand{Operation: operation, Args: append([]string{kind}, names...)}, nil
+}
+
+func isChannelKind(part string) bool {
+	kind := strings.ToUpper(part)
+	return kind == "CHANNEL" || kind == "PATTERN"
+}
+
+func isChannelName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, "'\"\\{},")
+}
@@ -0,0 +1,40 @@
+package parser
+
+import (
+	"strings"
+)
+
+var transferFormats = map[string]bool{"JSONL": true, "CSV": true}
+
+var conflictModes = map[string]bool{"FAIL": true, "SKIP": true, "REPLACE": true}
+
+func parseTransfer(operation string, parts []string) (*ParsedCommand, error) {
+	if len(parts) < 2 || !isEntityName(parts[1]) {
+		return nil, &ParseError{"Error parsing entity: " + operation + " expects an entity"}
+	}
+	parsedCommand := &ParsedCommand{Operation: operation, Entity: parts[1], Args: []string{"JSONL"}}
+	arguments := parts[2:]
+	if len(arguments) > 0 && transferFormats[strings.ToUpper(arguments[0])] {
+		parsedCommand.Args[0] = strings.ToUpper(arguments[0])
+		arguments = arguments[1:]
+	}
+	if operation == "EXPORT" {
+		if len(arguments) > 0 {
+			return nil, &ParseError{"Error parsing command: unexpected " + arguments[0]}
+		}
+		return parsedCommand, nil
+	}
+
+	conflict := "FAIL"
+	if len(arguments) > 0 {
+		if len(arguments) != 3 || strings.ToUpper(arguments[0]) != "ON" || strings.ToUpper(arguments[1]) != "CONFLICT" {
+			return nil, &ParseError{"Error parsing command: expected ON CONFLICT FAIL, SKIP or REPLACE"}
+		}
+		conflict = strings.ToUpper(arguments[2])
+		if !conflictModes[conflict] {
+			return nil, &ParseError{"Error parsing command: invalid conflict mode " + arguments[2]}
+		}
+	}
+	parsedCommand.Args = append(parsedCommand.Args, conflict)
+	return parsedCommand, nil
+}
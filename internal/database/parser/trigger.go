@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+var triggerEvents = map[string]bool{"INSERT": true, "UPDATE": true, "DELETE": true}
+
+func parseTrigger(parts []string) (*ParsedCommand, error) {
+	if len(parts) == 1 {
+		return &ParsedCommand{Operation: "TRIGGER"}, nil
+	}
+	if len(parts) == 3 && strings.ToUpper(parts[1]) == "DROP" {
+		if !isEntityName(parts[2]) {
+			return nil, &ParseError{"Error parsing trigger: invalid trigger name " + parts[2]}
+		}
+		return &ParsedCommand{Operation: "TRIGGER", Args: []string{"DROP", parts[2]}}, nil
+	}
+	if len(parts) < 7 || strings.ToUpper(parts[2]) != "ON" {
+		return nil, &ParseError{"Error parsing command: expected TRIGGER, TRIGGER DROP <name> or TRIGGER <name> ON <entity> BEFORE|AFTER INSERT|UPDATE|DELETE COPY <attribute> TO <attribute>|RUN <command>"}
+	}
+
+	name := parts[1]
+	if !isEntityName(name) || strings.ToUpper(name) == "DROP" {
+		return nil, &ParseError{"Error parsing trigger: invalid trigger name " + name}
+	}
+	if !isEntityName(parts[3]) {
+		return nil, &ParseError{"Error parsing entity: invalid entity " + parts[3]}
+	}
+	timing := strings.ToUpper(parts[4])
+	if timing != "BEFORE" && timing != "AFTER" {
+		return nil, &ParseError{"Error parsing trigger: expected BEFORE or AFTER, got " + parts[4]}
+	}
+	event := strings.ToUpper(parts[5])
+	if !triggerEvents[event] {
+		return nil, &ParseError{"Error parsing trigger: expected INSERT, UPDATE or DELETE, got " + parts[5]}
+	}
+
+	parsedCommand := &ParsedCommand{Operation: "TRIGGER", Entity: parts[3], Args: []string{name, timing, event}}
+	action := strings.ToUpper(parts[6])
+	switch action {
+	case "COPY":
+		if len(parts) != 10 || strings.ToUpper(parts[8]) != "TO" {
+			return nil, &ParseError{"Error parsing trigger: expected COPY <attribute> TO <attribute>"}
+		}
+		if timing != "BEFORE" || event == "DELETE" {
+			return nil, &ParseError{"Error parsing trigger: COPY is only supported BEFORE INSERT or UPDATE"}
+		}
+		if !isAttributeName(parts[7]) {
+			return nil, &ParseError{"Error parsing trigger: invalid attribute " + parts[7]}
+		}
+		if !isDataAttribute(parts[9]) {
+			return nil, &ParseError{"Error parsing trigger: invalid attribute " + parts[9]}
+		}
+		parsedCommand.Args = append(parsedCommand.Args, action, parts[7], parts[9])
+	case "RUN":
+		if len(parts) != 8 || !isQuoted(parts[7]) {
+			return nil, &ParseError{"Error parsing trigger: RUN expects a single quoted command"}
+		}
+		command, err := unquote(parts[7])
+		if err != nil {
+			return nil, &ParseError{"Error parsing trigger: " + err.Error()}
+		}
+		if _, err := ParseCommand(ExpandTriggerCommand(command, parts[3], 1)); err != nil {
+			return nil, &ParseError{"Error parsing trigger command: " + err.Error()}
+		}
+		parsedCommand.Args = append(parsedCommand.Args, action, command)
+	default:
+		return nil, &ParseError{"Error parsing trigger: expected COPY or RUN, got " + parts[6]}
+	}
+	return parsedCommand, nil
+}
+
+// ExpandTriggerCommand replaces the $entity and $id placeholders of a RUN
+// trigger command with the values of the record that fired it.
+func ExpandTriggerCommand(command string, entity string, id uint) string {
+	return strings.NewReplacer("$entity", entity, "$id", strconv.FormatUint(uint64(id), 10)).Replace(command)
+}
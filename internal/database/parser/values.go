@@ -0,0 +1,143 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// numberPattern matches integer, unsigned (42u) and float literals. Tokens
+// that merely start with a digit, like 1ABC or 2024-01-01, are strings.
+var numberPattern = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?u?$`)
+
+func parseDataTypes(part string) (interface{}, error) {
+	switch {
+	case isQuoted(part):
+		return unquote(part)
+	case strings.HasPrefix(part, "t") && isQuoted(part[1:]):
+		return parseTimestamp(part[1:])
+	case strings.HasPrefix(part, "d") && isQuoted(part[1:]):
+		return parseDuration(part[1:])
+	}
+
+	switch strings.ToUpper(part) {
+	case "NULL":
+		return nil, nil
+	case "TRUE":
+		return true, nil
+	case "FALSE":
+		return false, nil
+	}
+
+	if !isNumeric(part) {
+		if strings.ContainsAny(part, "'\"\\") {
+			return nil, fmt.Errorf("invalid value %s", part)
+		}
+		return part, nil
+	}
+
+	if strings.HasSuffix(part, "u") {
+		unsigned, err := strconv.ParseUint(strings.TrimSuffix(part, "u"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid unsigned integer %s", part)
+		}
+		return unsigned, nil
+	}
+
+	integer, err := strconv.ParseInt(part, 10, 64)
+	if err == nil {
+		return integer, nil
+	}
+	if !strings.ContainsAny(part, ".eE") {
+		return nil, fmt.Errorf("integer %s out of range", part)
+	}
+
+	float, err := strconv.ParseFloat(part, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid number %s", part)
+	}
+	return float, nil
+}
+
+func isNumeric(part string) bool {
+	return numberPattern.MatchString(part)
+}
+
+func isQuoted(part string) bool {
+	if len(part) < 2 {
+		return false
+	}
+	quote := part[0]
+	return (quote == '\'' || quote == '"') && part[len(part)-1] == quote
+}
+
+func parseTimestamp(part string) (time.Time, error) {
+	text, err := unquote(part)
+	if err != nil {
+		return time.Time{}, err
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, text)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %s", text)
+	}
+	return timestamp, nil
+}
+
+func parseDuration(part string) (time.Duration, error) {
+	text, err := unquote(part)
+	if err != nil {
+		return 0, err
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %s", text)
+	}
+	return duration, nil
+}
+
+func unquote(part string) (string, error) {
+	quote := part[0]
+	body := part[1 : len(part)-1]
+	builder := strings.Builder{}
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == quote {
+			return "", errors.New("unescaped quote inside string")
+		}
+		if c != '\\' {
+			builder.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(body) {
+			return "", errors.New("unterminated escape sequence")
+		}
+		switch body[i] {
+		case '\\', '\'', '"':
+			builder.WriteByte(body[i])
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 't':
+			builder.WriteByte('\t')
+		case 'u':
+			if i+5 > len(body) {
+				return "", errors.New("invalid unicode escape sequence")
+			}
+			code, err := strconv.ParseUint(body[i+1:i+5], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				return "", errors.New("invalid unicode escape sequence")
+			}
+			builder.WriteRune(rune(code))
+			i += 4
+		default:
+			return "", fmt.Errorf("invalid escape sequence \\%c", body[i])
+		}
+	}
+	return builder.String(), nil
+}
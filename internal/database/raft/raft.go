@@ -0,0 +1,820 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	Follower State = iota
+	Candidate
+	Leader
+)
+
+func (state State) String() string {
+	switch state {
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	default:
+		return "follower"
+	}
+}
+
+type EntryType int
+
+const (
+	EntryCommand EntryType = iota
+	EntryConfig
+	EntryNoop
+)
+
+type Entry struct {
+	Index uint64    `json:"index"`
+	Term  uint64    `json:"term"`
+	Type  EntryType `json:"type"`
+	Data  []byte    `json:"data,omitempty"`
+}
+
+type Snapshot struct {
+	Index   uint64            `json:"index"`
+	Term    uint64            `json:"term"`
+	Members map[string]string `json:"members"`
+	Data    []byte            `json:"data"`
+}
+
+type HardState struct {
+	Term uint64 `json:"term"`
+	Vote string `json:"vote"`
+}
+
+type MessageType int
+
+const (
+	MsgVote MessageType = iota
+	MsgVoteResponse
+	MsgAppend
+	MsgAppendResponse
+	MsgSnapshot
+)
+
+type Message struct {
+	Type     MessageType `json:"type"`
+	From     string      `json:"from"`
+	To       string      `json:"to"`
+	Term     uint64      `json:"term"`
+	LogIndex uint64      `json:"log_index,omitempty"`
+	LogTerm  uint64      `json:"log_term,omitempty"`
+	Entries  []Entry     `json:"entries,omitempty"`
+	Commit   uint64      `json:"commit,omitempty"`
+	Reject   bool        `json:"reject,omitempty"`
+	Index    uint64      `json:"index,omitempty"`
+	Snapshot *Snapshot   `json:"snapshot,omitempty"`
+}
+
+type StateMachine interface {
+	Apply(data []byte) []byte
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+}
+
+type Transport interface {
+	Send(address string, msg Message)
+}
+
+type Config struct {
+	Id                   string
+	Members              map[string]string
+	ElectionTicks        int
+	HeartbeatTicks       int
+	SnapshotThreshold    uint64
+	MaxEntriesPerMessage int
+}
+
+type Result struct {
+	Index    uint64
+	Response []byte
+	Err      error
+}
+
+type Status struct {
+	Id            string
+	State         State
+	Term          uint64
+	Leader        string
+	Commit        uint64
+	LeaderCommit  uint64
+	Applied       uint64
+	LastIndex     uint64
+	SnapshotIndex uint64
+	Members       map[string]string
+}
+
+type NotLeaderError struct {
+	Leader  string
+	Address string
+}
+
+func (err *NotLeaderError) Error() string {
+	if err.Leader == "" {
+		return "not the leader, no leader elected"
+	}
+	return fmt.Sprintf("not the leader, current leader is %s at %s", err.Leader, err.Address)
+}
+
+type MembershipError struct {
+	message string
+}
+
+func (err *MembershipError) Error() string {
+	return err.message
+}
+
+var (
+	ErrProposalDropped        = errors.New("proposal dropped by a leadership change")
+	ErrConfigChangeInProgress = errors.New("membership change already in progress")
+	ErrStopped                = errors.New("raft node stopped")
+)
+
+type proposal struct {
+	term uint64
+	done chan Result
+}
+
+type Node struct {
+	mu        sync.Mutex
+	id        string
+	config    Config
+	storage   Storage
+	machine   StateMachine
+	transport Transport
+	random    *rand.Rand
+	failed    error
+
+	state          State
+	term           uint64
+	vote           string
+	leader         string
+	snapshot       Snapshot
+	entries        []Entry
+	members        map[string]string
+	configIndex    uint64
+	appliedMembers map[string]string
+	commit         uint64
+	leaderCommit   uint64
+	applied        uint64
+
+	elapsed         int
+	timeout         int
+	votes           map[string]bool
+	next            map[string]uint64
+	match           map[string]uint64
+	snapshotPending map[string]int
+	proposals       map[uint64]*proposal
+}
+
+func NewNode(config Config, storage Storage, machine StateMachine, transport Transport) (*Node, error) {
+	if config.ElectionTicks <= 0 {
+		config.ElectionTicks = 10
+	}
+	if config.HeartbeatTicks <= 0 {
+		config.HeartbeatTicks = 1
+	}
+	if config.SnapshotThreshold == 0 {
+		config.SnapshotThreshold = 1000
+	}
+	if config.MaxEntriesPerMessage <= 0 {
+		config.MaxEntriesPerMessage = 256
+	}
+	seed := fnv.New64a()
+	seed.Write([]byte(config.Id))
+	n := &Node{
+		id:             config.Id,
+		config:         config,
+		storage:        storage,
+		machine:        machine,
+		transport:      transport,
+		random:         rand.New(rand.NewSource(int64(seed.Sum64()))),
+		appliedMembers: make(map[string]string),
+		proposals:      make(map[uint64]*proposal),
+	}
+
+	hardState, snapshot, entries, err := storage.Load()
+	if err != nil {
+		return nil, err
+	}
+	n.term, n.vote = hardState.Term, hardState.Vote
+	n.entries = entries
+	if snapshot != nil {
+		if err := machine.Restore(snapshot.Data); err != nil {
+			return nil, err
+		}
+		n.snapshot = *snapshot
+		n.commit, n.applied = snapshot.Index, snapshot.Index
+		n.appliedMembers = copyMembers(snapshot.Members)
+	} else if len(entries) == 0 && len(config.Members) > 0 {
+		data, _ := json.Marshal(config.Members)
+		bootstrap := Entry{Index: 1, Type: EntryConfig, Data: data}
+		if err := storage.AppendEntries([]Entry{bootstrap}); err != nil {
+			return nil, err
+		}
+		n.entries = []Entry{bootstrap}
+		n.commit = 1
+	}
+	n.refreshMembers()
+	n.resetElectionTimer()
+	n.applyCommitted()
+	return n, nil
+}
+
+func (n *Node) Run(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			n.Tick()
+		}
+	}
+}
+
+func (n *Node) Stop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failed == nil {
+		n.fail(ErrStopped)
+	}
+}
+
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return Status{
+		Id:            n.id,
+		State:         n.state,
+		Term:          n.term,
+		Leader:        n.leader,
+		Commit:        n.commit,
+		LeaderCommit:  n.knownLeaderCommit(),
+		Applied:       n.applied,
+		LastIndex:     n.lastIndex(),
+		SnapshotIndex: n.snapshot.Index,
+		Members:       copyMembers(n.members),
+	}
+}
+
+func (n *Node) Tick() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failed != nil {
+		return
+	}
+	n.elapsed++
+	if n.state == Leader {
+		for peer, ticks := range n.snapshotPending {
+			if ticks <= 1 {
+				delete(n.snapshotPending, peer)
+			} else {
+				n.snapshotPending[peer] = ticks - 1
+			}
+		}
+		if n.elapsed >= n.config.HeartbeatTicks {
+			n.elapsed = 0
+			n.broadcastAppend()
+		}
+		return
+	}
+	if n.elapsed >= n.timeout {
+		if _, member := n.members[n.id]; member {
+			n.campaign()
+		} else {
+			n.resetElectionTimer()
+		}
+	}
+}
+
+func (n *Node) Step(msg Message) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failed != nil {
+		return
+	}
+
+	if msg.Term > n.term {
+		if msg.Type == MsgVote && n.state == Follower && n.leader != "" && n.elapsed < n.config.ElectionTicks {
+			return
+		}
+		leader := ""
+		if msg.Type == MsgAppend || msg.Type == MsgSnapshot {
+			leader = msg.From
+		}
+		n.becomeFollower(msg.Term, leader)
+	}
+	if msg.Term < n.term {
+		switch msg.Type {
+		case MsgVote:
+			n.send(Message{Type: MsgVoteResponse, To: msg.From, Reject: true})
+		case MsgAppend, MsgSnapshot:
+			n.send(Message{Type: MsgAppendResponse, To: msg.From, Reject: true, Index: n.lastIndex()})
+		}
+		return
+	}
+
+	switch msg.Type {
+	case MsgVote:
+		n.handleVote(msg)
+	case MsgVoteResponse:
+		n.handleVoteResponse(msg)
+	case MsgAppend:
+		n.followLeader(msg.From)
+		n.leaderCommit = max(n.leaderCommit, msg.Commit)
+		n.handleAppend(msg)
+	case MsgAppendResponse:
+		n.handleAppendResponse(msg)
+	case MsgSnapshot:
+		n.followLeader(msg.From)
+		n.handleSnapshot(msg)
+	}
+}
+
+func (n *Node) Propose(data []byte) (<-chan Result, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.propose(Entry{Type: EntryCommand, Data: data})
+}
+
+func (n *Node) AddMember(id string, address string) (<-chan Result, error) {
+	return n.changeMembers(func(members map[string]string) error {
+		if _, found := members[id]; found {
+			return &MembershipError{fmt.Sprintf("member %s already exists", id)}
+		}
+		members[id] = address
+		return nil
+	})
+}
+
+func (n *Node) RemoveMember(id string) (<-chan Result, error) {
+	return n.changeMembers(func(members map[string]string) error {
+		if _, found := members[id]; !found {
+			return &MembershipError{fmt.Sprintf("member %s not found", id)}
+		}
+		if len(members) == 1 {
+			return &MembershipError{fmt.Sprintf("cannot remove the last member %s", id)}
+		}
+		delete(members, id)
+		return nil
+	})
+}
+
+func (n *Node) changeMembers(change func(members map[string]string) error) (<-chan Result, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failed != nil {
+		return nil, n.failed
+	}
+	if n.state != Leader {
+		return nil, n.notLeader()
+	}
+	if term, _ := n.termAt(n.commit); n.configIndex > n.commit || term != n.term {
+		return nil, ErrConfigChangeInProgress
+	}
+	members := copyMembers(n.members)
+	if err := change(members); err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(members)
+	return n.propose(Entry{Type: EntryConfig, Data: data})
+}
+
+func (n *Node) propose(entry Entry) (<-chan Result, error) {
+	if n.failed != nil {
+		return nil, n.failed
+	}
+	if n.state != Leader {
+		return nil, n.notLeader()
+	}
+	index := n.appendLocal(entry)
+	if n.failed != nil {
+		return nil, n.failed
+	}
+	p := &proposal{term: n.term, done: make(chan Result, 1)}
+	n.proposals[index] = p
+	n.maybeCommit()
+	n.broadcastAppend()
+	return p.done, nil
+}
+
+func (n *Node) notLeader() error {
+	return &NotLeaderError{Leader: n.leader, Address: n.members[n.leader]}
+}
+
+func (n *Node) campaign() {
+	n.state = Candidate
+	n.term++
+	n.vote = n.id
+	n.leader = ""
+	n.leaderCommit = 0
+	n.persistState()
+	n.resetElectionTimer()
+	n.votes = map[string]bool{n.id: true}
+	if n.hasQuorum(func(id string) bool { return n.votes[id] }) {
+		n.becomeLeader()
+		return
+	}
+	lastIndex := n.lastIndex()
+	lastTerm, _ := n.termAt(lastIndex)
+	for _, peer := range n.peers() {
+		n.send(Message{Type: MsgVote, To: peer, LogIndex: lastIndex, LogTerm: lastTerm})
+	}
+}
+
+func (n *Node) becomeFollower(term uint64, leader string) {
+	if term > n.term {
+		n.term = term
+		n.vote = ""
+		n.leaderCommit = 0
+		n.persistState()
+	}
+	if n.state != Follower {
+		n.state = Follower
+		n.resetElectionTimer()
+	}
+	n.leader = leader
+}
+
+func (n *Node) followLeader(leader string) {
+	if n.state != Follower {
+		n.becomeFollower(n.term, leader)
+	}
+	n.leader = leader
+	n.elapsed = 0
+}
+
+// knownLeaderCommit is the commit index of the leader as last heard from it in
+// the current term, 0 until then. A leader reports its own commit index once
+// an entry of its term is committed.
+func (n *Node) knownLeaderCommit() uint64 {
+	if n.state != Leader {
+		return n.leaderCommit
+	}
+	if term, _ := n.termAt(n.commit); term != n.term {
+		return 0
+	}
+	return n.commit
+}
+
+func (n *Node) becomeLeader() {
+	n.state = Leader
+	n.leader = n.id
+	n.elapsed = 0
+	n.next = make(map[string]uint64)
+	n.match = make(map[string]uint64)
+	n.snapshotPending = make(map[string]int)
+	for id := range n.members {
+		n.next[id] = n.lastIndex() + 1
+		n.match[id] = 0
+	}
+	n.appendLocal(Entry{Type: EntryNoop})
+	n.maybeCommit()
+	n.broadcastAppend()
+}
+
+func (n *Node) handleVote(msg Message) {
+	lastIndex := n.lastIndex()
+	lastTerm, _ := n.termAt(lastIndex)
+	upToDate := msg.LogTerm > lastTerm || (msg.LogTerm == lastTerm && msg.LogIndex >= lastIndex)
+	if (n.vote == "" || n.vote == msg.From) && upToDate {
+		n.vote = msg.From
+		n.persistState()
+		n.elapsed = 0
+		n.send(Message{Type: MsgVoteResponse, To: msg.From})
+		return
+	}
+	n.send(Message{Type: MsgVoteResponse, To: msg.From, Reject: true})
+}
+
+func (n *Node) handleVoteResponse(msg Message) {
+	if n.state != Candidate {
+		return
+	}
+	n.votes[msg.From] = !msg.Reject
+	if n.hasQuorum(func(id string) bool { return n.votes[id] }) {
+		n.becomeLeader()
+	}
+}
+
+func (n *Node) handleAppend(msg Message) {
+	prevIndex, prevTerm, entries := msg.LogIndex, msg.LogTerm, msg.Entries
+	matchIndex := msg.LogIndex + uint64(len(msg.Entries))
+	if prevIndex < n.snapshot.Index {
+		skip := n.snapshot.Index - prevIndex
+		if skip >= uint64(len(entries)) {
+			n.send(Message{Type: MsgAppendResponse, To: msg.From, Index: matchIndex})
+			return
+		}
+		prevIndex, prevTerm, entries = n.snapshot.Index, n.snapshot.Term, entries[skip:]
+	}
+
+	if term, ok := n.termAt(prevIndex); !ok || term != prevTerm {
+		hint := prevIndex - 1
+		if lastIndex := n.lastIndex(); prevIndex > lastIndex {
+			hint = lastIndex
+		}
+		n.send(Message{Type: MsgAppendResponse, To: msg.From, Reject: true, Index: hint})
+		return
+	}
+
+	for i, entry := range entries {
+		if term, ok := n.termAt(entry.Index); ok && term == entry.Term {
+			continue
+		}
+		n.entries = append(n.entries[:entry.Index-n.snapshot.Index-1], entries[i:]...)
+		if err := n.storage.AppendEntries(entries[i:]); err != nil {
+			n.fail(err)
+			return
+		}
+		n.refreshMembers()
+		break
+	}
+
+	if commit := max(n.commit, min(msg.Commit, matchIndex)); commit > n.commit {
+		n.commit = commit
+		n.applyCommitted()
+	}
+	n.send(Message{Type: MsgAppendResponse, To: msg.From, Index: matchIndex})
+}
+
+func (n *Node) handleAppendResponse(msg Message) {
+	if n.state != Leader {
+		return
+	}
+	next, found := n.next[msg.From]
+	if !found {
+		return
+	}
+	if msg.Reject {
+		next = max(min(next-1, msg.Index+1), n.match[msg.From]+1, 1)
+		n.next[msg.From] = next
+		n.sendAppend(msg.From)
+		return
+	}
+	delete(n.snapshotPending, msg.From)
+	if msg.Index > n.match[msg.From] {
+		n.match[msg.From] = msg.Index
+	}
+	if next <= msg.Index {
+		n.next[msg.From] = msg.Index + 1
+	}
+	n.maybeCommit()
+	if n.next[msg.From] <= n.lastIndex() {
+		n.sendAppend(msg.From)
+	}
+}
+
+func (n *Node) handleSnapshot(msg Message) {
+	snapshot := msg.Snapshot
+	if snapshot == nil {
+		return
+	}
+	if snapshot.Index <= n.commit {
+		n.send(Message{Type: MsgAppendResponse, To: msg.From, Index: n.commit})
+		return
+	}
+
+	var entries []Entry
+	if term, ok := n.termAt(snapshot.Index); ok && term == snapshot.Term && snapshot.Index > n.snapshot.Index {
+		entries = append(entries, n.entries[snapshot.Index-n.snapshot.Index:]...)
+	}
+	if err := n.storage.SaveSnapshot(*snapshot, entries); err != nil {
+		n.fail(err)
+		return
+	}
+	if err := n.machine.Restore(snapshot.Data); err != nil {
+		n.fail(err)
+		return
+	}
+	n.snapshot = *snapshot
+	n.entries = entries
+	n.commit, n.applied = snapshot.Index, snapshot.Index
+	n.appliedMembers = copyMembers(snapshot.Members)
+	n.refreshMembers()
+	for index, p := range n.proposals {
+		if index <= snapshot.Index {
+			delete(n.proposals, index)
+			p.done <- Result{Index: index, Err: ErrProposalDropped}
+		}
+	}
+	n.send(Message{Type: MsgAppendResponse, To: msg.From, Index: snapshot.Index})
+}
+
+func (n *Node) appendLocal(entry Entry) uint64 {
+	entry.Index = n.lastIndex() + 1
+	entry.Term = n.term
+	n.entries = append(n.entries, entry)
+	if err := n.storage.AppendEntries([]Entry{entry}); err != nil {
+		n.fail(err)
+		return entry.Index
+	}
+	if entry.Type == EntryConfig {
+		n.refreshMembers()
+	}
+	n.match[n.id] = entry.Index
+	n.next[n.id] = entry.Index + 1
+	return entry.Index
+}
+
+func (n *Node) maybeCommit() {
+	for index := n.lastIndex(); index > n.commit; index-- {
+		if term, _ := n.termAt(index); term != n.term {
+			return
+		}
+		if n.hasQuorum(func(id string) bool { return n.match[id] >= index }) {
+			n.commit = index
+			n.applyCommitted()
+			return
+		}
+	}
+}
+
+func (n *Node) applyCommitted() {
+	for n.applied < n.commit && n.failed == nil {
+		entry := n.entries[n.applied-n.snapshot.Index]
+		result := Result{Index: entry.Index}
+		switch entry.Type {
+		case EntryCommand:
+			result.Response = n.machine.Apply(entry.Data)
+		case EntryConfig:
+			members := make(map[string]string)
+			json.Unmarshal(entry.Data, &members)
+			n.appliedMembers = members
+		}
+		n.applied = entry.Index
+
+		if p, found := n.proposals[entry.Index]; found {
+			delete(n.proposals, entry.Index)
+			if p.term != entry.Term {
+				result = Result{Index: entry.Index, Err: ErrProposalDropped}
+			}
+			p.done <- result
+		}
+		if _, member := n.members[n.id]; entry.Type == EntryConfig && n.state == Leader && !member && entry.Index == n.configIndex {
+			n.becomeFollower(n.term, "")
+		}
+	}
+	n.maybeCompact()
+}
+
+func (n *Node) maybeCompact() {
+	if n.applied-n.snapshot.Index < n.config.SnapshotThreshold || n.failed != nil {
+		return
+	}
+	data, err := n.machine.Snapshot()
+	if err != nil {
+		return
+	}
+	term, _ := n.termAt(n.applied)
+	snapshot := Snapshot{Index: n.applied, Term: term, Members: copyMembers(n.appliedMembers), Data: data}
+	entries := append([]Entry(nil), n.entries[n.applied-n.snapshot.Index:]...)
+	if err := n.storage.SaveSnapshot(snapshot, entries); err != nil {
+		n.fail(err)
+		return
+	}
+	n.snapshot = snapshot
+	n.entries = entries
+}
+
+func (n *Node) broadcastAppend() {
+	for _, peer := range n.peers() {
+		n.sendAppend(peer)
+	}
+}
+
+func (n *Node) sendAppend(peer string) {
+	next := n.next[peer]
+	if next <= n.snapshot.Index {
+		if n.snapshotPending[peer] > 0 {
+			return
+		}
+		n.snapshotPending[peer] = n.config.ElectionTicks
+		snapshot := n.snapshot
+		n.send(Message{Type: MsgSnapshot, To: peer, Snapshot: &snapshot})
+		return
+	}
+	prevIndex := next - 1
+	prevTerm, _ := n.termAt(prevIndex)
+	start := next - n.snapshot.Index - 1
+	end := min(uint64(len(n.entries)), start+uint64(n.config.MaxEntriesPerMessage))
+	entries := append([]Entry(nil), n.entries[start:end]...)
+	n.send(Message{Type: MsgAppend, To: peer, LogIndex: prevIndex, LogTerm: prevTerm, Entries: entries, Commit: n.commit})
+}
+
+func (n *Node) send(msg Message) {
+	msg.From = n.id
+	msg.Term = n.term
+	n.transport.Send(n.members[msg.To], msg)
+}
+
+func (n *Node) refreshMembers() {
+	members := copyMembers(n.snapshot.Members)
+	n.configIndex = n.snapshot.Index
+	for _, entry := range n.entries {
+		if entry.Type == EntryConfig {
+			members = make(map[string]string)
+			json.Unmarshal(entry.Data, &members)
+			n.configIndex = entry.Index
+		}
+	}
+	n.members = members
+	if n.state != Leader {
+		return
+	}
+	for id := range members {
+		if _, found := n.next[id]; !found {
+			n.next[id] = n.lastIndex() + 1
+			n.match[id] = 0
+		}
+	}
+	for id := range n.next {
+		if _, found := members[id]; !found && id != n.id {
+			delete(n.next, id)
+			delete(n.match, id)
+			delete(n.snapshotPending, id)
+		}
+	}
+}
+
+func (n *Node) peers() []string {
+	peers := make([]string, 0, len(n.members))
+	for id := range n.members {
+		if id != n.id {
+			peers = append(peers, id)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+func (n *Node) hasQuorum(granted func(id string) bool) bool {
+	count := 0
+	for id := range n.members {
+		if granted(id) {
+			count++
+		}
+	}
+	return count > len(n.members)/2
+}
+
+func (n *Node) lastIndex() uint64 {
+	if len(n.entries) > 0 {
+		return n.entries[len(n.entries)-1].Index
+	}
+	return n.snapshot.Index
+}
+
+func (n *Node) termAt(index uint64) (uint64, bool) {
+	if index == n.snapshot.Index {
+		return n.snapshot.Term, true
+	}
+	if index < n.snapshot.Index || index > n.lastIndex() {
+		return 0, false
+	}
+	return n.entries[index-n.snapshot.Index-1].Term, true
+}
+
+func (n *Node) resetElectionTimer() {
+	n.elapsed = 0
+	n.timeout = n.config.ElectionTicks + n.random.Intn(n.config.ElectionTicks)
+}
+
+func (n *Node) persistState() {
+	if err := n.storage.SaveState(HardState{Term: n.term, Vote: n.vote}); err != nil {
+		n.fail(err)
+	}
+}
+
+func (n *Node) fail(err error) {
+	n.failed = err
+	for index, p := range n.proposals {
+		delete(n.proposals, index)
+		p.done <- Result{Index: index, Err: err}
+	}
+}
+
+func copyMembers(members map[string]string) map[string]string {
+	copied := make(map[string]string, len(members))
+	for id, address := range members {
+		copied[id] = address
+	}
+	return copied
+}
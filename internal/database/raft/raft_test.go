@@ -0,0 +1,452 @@
+package raft
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+type testMachine struct {
+	mu      sync.Mutex
+	applied []string
+}
+
+func (m *testMachine) Apply(data []byte) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.applied = append(m.applied, string(data))
+	return []byte("applied " + string(data))
+}
+
+func (m *testMachine) Snapshot() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return json.Marshal(m.applied)
+}
+
+func (m *testMachine) Restore(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.applied = nil
+	return json.Unmarshal(data, &m.applied)
+}
+
+func (m *testMachine) state() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return strings.Join(m.applied, ",")
+}
+
+type testCluster struct {
+	network  *Network
+	nodes    map[string]*Node
+	machines map[string]*testMachine
+	storages map[string]Storage
+	members  map[string]string
+	config   Config
+}
+
+func newTestCluster(t *testing.T, config Config, ids ...string) *testCluster {
+	cluster := &testCluster{
+		network:  NewNetwork(),
+		nodes:    make(map[string]*Node),
+		machines: make(map[string]*testMachine),
+		storages: make(map[string]Storage),
+		members:  make(map[string]string),
+		config:   config,
+	}
+	for _, id := range ids {
+		cluster.members[id] = id + ":7200"
+	}
+	for _, id := range ids {
+		cluster.start(t, id, cluster.members, NewMemoryStorage())
+	}
+	return cluster
+}
+
+func (cluster *testCluster) start(t *testing.T, id string, members map[string]string, storage Storage) *Node {
+	config := cluster.config
+	config.Id = id
+	config.Members = members
+	machine := &testMachine{}
+	node, err := NewNode(config, storage, machine, cluster.network)
+	if err != nil {
+		t.Fatalf("Error creating node %s: %v", id, err)
+	}
+	cluster.network.Add(node)
+	cluster.nodes[id] = node
+	cluster.machines[id] = machine
+	cluster.storages[id] = storage
+	return node
+}
+
+func (cluster *testCluster) leader(t *testing.T) *Node {
+	var leader *Node
+	var term uint64
+	for _, node := range cluster.nodes {
+		if status := node.Status(); status.State == Leader && status.Term >= term {
+			leader, term = node, status.Term
+		}
+	}
+	if leader == nil {
+		t.Fatalf("no leader elected")
+	}
+	return leader
+}
+
+func (cluster *testCluster) propose(t *testing.T, data string) <-chan Result {
+	result, err := cluster.leader(t).Propose([]byte(data))
+	if err != nil {
+		t.Fatalf("Error proposing %s: %v", data, err)
+	}
+	return result
+}
+
+func TestElectsSingleLeader(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{}, "n1", "n2", "n3")
+
+	// Act
+	cluster.network.Run(30)
+
+	// Assert
+	leader := cluster.leader(t)
+	leaders := 0
+	for _, node := range cluster.nodes {
+		status := node.Status()
+		if status.State == Leader {
+			leaders++
+		}
+		testutil.AssertEquals(t, leader.id, status.Leader, node.id+" leader")
+		testutil.AssertEquals(t, leader.Status().Term, status.Term, node.id+" term")
+	}
+	testutil.AssertEquals(t, 1, leaders, "leaders")
+}
+
+func TestElectionIsDeterministic(t *testing.T) {
+	// Arrange
+	first := newTestCluster(t, Config{}, "n1", "n2", "n3", "n4", "n5")
+	second := newTestCluster(t, Config{}, "n1", "n2", "n3", "n4", "n5")
+
+	// Act
+	first.network.Run(30)
+	second.network.Run(30)
+
+	// Assert
+	testutil.AssertEquals(t, first.leader(t).id, second.leader(t).id, "leader")
+	testutil.AssertEquals(t, first.leader(t).Status().Term, second.leader(t).Status().Term, "term")
+}
+
+func TestSingleNodeCommitsImmediately(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{}, "n1")
+	cluster.network.Run(30)
+
+	// Act
+	result := <-cluster.propose(t, "a")
+
+	// Assert
+	testutil.AssertNil(t, result.Err, "error")
+	testutil.AssertEquals(t, "applied a", string(result.Response), "response")
+	testutil.AssertEquals(t, "a", cluster.machines["n1"].state(), "machine")
+}
+
+func TestReplicatesCommittedProposals(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+
+	// Act
+	first := cluster.propose(t, "a")
+	second := cluster.propose(t, "b")
+	cluster.network.Run(2)
+
+	// Assert
+	testutil.AssertEquals(t, "applied a", string((<-first).Response), "first response")
+	testutil.AssertEquals(t, "applied b", string((<-second).Response), "second response")
+	for id, machine := range cluster.machines {
+		testutil.AssertEquals(t, "a,b", machine.state(), id+" machine")
+	}
+}
+
+func TestDelayedAppendDoesNotMoveCommitBack(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+	cluster.propose(t, "a")
+	cluster.propose(t, "b")
+	cluster.network.Run(5)
+	leader := cluster.leader(t)
+	var follower *Node
+	for _, node := range cluster.nodes {
+		if node != leader {
+			follower = node
+		}
+	}
+	commit := follower.Status().Commit
+	testutil.AssertTrue(t, commit > 1, "follower learned the commit")
+
+	// Act
+	follower.Step(Message{Type: MsgAppend, From: leader.id, To: follower.id, Term: leader.Status().Term, LogIndex: 1, LogTerm: 0, Commit: commit + 1})
+
+	// Assert
+	testutil.AssertEquals(t, commit, follower.Status().Commit, "follower commit")
+}
+
+func TestProposeOnFollowerReturnsLeader(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+	leader := cluster.leader(t)
+	var follower *Node
+	for _, node := range cluster.nodes {
+		if node != leader {
+			follower = node
+		}
+	}
+
+	// Act
+	_, err := follower.Propose([]byte("a"))
+
+	// Assert
+	var notLeader *NotLeaderError
+	testutil.AssertTrue(t, errors.As(err, &notLeader), "not leader error")
+	testutil.AssertEquals(t, leader.id, notLeader.Leader, "leader")
+	testutil.AssertEquals(t, leader.id+":7200", notLeader.Address, "address")
+}
+
+func TestDoesNotCommitWithoutMajority(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+	leader := cluster.leader(t)
+	for id := range cluster.nodes {
+		if id != leader.id {
+			cluster.network.Isolate(id)
+		}
+	}
+
+	// Act
+	result := cluster.propose(t, "a")
+	cluster.network.Run(5)
+	committedWhileIsolated := len(result) > 0
+	appliedWhileIsolated := cluster.machines[leader.id].state()
+	for id := range cluster.nodes {
+		cluster.network.Heal(id)
+	}
+	cluster.network.Run(5)
+
+	// Assert
+	testutil.AssertFalse(t, committedWhileIsolated, "committed while isolated")
+	testutil.AssertEquals(t, "", appliedWhileIsolated, "leader machine")
+	testutil.AssertEquals(t, leader.id, cluster.leader(t).id, "leader after heal")
+	testutil.AssertEquals(t, "applied a", string((<-result).Response), "response")
+}
+
+func TestReelectsAndDropsUncommittedProposals(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+	oldLeader := cluster.leader(t)
+	cluster.network.Isolate(oldLeader.id)
+	dropped := cluster.propose(t, "lost")
+
+	// Act
+	cluster.network.Run(50)
+	newLeader := cluster.leader(t)
+	committed := cluster.propose(t, "kept")
+	cluster.network.Run(2)
+	cluster.network.Heal(oldLeader.id)
+	cluster.network.Run(5)
+
+	// Assert
+	testutil.AssertTrue(t, newLeader.id != oldLeader.id, "new leader elected")
+	testutil.AssertEquals(t, Follower, oldLeader.Status().State, "old leader state")
+	testutil.AssertEquals(t, ErrProposalDropped, (<-dropped).Err, "dropped proposal")
+	testutil.AssertNil(t, (<-committed).Err, "committed proposal")
+	for id, machine := range cluster.machines {
+		testutil.AssertEquals(t, "kept", machine.state(), id+" machine")
+	}
+}
+
+func TestCompactsLogAndInstallsSnapshot(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{SnapshotThreshold: 5}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+	leader := cluster.leader(t)
+	var lagging string
+	for id := range cluster.nodes {
+		if id != leader.id {
+			lagging = id
+		}
+	}
+	cluster.network.Isolate(lagging)
+
+	// Act
+	expected := make([]string, 0)
+	for _, data := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+		cluster.propose(t, data)
+		expected = append(expected, data)
+		cluster.network.Run(1)
+	}
+	cluster.network.Heal(lagging)
+	cluster.network.Run(5)
+
+	// Assert
+	testutil.AssertTrue(t, leader.Status().SnapshotIndex > 0, "leader compacted")
+	testutil.AssertEquals(t, strings.Join(expected, ","), cluster.machines[lagging].state(), "lagging machine")
+	testutil.AssertEquals(t, leader.Status().Commit, cluster.nodes[lagging].Status().Applied, "lagging applied")
+	testutil.AssertTrue(t, cluster.nodes[lagging].Status().SnapshotIndex > 0, "lagging installed snapshot")
+}
+
+func TestAddsMember(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{SnapshotThreshold: 3}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+	for _, data := range []string{"a", "b", "c", "d"} {
+		cluster.propose(t, data)
+	}
+	cluster.network.Run(2)
+	cluster.start(t, "n4", nil, NewMemoryStorage())
+
+	// Act
+	result, err := cluster.leader(t).AddMember("n4", "n4:7200")
+	cluster.network.Run(5)
+	cluster.propose(t, "e")
+	cluster.network.Run(2)
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertNil(t, (<-result).Err, "result")
+	status := cluster.nodes["n4"].Status()
+	testutil.AssertEquals(t, 4, len(status.Members), "members")
+	testutil.AssertEquals(t, "n4:7200", status.Members["n4"], "n4 address")
+	testutil.AssertEquals(t, "a,b,c,d,e", cluster.machines["n4"].state(), "n4 machine")
+}
+
+func TestRemovesLeader(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+	oldLeader := cluster.leader(t)
+
+	// Act
+	result, err := oldLeader.RemoveMember(oldLeader.id)
+	cluster.network.Run(2)
+	removedState := oldLeader.Status().State
+	cluster.network.Run(50)
+	newLeader := cluster.leader(t)
+	committed := cluster.propose(t, "a")
+	cluster.network.Run(2)
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertNil(t, (<-result).Err, "result")
+	testutil.AssertEquals(t, Follower, removedState, "removed leader state")
+	testutil.AssertTrue(t, newLeader.id != oldLeader.id, "new leader elected")
+	testutil.AssertEquals(t, 2, len(newLeader.Status().Members), "members")
+	testutil.AssertNil(t, (<-committed).Err, "committed")
+	testutil.AssertEquals(t, "", cluster.machines[oldLeader.id].state(), "removed machine")
+}
+
+func TestRejectsConcurrentMembershipChanges(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+	leader := cluster.leader(t)
+
+	// Act
+	_, firstErr := leader.AddMember("n4", "n4:7200")
+	_, secondErr := leader.AddMember("n5", "n5:7200")
+	cluster.network.Run(2)
+	_, duplicateErr := leader.AddMember("n1", "n1:7200")
+
+	// Assert
+	testutil.AssertNil(t, firstErr, "first change")
+	testutil.AssertEquals(t, ErrConfigChangeInProgress, secondErr, "second change")
+	testutil.AssertEquals(t, "member n1 already exists", duplicateErr.Error(), "duplicate change")
+}
+
+func TestRestartsFromStorage(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{SnapshotThreshold: 3}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+	for _, data := range []string{"a", "b", "c", "d", "e"} {
+		cluster.propose(t, data)
+	}
+	cluster.network.Run(2)
+	var restarted string
+	for id := range cluster.nodes {
+		if id != cluster.leader(t).id {
+			restarted = id
+		}
+	}
+	cluster.nodes[restarted].Stop()
+	cluster.network.Remove(restarted)
+
+	// Act
+	node := cluster.start(t, restarted, cluster.members, cluster.storages[restarted])
+	restoredState := cluster.machines[restarted].state()
+	cluster.propose(t, "f")
+	cluster.network.Run(2)
+
+	// Assert
+	testutil.AssertTrue(t, node.Status().SnapshotIndex > 0, "restored snapshot")
+	testutil.AssertTrue(t, strings.HasPrefix("a,b,c,d,e", restoredState) && restoredState != "", "restored state")
+	testutil.AssertEquals(t, "a,b,c,d,e,f", cluster.machines[restarted].state(), "machine")
+}
+
+func TestRestartedFollowerTracksLeaderCommit(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+	leader := cluster.leader(t)
+	var lagging string
+	for id := range cluster.nodes {
+		if id != leader.id {
+			lagging = id
+		}
+	}
+	cluster.nodes[lagging].Stop()
+	cluster.network.Remove(lagging)
+	for _, data := range []string{"a", "b", "c"} {
+		cluster.propose(t, data)
+	}
+	cluster.network.Run(5)
+	node := cluster.start(t, lagging, cluster.members, cluster.storages[lagging])
+	restarted := node.Status()
+	leaderStatus := leader.Status()
+
+	// Act
+	node.Step(Message{Type: MsgAppend, From: leader.id, To: lagging, Term: leaderStatus.Term, LogIndex: leaderStatus.LastIndex, LogTerm: leaderStatus.Term, Commit: leaderStatus.Commit})
+	heartbeat := node.Status()
+	cluster.network.Run(5)
+
+	// Assert
+	testutil.AssertEquals(t, uint64(0), restarted.LeaderCommit, "leader commit after restart")
+	testutil.AssertEquals(t, leaderStatus.Commit, leaderStatus.LeaderCommit, "leader's own commit")
+	testutil.AssertEquals(t, leader.id, heartbeat.Leader, "leader")
+	testutil.AssertEquals(t, leaderStatus.Commit, heartbeat.LeaderCommit, "leader commit after heartbeat")
+	testutil.AssertTrue(t, heartbeat.Applied < heartbeat.LeaderCommit, "lagging behind the leader")
+	testutil.AssertEquals(t, leaderStatus.Commit, node.Status().Applied, "caught up")
+}
+
+func TestStoppedNodeRejectsProposals(t *testing.T) {
+	// Arrange
+	cluster := newTestCluster(t, Config{}, "n1", "n2", "n3")
+	cluster.network.Run(30)
+	leader := cluster.leader(t)
+	pending := cluster.propose(t, "a")
+
+	// Act
+	leader.Stop()
+	_, err := leader.Propose([]byte("b"))
+
+	// Assert
+	testutil.AssertEquals(t, ErrStopped, (<-pending).Err, "pending proposal")
+	testutil.AssertEquals(t, ErrStopped, err, "new proposal")
+}
@@ -0,0 +1,278 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type Storage interface {
+	Load() (HardState, *Snapshot, []Entry, error)
+	SaveState(state HardState) error
+	AppendEntries(entries []Entry) error
+	SaveSnapshot(snapshot Snapshot, entries []Entry) error
+}
+
+type MemoryStorage struct {
+	mu       sync.Mutex
+	state    HardState
+	snapshot *Snapshot
+	entries  []Entry
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+func (s *MemoryStorage) Load() (HardState, *Snapshot, []Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var snapshot *Snapshot
+	if s.snapshot != nil {
+		copied := *s.snapshot
+		snapshot = &copied
+	}
+	return s.state, snapshot, append([]Entry(nil), s.entries...), nil
+}
+
+func (s *MemoryStorage) SaveState(state HardState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	return nil
+}
+
+func (s *MemoryStorage) AppendEntries(entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = appendEntries(s.entries, entries)
+	return nil
+}
+
+func (s *MemoryStorage) SaveSnapshot(snapshot Snapshot, entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshot = &snapshot
+	s.entries = append([]Entry(nil), entries...)
+	return nil
+}
+
+func appendEntries(current []Entry, entries []Entry) []Entry {
+	if len(entries) == 0 {
+		return current
+	}
+	keep := len(current)
+	for keep > 0 && current[keep-1].Index >= entries[0].Index {
+		keep--
+	}
+	return append(current[:keep:keep], entries...)
+}
+
+type FileStorage struct {
+	mu       sync.Mutex
+	dir      string
+	log      *os.File
+	state    HardState
+	snapshot *Snapshot
+	entries  []Entry
+}
+
+func OpenFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &FileStorage{dir: dir}
+	if err := readJSONFile(filepath.Join(dir, "state.json"), &s.state); err != nil {
+		return nil, err
+	}
+	var snapshot Snapshot
+	if err := readJSONFile(filepath.Join(dir, "snapshot.json"), &snapshot); err != nil {
+		return nil, err
+	}
+	if snapshot.Index > 0 {
+		s.snapshot = &snapshot
+	}
+
+	clean, err := s.readLog()
+	if err != nil {
+		return nil, err
+	}
+	if !clean {
+		if err := s.rewriteLog(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if s.log, err = os.OpenFile(s.logPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStorage) Load() (HardState, *Snapshot, []Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var snapshot *Snapshot
+	if s.snapshot != nil {
+		copied := *s.snapshot
+		snapshot = &copied
+	}
+	return s.state, snapshot, append([]Entry(nil), s.entries...), nil
+}
+
+func (s *FileStorage) SaveState(state HardState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeJSONFile(filepath.Join(s.dir, "state.json"), state); err != nil {
+		return err
+	}
+	s.state = state
+	return nil
+}
+
+func (s *FileStorage) AppendEntries(entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+	truncated := len(s.entries) > 0 && entries[0].Index <= s.entries[len(s.entries)-1].Index
+	s.entries = appendEntries(s.entries, entries)
+	if truncated {
+		return s.rewriteLog()
+	}
+
+	writer := bufio.NewWriter(s.log)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return s.log.Sync()
+}
+
+func (s *FileStorage) SaveSnapshot(snapshot Snapshot, entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeJSONFile(filepath.Join(s.dir, "snapshot.json"), snapshot); err != nil {
+		return err
+	}
+	s.snapshot = &snapshot
+	s.entries = append([]Entry(nil), entries...)
+	return s.rewriteLog()
+}
+
+func (s *FileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log.Close()
+}
+
+func (s *FileStorage) logPath() string {
+	return filepath.Join(s.dir, "log.jsonl")
+}
+
+func (s *FileStorage) readLog() (bool, error) {
+	file, err := os.Open(s.logPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	clean := true
+	for decoder.More() {
+		var entry Entry
+		if err := decoder.Decode(&entry); err != nil {
+			clean = false
+			break
+		}
+		if s.snapshot != nil && entry.Index <= s.snapshot.Index {
+			clean = false
+			continue
+		}
+		s.entries = appendEntries(s.entries, []Entry{entry})
+	}
+	return clean, nil
+}
+
+func (s *FileStorage) rewriteLog() error {
+	if s.log != nil {
+		s.log.Close()
+	}
+	temporary := s.logPath() + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range s.entries {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temporary, s.logPath()); err != nil {
+		return err
+	}
+	s.log, err = os.OpenFile(s.logPath(), os.O_WRONLY|os.O_APPEND, 0o644)
+	return err
+}
+
+func readJSONFile(path string, value interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, value)
+}
+
+func writeJSONFile(path string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	temporary := path + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temporary, path)
+}
@@ -0,0 +1,95 @@
+package raft
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestStorageTruncatesConflictingEntries(t *testing.T) {
+	fileStorage, err := OpenFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening storage: %v", err)
+	}
+	defer fileStorage.Close()
+	storages := map[string]Storage{"memory": NewMemoryStorage(), "file": fileStorage}
+
+	for name, storage := range storages {
+		// Act
+		storage.AppendEntries([]Entry{{Index: 1, Term: 1}, {Index: 2, Term: 1}, {Index: 3, Term: 1}})
+		storage.AppendEntries([]Entry{{Index: 2, Term: 2, Data: []byte("a")}})
+		_, snapshot, entries, err := storage.Load()
+
+		// Assert
+		testutil.AssertNil(t, err, name+" error")
+		testutil.AssertNil(t, snapshot, name+" snapshot")
+		testutil.AssertEquals(t, 2, len(entries), name+" entries")
+		testutil.AssertEquals(t, uint64(2), entries[1].Term, name+" replaced term")
+		testutil.AssertEquals(t, "a", string(entries[1].Data), name+" replaced data")
+	}
+}
+
+func TestFileStorageReopens(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	storage, err := OpenFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Error opening storage: %v", err)
+	}
+	storage.SaveState(HardState{Term: 3, Vote: "n2"})
+	storage.AppendEntries([]Entry{{Index: 1, Term: 1}, {Index: 2, Term: 1}, {Index: 3, Term: 2}})
+	storage.SaveSnapshot(Snapshot{Index: 2, Term: 1, Members: map[string]string{"n1": "a:1"}, Data: []byte("data")}, []Entry{{Index: 3, Term: 2}})
+	storage.AppendEntries([]Entry{{Index: 4, Term: 3, Type: EntryCommand, Data: []byte("NEW car:1")}})
+	storage.Close()
+
+	// Act
+	reopened, err := OpenFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Error reopening storage: %v", err)
+	}
+	defer reopened.Close()
+	state, snapshot, entries, err := reopened.Load()
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertEquals(t, HardState{Term: 3, Vote: "n2"}, state, "state")
+	testutil.AssertEquals(t, uint64(2), snapshot.Index, "snapshot index")
+	testutil.AssertEquals(t, "a:1", snapshot.Members["n1"], "snapshot members")
+	testutil.AssertEquals(t, "data", string(snapshot.Data), "snapshot data")
+	testutil.AssertEquals(t, 2, len(entries), "entries")
+	testutil.AssertEquals(t, uint64(3), entries[0].Index, "first entry")
+	testutil.AssertEquals(t, "NEW car:1", string(entries[1].Data), "last entry data")
+}
+
+func TestFileStorageIgnoresTornWrite(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	storage, err := OpenFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Error opening storage: %v", err)
+	}
+	storage.AppendEntries([]Entry{{Index: 1, Term: 1}, {Index: 2, Term: 1}})
+	storage.Close()
+	file, _ := os.OpenFile(filepath.Join(dir, "log.jsonl"), os.O_WRONLY|os.O_APPEND, 0o644)
+	file.WriteString(`{"index":3,"te`)
+	file.Close()
+
+	// Act
+	reopened, err := OpenFileStorage(dir)
+	if err != nil {
+		t.Fatalf("Error reopening storage: %v", err)
+	}
+	defer reopened.Close()
+	reopened.AppendEntries([]Entry{{Index: 3, Term: 2}})
+	_, _, entries, _ := reopened.Load()
+	again, _ := OpenFileStorage(dir)
+	defer again.Close()
+	_, _, persisted, _ := again.Load()
+
+	// Assert
+	testutil.AssertEquals(t, 3, len(entries), "entries")
+	testutil.AssertEquals(t, 3, len(persisted), "persisted entries")
+	testutil.AssertEquals(t, uint64(2), persisted[2].Term, "appended term")
+}
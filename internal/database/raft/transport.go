@@ -0,0 +1,219 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	maxSettleRounds    = 10000
+	tcpQueueSize       = 1024
+	tcpDialTimeout     = time.Second
+	tcpReconnectDelay  = 100 * time.Millisecond
+	tcpReadBufferSize  = 64 * 1024
+	tcpWriteBufferSize = 64 * 1024
+)
+
+type Network struct {
+	mu       sync.Mutex
+	nodes    map[string]*Node
+	queue    []Message
+	isolated map[string]bool
+}
+
+func NewNetwork() *Network {
+	return &Network{nodes: make(map[string]*Node), isolated: make(map[string]bool)}
+}
+
+func (network *Network) Add(node *Node) {
+	network.mu.Lock()
+	defer network.mu.Unlock()
+	network.nodes[node.id] = node
+}
+
+func (network *Network) Remove(id string) {
+	network.mu.Lock()
+	defer network.mu.Unlock()
+	delete(network.nodes, id)
+}
+
+func (network *Network) Isolate(id string) {
+	network.mu.Lock()
+	defer network.mu.Unlock()
+	network.isolated[id] = true
+}
+
+func (network *Network) Heal(id string) {
+	network.mu.Lock()
+	defer network.mu.Unlock()
+	delete(network.isolated, id)
+}
+
+func (network *Network) Send(address string, msg Message) {
+	network.mu.Lock()
+	defer network.mu.Unlock()
+	if network.isolated[msg.From] || network.isolated[msg.To] {
+		return
+	}
+	network.queue = append(network.queue, msg)
+}
+
+func (network *Network) Deliver() int {
+	network.mu.Lock()
+	queue := network.queue
+	network.queue = nil
+	targets := make([]*Node, len(queue))
+	for i, msg := range queue {
+		if !network.isolated[msg.From] && !network.isolated[msg.To] {
+			targets[i] = network.nodes[msg.To]
+		}
+	}
+	network.mu.Unlock()
+
+	delivered := 0
+	for i, msg := range queue {
+		if targets[i] != nil {
+			targets[i].Step(msg)
+			delivered++
+		}
+	}
+	return delivered
+}
+
+func (network *Network) Settle() {
+	for round := 0; round < maxSettleRounds && network.Deliver() > 0; round++ {
+	}
+}
+
+func (network *Network) Tick() {
+	network.mu.Lock()
+	ids := make([]string, 0, len(network.nodes))
+	for id := range network.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	nodes := make([]*Node, len(ids))
+	for i, id := range ids {
+		nodes[i] = network.nodes[id]
+	}
+	network.mu.Unlock()
+
+	for _, node := range nodes {
+		node.Tick()
+	}
+}
+
+func (network *Network) Run(ticks int) {
+	for i := 0; i < ticks; i++ {
+		network.Tick()
+		network.Settle()
+	}
+}
+
+type TCPTransport struct {
+	mu        sync.Mutex
+	peers     map[string]chan Message
+	listeners []net.Listener
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func NewTCPTransport() *TCPTransport {
+	return &TCPTransport{peers: make(map[string]chan Message), done: make(chan struct{})}
+}
+
+func (transport *TCPTransport) Send(address string, msg Message) {
+	if address == "" {
+		return
+	}
+	transport.mu.Lock()
+	queue, found := transport.peers[address]
+	if !found {
+		queue = make(chan Message, tcpQueueSize)
+		transport.peers[address] = queue
+		go transport.sendLoop(address, queue)
+	}
+	transport.mu.Unlock()
+	select {
+	case queue <- msg:
+	default:
+	}
+}
+
+func (transport *TCPTransport) sendLoop(address string, queue chan Message) {
+	for {
+		conn, err := net.DialTimeout("tcp", address, tcpDialTimeout)
+		if err == nil {
+			transport.writeMessages(conn, queue)
+			conn.Close()
+		}
+		select {
+		case <-transport.done:
+			return
+		case <-time.After(tcpReconnectDelay):
+		}
+		for len(queue) > 0 {
+			<-queue
+		}
+	}
+}
+
+func (transport *TCPTransport) writeMessages(conn net.Conn, queue chan Message) {
+	writer := bufio.NewWriterSize(conn, tcpWriteBufferSize)
+	encoder := json.NewEncoder(writer)
+	for {
+		select {
+		case <-transport.done:
+			return
+		case msg := <-queue:
+			if err := encoder.Encode(msg); err != nil {
+				return
+			}
+			if len(queue) == 0 {
+				if err := writer.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (transport *TCPTransport) Serve(listener net.Listener, node *Node) {
+	transport.mu.Lock()
+	transport.listeners = append(transport.listeners, listener)
+	transport.mu.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go transport.readMessages(conn, node)
+	}
+}
+
+func (transport *TCPTransport) readMessages(conn net.Conn, node *Node) {
+	defer conn.Close()
+	decoder := json.NewDecoder(bufio.NewReaderSize(conn, tcpReadBufferSize))
+	for {
+		var msg Message
+		if err := decoder.Decode(&msg); err != nil {
+			return
+		}
+		node.Step(msg)
+	}
+}
+
+func (transport *TCPTransport) Close() {
+	transport.closeOnce.Do(func() {
+		close(transport.done)
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+		for _, listener := range transport.listeners {
+			listener.Close()
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package raft
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestTCPTransportReplicates(t *testing.T) {
+	// Arrange
+	listeners := make(map[string]net.Listener)
+	members := make(map[string]string)
+	for _, id := range []string{"n1", "n2", "n3"} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Error listening: %v", err)
+		}
+		listeners[id] = listener
+		members[id] = listener.Addr().String()
+	}
+	done := make(chan struct{})
+	defer close(done)
+	nodes := make(map[string]*Node)
+	machines := make(map[string]*testMachine)
+	for id, listener := range listeners {
+		transport := NewTCPTransport()
+		defer transport.Close()
+		machines[id] = &testMachine{}
+		node, err := NewNode(Config{Id: id, Members: members}, NewMemoryStorage(), machines[id], transport)
+		if err != nil {
+			t.Fatalf("Error creating node: %v", err)
+		}
+		nodes[id] = node
+		go transport.Serve(listener, node)
+		go node.Run(5*time.Millisecond, done)
+	}
+
+	// Act
+	var result Result
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, node := range nodes {
+			if proposal, err := node.Propose([]byte("a")); err == nil {
+				result = <-proposal
+			}
+		}
+		if result.Index > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for time.Now().Before(deadline) && (machines["n1"].state() != "a" || machines["n2"].state() != "a" || machines["n3"].state() != "a") {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Assert
+	testutil.AssertNil(t, result.Err, "error")
+	testutil.AssertEquals(t, "applied a", string(result.Response), "response")
+	for id, machine := range machines {
+		testutil.AssertEquals(t, "a", machine.state(), id+" machine")
+	}
+}
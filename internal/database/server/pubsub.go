@@ -0,0 +1,224 @@
+package server
+
+import (
+	"path"
+	"sync"
+)
+
+const defaultPubSubBuffer = 1024
+
+type Message struct {
+	Channel string
+	Pattern string
+	Payload interface{}
+}
+
+type MessageFormatter func(message Message) []byte
+
+// PubSub delivers published messages to subscribed sessions. Every subscriber
+// has a bounded buffer drained by its own goroutine; a subscriber whose buffer
+// is full when a message arrives is disconnected instead of slowing down the
+// publisher.
+type PubSub struct {
+	mu          sync.RWMutex
+	bufferSize  int
+	channels    map[string]map[*subscriber]bool
+	patterns    map[string]map[*subscriber]bool
+	subscribers map[*Session]*subscriber
+}
+
+type subscriber struct {
+	session  *Session
+	format   MessageFormatter
+	messages chan Message
+	channels map[string]bool
+	patterns map[string]bool
+	removed  chan struct{}
+}
+
+type delivery struct {
+	subscriber *subscriber
+	message    Message
+}
+
+func NewPubSub(bufferSize int) *PubSub {
+	if bufferSize <= 0 {
+		bufferSize = defaultPubSubBuffer
+	}
+	return &PubSub{
+		bufferSize:  bufferSize,
+		channels:    make(map[string]map[*subscriber]bool),
+		patterns:    make(map[string]map[*subscriber]bool),
+		subscribers: make(map[*Session]*subscriber),
+	}
+}
+
+func (ps *PubSub) Subscribe(session *Session, format MessageFormatter, channels ...string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	sub := ps.subscriberLocked(session, format)
+	for _, channel := range channels {
+		addSubscription(ps.channels, channel, sub)
+		sub.channels[channel] = true
+	}
+	return len(sub.channels) + len(sub.patterns)
+}
+
+func (ps *PubSub) SubscribePattern(session *Session, format MessageFormatter, patterns ...string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	sub := ps.subscriberLocked(session, format)
+	for _, pattern := range patterns {
+		addSubscription(ps.patterns, pattern, sub)
+		sub.patterns[pattern] = true
+	}
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// Unsubscribe removes the session from the given channels, or from all of its
+// channels when none are given, and returns its remaining subscription count.
+func (ps *PubSub) Unsubscribe(session *Session, channels ...string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.unsubscribeLocked(session, ps.channels, func(sub *subscriber) map[string]bool { return sub.channels }, channels)
+}
+
+func (ps *PubSub) UnsubscribePattern(session *Session, patterns ...string) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.unsubscribeLocked(session, ps.patterns, func(sub *subscriber) map[string]bool { return sub.patterns }, patterns)
+}
+
+// Publish queues the payload for every session subscribed to the channel,
+// directly or through a matching pattern, and returns how many deliveries
+// were queued.
+func (ps *PubSub) Publish(channel string, payload interface{}) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	deliveries := make([]delivery, 0)
+	for sub := range ps.channels[channel] {
+		deliveries = append(deliveries, delivery{sub, Message{Channel: channel, Payload: payload}})
+	}
+	for pattern, subs := range ps.patterns {
+		if matched, _ := path.Match(pattern, channel); matched {
+			for sub := range subs {
+				deliveries = append(deliveries, delivery{sub, Message{Channel: channel, Pattern: pattern, Payload: payload}})
+			}
+		}
+	}
+
+	delivered := 0
+	for _, d := range deliveries {
+		if _, active := ps.subscribers[d.subscriber.session]; !active {
+			continue
+		}
+		select {
+		case d.subscriber.messages <- d.message:
+			delivered++
+		default:
+			ps.removeLocked(d.subscriber)
+			d.subscriber.session.Disconnect()
+		}
+	}
+	return delivered
+}
+
+func (ps *PubSub) Subscribers() int {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return len(ps.subscribers)
+}
+
+func (ps *PubSub) subscriberLocked(session *Session, format MessageFormatter) *subscriber {
+	if sub, found := ps.subscribers[session]; found {
+		sub.format = format
+		return sub
+	}
+	sub := &subscriber{
+		session:  session,
+		format:   format,
+		messages: make(chan Message, ps.bufferSize),
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+		removed:  make(chan struct{}),
+	}
+	ps.subscribers[session] = sub
+	go ps.deliver(sub)
+	return sub
+}
+
+func (ps *PubSub) unsubscribeLocked(session *Session, index map[string]map[*subscriber]bool, names func(sub *subscriber) map[string]bool, targets []string) int {
+	sub, found := ps.subscribers[session]
+	if !found {
+		return 0
+	}
+	subscribed := names(sub)
+	if len(targets) == 0 {
+		for name := range subscribed {
+			targets = append(targets, name)
+		}
+	}
+	for _, name := range targets {
+		removeSubscription(index, name, sub)
+		delete(subscribed, name)
+	}
+	remaining := len(sub.channels) + len(sub.patterns)
+	if remaining == 0 {
+		ps.removeLocked(sub)
+	}
+	return remaining
+}
+
+func (ps *PubSub) deliver(sub *subscriber) {
+	for {
+		select {
+		case message := <-sub.messages:
+			ps.mu.RLock()
+			format := sub.format
+			ps.mu.RUnlock()
+			if sub.session.Push(format(message)) != nil {
+				ps.remove(sub)
+				return
+			}
+		case <-sub.session.Done():
+			ps.remove(sub)
+			return
+		case <-sub.removed:
+			return
+		}
+	}
+}
+
+func (ps *PubSub) remove(sub *subscriber) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.removeLocked(sub)
+}
+
+func (ps *PubSub) removeLocked(sub *subscriber) {
+	if ps.subscribers[sub.session] != sub {
+		return
+	}
+	delete(ps.subscribers, sub.session)
+	for channel := range sub.channels {
+		removeSubscription(ps.channels, channel, sub)
+	}
+	for pattern := range sub.patterns {
+		removeSubscription(ps.patterns, pattern, sub)
+	}
+	close(sub.removed)
+}
+
+func addSubscription(index map[string]map[*subscriber]bool, name string, sub *subscriber) {
+	if index[name] == nil {
+		index[name] = make(map[*subscriber]bool)
+	}
+	index[name][sub] = true
+}
+
+func removeSubscription(index map[string]map[*subscriber]bool, name string, sub *subscriber) {
+	delete(index[name], sub)
+	if len(index[name]) == 0 {
+		delete(index, name)
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func formatTestMessage(message Message) []byte {
+	return []byte(fmt.Sprintf("%s|%s|%v", message.Pattern, message.Channel, message.Payload))
+}
+
+func pipeSession(t *testing.T) (*Session, *bufio.Reader, net.Conn) {
+	server, client := net.Pipe()
+	t.Cleanup(func() { server.Close(); client.Close() })
+	session := NewSession("pipe")
+	session.attach(server)
+	return session, bufio.NewReader(client), client
+}
+
+func readPushed(t *testing.T, client net.Conn, reader *bufio.Reader) string {
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Error reading message: %v", err)
+	}
+	return line
+}
+
+func waitForSubscribers(t *testing.T, ps *PubSub, expected int) {
+	deadline := time.Now().Add(time.Second)
+	for ps.Subscribers() != expected && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	testutil.AssertEquals(t, expected, ps.Subscribers(), "subscribers")
+}
+
+func TestPubSubDeliversToChannelsAndPatterns(t *testing.T) {
+	// Arrange
+	ps := NewPubSub(0)
+	news, newsReader, newsConn := pipeSession(t)
+	all, allReader, allConn := pipeSession(t)
+	newsCount := ps.Subscribe(news, formatTestMessage, "news", "alerts")
+	allCount := ps.SubscribePattern(all, formatTestMessage, "news*")
+
+	// Act
+	first := ps.Publish("news", "hello")
+	second := ps.Publish("newsroom", 42)
+	third := ps.Publish("sports", "ignored")
+	remaining := ps.Unsubscribe(news, "news")
+	fourth := ps.Publish("news", "gone")
+
+	// Assert
+	testutil.AssertEquals(t, 2, newsCount, "news subscriptions")
+	testutil.AssertEquals(t, 1, allCount, "pattern subscriptions")
+	testutil.AssertEquals(t, 2, first, "first deliveries")
+	testutil.AssertEquals(t, 1, second, "second deliveries")
+	testutil.AssertEquals(t, 0, third, "third deliveries")
+	testutil.AssertEquals(t, 1, remaining, "remaining subscriptions")
+	testutil.AssertEquals(t, 1, fourth, "fourth deliveries")
+	testutil.AssertEquals(t, "|news|hello\n", readPushed(t, newsConn, newsReader), "news message")
+	testutil.AssertEquals(t, "news*|news|hello\n", readPushed(t, allConn, allReader), "pattern message")
+	testutil.AssertEquals(t, "news*|newsroom|42\n", readPushed(t, allConn, allReader), "pattern message")
+	testutil.AssertEquals(t, "news*|news|gone\n", readPushed(t, allConn, allReader), "pattern message")
+}
+
+func TestPubSubRemovesSubscriberWithoutSubscriptions(t *testing.T) {
+	// Arrange
+	ps := NewPubSub(0)
+	session, _, _ := pipeSession(t)
+	ps.Subscribe(session, formatTestMessage, "a", "b")
+	ps.SubscribePattern(session, formatTestMessage, "c*")
+
+	// Act
+	channels := ps.Unsubscribe(session)
+	patterns := ps.UnsubscribePattern(session)
+
+	// Assert
+	testutil.AssertEquals(t, 1, channels, "after channels")
+	testutil.AssertEquals(t, 0, patterns, "after patterns")
+	testutil.AssertEquals(t, 0, ps.Subscribers(), "subscribers")
+	testutil.AssertEquals(t, 0, ps.Publish("a", "x"), "deliveries")
+}
+
+func TestPubSubDisconnectsSlowConsumers(t *testing.T) {
+	// Arrange
+	ps := NewPubSub(1)
+	session, reader, client := pipeSession(t)
+	ps.Subscribe(session, formatTestMessage, "news")
+
+	// Act
+	delivered := 0
+	for i := 0; i < 5; i++ {
+		delivered += ps.Publish("news", i)
+	}
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := reader.ReadString('\n')
+	for err == nil {
+		_, err = reader.ReadString('\n')
+	}
+
+	// Assert
+	testutil.AssertTrue(t, delivered < 5, "some messages dropped")
+	testutil.AssertEquals(t, 0, ps.Subscribers(), "subscribers")
+	testutil.AssertTrue(t, !isTimeout(err), "connection closed")
+}
+
+func TestPubSubForgetsClosedSessions(t *testing.T) {
+	// Arrange
+	ps := NewPubSub(0)
+	session, _, _ := pipeSession(t)
+	ps.SubscribePattern(session, formatTestMessage, "*")
+
+	// Act
+	session.close()
+
+	// Assert
+	waitForSubscribers(t, ps, 0)
+}
+
+func isTimeout(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
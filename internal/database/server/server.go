@@ -1,20 +1,85 @@
 package server
 
 import (
-	"fmt"
+	"bufio"
+	"errors"
 	"io"
+	"log/slog"
 	"net"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
-type MessageHandler func(message string) []byte
+const (
+	readBufferSize = 64 * 1024
+	maxMessageSize = 16 * 1024 * 1024
+)
+
+var ErrMessageTooLong = errors.New("message exceeds the maximum size")
+
+type MessageHandler func(session *Session, message string) []byte
 
 type Server struct {
 	port           string
 	messageHandler MessageHandler
+	pubsub         *PubSub
+	logger         *slog.Logger
+	logCommands    bool
+	connections    atomic.Int64
+	bytesReceived  atomic.Uint64
+	bytesSent      atomic.Uint64
+}
+
+type countingConn struct {
+	net.Conn
+	server *Server
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.server.bytesReceived.Add(uint64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.server.bytesSent.Add(uint64(n))
+	return n, err
 }
 
 func New(port string) *Server {
-	return &Server{port: port}
+	return &Server{port: port, pubsub: NewPubSub(0), logger: slog.Default()}
+}
+
+func (s *Server) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// SetCommandLogging makes the server log every command it handles along with
+// how long it took.
+func (s *Server) SetCommandLogging(enabled bool) {
+	s.logCommands = enabled
+}
+
+func (s *Server) PubSub() *PubSub {
+	return s.pubsub
+}
+
+func (s *Server) SetPubSubBuffer(size int) {
+	s.pubsub = NewPubSub(size)
+}
+
+func (s *Server) Connections() int64 {
+	return s.connections.Load()
+}
+
+func (s *Server) BytesReceived() uint64 {
+	return s.bytesReceived.Load()
+}
+
+func (s *Server) BytesSent() uint64 {
+	return s.bytesSent.Load()
 }
 
 func (s *Server) SetMessageHandler(fn MessageHandler) {
@@ -29,25 +94,79 @@ func (s *Server) Listen() {
 	if err != nil {
 		panic(err)
 	}
-	fmt.Println("Server started on port 7123")
+	s.log().Info("server started", "port", s.port)
+	s.Serve(ln)
+}
 
+func (s *Server) Serve(ln net.Listener) {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			fmt.Printf("Error accepting connection: %v", err)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.log().Error("error accepting connection", "error", err)
+			continue
 		}
 		go s.handleConnection(conn)
 	}
 }
 
 func (s *Server) handleConnection(conn net.Conn) {
-	buffer := make([]byte, 512)
+	defer conn.Close()
+	s.connections.Add(1)
+	defer s.connections.Add(-1)
+	conn = &countingConn{Conn: conn, server: s}
+	session := NewSession(conn.RemoteAddr().String())
+	session.attach(conn)
+	defer session.close()
+	logger := s.log().With("conn", session.Id, "remote", session.RemoteAddr)
+	logger.Info("connection opened")
+	reader := bufio.NewReaderSize(conn, readBufferSize)
 	for {
-		n, err := conn.Read(buffer)
-		if err == io.EOF {
+		message, err := readMessage(reader)
+		if message != "" {
+			start := time.Now()
+			response := s.messageHandler(session, message)
+			if s.logCommands {
+				logger.Info("command", "command", message, "duration", time.Since(start), "response_bytes", len(response))
+			}
+			if response != nil {
+				if pushErr := session.Push(response); pushErr != nil {
+					logger.Warn("error writing response", "error", pushErr)
+				}
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				logger.Warn("error reading from connection", "error", err)
+			}
 			break
 		}
-		response := s.messageHandler(string(buffer[:n]))
-		conn.Write(append(response, '\n'))
+	}
+	logger.Info("connection closed")
+}
+
+func (s *Server) log() *slog.Logger {
+	if s.logger == nil {
+		return slog.Default()
+	}
+	return s.logger
+}
+
+// readMessage reads one newline terminated message, however many reads it
+// takes to arrive. A final message without a newline is returned along with
+// io.EOF, and messages longer than maxMessageSize end the connection.
+func readMessage(reader *bufio.Reader) (string, error) {
+	var message []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(message)+len(chunk) > maxMessageSize {
+			return "", ErrMessageTooLong
+		}
+		message = append(message, chunk...)
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return strings.TrimRight(string(message), "\r\n"), err
+		}
 	}
 }
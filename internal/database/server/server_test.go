@@ -2,16 +2,23 @@ package server
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/gabrielluciano/liondb/internal/testutil"
 )
 
 func TestServer(t *testing.T) {
 	expected := "Hello, John\n"
 
 	server := &Server{port: "7123"}
-	server.SetMessageHandler(func(user string) []byte {
+	server.SetMessageHandler(func(session *Session, user string) []byte {
 		return []byte("Hello, " + user)
 	})
 	go server.Listen()
@@ -22,7 +29,7 @@ func TestServer(t *testing.T) {
 	if err != nil {
 		t.Errorf("Error connecting to server: %v", err)
 	}
-	conn.Write([]byte("John"))
+	conn.Write([]byte("John\n"))
 
 	// Verify response
 	response, err := bufio.NewReader(conn).ReadString('\n')
@@ -33,3 +40,212 @@ func TestServer(t *testing.T) {
 		t.Errorf("Incorrect result, expected response to be: %v, got %v", expected, response)
 	}
 }
+
+func TestServerFramesMessagesByNewline(t *testing.T) {
+	// Arrange
+	server := &Server{port: "7124"}
+	server.SetMessageHandler(func(session *Session, message string) []byte {
+		return []byte("echo " + message)
+	})
+	go server.Listen()
+	time.Sleep(10 * time.Millisecond) // Wait for server initialization
+
+	conn, err := net.Dial("tcp", ":7124")
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	large := strings.Repeat("x", 3*readBufferSize)
+
+	// Act
+	conn.Write([]byte("first\r\nsecond "))
+	time.Sleep(10 * time.Millisecond)
+	conn.Write([]byte("part\n" + large[:readBufferSize]))
+	time.Sleep(10 * time.Millisecond)
+	conn.Write([]byte(large[readBufferSize:] + "\nlast"))
+	conn.(*net.TCPConn).CloseWrite()
+	first, _ := reader.ReadString('\n')
+	second, _ := reader.ReadString('\n')
+	third, _ := reader.ReadString('\n')
+	last, _ := reader.ReadString('\n')
+
+	// Assert
+	testutil.AssertEquals(t, "echo first\n", first, "first")
+	testutil.AssertEquals(t, "echo second part\n", second, "second")
+	testutil.AssertEquals(t, "echo "+large+"\n", third, "large")
+	testutil.AssertEquals(t, "echo last\n", last, "last")
+}
+
+func TestReadMessageTooLong(t *testing.T) {
+	// Arrange
+	reader := bufio.NewReaderSize(strings.NewReader(strings.Repeat("x", maxMessageSize+1)+"\n"), readBufferSize)
+
+	// Act
+	_, err := readMessage(reader)
+
+	// Assert
+	testutil.AssertEquals(t, ErrMessageTooLong, err, "error")
+}
+
+func TestServerPush(t *testing.T) {
+	// Arrange
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer listener.Close()
+	closed := make(chan struct{})
+	server := New("")
+	server.SetMessageHandler(func(session *Session, message string) []byte {
+		go func() {
+			session.Push([]byte("first " + message))
+			session.Push([]byte("second " + message))
+			<-session.Done()
+			close(closed)
+		}()
+		return nil
+	})
+	go server.Serve(listener)
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+
+	// Act
+	conn.Write([]byte("event\n"))
+	first, _ := reader.ReadString('\n')
+	second, _ := reader.ReadString('\n')
+	conn.Close()
+
+	// Assert
+	testutil.AssertEquals(t, "first event\n", first, "first")
+	testutil.AssertEquals(t, "second event\n", second, "second")
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("session was not closed after the connection ended")
+	}
+	testutil.AssertEquals(t, ErrNotConnected, NewSession("test").Push([]byte("x")), "detached push")
+}
+
+func TestServerCountsConnectionsAndTraffic(t *testing.T) {
+	// Arrange
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer listener.Close()
+	server := New("")
+	server.SetMessageHandler(func(session *Session, message string) []byte {
+		return []byte("ok")
+	})
+	go server.Serve(listener)
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+	reader := bufio.NewReader(conn)
+
+	// Act
+	conn.Write([]byte("PING\n"))
+	reader.ReadString('\n')
+	connected := server.Connections()
+	conn.Close()
+	deadline := time.Now().Add(time.Second)
+	for server.Connections() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Assert
+	testutil.AssertEquals(t, int64(1), connected, "connected")
+	testutil.AssertEquals(t, int64(0), server.Connections(), "disconnected")
+	testutil.AssertEquals(t, uint64(5), server.BytesReceived(), "bytes received")
+	testutil.AssertEquals(t, uint64(3), server.BytesSent(), "bytes sent")
+}
+
+type syncBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.String()
+}
+
+func TestServerLogsConnectionsAndCommands(t *testing.T) {
+	// Arrange
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %v", err)
+	}
+	defer listener.Close()
+	output := &syncBuffer{}
+	logger, _ := NewLogger(output, "json", "info")
+	server := New("")
+	server.SetLogger(logger)
+	server.SetCommandLogging(true)
+	server.SetMessageHandler(func(session *Session, message string) []byte {
+		return []byte("ok")
+	})
+	go server.Serve(listener)
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Error connecting to server: %v", err)
+	}
+
+	// Act
+	conn.Write([]byte("GET car:1\n"))
+	bufio.NewReader(conn).ReadString('\n')
+	conn.Close()
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(output.String(), "connection closed") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+
+	// Assert
+	testutil.AssertEquals(t, 3, len(lines), "log lines")
+	entries := make([]map[string]interface{}, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal([]byte(line), &entries[i]); err != nil {
+			t.Fatalf("Error decoding log line %q: %v", line, err)
+		}
+		testutil.AssertEquals(t, conn.LocalAddr().String(), entries[i]["remote"], "remote")
+		testutil.AssertNotNil(t, entries[i]["conn"], "conn")
+	}
+	testutil.AssertEquals(t, "connection opened", entries[0]["msg"], "opened")
+	testutil.AssertEquals(t, "command", entries[1]["msg"], "command")
+	testutil.AssertEquals(t, "GET car:1", entries[1]["command"], "command text")
+	testutil.AssertEquals(t, "INFO", entries[1]["level"], "level")
+	testutil.AssertEquals(t, "connection closed", entries[2]["msg"], "closed")
+}
+
+func TestNewLogger(t *testing.T) {
+	// Arrange
+	output := &bytes.Buffer{}
+
+	// Act
+	logger, err := NewLogger(output, "text", "warn")
+	logger.Info("hidden")
+	logger.Warn("shown", "attempt", 2)
+	_, levelErr := NewLogger(output, "text", "verbose")
+	_, formatErr := NewLogger(output, "xml", "info")
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertFalse(t, strings.Contains(output.String(), "hidden"), "info filtered")
+	testutil.AssertContains(t, output.String(), "level=WARN msg=shown attempt=2")
+	testutil.AssertEquals(t, `invalid log level "verbose"`, fmt.Sprint(levelErr), "level error")
+	testutil.AssertEquals(t, `invalid log format "xml"`, fmt.Sprint(formatErr), "format error")
+}
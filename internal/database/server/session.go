@@ -0,0 +1,96 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+var lastSessionId atomic.Uint64
+
+var ErrNotConnected = errors.New("session is not attached to a connection")
+
+type Session struct {
+	Id         uint64
+	RemoteAddr string
+	mu         sync.Mutex
+	values     map[string]interface{}
+	writeMu    sync.Mutex
+	writer     io.Writer
+	closer     io.Closer
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+func NewSession(remoteAddr string) *Session {
+	return &Session{
+		Id:         lastSessionId.Add(1),
+		RemoteAddr: remoteAddr,
+		values:     make(map[string]interface{}),
+		done:       make(chan struct{}),
+	}
+}
+
+func (s *Session) Get(key string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.values[key]
+}
+
+func (s *Session) Set(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+// Push writes a message to the session's connection outside the normal
+// request/response cycle, so handlers can stream data to the client.
+func (s *Session) Push(message []byte) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	if s.writer == nil {
+		return ErrNotConnected
+	}
+	_, err := s.writer.Write(append(message, '\n'))
+	return err
+}
+
+// Connected reports whether the session is attached to a connection that
+// Push can write to.
+func (s *Session) Connected() bool {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	return s.writer != nil
+}
+
+// Done is closed when the session's connection ends.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Disconnect closes the session's connection, ending it as if the client
+// had hung up.
+func (s *Session) Disconnect() {
+	s.mu.Lock()
+	closer := s.closer
+	s.mu.Unlock()
+	if closer != nil {
+		closer.Close()
+	}
+}
+
+func (s *Session) attach(conn io.WriteCloser) {
+	s.writeMu.Lock()
+	s.writer = conn
+	s.writeMu.Unlock()
+	s.mu.Lock()
+	s.closer = conn
+	s.mu.Unlock()
+}
+
+func (s *Session) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
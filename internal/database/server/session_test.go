@@ -0,0 +1,29 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestNewSessionUniqueIds(t *testing.T) {
+	// Act
+	first := NewSession("127.0.0.1:1000")
+	second := NewSession("127.0.0.1:1001")
+
+	// Assert
+	testutil.AssertTrue(t, first.Id != second.Id, "unique ids")
+	testutil.AssertEquals(t, "127.0.0.1:1000", first.RemoteAddr, "remote address")
+}
+
+func TestSessionValues(t *testing.T) {
+	// Arrange
+	session := NewSession("127.0.0.1:1000")
+
+	// Act
+	session.Set("format", "json")
+
+	// Assert
+	testutil.AssertEquals(t, "json", session.Get("format"), "format")
+	testutil.AssertNil(t, session.Get("missing"), "missing")
+}
@@ -0,0 +1,123 @@
+package sharding
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const DefaultVirtualNodes = 128
+
+type Ring struct {
+	mu           sync.RWMutex
+	virtualNodes int
+	nodes        map[string]string
+	hashes       []uint64
+	owners       map[uint64]string
+}
+
+func NewRing(virtualNodes int) *Ring {
+	if virtualNodes <= 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	return &Ring{virtualNodes: virtualNodes, nodes: make(map[string]string), owners: make(map[uint64]string)}
+}
+
+func (r *Ring) Add(node string, address string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nodes[node] = address
+	r.rebuild()
+}
+
+func (r *Ring) Remove(node string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.nodes, node)
+	r.rebuild()
+}
+
+func (r *Ring) Set(nodes map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nodes = make(map[string]string, len(nodes))
+	for node, address := range nodes {
+		r.nodes[node] = address
+	}
+	r.rebuild()
+}
+
+func (r *Ring) Owner(key string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	hash := hashKey(key)
+	index := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= hash })
+	if index == len(r.hashes) {
+		index = 0
+	}
+	return r.owners[r.hashes[index]]
+}
+
+func (r *Ring) Address(node string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.nodes[node]
+}
+
+func (r *Ring) Nodes() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	nodes := make(map[string]string, len(r.nodes))
+	for node, address := range r.nodes {
+		nodes[node] = address
+	}
+	return nodes
+}
+
+func (r *Ring) NodeIds() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]string, 0, len(r.nodes))
+	for node := range r.nodes {
+		ids = append(ids, node)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (r *Ring) rebuild() {
+	r.hashes = r.hashes[:0]
+	r.owners = make(map[uint64]string, len(r.nodes)*r.virtualNodes)
+	for node := range r.nodes {
+		for i := 0; i < r.virtualNodes; i++ {
+			hash := hashKey(node + "#" + strconv.Itoa(i))
+			if owner, found := r.owners[hash]; found && owner < node {
+				continue
+			}
+			if _, found := r.owners[hash]; !found {
+				r.hashes = append(r.hashes, hash)
+			}
+			r.owners[hash] = node
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+func hashKey(key string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	return mix(hash.Sum64())
+}
+
+func mix(hash uint64) uint64 {
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+	return hash
+}
@@ -0,0 +1,92 @@
+package sharding
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestRingEmpty(t *testing.T) {
+	// Arrange
+	ring := NewRing(0)
+
+	// Act
+	owner := ring.Owner("car:1")
+
+	// Assert
+	testutil.AssertEquals(t, "", owner, "owner")
+}
+
+func TestRingIsDeterministic(t *testing.T) {
+	// Arrange
+	first := NewRing(64)
+	second := NewRing(64)
+	first.Set(map[string]string{"s1": "a:1", "s2": "a:2", "s3": "a:3"})
+	second.Add("s3", "a:3")
+	second.Add("s1", "a:1")
+	second.Add("s2", "a:2")
+
+	// Act & Assert
+	for i := 1; i <= 1000; i++ {
+		key := fmt.Sprintf("car:%d", i)
+		testutil.AssertEquals(t, first.Owner(key), second.Owner(key), key)
+	}
+}
+
+func TestRingBalancesKeys(t *testing.T) {
+	// Arrange
+	ring := NewRing(0)
+	ring.Set(map[string]string{"s1": "a:1", "s2": "a:2", "s3": "a:3"})
+
+	// Act
+	counts := make(map[string]int)
+	for i := 1; i <= 30000; i++ {
+		counts[ring.Owner(fmt.Sprintf("car:%d", i))]++
+	}
+
+	// Assert
+	for _, node := range []string{"s1", "s2", "s3"} {
+		testutil.AssertTrue(t, counts[node] > 7000 && counts[node] < 13000, fmt.Sprintf("%s share %d", node, counts[node]))
+	}
+}
+
+func TestRingMovesOnlyKeysOfNewNode(t *testing.T) {
+	// Arrange
+	ring := NewRing(0)
+	ring.Set(map[string]string{"s1": "a:1", "s2": "a:2", "s3": "a:3"})
+	before := make(map[string]string)
+	for i := 1; i <= 10000; i++ {
+		key := fmt.Sprintf("car:%d", i)
+		before[key] = ring.Owner(key)
+	}
+
+	// Act
+	ring.Add("s4", "a:4")
+
+	// Assert
+	moved := 0
+	for key, owner := range before {
+		if current := ring.Owner(key); current != owner {
+			testutil.AssertEquals(t, "s4", current, key+" new owner")
+			moved++
+		}
+	}
+	testutil.AssertTrue(t, moved > 1500 && moved < 3500, fmt.Sprintf("moved %d", moved))
+	testutil.AssertEquals(t, 4, len(ring.NodeIds()), "nodes")
+	testutil.AssertEquals(t, "a:4", ring.Address("s4"), "address")
+}
+
+func TestRingRemove(t *testing.T) {
+	// Arrange
+	ring := NewRing(0)
+	ring.Set(map[string]string{"s1": "a:1", "s2": "a:2"})
+
+	// Act
+	ring.Remove("s2")
+
+	// Assert
+	for i := 1; i <= 100; i++ {
+		testutil.AssertEquals(t, "s1", ring.Owner(fmt.Sprintf("car:%d", i)), "owner")
+	}
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func (d Data) GetPath(path string) (interface{}, bool) {
+	var current interface{} = d
+	for _, segment := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case Data:
+			value, found := node[segment]
+			if !found {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func (d Data) SetPath(path string, value interface{}) error {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("invalid attribute path %s", path)
+		}
+	}
+
+	var parent interface{} = d
+	for i, segment := range segments {
+		if i == len(segments)-1 {
+			return setChild(parent, segment, value, path)
+		}
+		child, found, err := getChild(parent, segment, path)
+		if err != nil {
+			return err
+		}
+		if !found || child == nil {
+			child = Data{}
+			if err := setChild(parent, segment, child, path); err != nil {
+				return err
+			}
+		}
+		if !isContainer(child) {
+			return fmt.Errorf("attribute %s in path %s is not an object", strings.Join(segments[:i+1], "."), path)
+		}
+		parent = child
+	}
+	return nil
+}
+
+func (d Data) DeletePath(path string) bool {
+	parentPath, segment := "", path
+	if index := strings.LastIndex(path, "."); index >= 0 {
+		parentPath, segment = path[:index], path[index+1:]
+	}
+
+	var parent interface{} = d
+	if parentPath != "" {
+		var found bool
+		if parent, found = d.GetPath(parentPath); !found {
+			return false
+		}
+	}
+	switch node := parent.(type) {
+	case Data:
+		if _, found := node[segment]; !found {
+			return false
+		}
+		delete(node, segment)
+		return true
+	case []interface{}:
+		index, err := listIndex(node, segment, path)
+		if err != nil {
+			return false
+		}
+		remaining := append(append([]interface{}{}, node[:index]...), node[index+1:]...)
+		return d.SetPath(parentPath, remaining) == nil
+	default:
+		return false
+	}
+}
+
+func getChild(parent interface{}, segment string, path string) (interface{}, bool, error) {
+	switch node := parent.(type) {
+	case Data:
+		child, found := node[segment]
+		return child, found, nil
+	default:
+		list := node.([]interface{})
+		index, err := listIndex(list, segment, path)
+		if err != nil {
+			return nil, false, err
+		}
+		return list[index], true, nil
+	}
+}
+
+func setChild(parent interface{}, segment string, value interface{}, path string) error {
+	switch node := parent.(type) {
+	case Data:
+		node[segment] = value
+	default:
+		list := node.([]interface{})
+		index, err := listIndex(list, segment, path)
+		if err != nil {
+			return err
+		}
+		list[index] = value
+	}
+	return nil
+}
+
+func listIndex(list []interface{}, segment string, path string) (int, error) {
+	index, err := strconv.Atoi(segment)
+	if err != nil || index < 0 || index >= len(list) {
+		return 0, fmt.Errorf("invalid list index %s in attribute path %s", segment, path)
+	}
+	return index, nil
+}
+
+func isContainer(value interface{}) bool {
+	switch value.(type) {
+	case Data, []interface{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d Data) Keys() []string {
+	keys := make([]string, 0, len(d))
+	for key := range d {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (d Data) Clone() Data {
+	return CloneValue(d).(Data)
+}
+
+func CloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case Data:
+		clone := make(Data, len(v))
+		for key, nested := range v {
+			clone[key] = CloneValue(nested)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(v))
+		for i, nested := range v {
+			clone[i] = CloneValue(nested)
+		}
+		return clone
+	default:
+		return value
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestGetPath(t *testing.T) {
+	// Arrange
+	data := Data{
+		"name":    "John",
+		"address": Data{"city": "SP"},
+		"tags":    []interface{}{"a", Data{"label": "b"}},
+	}
+
+	// Act
+	name, nameFound := data.GetPath("name")
+	city, cityFound := data.GetPath("address.city")
+	label, labelFound := data.GetPath("tags.1.label")
+	_, missingFound := data.GetPath("address.zip")
+	_, outOfRangeFound := data.GetPath("tags.5")
+	_, scalarFound := data.GetPath("name.first")
+
+	// Assert
+	testutil.AssertTrue(t, nameFound, "name found")
+	testutil.AssertEquals(t, "John", name, "name")
+	testutil.AssertTrue(t, cityFound, "city found")
+	testutil.AssertEquals(t, "SP", city, "city")
+	testutil.AssertTrue(t, labelFound, "label found")
+	testutil.AssertEquals(t, "b", label, "label")
+	testutil.AssertFalse(t, missingFound, "missing found")
+	testutil.AssertFalse(t, outOfRangeFound, "out of range found")
+	testutil.AssertFalse(t, scalarFound, "scalar found")
+}
+
+func TestSetPath(t *testing.T) {
+	// Arrange
+	data := Data{
+		"tags": []interface{}{"a", "b"},
+	}
+
+	// Act
+	createErr := data.SetPath("address.city", "SP")
+	listErr := data.SetPath("tags.1", "c")
+
+	// Assert
+	testutil.AssertNil(t, createErr, "create error")
+	testutil.AssertNil(t, listErr, "list error")
+	city, _ := data.GetPath("address.city")
+	tag, _ := data.GetPath("tags.1")
+	testutil.AssertEquals(t, "SP", city, "city")
+	testutil.AssertEquals(t, "c", tag, "tag")
+}
+
+func TestSetPathInvalid(t *testing.T) {
+	// Arrange
+	data := Data{
+		"name": "John",
+		"tags": []interface{}{"a"},
+	}
+
+	// Act & Assert
+	testutil.AssertNotNil(t, data.SetPath("name.first", "J"), "scalar parent")
+	testutil.AssertNotNil(t, data.SetPath("tags.3", "b"), "out of range index")
+	testutil.AssertNotNil(t, data.SetPath("address..city", "SP"), "empty segment")
+}
+
+func TestClone(t *testing.T) {
+	// Arrange
+	data := Data{
+		"address": Data{"city": "SP"},
+		"tags":    []interface{}{"a"},
+	}
+
+	// Act
+	clone := data.Clone()
+	clone.SetPath("address.city", "RJ")
+	clone.SetPath("tags.0", "b")
+
+	// Assert
+	city, _ := data.GetPath("address.city")
+	tag, _ := data.GetPath("tags.0")
+	testutil.AssertEquals(t, "SP", city, "city")
+	testutil.AssertEquals(t, "a", tag, "tag")
+}
+
+func TestDeletePath(t *testing.T) {
+	// Arrange
+	data := Data{
+		"name":    "John",
+		"address": Data{"city": "SP", "zip": 123},
+		"tags":    []interface{}{"a", "b", "c"},
+	}
+
+	// Act
+	nameDeleted := data.DeletePath("name")
+	zipDeleted := data.DeletePath("address.zip")
+	tagDeleted := data.DeletePath("tags.1")
+	missingDeleted := data.DeletePath("address.street")
+	outOfRangeDeleted := data.DeletePath("tags.7")
+
+	// Assert
+	testutil.AssertTrue(t, nameDeleted, "name deleted")
+	testutil.AssertTrue(t, zipDeleted, "zip deleted")
+	testutil.AssertTrue(t, tagDeleted, "tag deleted")
+	testutil.AssertFalse(t, missingDeleted, "missing deleted")
+	testutil.AssertFalse(t, outOfRangeDeleted, "out of range deleted")
+	_, nameFound := data.GetPath("name")
+	city, _ := data.GetPath("address.city")
+	secondTag, _ := data.GetPath("tags.1")
+	testutil.AssertFalse(t, nameFound, "name found")
+	testutil.AssertEquals(t, "SP", city, "city")
+	testutil.AssertEquals(t, 1, len(data["address"].(Data)), "address length")
+	testutil.AssertEquals(t, 2, len(data["tags"].([]interface{})), "tags length")
+	testutil.AssertEquals(t, "c", secondTag, "second tag")
+}
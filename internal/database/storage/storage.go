@@ -1,22 +1,78 @@
 package storage
 
 import (
+	"errors"
 	"sync"
+	"sync/atomic"
 
 	"github.com/google/btree"
 )
 
 type Data map[string]interface{}
 
+// Record is a version of a stored record. Once stored it is never modified:
+// writes store a new version instead, so a record handed out by the storage
+// can be read without locking.
 type Record struct {
-	Mu   sync.Mutex
 	Id   uint
 	Data *Data
 }
 
+// entry holds the current version of a record. writeMu serializes the writes
+// to the record, which store each new version atomically.
+type entry struct {
+	id      uint
+	writeMu sync.Mutex
+	current atomic.Pointer[Record]
+}
+
+type ChangeType string
+
+const (
+	ChangeInsert ChangeType = "insert"
+	ChangeUpdate ChangeType = "update"
+	ChangeDelete ChangeType = "delete"
+)
+
+type Change struct {
+	Type   ChangeType
+	Entity string
+	Id     uint
+	Old    Data
+	New    Data
+}
+
+type ChangeGuard func(change *Change) error
+
+type RejectedError struct {
+	Err error
+}
+
+func (err *RejectedError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *RejectedError) Unwrap() error {
+	return err.Err
+}
+
+// ErrDropped is returned by writes to a storage after Drop.
+var ErrDropped = errors.New("entity was dropped")
+
 type Storage struct {
-	name    string
-	records btree.BTreeG[*Record]
+	mu       sync.RWMutex
+	name     string
+	dropped  bool
+	records  btree.BTreeG[*entry]
+	onChange func(change Change)
+	guard    ChangeGuard
+	scanned  atomic.Uint64
+}
+
+type changeHooks struct {
+	entity  string
+	guard   ChangeGuard
+	handler func(change Change)
 }
 
 func New(name string) *Storage {
@@ -26,60 +82,442 @@ func New(name string) *Storage {
 	}
 }
 
-func lessFunc(a, b *Record) bool {
-	return a.Id < b.Id
+func (s *Storage) Name() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.name
+}
+
+// Drop makes every later write fail with ErrDropped. Writes already running
+// finish first, so none of them is acknowledged once Drop returns.
+func (s *Storage) Drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped = true
+}
+
+func (s *Storage) Rename(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = name
+}
+
+// SetChangeHandler registers a function called after every mutation. It runs
+// while the storage or record lock is held, so it sees changes to a record in
+// the order they were applied and must not call back into the storage.
+func (s *Storage) SetChangeHandler(handler func(change Change)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onChange = handler
+}
+
+// SetChangeGuard registers a function called before every mutation, under the
+// same locks as the change handler. It may rewrite change.New for inserts and
+// updates, or return an error to reject the change, which the mutating method
+// then returns wrapped in a RejectedError.
+func (s *Storage) SetChangeGuard(guard ChangeGuard) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.guard = guard
+}
+
+func (s *Storage) hooksLocked() changeHooks {
+	return changeHooks{entity: s.name, guard: s.guard, handler: s.onChange}
+}
+
+func (hooks changeHooks) check(change *Change, r *Record) error {
+	if hooks.guard == nil {
+		return nil
+	}
+	if err := hooks.guard(change); err != nil {
+		return &RejectedError{err}
+	}
+	if r.Data == nil {
+		r.Data = &change.New
+	} else {
+		*r.Data = change.New
+	}
+	return nil
+}
+
+func (hooks changeHooks) apply(saved *entry, change Change) error {
+	if hooks.guard != nil {
+		if err := hooks.guard(&change); err != nil {
+			return &RejectedError{err}
+		}
+	}
+	saved.current.Store(&Record{Id: saved.id, Data: &change.New})
+	hooks.notify(change)
+	return nil
+}
+
+func (hooks changeHooks) notify(change Change) {
+	if hooks.handler != nil {
+		hooks.handler(change)
+	}
+}
+
+func dataOf(r *Record) Data {
+	if r.Data == nil {
+		return nil
+	}
+	return *r.Data
+}
+
+func newEntry(r *Record) *entry {
+	saved := &entry{id: r.Id}
+	saved.current.Store(r)
+	return saved
+}
+
+func lessFunc(a, b *entry) bool {
+	return a.id < b.id
 }
 
 func (s *Storage) GetRecord(id uint) (*Record, bool) {
-	return s.records.Get(&Record{Id: id})
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	saved, found := s.records.Get(&entry{id: id})
+	if !found {
+		return nil, false
+	}
+	return saved.current.Load(), true
 }
 
 func (s *Storage) IterateOverRecords(iterator func(record *Record) bool) {
-	s.records.Ascend(iterator)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.records.Ascend(s.counting(iterator))
+}
+
+// Scanned returns how many records iterations over the storage have visited
+// since it was created.
+func (s *Storage) Scanned() uint64 {
+	return s.scanned.Load()
+}
+
+func (s *Storage) counting(iterator func(record *Record) bool) func(saved *entry) bool {
+	return func(saved *entry) bool {
+		s.scanned.Add(1)
+		return iterator(saved.current.Load())
+	}
 }
 
 func (s *Storage) GetAllRecords(descend bool) []*Record {
-	records := make([]*Record, 0, s.Len())
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	records := make([]*Record, 0, s.records.Len())
+	collect := func(saved *entry) bool {
+		records = append(records, saved.current.Load())
+		return true
+	}
 	if descend {
-		s.records.Descend(func(record *Record) bool {
-			records = append(records, record)
-			return true
-		})
+		s.records.Descend(collect)
 	} else {
-		s.records.Ascend(func(record *Record) bool {
-			records = append(records, record)
-			return true
-		})
+		s.records.Ascend(collect)
 	}
+	s.scanned.Add(uint64(len(records)))
 	return records
 }
 
-func (s *Storage) InsertRecord(r *Record) bool {
-	_, found := s.GetRecord(r.Id)
-	if found {
-		return false
+func (s *Storage) GetRecordsInRange(lower, upper uint) []*Record {
+	records := make([]*Record, 0)
+	s.IterateOverRange(lower, upper, func(record *Record) bool {
+		records = append(records, record)
+		return true
+	})
+	return records
+}
+
+func (s *Storage) IterateOverRange(lower, upper uint, iterator func(record *Record) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.records.AscendGreaterOrEqual(&entry{id: lower}, func(saved *entry) bool {
+		if upper != 0 && saved.id > upper {
+			return false
+		}
+		s.scanned.Add(1)
+		return iterator(saved.current.Load())
+	})
+}
+
+func (s *Storage) IterateOverRangeDescending(lower, upper uint, iterator func(record *Record) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	descendingIterator := func(saved *entry) bool {
+		if saved.id < lower {
+			return false
+		}
+		s.scanned.Add(1)
+		return iterator(saved.current.Load())
 	}
-	s.records.ReplaceOrInsert(r)
-	return true
+	if upper == 0 {
+		s.records.Descend(descendingIterator)
+	} else {
+		s.records.DescendLessOrEqual(&entry{id: upper}, descendingIterator)
+	}
+}
+
+func (s *Storage) InsertRecord(r *Record) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropped {
+		return false, ErrDropped
+	}
+	if s.records.Has(&entry{id: r.Id}) {
+		return false, nil
+	}
+	hooks := s.hooksLocked()
+	change := Change{Type: ChangeInsert, Entity: hooks.entity, Id: r.Id, New: dataOf(r)}
+	if err := hooks.check(&change, r); err != nil {
+		return false, err
+	}
+	s.records.ReplaceOrInsert(newEntry(r))
+	hooks.notify(change)
+	return true, nil
+}
+
+func (s *Storage) UpdateRecord(r *Record) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	saved, found, err := s.getForWrite(r.Id)
+	if !found {
+		return false, err
+	}
+	hooks := s.hooksLocked()
+	saved.writeMu.Lock()
+	defer saved.writeMu.Unlock()
+	if r.Data == nil {
+		return true, nil
+	}
+	old := dataOf(saved.current.Load())
+	if old == nil {
+		old = Data{}
+	}
+	updated := old.Clone()
+	for path, value := range *r.Data {
+		if err := updated.SetPath(path, value); err != nil {
+			return false, err
+		}
+	}
+	return true, hooks.apply(saved, Change{Type: ChangeUpdate, Entity: hooks.entity, Id: r.Id, Old: old, New: updated})
+}
+
+// InsertRecords inserts every record whose id is not taken yet. The returned
+// errors are nil unless a change guard rejected at least one record, in which
+// case they hold the rejection at the record's index.
+func (s *Storage) InsertRecords(records []*Record) ([]bool, []error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inserted := make([]bool, len(records))
+	if s.dropped {
+		return inserted, droppedErrors(len(records))
+	}
+	hooks := s.hooksLocked()
+	var errs []error
+	for i, r := range records {
+		if s.records.Has(&entry{id: r.Id}) {
+			continue
+		}
+		change := Change{Type: ChangeInsert, Entity: hooks.entity, Id: r.Id, New: dataOf(r)}
+		if err := hooks.check(&change, r); err != nil {
+			errs = setError(errs, len(records), i, err)
+			continue
+		}
+		s.records.ReplaceOrInsert(newEntry(r))
+		inserted[i] = true
+		hooks.notify(change)
+	}
+	return inserted, errs
+}
+
+func (s *Storage) PutRecords(records []*Record) ([]bool, []error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inserted := make([]bool, len(records))
+	if s.dropped {
+		return inserted, droppedErrors(len(records))
+	}
+	hooks := s.hooksLocked()
+	var errs []error
+	for i, r := range records {
+		saved, found := s.records.Get(&entry{id: r.Id})
+		if !found {
+			change := Change{Type: ChangeInsert, Entity: hooks.entity, Id: r.Id, New: dataOf(r)}
+			if err := hooks.check(&change, r); err != nil {
+				errs = setError(errs, len(records), i, err)
+				continue
+			}
+			s.records.ReplaceOrInsert(newEntry(r))
+			inserted[i] = true
+			hooks.notify(change)
+			continue
+		}
+		change := Change{Type: ChangeUpdate, Entity: hooks.entity, Id: r.Id, Old: dataOf(saved.current.Load()), New: dataOf(r)}
+		if err := hooks.check(&change, r); err != nil {
+			errs = setError(errs, len(records), i, err)
+			continue
+		}
+		saved.current.Store(r)
+		hooks.notify(change)
+	}
+	return inserted, errs
+}
+
+func (s *Storage) ModifyRecord(id uint, modify func(data Data) error) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	saved, found, err := s.getForWrite(id)
+	if !found {
+		return false, err
+	}
+	hooks := s.hooksLocked()
+	saved.writeMu.Lock()
+	defer saved.writeMu.Unlock()
+	old := dataOf(saved.current.Load())
+	modified := Data{}
+	if old != nil {
+		modified = old.Clone()
+	}
+	if err := modify(modified); err != nil {
+		return true, err
+	}
+	return true, hooks.apply(saved, Change{Type: ChangeUpdate, Entity: hooks.entity, Id: id, Old: old, New: modified})
+}
+
+func (s *Storage) ReplaceRecord(r *Record) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	saved, found, err := s.getForWrite(r.Id)
+	if !found {
+		return false, err
+	}
+	hooks := s.hooksLocked()
+	saved.writeMu.Lock()
+	defer saved.writeMu.Unlock()
+	replacement := Data{}
+	if r.Data != nil {
+		replacement = r.Data.Clone()
+	}
+	return true, hooks.apply(saved, Change{Type: ChangeUpdate, Entity: hooks.entity, Id: r.Id, Old: dataOf(saved.current.Load()), New: replacement})
 }
 
-func (s *Storage) UpdateRecord(r *Record) bool {
-	savedRecord, found := s.GetRecord(r.Id)
+func (s *Storage) UnsetAttributes(id uint, paths []string) (int, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	saved, found, err := s.getForWrite(id)
 	if !found {
-		return false
+		return 0, false, err
 	}
-	savedRecord.Mu.Lock()
-	defer savedRecord.Mu.Unlock()
-	for k, v := range *r.Data {
-		(*savedRecord.Data)[k] = v
+	hooks := s.hooksLocked()
+	saved.writeMu.Lock()
+	defer saved.writeMu.Unlock()
+	old := dataOf(saved.current.Load())
+	if old == nil {
+		return 0, true, nil
 	}
-	return true
+	updated := old.Clone()
+	removed := 0
+	for _, path := range paths {
+		if updated.DeletePath(path) {
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, true, nil
+	}
+	if err := hooks.apply(saved, Change{Type: ChangeUpdate, Entity: hooks.entity, Id: id, Old: old, New: updated}); err != nil {
+		return 0, true, err
+	}
+	return removed, true, nil
 }
 
-func (s *Storage) DeleteRecord(id uint) (*Record, bool) {
-	return s.records.Delete(&Record{Id: id})
+func (s *Storage) DeleteRecord(id uint) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropped {
+		return nil, false, ErrDropped
+	}
+	saved, found := s.records.Get(&entry{id: id})
+	if !found {
+		return nil, false, nil
+	}
+	hooks := s.hooksLocked()
+	deleted := saved.current.Load()
+	change := Change{Type: ChangeDelete, Entity: hooks.entity, Id: id, Old: dataOf(deleted)}
+	if hooks.guard != nil {
+		if err := hooks.guard(&change); err != nil {
+			return nil, true, &RejectedError{err}
+		}
+	}
+	s.records.Delete(saved)
+	hooks.notify(change)
+	return deleted, true, nil
+}
+
+// AdoptRecord inserts a record handed over by another node without running
+// the change guard or handler. It never overwrites: it returns false when a
+// record with the same id already exists.
+func (s *Storage) AdoptRecord(r *Record) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dropped {
+		return false, ErrDropped
+	}
+	if s.records.Has(&entry{id: r.Id}) {
+		return false, nil
+	}
+	s.records.ReplaceOrInsert(newEntry(r))
+	return true, nil
 }
 
+// EvictRecord removes a record without running the change guard or handler,
+// for records handed over to another node rather than deleted.
+func (s *Storage) EvictRecord(id uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, found := s.records.Delete(&entry{id: id})
+	return found
+}
+
+// getForWrite looks up a record to store a new version of. Callers hold the
+// read lock until the write is done, so Drop waits for it.
+func (s *Storage) getForWrite(id uint) (*entry, bool, error) {
+	if s.dropped {
+		return nil, false, ErrDropped
+	}
+	saved, found := s.records.Get(&entry{id: id})
+	return saved, found, nil
+}
+
+func droppedErrors(size int) []error {
+	errs := make([]error, size)
+	for i := range errs {
+		errs[i] = ErrDropped
+	}
+	return errs
+}
+
+func setError(errs []error, size int, index int, err error) []error {
+	if errs == nil {
+		errs = make([]error, size)
+	}
+	errs[index] = err
+	return errs
+}
 func (s *Storage) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.records.Len()
 }
+
+func (s *Storage) IdBounds() (uint, uint) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	lowest, found := s.records.Min()
+	if !found {
+		return 0, 0
+	}
+	highest, _ := s.records.Max()
+	return lowest.id, highest.id
+}
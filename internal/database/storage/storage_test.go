@@ -1,6 +1,11 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/gabrielluciano/liondb/internal/testutil"
@@ -18,7 +23,7 @@ func TestInsertRecord_ShouldReturnTrue(t *testing.T) {
 	personsStorage := New("persons")
 
 	// Act
-	inserted := personsStorage.InsertRecord(r)
+	inserted, _ := personsStorage.InsertRecord(r)
 
 	// Assert
 	testutil.AssertTrue(t, inserted, "inserted")
@@ -41,7 +46,7 @@ func TestInsertRecord_ShouldReturnFalse(t *testing.T) {
 	personsStorage.InsertRecord(r)
 
 	// Act
-	inserted := personsStorage.InsertRecord(r)
+	inserted, _ := personsStorage.InsertRecord(r)
 
 	// Assert
 	testutil.AssertFalse(t, inserted, "inserted")
@@ -68,9 +73,10 @@ func TestUpdateRecord_ShouldReturnTrue(t *testing.T) {
 	personsStorage.InsertRecord(original)
 
 	// Act
-	replaced := personsStorage.UpdateRecord(replacement)
+	replaced, err := personsStorage.UpdateRecord(replacement)
 
 	// Assert
+	testutil.AssertNil(t, err, "error")
 	testutil.AssertTrue(t, replaced, "replaced")
 
 	updatedRecord, found := personsStorage.GetRecord(original.Id)
@@ -91,12 +97,166 @@ func TestUpdateRecord_ShouldReturnFalse(t *testing.T) {
 	personsStorage := New("persons")
 
 	// Act
-	replaced := personsStorage.UpdateRecord(replacement)
+	replaced, err := personsStorage.UpdateRecord(replacement)
 
 	// Assert
+	testutil.AssertNil(t, err, "error")
 	testutil.AssertFalse(t, replaced, "replaced")
 }
 
+func TestUpdateRecord_NestedPath(t *testing.T) {
+	// Arrange
+	original := &Record{
+		Id: 1,
+		Data: &Data{
+			"name":    "Jonh",
+			"address": Data{"city": "SP", "zip": 123},
+		},
+	}
+	replacement := &Record{
+		Id: 1,
+		Data: &Data{
+			"address.city": "RJ",
+		},
+	}
+	personsStorage := New("persons")
+	personsStorage.InsertRecord(original)
+
+	// Act
+	replaced, err := personsStorage.UpdateRecord(replacement)
+
+	// Assert
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertTrue(t, replaced, "replaced")
+	updated, _ := personsStorage.GetRecord(1)
+	city, _ := updated.Data.GetPath("address.city")
+	zip, _ := updated.Data.GetPath("address.zip")
+	testutil.AssertEquals(t, "RJ", city, "city")
+	testutil.AssertEquals(t, 123, zip, "zip")
+}
+
+func TestUpdateRecord_InvalidPathShouldNotModifyRecord(t *testing.T) {
+	// Arrange
+	original := &Record{
+		Id: 1,
+		Data: &Data{
+			"name": "Jonh",
+		},
+	}
+	replacement := &Record{
+		Id: 1,
+		Data: &Data{
+			"age":        23,
+			"name.first": "Jonh",
+		},
+	}
+	personsStorage := New("persons")
+	personsStorage.InsertRecord(original)
+
+	// Act
+	replaced, err := personsStorage.UpdateRecord(replacement)
+
+	// Assert
+	testutil.AssertNotNil(t, err, "error")
+	testutil.AssertFalse(t, replaced, "replaced")
+	_, found := (*original.Data)["age"]
+	testutil.AssertFalse(t, found, "age found")
+}
+
+func TestInsertRecords(t *testing.T) {
+	// Arrange
+	personsStorage := New("persons")
+	personsStorage.InsertRecord(&Record{Id: 2})
+
+	// Act
+	inserted, _ := personsStorage.InsertRecords([]*Record{{Id: 1}, {Id: 2}, {Id: 3}, {Id: 1}})
+
+	// Assert
+	testutil.AssertTrue(t, inserted[0], "first inserted")
+	testutil.AssertFalse(t, inserted[1], "existing inserted")
+	testutil.AssertTrue(t, inserted[2], "third inserted")
+	testutil.AssertFalse(t, inserted[3], "duplicated inserted")
+	testutil.AssertEquals(t, 3, personsStorage.Len(), "len")
+}
+
+func TestPutRecords(t *testing.T) {
+	// Arrange
+	personsStorage := New("persons")
+	original := &Record{Id: 1, Data: &Data{"name": "Jonh"}}
+	personsStorage.InsertRecord(original)
+
+	// Act
+	inserted, _ := personsStorage.PutRecords([]*Record{{Id: 1, Data: &Data{"name": "John"}}, {Id: 2, Data: &Data{"name": "Mary"}}})
+
+	// Assert
+	testutil.AssertFalse(t, inserted[0], "existing inserted")
+	testutil.AssertTrue(t, inserted[1], "new inserted")
+	replaced, _ := personsStorage.GetRecord(1)
+	testutil.AssertEquals(t, "John", (*replaced.Data)["name"], "replaced name")
+	testutil.AssertEquals(t, "Jonh", (*original.Data)["name"], "original version")
+	testutil.AssertEquals(t, 2, personsStorage.Len(), "len")
+}
+
+func TestModifyRecord(t *testing.T) {
+	// Arrange
+	personsStorage := New("persons")
+	personsStorage.InsertRecord(&Record{Id: 1, Data: &Data{"age": 75}})
+
+	// Act
+	found, err := personsStorage.ModifyRecord(1, func(data Data) error {
+		data["age"] = 76
+		return nil
+	})
+	_, failedErr := personsStorage.ModifyRecord(1, func(data Data) error {
+		data["age"] = 77
+		return fmt.Errorf("failed")
+	})
+	missingFound, _ := personsStorage.ModifyRecord(2, func(data Data) error { return nil })
+
+	// Assert
+	testutil.AssertTrue(t, found, "found")
+	testutil.AssertNil(t, err, "error")
+	testutil.AssertNotNil(t, failedErr, "failed error")
+	testutil.AssertFalse(t, missingFound, "missing found")
+	record, _ := personsStorage.GetRecord(1)
+	testutil.AssertEquals(t, 76, (*record.Data)["age"], "age")
+}
+
+func TestReplaceRecord(t *testing.T) {
+	// Arrange
+	personsStorage := New("persons")
+	personsStorage.InsertRecord(&Record{Id: 1, Data: &Data{"name": "Jonh", "age": 75}})
+
+	// Act
+	replaced, _ := personsStorage.ReplaceRecord(&Record{Id: 1, Data: &Data{"name": "John"}})
+	missingReplaced, _ := personsStorage.ReplaceRecord(&Record{Id: 2, Data: &Data{"name": "Mary"}})
+
+	// Assert
+	testutil.AssertTrue(t, replaced, "replaced")
+	testutil.AssertFalse(t, missingReplaced, "missing replaced")
+	record, _ := personsStorage.GetRecord(1)
+	testutil.AssertEquals(t, 1, len(*record.Data), "attributes")
+	testutil.AssertEquals(t, "John", (*record.Data)["name"], "name")
+}
+
+func TestUnsetAttributes(t *testing.T) {
+	// Arrange
+	personsStorage := New("persons")
+	personsStorage.InsertRecord(&Record{Id: 1, Data: &Data{"name": "Jonh", "age": 75, "address": Data{"city": "SP"}}})
+
+	// Act
+	removed, found, _ := personsStorage.UnsetAttributes(1, []string{"age", "address.city", "email"})
+	_, missingFound, _ := personsStorage.UnsetAttributes(2, []string{"age"})
+
+	// Assert
+	testutil.AssertTrue(t, found, "found")
+	testutil.AssertFalse(t, missingFound, "missing found")
+	testutil.AssertEquals(t, 2, removed, "removed")
+	record, _ := personsStorage.GetRecord(1)
+	testutil.AssertEquals(t, 2, len(*record.Data), "attributes")
+	testutil.AssertEquals(t, 0, len((*record.Data)["address"].(Data)), "address attributes")
+}
+
 func TestGetRecord_ShouldFindRecord(t *testing.T) {
 	// Arrange
 	r := &Record{
@@ -142,7 +302,7 @@ func TestDeleteRecord_ShouldReturnTrue(t *testing.T) {
 	personsStorage.InsertRecord(r)
 
 	// Act
-	deletedRecord, deleted := personsStorage.DeleteRecord(r.Id)
+	deletedRecord, deleted, _ := personsStorage.DeleteRecord(r.Id)
 
 	// Assert
 	testutil.AssertEquals(t, r, deletedRecord, "deletedRecord")
@@ -154,7 +314,7 @@ func TestDeleteRecord_ShouldReturnFalse(t *testing.T) {
 	personsStorage := New("persons")
 
 	// Act
-	_, deleted := personsStorage.DeleteRecord(1)
+	_, deleted, _ := personsStorage.DeleteRecord(1)
 
 	// Assert
 	testutil.AssertFalse(t, deleted, "deleted")
@@ -299,3 +459,304 @@ func TestGetAllRecordsEmptyStorage(t *testing.T) {
 	// Assert
 	testutil.AssertEquals(t, dataStorage.Len(), len(records), "len(records)")
 }
+
+func TestGetRecordsInRange(t *testing.T) {
+	// Arrange
+	dataStorage := New("data")
+	for id := uint(1); id <= 5; id++ {
+		dataStorage.InsertRecord(&Record{Id: id, Data: &Data{}})
+	}
+
+	tests := []struct {
+		lower, upper uint
+		expected     []uint
+	}{
+		{2, 4, []uint{2, 3, 4}},
+		{0, 2, []uint{1, 2}},
+		{4, 0, []uint{4, 5}},
+		{0, 0, []uint{1, 2, 3, 4, 5}},
+		{6, 9, []uint{}},
+	}
+
+	for _, test := range tests {
+		// Act
+		records := dataStorage.GetRecordsInRange(test.lower, test.upper)
+
+		// Assert
+		testutil.AssertEquals(t, len(test.expected), len(records), "len(records)")
+		for i, record := range records {
+			testutil.AssertEquals(t, test.expected[i], record.Id, "id")
+		}
+	}
+}
+
+func TestIterateOverRangeStops(t *testing.T) {
+	// Arrange
+	dataStorage := New("data")
+	for id := uint(1); id <= 5; id++ {
+		dataStorage.InsertRecord(&Record{Id: id, Data: &Data{}})
+	}
+
+	// Act
+	visited := make([]uint, 0)
+	dataStorage.IterateOverRange(2, 0, func(record *Record) bool {
+		visited = append(visited, record.Id)
+		return len(visited) < 2
+	})
+
+	// Assert
+	testutil.AssertEquals(t, 2, len(visited), "len(visited)")
+	testutil.AssertEquals(t, uint(2), visited[0], "visited[0]")
+	testutil.AssertEquals(t, uint(3), visited[1], "visited[1]")
+}
+
+func TestScannedCountsVisitedRecords(t *testing.T) {
+	// Arrange
+	dataStorage := New("data")
+	for id := uint(1); id <= 5; id++ {
+		dataStorage.InsertRecord(&Record{Id: id, Data: &Data{}})
+	}
+
+	// Act
+	dataStorage.IterateOverRange(2, 3, func(record *Record) bool { return true })
+	dataStorage.IterateOverRecords(func(record *Record) bool { return record.Id < 2 })
+	dataStorage.GetAllRecords(true)
+	dataStorage.GetRecord(1)
+
+	// Assert
+	testutil.AssertEquals(t, uint64(9), dataStorage.Scanned(), "scanned")
+}
+
+func TestIterateOverRangeDescending(t *testing.T) {
+	// Arrange
+	dataStorage := New("data")
+	for id := uint(1); id <= 5; id++ {
+		dataStorage.InsertRecord(&Record{Id: id, Data: &Data{}})
+	}
+
+	tests := []struct {
+		lower, upper uint
+		expected     []uint
+	}{
+		{2, 4, []uint{4, 3, 2}},
+		{0, 0, []uint{5, 4, 3, 2, 1}},
+		{4, 0, []uint{5, 4}},
+	}
+
+	for _, test := range tests {
+		// Act
+		visited := make([]uint, 0)
+		dataStorage.IterateOverRangeDescending(test.lower, test.upper, func(record *Record) bool {
+			visited = append(visited, record.Id)
+			return true
+		})
+
+		// Assert
+		testutil.AssertEquals(t, len(test.expected), len(visited), "len(visited)")
+		for i, id := range visited {
+			testutil.AssertEquals(t, test.expected[i], id, "id")
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	// Arrange
+	dataStorage := New("data")
+
+	// Act
+	dataStorage.Rename("renamed")
+
+	// Assert
+	testutil.AssertEquals(t, "renamed", dataStorage.Name(), "name")
+}
+
+func TestIdBounds(t *testing.T) {
+	// Arrange
+	dataStorage := New("data")
+	emptyLower, emptyUpper := dataStorage.IdBounds()
+	dataStorage.InsertRecord(&Record{Id: 7, Data: &Data{}})
+	dataStorage.InsertRecord(&Record{Id: 3, Data: &Data{}})
+
+	// Act
+	lower, upper := dataStorage.IdBounds()
+
+	// Assert
+	testutil.AssertEquals(t, uint(0), emptyLower, "empty lower")
+	testutil.AssertEquals(t, uint(0), emptyUpper, "empty upper")
+	testutil.AssertEquals(t, uint(3), lower, "lower")
+	testutil.AssertEquals(t, uint(7), upper, "upper")
+}
+
+func TestChangeHandler(t *testing.T) {
+	// Arrange
+	dataStorage := New("data")
+	changes := make([]Change, 0)
+	dataStorage.SetChangeHandler(func(change Change) {
+		changes = append(changes, change)
+	})
+
+	// Act
+	dataStorage.InsertRecord(&Record{Id: 1, Data: &Data{"name": "a"}})
+	dataStorage.UpdateRecord(&Record{Id: 1, Data: &Data{"name": "b"}})
+	dataStorage.ModifyRecord(1, func(data Data) error {
+		data["count"] = int64(1)
+		return nil
+	})
+	dataStorage.UnsetAttributes(1, []string{"missing"})
+	dataStorage.Rename("renamed")
+	dataStorage.ReplaceRecord(&Record{Id: 1, Data: &Data{"name": "c"}})
+	dataStorage.PutRecords([]*Record{{Id: 1, Data: &Data{"name": "d"}}, {Id: 2, Data: &Data{}}})
+	dataStorage.DeleteRecord(1)
+	dataStorage.DeleteRecord(9)
+
+	// Assert
+	types := make([]string, len(changes))
+	for i, change := range changes {
+		types[i] = fmt.Sprintf("%s %s:%d", change.Type, change.Entity, change.Id)
+	}
+	testutil.AssertEquals(t, "insert data:1,update data:1,update data:1,update renamed:1,update renamed:1,insert renamed:2,delete renamed:1",
+		strings.Join(types, ","), "changes")
+	testutil.AssertEquals(t, "a", changes[1].Old["name"], "old name")
+	testutil.AssertEquals(t, "b", changes[1].New["name"], "new name")
+	testutil.AssertEquals(t, int64(1), changes[2].New["count"], "modified count")
+	testutil.AssertNil(t, changes[2].Old["count"], "old count")
+	testutil.AssertEquals(t, "d", changes[6].Old["name"], "deleted name")
+	testutil.AssertTrue(t, changes[6].New == nil, "deleted new data")
+}
+
+func TestChangeGuard(t *testing.T) {
+	// Arrange
+	dataStorage := New("data")
+	rejection := fmt.Errorf("locked")
+	dataStorage.SetChangeGuard(func(change *Change) error {
+		if change.Id == 9 || (change.Old != nil && change.Old["locked"] == true) {
+			return rejection
+		}
+		if change.New != nil {
+			change.New["copy"] = change.New["name"]
+		}
+		return nil
+	})
+
+	// Act
+	inserted, insertErr := dataStorage.InsertRecord(&Record{Id: 1, Data: &Data{"name": "a"}})
+	_, rejectedErr := dataStorage.InsertRecord(&Record{Id: 9, Data: &Data{"name": "z"}})
+	dataStorage.UpdateRecord(&Record{Id: 1, Data: &Data{"name": "b"}})
+	batch, batchErrs := dataStorage.InsertRecords([]*Record{{Id: 2, Data: &Data{"locked": true}}, {Id: 9, Data: &Data{}}})
+	_, updateErr := dataStorage.UpdateRecord(&Record{Id: 2, Data: &Data{"name": "c"}})
+	_, found, deleteErr := dataStorage.DeleteRecord(2)
+	record, _ := dataStorage.GetRecord(1)
+	locked, _ := dataStorage.GetRecord(2)
+
+	// Assert
+	testutil.AssertTrue(t, inserted, "inserted")
+	testutil.AssertNil(t, insertErr, "insert error")
+	testutil.AssertEquals(t, rejection, errors.Unwrap(rejectedErr), "rejected insert")
+	testutil.AssertEquals(t, "b", (*record.Data)["copy"], "copied attribute")
+	testutil.AssertTrue(t, batch[0] && !batch[1], "batch inserted")
+	testutil.AssertNil(t, batchErrs[0], "batch error")
+	testutil.AssertEquals(t, rejection, errors.Unwrap(batchErrs[1]), "batch rejection")
+	testutil.AssertEquals(t, "locked", updateErr.Error(), "rejected update")
+	testutil.AssertTrue(t, found, "delete found")
+	testutil.AssertEquals(t, "locked", deleteErr.Error(), "rejected delete")
+	testutil.AssertTrue(t, locked != nil, "locked record kept")
+	testutil.AssertNil(t, (*locked.Data)["name"], "locked name")
+	_, missing := dataStorage.GetRecord(9)
+	testutil.AssertFalse(t, missing, "rejected record")
+}
+
+func TestAdoptRecord(t *testing.T) {
+	// Arrange
+	dataStorage := New("data")
+	dataStorage.InsertRecord(&Record{Id: 1, Data: &Data{"name": "a"}})
+	notified := false
+	dataStorage.SetChangeHandler(func(change Change) {
+		notified = true
+	})
+
+	// Act
+	adopted, adoptErr := dataStorage.AdoptRecord(&Record{Id: 2, Data: &Data{"name": "b"}})
+	existing, existingErr := dataStorage.AdoptRecord(&Record{Id: 1, Data: &Data{"name": "z"}})
+	record, _ := dataStorage.GetRecord(1)
+
+	// Assert
+	testutil.AssertTrue(t, adopted, "adopted")
+	testutil.AssertNil(t, adoptErr, "adopt error")
+	testutil.AssertFalse(t, existing, "existing adopted")
+	testutil.AssertNil(t, existingErr, "existing error")
+	testutil.AssertEquals(t, "a", (*record.Data)["name"], "existing name")
+	testutil.AssertEquals(t, 2, dataStorage.Len(), "records")
+	testutil.AssertFalse(t, notified, "change handler called")
+}
+
+func TestEvictRecord(t *testing.T) {
+	// Arrange
+	dataStorage := New("data")
+	dataStorage.InsertRecord(&Record{Id: 1, Data: &Data{"name": "a"}})
+	notified := false
+	dataStorage.SetChangeHandler(func(change Change) {
+		notified = true
+	})
+	dataStorage.SetChangeGuard(func(change *Change) error {
+		return fmt.Errorf("locked")
+	})
+
+	// Act
+	evicted := dataStorage.EvictRecord(1)
+	evictedAgain := dataStorage.EvictRecord(1)
+
+	// Assert
+	testutil.AssertTrue(t, evicted, "evicted")
+	testutil.AssertFalse(t, evictedAgain, "evicted again")
+	testutil.AssertEquals(t, 0, dataStorage.Len(), "records")
+	testutil.AssertFalse(t, notified, "change handler called")
+}
+
+func TestDrop(t *testing.T) {
+	// Arrange
+	dataStorage := New("car")
+	dataStorage.InsertRecord(&Record{Id: 1, Data: &Data{"name": "bmw"}})
+
+	// Act
+	dataStorage.Drop()
+	_, insertErr := dataStorage.InsertRecord(&Record{Id: 2})
+	_, updateErr := dataStorage.UpdateRecord(&Record{Id: 1, Data: &Data{"name": "audi"}})
+	_, replaceErr := dataStorage.ReplaceRecord(&Record{Id: 1})
+	_, modifyErr := dataStorage.ModifyRecord(1, func(data Data) error { return nil })
+	_, _, unsetErr := dataStorage.UnsetAttributes(1, []string{"name"})
+	_, _, deleteErr := dataStorage.DeleteRecord(1)
+	_, batchErrs := dataStorage.PutRecords([]*Record{{Id: 3}})
+
+	// Assert
+	for _, err := range []error{insertErr, updateErr, replaceErr, modifyErr, unsetErr, deleteErr, batchErrs[0]} {
+		testutil.AssertEquals(t, ErrDropped, err, "write error")
+	}
+	record, _ := dataStorage.GetRecord(1)
+	testutil.AssertEquals(t, "bmw", (*record.Data)["name"], "name")
+}
+
+func TestDropWaitsForRunningWrites(t *testing.T) {
+	// Arrange
+	dataStorage := New("car")
+	var acknowledged atomic.Int64
+	var wg sync.WaitGroup
+	for i := 1; i <= 8; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for id := 0; id < 200; id++ {
+				if inserted, _ := dataStorage.InsertRecord(&Record{Id: uint(worker*1000 + id)}); inserted {
+					acknowledged.Add(1)
+				}
+			}
+		}(i)
+	}
+
+	// Act
+	dataStorage.Drop()
+	afterDrop := dataStorage.Len()
+	wg.Wait()
+
+	// Assert
+	testutil.AssertEquals(t, int64(afterDrop), acknowledged.Load(), "acknowledged writes")
+}
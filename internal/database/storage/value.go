@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"cmp"
+	"strings"
+	"time"
+)
+
+const (
+	rankNull = iota
+	rankBool
+	rankNumber
+	rankString
+	rankTimestamp
+	rankDuration
+	rankList
+	rankObject
+	rankUnknown
+)
+
+func CompareValues(a, b interface{}) int {
+	rankA, rankB := valueRank(a), valueRank(b)
+	if rankA != rankB {
+		return cmp.Compare(rankA, rankB)
+	}
+
+	switch rankA {
+	case rankBool:
+		return compareBools(a.(bool), b.(bool))
+	case rankNumber:
+		return compareNumbers(a, b)
+	case rankString:
+		return strings.Compare(a.(string), b.(string))
+	case rankTimestamp:
+		return a.(time.Time).Compare(b.(time.Time))
+	case rankDuration:
+		return cmp.Compare(a.(time.Duration), b.(time.Duration))
+	case rankList:
+		return compareLists(a.([]interface{}), b.([]interface{}))
+	case rankObject:
+		return compareObjects(a.(Data), b.(Data))
+	default:
+		return 0
+	}
+}
+
+func SameKind(a, b interface{}) bool {
+	return valueRank(a) == valueRank(b)
+}
+
+func EqualValues(a, b interface{}) bool {
+	return CompareValues(a, b) == 0
+}
+
+func valueRank(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return rankNull
+	case bool:
+		return rankBool
+	case int, int64, uint, uint64, float64:
+		return rankNumber
+	case string:
+		return rankString
+	case time.Time:
+		return rankTimestamp
+	case time.Duration:
+		return rankDuration
+	case []interface{}:
+		return rankList
+	case Data:
+		return rankObject
+	default:
+		return rankUnknown
+	}
+}
+
+func compareLists(a, b []interface{}) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if result := CompareValues(a[i], b[i]); result != 0 {
+			return result
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+func compareObjects(a, b Data) int {
+	keysA, keysB := a.Keys(), b.Keys()
+	for i := 0; i < len(keysA) && i < len(keysB); i++ {
+		if result := strings.Compare(keysA[i], keysB[i]); result != 0 {
+			return result
+		}
+		if result := CompareValues(a[keysA[i]], b[keysB[i]]); result != 0 {
+			return result
+		}
+	}
+	return cmp.Compare(len(keysA), len(keysB))
+}
+
+func compareBools(a, b bool) int {
+	if a == b {
+		return 0
+	}
+	if !a {
+		return -1
+	}
+	return 1
+}
+
+func compareNumbers(a, b interface{}) int {
+	signedA, unsignedA, floatA, kindA := splitNumber(a)
+	signedB, unsignedB, floatB, kindB := splitNumber(b)
+
+	switch {
+	case kindA == numberFloat || kindB == numberFloat:
+		return cmp.Compare(toFloat(signedA, unsignedA, floatA, kindA), toFloat(signedB, unsignedB, floatB, kindB))
+	case kindA == numberSigned && kindB == numberSigned:
+		return cmp.Compare(signedA, signedB)
+	case kindA == numberUnsigned && kindB == numberUnsigned:
+		return cmp.Compare(unsignedA, unsignedB)
+	case kindA == numberSigned:
+		if signedA < 0 {
+			return -1
+		}
+		return cmp.Compare(uint64(signedA), unsignedB)
+	default:
+		if signedB < 0 {
+			return 1
+		}
+		return cmp.Compare(unsignedA, uint64(signedB))
+	}
+}
+
+const (
+	numberSigned = iota
+	numberUnsigned
+	numberFloat
+)
+
+func splitNumber(value interface{}) (int64, uint64, float64, int) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), 0, 0, numberSigned
+	case int64:
+		return v, 0, 0, numberSigned
+	case uint:
+		return 0, uint64(v), 0, numberUnsigned
+	case uint64:
+		return 0, v, 0, numberUnsigned
+	default:
+		return 0, 0, value.(float64), numberFloat
+	}
+}
+
+func toFloat(signed int64, unsigned uint64, float float64, kind int) float64 {
+	switch kind {
+	case numberSigned:
+		return float64(signed)
+	case numberUnsigned:
+		return float64(unsigned)
+	default:
+		return float
+	}
+}
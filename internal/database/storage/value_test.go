@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gabrielluciano/liondb/internal/testutil"
+)
+
+func TestCompareValues(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		a, b     interface{}
+		expected int
+	}{
+		{nil, nil, 0},
+		{nil, false, -1},
+		{true, false, 1},
+		{false, int64(0), -1},
+		{int64(1), 1.5, -1},
+		{2, int64(2), 0},
+		{uint64(math.MaxUint64), int64(math.MaxInt64), 1},
+		{int64(-1), uint64(0), -1},
+		{uint64(3), 3.0, 0},
+		{int64(10), "10", -1},
+		{"abc", "abd", -1},
+		{"z", now, -1},
+		{now.Add(time.Second), now, 1},
+		{now, time.Second, -1},
+		{time.Minute, time.Second, 1},
+		{time.Minute, []interface{}{}, -1},
+		{[]interface{}{int64(1), "a"}, []interface{}{int64(1), "b"}, -1},
+		{[]interface{}{int64(1)}, []interface{}{int64(1), "b"}, -1},
+		{[]interface{}{}, Data{}, -1},
+		{Data{"a": int64(1)}, Data{"a": int64(2)}, -1},
+		{Data{"a": int64(1)}, Data{"b": int64(0)}, -1},
+	}
+
+	for _, test := range tests {
+		// Act
+		result := CompareValues(test.a, test.b)
+
+		// Assert
+		testutil.AssertEquals(t, test.expected, result, "compare")
+		testutil.AssertEquals(t, -test.expected, CompareValues(test.b, test.a), "reverse compare")
+	}
+}
+
+func TestEqualValues(t *testing.T) {
+	testutil.AssertTrue(t, EqualValues(int64(5), uint64(5)), "int64 and uint64")
+	testutil.AssertTrue(t, EqualValues(5, 5.0), "int and float64")
+	testutil.AssertFalse(t, EqualValues("5", int64(5)), "string and int64")
+}